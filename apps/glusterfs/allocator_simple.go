@@ -19,22 +19,30 @@ func NewSimpleAllocator() *SimpleAllocator {
 	return s
 }
 
+// loadRingFromDeviceSource returns a ring of the devices of the
+// healthy nodes and a ring of the devices of the degraded nodes.
 func loadRingFromDeviceSource(dsrc DeviceSource) (
-	*SimpleAllocatorRing, error) {
+	ring, degradedRing *SimpleAllocatorRing, err error) {
 
-	ring := NewSimpleAllocatorRing()
+	ring = NewSimpleAllocatorRing()
+	degradedRing = NewSimpleAllocatorRing()
 	dnl, err := dsrc.Devices()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, dan := range dnl {
-		ring.Add(&SimpleDevice{
+		sd := &SimpleDevice{
 			zone:     dan.Node.Info.Zone,
 			nodeId:   dan.Node.Info.Id,
 			deviceId: dan.Device.Info.Id,
-		})
+		}
+		if dan.Degraded {
+			degradedRing.Add(sd)
+		} else {
+			ring.Add(sd)
+		}
 	}
-	return ring, nil
+	return ring, degradedRing, nil
 }
 
 // GetNodesFromDeviceSource is a shim function that should only
@@ -45,12 +53,14 @@ func (s *SimpleAllocator) GetNodesFromDeviceSource(dsrc DeviceSource,
 
 	device, done := make(chan string), make(chan struct{})
 
-	ring, err := loadRingFromDeviceSource(dsrc)
+	ring, degradedRing, err := loadRingFromDeviceSource(dsrc)
 	if err != nil {
 		close(device)
 		return device, done, err
 	}
-	devicelist := ring.GetDeviceList(brickId)
+	// the devices of degraded nodes are the last resort
+	devicelist := append(ring.GetDeviceList(brickId),
+		degradedRing.GetDeviceList(brickId)...)
 
 	generateDevices(devicelist, device, done)
 	return device, done, nil
@@ -14,6 +14,8 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -26,7 +28,11 @@ import (
 	"github.com/heketi/heketi/executors/kubeexec"
 	"github.com/heketi/heketi/executors/mockexec"
 	"github.com/heketi/heketi/executors/sshexec"
+	"github.com/heketi/heketi/pkg/backup"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/logging"
+	"github.com/heketi/heketi/pkg/metrics"
+	"github.com/heketi/heketi/pkg/tracing"
 )
 
 const (
@@ -62,6 +68,14 @@ var (
 	// operations cleanup mechanism.
 	EnableBackgroundCleaner = false
 
+	// global var to enable the periodic background checks of
+	// the db and of the state of gluster.
+	EnableStateChecker = false
+
+	// global var to enable the periodic remount of the bricks
+	// that are not mounted on the nodes.
+	EnableBrickRemount = false
+
 	// global var that contains list of volume options that are set *before*
 	// setting the volume options that come as part of volume request.
 	PreReqVolumeOptions = ""
@@ -83,10 +97,37 @@ type App struct {
 	nhealth *NodeHealthCache
 	// background operations cleaner
 	bgcleaner *backgroundOperationCleaner
+	// background state checker
+	statechecker *backgroundStateChecker
+	// background brick remounter
+	brickremounter *backgroundBrickRemounter
+	// background db backups
+	dbbackup       *backgroundDbBackup
+	dbBackupStatus dbBackupStatus
 
 	// operations tracker
 	optracker *OpTracker
 
+	// exporter of the traced requests, operations and commands
+	tracer tracing.Exporter
+	// sender of the events to the webhooks
+	webhooks *webhookForwarder
+
+	// administrative state of the server, if known
+	adminState AdminStateTracker
+	// serializes restores of the db
+	restoreLock sync.Mutex
+	// held shared by the requests while they run and exclusively
+	// while a restore replaces the db
+	dbGate sync.RWMutex
+	// set while a restore waits for or holds the db gate
+	restoring int32
+
+	// TLS certificate served, if any, checked by the readiness checks
+	tlsCert *tlsCertificate
+	// last write check of the db by the readiness checks
+	dbWriteCheck dbWriteCheck
+
 	// For testing only.  Keep access to the object
 	// not through the interface
 	xo *mockexec.MockExecutor
@@ -116,6 +157,17 @@ func NewApp(conf *GlusterFSConfig) *App {
 		// anything in previous versions
 		logger.Err(err)
 	}
+	if f, err := logging.ParseFormat(app.conf.LogFormat); err != nil {
+		logger.Err(err)
+	} else if app.conf.LogFormat != "" {
+		logging.SetFormat(f)
+	}
+
+	// Setup tracing
+	app.initTracing()
+
+	// Setup webhooks
+	app.initWebhooks()
 
 	// Setup asynchronous manager
 	app.asyncManager = rest.NewAsyncHttpManager(ASYNC_ROUTE)
@@ -177,8 +229,7 @@ func NewApp(conf *GlusterFSConfig) *App {
 
 	// initialize sub-objects and background tasks
 	app.initOpTracker()
-	app.initNodeMonitor()
-	app.initBackgroundCleaner()
+	app.initBackgroundTasks()
 
 	// Show application has loaded
 	logger.Info("GlusterFS Application Loaded")
@@ -200,24 +251,82 @@ func (app *App) initDB() error {
 		}
 		app.dbReadOnly = true
 	} else {
+		// a db without buckets was just created and needs no backup
+		newDb := false
+		app.db.View(func(tx *bolt.Tx) error {
+			newDb = tx.Bucket([]byte(BOLTDB_BUCKET_CLUSTER)) == nil
+			return nil
+		})
+
 		err = app.db.Update(func(tx *bolt.Tx) error {
 			err := initializeBuckets(tx)
 			if err != nil {
 				return logger.LogError("Unable to initialize buckets: %v", err)
 			}
+			return nil
+		})
 
-			// Handle Upgrade Changes
-			err = UpgradeDB(tx)
+		if err == nil {
+			if newDb {
+				err = migrateDB(app.db, latestDbMigration())
+			} else {
+				err = migrateDBWithBackup(app.db, dbfilename, latestDbMigration())
+			}
 			if err != nil {
-				return logger.LogError("Unable to Upgrade DB: %v", err)
+				logger.LogError("Unable to migrate DB: %v", err)
 			}
+		}
 
-			return nil
-		})
+		// a db that could not be brought to the layout of this
+		// version, e.g. one migrated by a newer version, must not
+		// be changed by it
+		if err != nil {
+			logger.Warning("Database is not up to date. Reopening in read only mode")
+			app.db.Close()
+			app.db, err = OpenDB(dbfilename, true)
+			if err != nil {
+				return logger.LogError("Unable to open database: %v", err)
+			}
+			app.dbReadOnly = true
+		}
 	}
 	return nil
 }
 
+// initBackgroundTasks starts the tasks that run in the background
+// of the app, all of which work on the current db.
+func (app *App) initBackgroundTasks() {
+	app.initNodeMonitor()
+	app.initBackgroundCleaner()
+	app.initStateChecker()
+	app.initBrickRemounter()
+	app.initDbBackup()
+}
+
+// stopBackgroundTasks stops the tasks started by initBackgroundTasks.
+func (app *App) stopBackgroundTasks() {
+	if app.nhealth != nil {
+		app.nhealth.Stop()
+		app.nhealth = nil
+	}
+	if app.bgcleaner != nil {
+		app.bgcleaner.Stop()
+		app.bgcleaner = nil
+	}
+	if app.statechecker != nil {
+		app.statechecker.Stop()
+		app.statechecker = nil
+	}
+	if app.brickremounter != nil {
+		app.brickremounter.Stop()
+		app.brickremounter = nil
+	}
+	if app.dbbackup != nil {
+		app.dbbackup.Stop()
+		app.dbbackup = nil
+	}
+}
+
 func (app *App) initNodeMonitor() {
 	//default monitor gluster node refresh time
 	var timer uint32 = 120
@@ -230,6 +339,12 @@ func (app *App) initNodeMonitor() {
 	}
 	if MonitorGlusterNodes {
 		app.nhealth = NewNodeHealthCache(timer, startDelay, app.db, app.executor)
+		if !app.dbReadOnly {
+			// disks are most likely to be renamed when a node reboots
+			app.nhealth.NodeUp = func(nodeId string) {
+				go app.refreshDeviceIdentities(nodeId)
+			}
+		}
 		app.nhealth.Monitor()
 		currentNodeHealthCache = app.nhealth
 	}
@@ -249,12 +364,81 @@ func (app *App) initBackgroundCleaner() {
 	}
 }
 
+func (app *App) initStateChecker() {
+	// configure state checker params
+	if app.conf.StartTimeStateChecker == 0 {
+		app.conf.StartTimeStateChecker = 300
+	}
+	if app.conf.RefreshTimeStateChecker == 0 {
+		app.conf.RefreshTimeStateChecker = 21600
+	}
+	if app.conf.StateCheckerReports <= 0 {
+		app.conf.StateCheckerReports = 10
+	}
+	if EnableStateChecker && !app.dbReadOnly {
+		app.statechecker = app.StateChecker()
+		app.statechecker.Start()
+	}
+}
+
+func (app *App) initBrickRemounter() {
+	// configure brick remounter params
+	if app.conf.StartTimeBrickRemount == 0 {
+		app.conf.StartTimeBrickRemount = 120
+	}
+	if app.conf.RefreshTimeBrickRemount == 0 {
+		app.conf.RefreshTimeBrickRemount = 600
+	}
+	if EnableBrickRemount && !app.dbReadOnly {
+		app.brickremounter = app.BrickRemounter()
+		app.brickremounter.Start()
+	}
+}
+
+func (app *App) initTracing() {
+	e, err := tracing.NewExporter(app.conf.Tracing)
+	if err != nil {
+		logger.LogError("Unable to start tracing: %v", err)
+		return
+	}
+	if e == nil {
+		return
+	}
+	logger.Info("Tracing with the %v exporter", app.conf.Tracing.Exporter)
+	app.tracer = e
+	tracing.SetExporter(e)
+}
+
+func (app *App) initDbBackup() {
+	// configure db backup params, backups are only taken if an
+	// interval and a target are configured
+	if app.conf.DbBackup.StartTime == 0 {
+		app.conf.DbBackup.StartTime = 60
+	}
+	if app.conf.DbBackup.Retention <= 0 {
+		app.conf.DbBackup.Retention = backup.DefaultRetention
+	}
+	if app.conf.DbBackup.Interval == 0 {
+		return
+	}
+	bdb, err := app.DbBackup()
+	if err != nil {
+		logger.LogError("Unable to start db backups: %v", err)
+		return
+	}
+	app.dbbackup = bdb
+	app.dbbackup.Start()
+}
+
 func (app *App) initOpTracker() {
 	oplimit := app.conf.MaxInflightOperations
 	if oplimit == 0 {
 		oplimit = DEFAULT_OP_LIMIT
 	}
 	app.optracker = newOpTracker(oplimit)
+	app.optracker.QueueSize = app.conf.OperationQueueSize
+	app.optracker.ClusterLimit = app.conf.MaxInflightOperationsCluster
+	app.optracker.NodeLimit = app.conf.MaxInflightOperationsNode
 }
 
 func SetLogLevel(level string) error {
@@ -299,6 +483,11 @@ func (a *App) setFromEnvironmentalVariable() {
 		a.conf.Loglevel = env
 	}
 
+	env = os.Getenv("HEKETI_LOG_FORMAT")
+	if env != "" {
+		a.conf.LogFormat = env
+	}
+
 	env = os.Getenv("HEKETI_AUTO_CREATE_BLOCK_HOSTING_VOLUME")
 	if "" != env {
 		a.conf.CreateBlockHostingVolumes, err = strconv.ParseBool(env)
@@ -341,6 +530,16 @@ func (a *App) setFromEnvironmentalVariable() {
 		}
 	}
 
+	env = os.Getenv("HEKETI_OPERATION_QUEUE_SIZE")
+	if env != "" {
+		value, err := strconv.ParseUint(env, 10, 64)
+		if err != nil {
+			logger.LogError("Error: While parsing HEKETI_OPERATION_QUEUE_SIZE: %v", err)
+		} else {
+			a.conf.OperationQueueSize = value
+		}
+	}
+
 	env = os.Getenv("HEKETI_PRE_REQUEST_VOLUME_OPTIONS")
 	if "" != env {
 		a.conf.PreReqVolumeOptions = env
@@ -395,6 +594,26 @@ func (a *App) setAdvSettings() {
 		logger.Info("Zone checking: '%v'", a.conf.ZoneChecking)
 		ZoneChecking = ZoneCheckingStrategy(a.conf.ZoneChecking)
 	}
+	if a.conf.OperationHistoryEntries > 0 {
+		logger.Info("Adv: Operation history entries set to %v", a.conf.OperationHistoryEntries)
+		operationHistoryEntries = a.conf.OperationHistoryEntries
+	}
+	if a.conf.OperationHistoryMaxAge > 0 {
+		logger.Info("Adv: Operation history max age %v seconds", a.conf.OperationHistoryMaxAge)
+		operationHistoryMaxAge = time.Duration(a.conf.OperationHistoryMaxAge) * time.Second
+	}
+	if a.conf.OperationTranscriptEntries > 0 {
+		logger.Info("Adv: Operation transcript entries set to %v", a.conf.OperationTranscriptEntries)
+		operationTranscripts.SetMax(a.conf.OperationTranscriptEntries)
+	}
+	if a.conf.OperationTranscriptBytes > 0 {
+		logger.Info("Adv: Operation transcript bytes set to %v", a.conf.OperationTranscriptBytes)
+		operationTranscripts.SetMaxBytes(a.conf.OperationTranscriptBytes)
+	}
+	if a.conf.EventBufferSize > 0 {
+		logger.Info("Adv: Event buffer size set to %v", a.conf.EventBufferSize)
+		eventLog.SetSize(a.conf.EventBufferSize)
+	}
 }
 
 func (a *App) setBlockSettings() {
@@ -427,7 +646,7 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Name:        "Async",
 			Method:      "GET",
 			Pattern:     ASYNC_ROUTE + "/{id:[A-Fa-f0-9]+}",
-			HandlerFunc: a.asyncManager.HandlerStatus},
+			HandlerFunc: a.AsyncStatus},
 
 		// Cluster
 		rest.Route{
@@ -482,6 +701,21 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/tags",
 			HandlerFunc: a.NodeSetTags},
+		rest.Route{
+			Name:        "NodeDisks",
+			Method:      "GET",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/disks",
+			HandlerFunc: a.NodeDisks},
+		rest.Route{
+			Name:        "NodeDisksAdd",
+			Method:      "POST",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/disks/autoadd",
+			HandlerFunc: a.NodeDisksAdd},
+		rest.Route{
+			Name:        "NodeHealth",
+			Method:      "GET",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/health",
+			HandlerFunc: a.NodeHealth},
 
 		// Devices
 		rest.Route{
@@ -554,6 +788,13 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/clone",
 			HandlerFunc: a.VolumeClone},
 
+		// Volume Import
+		rest.Route{
+			Name:        "VolumeImport",
+			Method:      "POST",
+			Pattern:     "/volumes/import",
+			HandlerFunc: a.VolumeImport},
+
 		// BlockVolumes
 		rest.Route{
 			Name:        "BlockVolumeCreate",
@@ -582,6 +823,11 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/backup/db",
 			HandlerFunc: a.Backup},
+		rest.Route{
+			Name:        "BackupRestore",
+			Method:      "POST",
+			Pattern:     "/backup/restore",
+			HandlerFunc: a.Restore},
 
 		// Db
 		rest.Route{
@@ -594,6 +840,11 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/db/check",
 			HandlerFunc: a.DbCheck},
+		rest.Route{
+			Name:        "DbCheckFix",
+			Method:      "POST",
+			Pattern:     "/db/check/fix",
+			HandlerFunc: a.DbCheckFix},
 
 		// Logging
 		rest.Route{
@@ -624,12 +875,35 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/operations/pending/{id:[A-Fa-f0-9]+}",
 			HandlerFunc: a.PendingOperationDetails},
+		// cancel a running operation
+		rest.Route{
+			Name:        "PendingOperationCancel",
+			Method:      "DELETE",
+			Pattern:     "/operations/pending/{id:[A-Fa-f0-9]+}",
+			HandlerFunc: a.PendingOperationCancel},
 		// request operation clean up
 		rest.Route{
 			Name:        "PendingOperationCleanUp",
 			Method:      "POST",
 			Pattern:     "/operations/pending/cleanup",
 			HandlerFunc: a.PendingOperationCleanUp},
+		rest.Route{
+			Name:        "OperationHistory",
+			Method:      "GET",
+			Pattern:     "/operations/history",
+			HandlerFunc: a.OperationHistory},
+		rest.Route{
+			Name:        "OperationTranscript",
+			Method:      "GET",
+			Pattern:     "/operations/{id:[A-Fa-f0-9]+}/transcript",
+			HandlerFunc: a.OperationTranscript},
+
+		// Events
+		rest.Route{
+			Name:        "Events",
+			Method:      "GET",
+			Pattern:     "/events",
+			HandlerFunc: a.Events},
 
 		// State examination
 		rest.Route{
@@ -637,17 +911,34 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/internal/state/examine/gluster",
 			HandlerFunc: a.ExamineGluster},
+		rest.Route{
+			Name:        "RepairState",
+			Method:      "POST",
+			Pattern:     "/internal/state/repair",
+			HandlerFunc: a.RepairState},
+		rest.Route{
+			Name:        "StateReport",
+			Method:      "GET",
+			Pattern:     "/internal/state/report",
+			HandlerFunc: a.StateReport},
 	}
 
 	// Register all routes from the App
 	for _, route := range routes {
 
+		// requests wait while the db is replaced, except the restore
+		// replacing it and the event requests, which only read the
+		// events in memory and may stay open for a long time
+		if route.Name != "BackupRestore" && route.Name != "Events" {
+			route.HandlerFunc = a.DbGated(route.HandlerFunc)
+		}
+
 		// Add routes from the table
 		router.
 			Methods(route.Method).
 			Path(route.Pattern).
 			Name(route.Name).
-			Handler(route.HandlerFunc)
+			Handler(instrumentRoute(route))
 
 	}
 
@@ -658,16 +949,21 @@ func (a *App) SetRoutes(router *mux.Router) error {
 }
 
 func (a *App) Close() {
-	// stop the health goroutine
-	if a.nhealth != nil {
-		a.nhealth.Stop()
-	}
-	if a.bgcleaner != nil {
-		a.bgcleaner.Stop()
-	}
+	// stop the health goroutine and the other background tasks
+	a.stopBackgroundTasks()
 
 	// Close the DB
 	a.db.Close()
+
+	if a.tracer != nil {
+		tracing.SetExporter(nil)
+		a.tracer.Close()
+		a.tracer = nil
+	}
+	if a.webhooks != nil {
+		a.webhooks.Stop()
+		a.webhooks = nil
+	}
 	logger.Info("Closed")
 }
 
@@ -684,6 +980,44 @@ func (a *App) Backup(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// instrumentRoute wraps the handler of a route to record metrics and
+// traces of its requests and to log them with a request id.
+func instrumentRoute(route rest.Route) http.HandlerFunc {
+	handler := logging.RequestHandler(route.HandlerFunc)
+	handler = tracing.Handler(route.Name, handler)
+	return metrics.InstrumentHandler(route.Name, handler)
+}
+
+// DbGated returns a handler running h while holding off restores of
+// the db, so h never sees the db closed or being replaced. Requests
+// served by h wait while a restore is replacing the db.
+func (a *App) DbGated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.dbGate.RLock()
+		defer a.dbGate.RUnlock()
+		h(w, r)
+	}
+}
+
+// DbGatedOrUnavailable is like DbGated, except that while a restore is
+// replacing the db the requests are answered at once with 503 instead
+// of waiting.
+func (a *App) DbGatedOrUnavailable(h http.HandlerFunc) http.HandlerFunc {
+	gated := a.DbGated(h)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.dbRestoring() {
+			http.Error(w, "db is being restored", http.StatusServiceUnavailable)
+			return
+		}
+		gated(w, r)
+	}
+}
+
+// dbRestoring returns true while a restore is replacing the db.
+func (a *App) dbRestoring() bool {
+	return atomic.LoadInt32(&a.restoring) != 0
+}
+
 func (a *App) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Warning("Invalid path or request %v", r.URL.Path)
 	http.Error(w, "Invalid path or request", http.StatusNotFound)
@@ -759,6 +1093,17 @@ func (a *App) OnDemandExaminer() Examiner {
 	}
 }
 
+// OnDemandRepairer returns a state repairer based on the current
+// app object that can be used to repair state on user demand.
+func (a *App) OnDemandRepairer() StateRepairer {
+	return StateRepairer{
+		db:        a.db,
+		executor:  a.executor,
+		optracker: a.optracker,
+		caller:    internalCaller,
+	}
+}
+
 // BackgroundCleaner returns a background operations cleaner
 // suitable for use as a background "process" in the heketi server.
 func (a *App) BackgroundCleaner() *backgroundOperationCleaner {
@@ -778,6 +1123,86 @@ func (a *App) BackgroundCleaner() *backgroundOperationCleaner {
 	}
 }
 
+// StateChecker returns a background state checker suitable for use
+// as a background "process" in the heketi server.
+func (a *App) StateChecker() *backgroundStateChecker {
+	godbc.Require(a.optracker != nil)
+	startSec := time.Duration(a.conf.StartTimeStateChecker)
+	checkSec := time.Duration(a.conf.RefreshTimeStateChecker)
+	return &backgroundStateChecker{
+		db: a.db,
+		examiner: Examiner{
+			db:        a.db,
+			executor:  a.executor,
+			optracker: a.optracker,
+			mode:      BackgroundExaminer,
+		},
+		keep:          a.conf.StateCheckerReports,
+		StartInterval: startSec * time.Second,
+		CheckInterval: checkSec * time.Second,
+	}
+}
+
+// BrickRemounter returns a background brick remounter suitable for
+// use as a background "process" in the heketi server.
+func (a *App) BrickRemounter() *backgroundBrickRemounter {
+	godbc.Require(a.optracker != nil)
+	startSec := time.Duration(a.conf.StartTimeBrickRemount)
+	checkSec := time.Duration(a.conf.RefreshTimeBrickRemount)
+	return &backgroundBrickRemounter{
+		remounter: &BrickRemounter{
+			db:        a.db,
+			executor:  a.executor,
+			optracker: a.optracker,
+			DryRun:    a.conf.BrickRemountDryRun,
+		},
+		StartInterval: startSec * time.Second,
+		CheckInterval: checkSec * time.Second,
+	}
+}
+
+// DbBackup returns a background db backup suitable for use as a
+// background "process" in the heketi server.
+func (a *App) DbBackup() (*backgroundDbBackup, error) {
+	target, err := backup.NewTarget(a.conf.DbBackup)
+	if err != nil {
+		return nil, err
+	}
+	startSec := time.Duration(a.conf.DbBackup.StartTime)
+	checkSec := time.Duration(a.conf.DbBackup.Interval)
+	return &backgroundDbBackup{
+		db:            a.db,
+		target:        target,
+		keep:          a.conf.DbBackup.Retention,
+		status:        &a.dbBackupStatus,
+		StartInterval: startSec * time.Second,
+		CheckInterval: checkSec * time.Second,
+	}, nil
+}
+
+// LastDbBackup returns the time of the most recent successful db
+// backup taken by this server or the zero time if there is none.
+func (a *App) LastDbBackup() time.Time {
+	return a.dbBackupStatus.Get()
+}
+
+// StateCheckSummary returns the counts of problems found by the
+// most recent state check or nil if no check has been run.
+func (a *App) StateCheckSummary() (*api.StateCheckSummary, error) {
+	var summary *api.StateCheckSummary
+	err := a.db.View(func(tx *bolt.Tx) error {
+		report, err := LatestStateReport(tx)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		summary = report.Summary()
+		return nil
+	})
+	return summary, err
+}
+
 // currentNodeHealthStatus returns a map of node ids to the most
 // recently known health status (true is up, false is not up).
 // If a node is not found in the map its status is unknown.
@@ -791,3 +1216,15 @@ func currentNodeHealthStatus() (nodeUp map[string]bool) {
 	}
 	return
 }
+
+// currentNodeHealthy returns a map of node ids to true if the node
+// was recently found up and not degraded. As for the health status
+// nodes not found in the map have an unknown health.
+func currentNodeHealthy() (healthy map[string]bool) {
+	if currentNodeHealthCache != nil {
+		healthy = currentNodeHealthCache.Healthy()
+	} else {
+		healthy = map[string]bool{}
+	}
+	return
+}
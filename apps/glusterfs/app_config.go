@@ -13,12 +13,29 @@ import (
 	"github.com/heketi/heketi/executors/injectexec"
 	"github.com/heketi/heketi/executors/kubeexec"
 	"github.com/heketi/heketi/executors/sshexec"
+	"github.com/heketi/heketi/pkg/backup"
+	"github.com/heketi/heketi/pkg/tracing"
+	"github.com/heketi/heketi/pkg/webhook"
 )
 
 type RetryLimitConfig struct {
 	VolumeCreate int `json:"volume_create"`
 }
 
+type ReadinessConfig struct {
+	// names of the checks not run by the readiness endpoint
+	ExcludeChecks []string `json:"exclude_checks"`
+	// pending operations in the db above which the server is not
+	// ready, -1 for no limit
+	MaxPendingOperations int `json:"max_pending_operations"`
+	// days before the expiry of the TLS certificate from which the
+	// server is not ready
+	CertExpiryDays int `json:"cert_expiry_days"`
+	// seconds for which the result of the write check of the db is
+	// reused, -1 to not check writes
+	DbWriteCheckInterval int `json:"db_write_check_interval"`
+}
+
 type GlusterFSConfig struct {
 	DBfile       string                  `json:"db"`
 	Executor     string                  `json:"executor"`
@@ -27,6 +44,7 @@ type GlusterFSConfig struct {
 	KubeConfig   kubeexec.KubeConfig     `json:"kubeexec"`
 	InjectConfig injectexec.InjectConfig `json:"injectexec"`
 	Loglevel     string                  `json:"loglevel"`
+	LogFormat    string                  `json:"log_format"`
 
 	// advanced settings
 	BrickMaxSize         int    `json:"brick_max_size_gb"`
@@ -47,11 +65,52 @@ type GlusterFSConfig struct {
 	RefreshTimeMonitorGlusterNodes uint32 `json:"refresh_time_monitor_gluster_nodes"`
 	StartTimeMonitorGlusterNodes   uint32 `json:"start_time_monitor_gluster_nodes"`
 	MaxInflightOperations          uint64 `json:"max_inflight_operations"`
+	OperationQueueSize             uint64 `json:"operation_queue_size"`
+	MaxInflightOperationsCluster   uint64 `json:"max_inflight_operations_per_cluster"`
+	MaxInflightOperationsNode      uint64 `json:"max_inflight_operations_per_node"`
 
 	DisableBackgroundCleaner     bool   `json:"disable_background_cleaner"`
 	RefreshTimeBackgroundCleaner uint32 `json:"refresh_time_background_cleaner"`
 	StartTimeBackgroundCleaner   uint32 `json:"start_time_background_cleaner"`
 
+	DisableStateChecker     bool   `json:"disable_state_checker"`
+	RefreshTimeStateChecker uint32 `json:"refresh_time_state_checker"`
+	StartTimeStateChecker   uint32 `json:"start_time_state_checker"`
+	StateCheckerReports     int    `json:"state_checker_reports"`
+
+	EnableBrickRemount      bool   `json:"enable_brick_remount"`
+	RefreshTimeBrickRemount uint32 `json:"refresh_time_brick_remount"`
+	StartTimeBrickRemount   uint32 `json:"start_time_brick_remount"`
+	BrickRemountDryRun      bool   `json:"brick_remount_dry_run"`
+
+	// retention of the operation history
+	OperationHistoryEntries int    `json:"operation_history_entries"`
+	OperationHistoryMaxAge  uint32 `json:"operation_history_max_age"`
+
+	// number of operations the command transcripts are kept of and
+	// bytes kept for all of the transcripts
+	OperationTranscriptEntries int `json:"operation_transcript_entries"`
+	OperationTranscriptBytes   int `json:"operation_transcript_bytes"`
+
+	// number of events kept for the readers of the event stream
+	EventBufferSize int `json:"event_buffer_size"`
+
+	// number of volumes and block volumes exported by the metrics
+	// endpoint with a series of their own, -1 exports none
+	MetricsVolumeLimit int `json:"metrics_volume_limit"`
+
+	// periodic backups of the db
+	DbBackup backup.Config `json:"db_backup"`
+
+	// tracing of requests, operations and commands
+	Tracing tracing.Config `json:"tracing"`
+
+	// notifications of the events of the server
+	Webhooks webhook.Config `json:"webhooks"`
+
+	// checks of the readiness endpoint
+	Readiness ReadinessConfig `json:"readiness"`
+
 	// operation retry amounts
 	RetryLimits RetryLimitConfig `json:"operation_retry_limits"`
 }
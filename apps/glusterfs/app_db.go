@@ -12,6 +12,9 @@ package glusterfs
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
 )
 
 // DbDump ... Creates a JSON output representing the state of DB
@@ -52,3 +55,36 @@ func (a *App) DbCheck(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 }
+
+// DbCheckFix ... Repairs the inconsistencies of the DB that are safe to fix
+// and returns a JSON summary of the changes. On a dry run the changes are
+// only listed. Fixes are refused while operations are in flight.
+// This is the variant to be called via the API and running in the App
+func (a *App) DbCheckFix(w http.ResponseWriter, r *http.Request) {
+	var msg api.DbFixRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	if !msg.DryRun && a.optracker.Get() > 0 {
+		http.Error(w, ErrOperationsInFlight.Error(), http.StatusConflict)
+		return
+	}
+
+	fixResponse, err := dbFixConsistency(a.db, msg.DryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(fixResponse); err != nil {
+		panic(err)
+	}
+}
@@ -90,64 +90,71 @@ func (a *App) DeviceAdd(w http.ResponseWriter, r *http.Request) {
 			}
 		}()
 
-		// Setup device on node
-		info, err := a.executor.DeviceSetup(node.ManageHostName(),
-			device.Info.Name, device.Info.Id, msg.DestroyData)
+		err := a.setupDevice(node, device, msg.DestroyData)
 		if err != nil {
 			return "", err
 		}
 
-		// Create an entry for the device and set the size
-		device.StorageSet(info.TotalSize, info.FreeSize, info.UsedSize)
-		device.SetExtentSize(info.ExtentSize)
+		logger.Info("Added device %v", msg.Name)
 
-		// Setup garbage collector on error
-		defer func() {
-			if e != nil {
-				a.executor.DeviceTeardown(node.ManageHostName(),
-					device.Info.Name,
-					device.Info.Id)
-			}
-		}()
+		// Done
+		// Returning a null string instructs the async manager
+		// to return http status of 204 (No Content)
+		return "", nil
+	})
 
-		// Save on db
-		err = a.db.Update(func(tx *bolt.Tx) error {
+}
 
-			nodeEntry, err := NewNodeEntryFromId(tx, msg.NodeId)
-			if err != nil {
-				return err
-			}
+// setupDevice initializes the device on the storage node and saves
+// the new device entry to the db. The device must already be registered.
+func (a *App) setupDevice(node *NodeEntry, device *DeviceEntry, destroy bool) (e error) {
+	// Setup device on node
+	info, err := a.executor.DeviceSetup(node.ManageHostName(),
+		device.Info.Name, device.Info.Id, destroy)
+	if err != nil {
+		return err
+	}
 
-			// Add device to node
-			nodeEntry.DeviceAdd(device.Info.Id)
+	// Create an entry for the device and set the size
+	device.StorageSet(info.TotalSize, info.FreeSize, info.UsedSize)
+	device.SetExtentSize(info.ExtentSize)
+	device.SetIdentity(info)
+
+	// Setup garbage collector on error
+	defer func() {
+		if e != nil {
+			a.executor.DeviceTeardown(node.ManageHostName(),
+				device.Info.Name,
+				device.Info.Id)
+		}
+	}()
 
-			// Commit
-			err = nodeEntry.Save(tx)
-			if err != nil {
-				return err
-			}
+	// Save on db
+	return a.db.Update(func(tx *bolt.Tx) error {
 
-			// Save drive
-			err = device.Save(tx)
-			if err != nil {
-				return err
-			}
+		nodeEntry, err := NewNodeEntryFromId(tx, node.Info.Id)
+		if err != nil {
+			return err
+		}
 
-			return nil
+		// Add device to node
+		nodeEntry.DeviceAdd(device.Info.Id)
 
-		})
+		// Commit
+		err = nodeEntry.Save(tx)
 		if err != nil {
-			return "", err
+			return err
 		}
 
-		logger.Info("Added device %v", msg.Name)
+		// Save drive
+		err = device.Save(tx)
+		if err != nil {
+			return err
+		}
 
-		// Done
-		// Returning a null string instructs the async manager
-		// to return http status of 204 (No Content)
-		return "", nil
-	})
+		return nil
 
+	})
 }
 
 func (a *App) DeviceInfo(w http.ResponseWriter, r *http.Request) {
@@ -448,6 +455,12 @@ func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
 
 			device.StorageSet(info.TotalSize, info.FreeSize, info.UsedSize)
 
+			// The disk may have been given a new name by the kernel
+			if _, err := device.updateIdentity(tx, info); err != nil {
+				logger.Err(err)
+				return err
+			}
+
 			// Save updated device
 			err = device.Save(tx)
 			if err != nil {
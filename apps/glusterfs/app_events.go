@@ -0,0 +1,135 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+const (
+	// default and maximum time a long-poll request waits for events
+	eventsDefaultWait = 30 * time.Second
+	eventsMaxWait     = 5 * time.Minute
+	// interval of the comments keeping event streams open
+	eventsKeepAlive = 30 * time.Second
+)
+
+// Events ... Returns the events after the token given in the after
+// query parameter, or the Last-Event-ID header. Requests accepting
+// text/event-stream get the events as server-sent events until they
+// disconnect. Other requests get the events as a list, waiting up to
+// timeout seconds for one if there are none.
+func (a *App) Events(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("after")
+	if token == "" {
+		token = r.Header.Get("Last-Event-ID")
+	}
+	if token != "" {
+		if _, _, err := parseEventToken(token); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		a.streamEvents(w, r, token)
+		return
+	}
+
+	wait := eventsDefaultWait
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 || time.Duration(secs)*time.Second > eventsMaxWait {
+			http.Error(w, fmt.Sprintf("invalid timeout: %v", v),
+				http.StatusBadRequest)
+			return
+		}
+		wait = time.Duration(secs) * time.Second
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	resp := &api.EventsResponse{}
+	for {
+		events, next, lost, published, _ := eventLog.After(token)
+		resp.Events = events
+		resp.Next = next
+		resp.Lost = lost
+		if len(events) > 0 || lost {
+			break
+		}
+		// wait for events after the current one
+		token = next
+		select {
+		case <-published:
+			continue
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+		break
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) streamEvents(w http.ResponseWriter,
+	r *http.Request, token string) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+	for {
+		events, next, lost, published, _ := eventLog.After(token)
+		if lost {
+			fmt.Fprintf(w, "event: %v\ndata: {\"type\":%q}\n\n",
+				api.EventsLost, api.EventsLost)
+		}
+		for _, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n",
+				e.Id, e.Type, data)
+		}
+		flusher.Flush()
+		token = next
+
+		select {
+		case <-published:
+		case <-ticker.C:
+			fmt.Fprintf(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
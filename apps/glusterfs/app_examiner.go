@@ -12,6 +12,12 @@ package glusterfs
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/tracing"
+	"github.com/heketi/heketi/pkg/utils"
 )
 
 // ExamineGluster ... Compares the state of heketi db with the state of Gluster
@@ -33,3 +39,69 @@ func (a *App) ExamineGluster(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 }
+
+// RepairState ... Proposes fixes for the differences between the state of
+// heketi db and the state of Gluster and applies them unless a dry run
+// is requested.
+func (a *App) RepairState(w http.ResponseWriter, r *http.Request) {
+
+	var msg api.StateRepairRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	repairer := a.OnDemandRepairer()
+	repairer.caller = requestCaller(r)
+	repairer.parent = tracing.RequestSpan(r).Context()
+	response, err := repairer.Repair(&msg)
+	if err == ErrOperationsInFlight {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// StateReport ... Returns the most recent report of the background
+// state checker.
+func (a *App) StateReport(w http.ResponseWriter, r *http.Request) {
+
+	var report *StateReportEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		report, err = LatestStateReport(tx)
+		return err
+	})
+	if err == ErrNotFound {
+		http.Error(w, "No state report available", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(report); err != nil {
+		panic(err)
+	}
+}
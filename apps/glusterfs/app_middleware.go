@@ -65,7 +65,9 @@ func (a *App) BackupToKubernetesSecret(
 	}
 
 	// Backup database
+	a.dbGate.RLock()
 	err := kubeBackupDbToSecret(a.db)
+	a.dbGate.RUnlock()
 	if err != nil {
 		logger.Err(err)
 	} else {
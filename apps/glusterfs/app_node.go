@@ -213,6 +213,53 @@ func (a *App) NodeInfo(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// NodeHealth ... Returns the health of the node as seen by the node
+// health monitor. The state is unknown if the node was not checked.
+func (a *App) NodeHealth(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var node *NodeEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		node, err = NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	var (
+		health *api.NodeHealthResponse
+		found  bool
+	)
+	if a.nhealth != nil {
+		health, found = a.nhealth.Health(id)
+	}
+	if !found {
+		health = &api.NodeHealthResponse{
+			NodeId:  id,
+			Host:    node.ManageHostName(),
+			State:   api.NodeHealthUnknown,
+			Checks:  []api.NodeHealthCheck{},
+			History: []api.NodeHealthTransition{},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		panic(err)
+	}
+}
+
 func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 	// Get the id from the URL
 	vars := mux.Vars(r)
@@ -0,0 +1,258 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// nodeDisks returns the raw disks present on the node. Disks that are
+// already in use by a heketi device are annotated with the device id.
+func (a *App) nodeDisks(node *NodeEntry) ([]api.NodeDisk, error) {
+	devices := map[string]string{}
+	err := a.db.View(func(tx *bolt.Tx) error {
+		for _, id := range node.Devices {
+			d, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			devices[d.Info.Name] = d.Info.Id
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := a.executor.ListDisks(node.ManageHostName())
+	if err != nil {
+		return nil, err
+	}
+
+	disks := []api.NodeDisk{}
+	for _, d := range info.Disks {
+		nd := api.NodeDisk{
+			Name:       d.Name,
+			Size:       d.Size,
+			Rotational: d.Rotational,
+			Wwn:        d.Wwn,
+			IdPaths:    d.IdPaths,
+			Signatures: d.Signatures,
+			Mounted:    d.Mounted,
+		}
+		for _, p := range diskPaths(nd) {
+			if id, ok := devices[p]; ok {
+				nd.DeviceId = id
+				break
+			}
+		}
+		disks = append(disks, nd)
+	}
+	return disks, nil
+}
+
+// diskPaths returns all the paths a disk is known by, with the
+// persistent paths first.
+func diskPaths(d api.NodeDisk) []string {
+	return append(append([]string{}, d.IdPaths...), d.Name)
+}
+
+// diskMatch returns the first path of the disk that matches the
+// glob pattern or an empty string if no path matches.
+func diskMatch(d api.NodeDisk, pattern string) string {
+	for _, p := range diskPaths(d) {
+		if m, _ := filepath.Match(pattern, p); m {
+			return p
+		}
+	}
+	return ""
+}
+
+// planDiskAdds determines the devices that should be added to the node
+// given the disks found on the node and the auto-add request.
+// Only disks that are unused, unmounted and free of signatures are
+// considered. The device is named by the path that matched the glob,
+// so a glob on /dev/disk/by-id gives devices stable names.
+func planDiskAdds(nodeId string,
+	disks []api.NodeDisk,
+	req *api.NodeDisksAddRequest) []*api.DeviceAddRequest {
+
+	plan := []*api.DeviceAddRequest{}
+	for _, d := range disks {
+		if !d.Candidate() {
+			continue
+		}
+		name := diskMatch(d, req.PathGlob)
+		if name == "" {
+			continue
+		}
+		dreq := &api.DeviceAddRequest{NodeId: nodeId}
+		dreq.Name = name
+		dreq.Tags = map[string]string{}
+		for _, rule := range req.TagRules {
+			if rule.Match != "" && diskMatch(d, rule.Match) == "" {
+				continue
+			}
+			if rule.Media == api.DiskMediaSSD && d.Rotational {
+				continue
+			}
+			if rule.Media == api.DiskMediaHDD && !d.Rotational {
+				continue
+			}
+			for k, v := range rule.Tags {
+				dreq.Tags[k] = v
+			}
+		}
+		plan = append(plan, dreq)
+	}
+	return plan
+}
+
+func (a *App) NodeDisks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var node *NodeEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		node, err = NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	disks, err := a.nodeDisks(node)
+	if err != nil {
+		logger.LogError("Unable to list disks on node %v: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.NodeDisksResponse{
+		NodeId: node.Info.Id,
+		Disks:  disks,
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) NodeDisksAdd(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.NodeDisksAddRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var node *NodeEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+		node, err = NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// setting up devices is long running and must be throttled
+	throttled, token := a.optracker.ThrottleOrToken()
+	if throttled {
+		OperationHttpErrorf(w, ErrTooManyOperations, "")
+		return
+	}
+
+	logger.Info("Adding disks matching %v to node %v", msg.PathGlob, id)
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+		defer a.optracker.Remove(token)
+
+		disks, err := a.nodeDisks(node)
+		if err != nil {
+			return "", err
+		}
+
+		plan := planDiskAdds(node.Info.Id, disks, &msg)
+		failed := 0
+		for _, dreq := range plan {
+			if err := a.autoAddDevice(node, dreq); err != nil {
+				logger.LogError("Unable to add disk %v to node %v: %v",
+					dreq.Name, id, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return "", fmt.Errorf("Failed to add %v of %v disks to node %v",
+				failed, len(plan), id)
+		}
+		logger.Info("Added %v disks to node %v", len(plan), id)
+		return "/nodes/" + id, nil
+	})
+}
+
+// autoAddDevice registers and sets up a single device chosen by
+// the disk auto-add policy.
+func (a *App) autoAddDevice(node *NodeEntry, req *api.DeviceAddRequest) (e error) {
+	device := NewDeviceEntryFromRequest(req)
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		return device.Register(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if e != nil {
+			a.db.Update(func(tx *bolt.Tx) error {
+				return device.Deregister(tx)
+			})
+		}
+	}()
+
+	logger.Info("Adding device %v to node %v", req.Name, req.NodeId)
+	if err := a.setupDevice(node, device, false); err != nil {
+		return err
+	}
+	logger.Info("Added device %v", req.Name)
+	return nil
+}
@@ -0,0 +1,353 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func sampleNodeDisks(existing string) *executors.DisksInfo {
+	return &executors.DisksInfo{
+		Disks: []executors.DiskInfo{
+			executors.DiskInfo{
+				Name:       existing,
+				Size:       500 * GB,
+				Rotational: true,
+				Signatures: []string{"LVM2_member"},
+			},
+			executors.DiskInfo{
+				Name:       "/dev/sdb",
+				Size:       500 * GB,
+				Rotational: false,
+				Wwn:        "0x5000c500deadbeef",
+				IdPaths:    []string{"/dev/disk/by-id/wwn-0x5000c500deadbeef"},
+			},
+			executors.DiskInfo{
+				Name:       "/dev/sdc",
+				Size:       500 * GB,
+				Rotational: true,
+				IdPaths:    []string{"/dev/disk/by-id/wwn-0x5000c500cafebabe"},
+			},
+			executors.DiskInfo{
+				Name:       "/dev/sdd",
+				Size:       500 * GB,
+				Rotational: true,
+				IdPaths:    []string{"/dev/disk/by-id/wwn-0x5000c500feedface"},
+				Signatures: []string{"xfs"},
+				Mounted:    true,
+			},
+		},
+	}
+}
+
+func TestPlanDiskAdds(t *testing.T) {
+	disks := []api.NodeDisk{
+		api.NodeDisk{Name: "/dev/sda", DeviceId: "abc"},
+		api.NodeDisk{
+			Name:       "/dev/sdb",
+			IdPaths:    []string{"/dev/disk/by-id/wwn-1"},
+			Rotational: false,
+		},
+		api.NodeDisk{
+			Name:       "/dev/sdc",
+			IdPaths:    []string{"/dev/disk/by-id/wwn-2"},
+			Rotational: true,
+		},
+		api.NodeDisk{Name: "/dev/sdd", Signatures: []string{"xfs"}},
+		api.NodeDisk{Name: "/dev/vda"},
+	}
+
+	req := &api.NodeDisksAddRequest{
+		PathGlob: "/dev/sd*",
+		TagRules: []api.DiskTagRule{
+			api.DiskTagRule{Tags: map[string]string{"auto": "yes"}},
+			api.DiskTagRule{
+				Media: api.DiskMediaSSD,
+				Tags:  map[string]string{"media": "ssd"},
+			},
+			api.DiskTagRule{
+				Media: api.DiskMediaHDD,
+				Tags:  map[string]string{"media": "hdd"},
+			},
+			api.DiskTagRule{
+				Match: "/dev/disk/by-id/wwn-2",
+				Tags:  map[string]string{"auto": "no"},
+			},
+		},
+	}
+	plan := planDiskAdds("n1", disks, req)
+	tests.Assert(t, len(plan) == 2, "expected len(plan) == 2, got:", len(plan))
+	tests.Assert(t, plan[0].Name == "/dev/sdb", plan[0].Name)
+	tests.Assert(t, plan[0].NodeId == "n1")
+	tests.Assert(t, plan[0].Tags["media"] == "ssd", plan[0].Tags)
+	tests.Assert(t, plan[0].Tags["auto"] == "yes", plan[0].Tags)
+	tests.Assert(t, plan[1].Name == "/dev/sdc", plan[1].Name)
+	tests.Assert(t, plan[1].Tags["media"] == "hdd", plan[1].Tags)
+	tests.Assert(t, plan[1].Tags["auto"] == "no", plan[1].Tags)
+
+	// a glob on the persistent names names the devices by those paths
+	req = &api.NodeDisksAddRequest{PathGlob: "/dev/disk/by-id/*"}
+	plan = planDiskAdds("n1", disks, req)
+	tests.Assert(t, len(plan) == 2, "expected len(plan) == 2, got:", len(plan))
+	tests.Assert(t, plan[0].Name == "/dev/disk/by-id/wwn-1", plan[0].Name)
+	tests.Assert(t, plan[1].Name == "/dev/disk/by-id/wwn-2", plan[1].Name)
+}
+
+func TestNodeDisks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 1, 1, 500*GB)
+	tests.Assert(t, err == nil)
+
+	var node *NodeEntry
+	var device *DeviceEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, nodes[0])
+		if err != nil {
+			return err
+		}
+		device, err = NewDeviceEntryFromId(tx, node.Devices[0])
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	app.xo.MockListDisks = func(host string) (*executors.DisksInfo, error) {
+		return sampleNodeDisks(device.Info.Name), nil
+	}
+
+	// Unknown node
+	r, err := http.Get(ts.URL + "/nodes/123456789/disks")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	r, err = http.Get(ts.URL + "/nodes/" + node.Info.Id + "/disks")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+
+	var info api.NodeDisksResponse
+	err = utils.GetJsonFromResponse(r, &info)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, info.NodeId == node.Info.Id)
+	tests.Assert(t, len(info.Disks) == 4, "expected 4 disks, got:", len(info.Disks))
+	tests.Assert(t, info.Disks[0].DeviceId == device.Info.Id, info.Disks[0])
+	tests.Assert(t, !info.Disks[0].Candidate())
+	tests.Assert(t, info.Disks[1].DeviceId == "")
+	tests.Assert(t, info.Disks[1].Candidate())
+	tests.Assert(t, !info.Disks[3].Candidate())
+
+	// Executor failure
+	app.xo.MockListDisks = func(host string) (*executors.DisksInfo, error) {
+		return nil, fmt.Errorf("lsblk failed")
+	}
+	r, err = http.Get(ts.URL + "/nodes/" + node.Info.Id + "/disks")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError)
+}
+
+func TestNodeDisksAdd(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 1, 1, 500*GB)
+	tests.Assert(t, err == nil)
+
+	var node *NodeEntry
+	var existing *DeviceEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, nodes[0])
+		if err != nil {
+			return err
+		}
+		existing, err = NewDeviceEntryFromId(tx, node.Devices[0])
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	app.xo.MockListDisks = func(host string) (*executors.DisksInfo, error) {
+		return sampleNodeDisks(existing.Info.Name), nil
+	}
+
+	// Missing glob
+	request := []byte(`{}`)
+	r, err := http.Post(ts.URL+"/nodes/"+node.Info.Id+"/disks/autoadd",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// Unknown node
+	request = []byte(`{"path_glob": "/dev/disk/by-id/*"}`)
+	r, err = http.Post(ts.URL+"/nodes/123456789/disks/autoadd",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	request = []byte(`{
+		"path_glob": "/dev/disk/by-id/*",
+		"tag_rules": [
+			{"media": "ssd", "tags": {"media": "ssd"}},
+			{"media": "hdd", "tags": {"media": "hdd"}}
+		]
+	}`)
+	r, err = http.Post(ts.URL+"/nodes/"+node.Info.Id+"/disks/autoadd",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	// Query queue until finished
+	var info api.NodeInfoResponse
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		if r.ContentLength <= 0 {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		} else {
+			err = utils.GetJsonFromResponse(r, &info)
+			tests.Assert(t, err == nil)
+			break
+		}
+	}
+	tests.Assert(t, info.Id == node.Info.Id)
+	tests.Assert(t, len(info.DevicesInfo) == 3,
+		"expected 3 devices, got:", len(info.DevicesInfo))
+
+	devices := map[string]api.DeviceInfoResponse{}
+	for _, d := range info.DevicesInfo {
+		devices[d.Name] = d
+	}
+	sdb, ok := devices["/dev/disk/by-id/wwn-0x5000c500deadbeef"]
+	tests.Assert(t, ok, devices)
+	tests.Assert(t, sdb.Tags["media"] == "ssd", sdb.Tags)
+	sdc, ok := devices["/dev/disk/by-id/wwn-0x5000c500cafebabe"]
+	tests.Assert(t, ok, devices)
+	tests.Assert(t, sdc.Tags["media"] == "hdd", sdc.Tags)
+	_, ok = devices["/dev/disk/by-id/wwn-0x5000c500feedface"]
+	tests.Assert(t, !ok, "mounted disk must not be added")
+}
+
+func TestNodeDisksAddSetupFails(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 1, 0, 500*GB)
+	tests.Assert(t, err == nil)
+
+	var nodeId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		nodeId = nodes[0]
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	app.xo.MockListDisks = func(host string) (*executors.DisksInfo, error) {
+		return sampleNodeDisks("/dev/sda"), nil
+	}
+	app.xo.MockDeviceSetup = func(host, device, vgid string, destroy bool) (*executors.DeviceInfo, error) {
+		if device == "/dev/sdc" {
+			return nil, fmt.Errorf("pvcreate failed")
+		}
+		return &executors.DeviceInfo{
+			TotalSize:  500 * GB,
+			FreeSize:   500 * GB,
+			ExtentSize: 4096,
+		}, nil
+	}
+
+	request := []byte(`{"path_glob": "/dev/sd*"}`)
+	r, err := http.Post(ts.URL+"/nodes/"+nodeId+"/disks/autoadd",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		if r.Header.Get("X-Pending") == "true" {
+			tests.Assert(t, r.StatusCode == http.StatusOK)
+			time.Sleep(time.Millisecond * 10)
+		} else {
+			tests.Assert(t, r.StatusCode == http.StatusInternalServerError)
+			break
+		}
+	}
+
+	// the disk that failed must not be left behind in the db
+	err = app.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(node.Devices) == 1, node.Devices)
+		device, err := NewDeviceEntryFromId(tx, node.Devices[0])
+		tests.Assert(t, err == nil)
+		tests.Assert(t, device.Info.Name == "/dev/sdb", device.Info.Name)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
@@ -45,6 +45,8 @@ func (a *App) OperationsInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	info.InFlight = a.optracker.Get()
+	info.Queued = a.optracker.Queued()
+	info.Limits = a.optracker.Limits()
 
 	// Write msg
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -127,6 +129,92 @@ func (a *App) PendingOperationDetails(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// PendingOperationCancel ... Requests that a running operation stop.
+// The operation stops at its next safe point and is rolled back, so
+// the request is only accepted here and the result of the operation
+// is reported by the request that started it.
+func (a *App) PendingOperationCancel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pid := vars["id"]
+
+	if runningOperations.Cancel(pid) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	// queued operations have no pending operation entry yet
+	if a.optracker.CancelQueued(pid) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		_, err := NewPendingOperationEntryFromId(tx, pid)
+		return err
+	})
+	if err == ErrNotFound {
+		http.Error(w, fmt.Sprintf("Id not found: %v", pid), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Error(w,
+		fmt.Sprintf("Operation %v is not running or can not be canceled", pid),
+		http.StatusConflict)
+}
+
+// OperationTranscript ... Returns the commands run by a running or
+// recently finished operation, with their output.
+func (a *App) OperationTranscript(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	transcript, ok := operationTranscripts.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Id not found: %v", id), http.StatusNotFound)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(transcript); err != nil {
+		panic(err)
+	}
+}
+
+// OperationHistory ... Lists the completed and failed operations that
+// match the filters given as query parameters, most recent first.
+func (a *App) OperationHistory(w http.ResponseWriter, r *http.Request) {
+	filter, err := api.NewOperationHistoryFilter(r.URL.Query())
+	if err == nil {
+		err = filter.Validate()
+	}
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	history := &api.OperationHistoryResponse{}
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		history.Operations, err = OperationHistory(tx, filter)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		panic(err)
+	}
+}
+
 func (a *App) PendingOperationCleanUp(w http.ResponseWriter, r *http.Request) {
 
 	// Unmarshal JSON
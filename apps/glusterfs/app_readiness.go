@@ -0,0 +1,338 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+const (
+	// pending operations in the db above which the server is not
+	// ready, unless configured
+	DEFAULT_READINESS_MAX_PENDING_OPS = 100
+	// seconds for which the result of the write check of the db is
+	// reused, unless configured
+	DEFAULT_READINESS_DB_WRITE_CHECK_INTERVAL = 60
+)
+
+var (
+	// rolls back the write transaction of the db check
+	errReadinessRollback = errors.New("readiness check rollback")
+)
+
+// tlsCertificate is the certificate served by the server. The
+// certificate is read again when its file is modified, so renewed
+// certificates are seen.
+type tlsCertificate struct {
+	path string
+
+	lock     sync.Mutex
+	modTime  time.Time
+	notAfter time.Time
+	err      error
+}
+
+// SetTLSCertificate sets the certificate file served by the server,
+// whose expiry is part of the readiness checks.
+func (a *App) SetTLSCertificate(certFile string) {
+	a.tlsCert = &tlsCertificate{path: certFile}
+	a.tlsCert.expiry()
+}
+
+// expiry returns the expiry of the certificate, read again if the
+// file was modified since it was last read.
+func (c *tlsCertificate) expiry() (time.Time, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		c.modTime = time.Time{}
+		c.err = err
+	} else if !fi.ModTime().Equal(c.modTime) {
+		c.modTime = fi.ModTime()
+		c.notAfter, c.err = readCertificateExpiry(c.path)
+		if c.err != nil {
+			logger.LogError("Unable to read TLS certificate %v: %v",
+				c.path, c.err)
+		}
+	}
+	return c.notAfter, c.err
+}
+
+// dbWriteCheck is the last result of the write check of the db.
+type dbWriteCheck struct {
+	lock sync.Mutex
+	at   time.Time
+	err  error
+}
+
+// readCertificateExpiry returns the expiry of the first certificate
+// of a PEM file.
+func readCertificateExpiry(certFile string) (time.Time, error) {
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return time.Time{}, fmt.Errorf("no certificate found")
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return cert.NotAfter, nil
+	}
+}
+
+// Liveness reports that the server process is running. It does not
+// check anything the server depends on.
+func (a *App) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, `{"status":"ok"}`)
+}
+
+// Readiness runs the checks of the dependencies of the server and
+// responds with their results. The status code is 503 if a check
+// failed. The checks named by the exclude query parameters, or
+// excluded by the configuration, are not run. While a restore replaces
+// the db the server is not ready and the checks are not run.
+func (a *App) Readiness(w http.ResponseWriter, r *http.Request) {
+	exclude := map[string]bool{}
+	for _, name := range a.conf.Readiness.ExcludeChecks {
+		exclude[name] = true
+	}
+	for _, param := range r.URL.Query()["exclude"] {
+		for _, name := range strings.Split(param, ",") {
+			if _, ok := a.readinessChecks()[name]; !ok {
+				http.Error(w, "unknown check: "+name, http.StatusBadRequest)
+				return
+			}
+			exclude[name] = true
+		}
+	}
+
+	var resp *api.ReadinessResponse
+	if a.dbRestoring() {
+		resp = &api.ReadinessResponse{
+			Status: api.HealthCheckFailed,
+			Checks: []api.ReadinessCheck{{
+				Name:    api.ReadinessCheckDb,
+				Status:  api.HealthCheckFailed,
+				Message: "db is being restored",
+			}},
+		}
+	} else {
+		a.dbGate.RLock()
+		resp = a.checkReadiness(exclude)
+		a.dbGate.RUnlock()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if resp.Status == api.HealthCheckOk {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) readinessChecks() map[string]func() (bool, string) {
+	return map[string]func() (bool, string){
+		api.ReadinessCheckDb:             a.checkReadyDb,
+		api.ReadinessCheckAdminState:     a.checkReadyAdminState,
+		api.ReadinessCheckNodeHealth:     a.checkReadyNodeHealth,
+		api.ReadinessCheckOperations:     a.checkReadyOperations,
+		api.ReadinessCheckTLSCertificate: a.checkReadyTLSCertificate,
+	}
+}
+
+// checkReadiness runs the checks not excluded, in a stable order.
+func (a *App) checkReadiness(exclude map[string]bool) *api.ReadinessResponse {
+	resp := &api.ReadinessResponse{
+		Status: api.HealthCheckOk,
+		Checks: []api.ReadinessCheck{},
+	}
+	checks := a.readinessChecks()
+	for _, name := range []string{
+		api.ReadinessCheckDb,
+		api.ReadinessCheckAdminState,
+		api.ReadinessCheckNodeHealth,
+		api.ReadinessCheckOperations,
+		api.ReadinessCheckTLSCertificate,
+	} {
+		if exclude[name] {
+			continue
+		}
+		ok, msg := checks[name]()
+		c := api.ReadinessCheck{
+			Name:    name,
+			Status:  api.HealthCheckOk,
+			Message: msg,
+		}
+		if !ok {
+			c.Status = api.HealthCheckFailed
+			resp.Status = api.HealthCheckFailed
+			logger.Warning("Readiness check %v failed: %v", name, msg)
+		}
+		resp.Checks = append(resp.Checks, c)
+	}
+	return resp
+}
+
+// checkReadyDb reads the db and, unless the db is read-only, starts a
+// write transaction that is rolled back. The write transaction waits
+// for the other writers, so its result is reused for a while.
+func (a *App) checkReadyDb() (bool, string) {
+	err := a.db.View(func(tx *bolt.Tx) error {
+		_, err := ClusterList(tx)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Sprintf("unable to read the db: %v", err)
+	}
+	if a.dbReadOnly {
+		return true, "db is read-only"
+	}
+	interval := a.conf.Readiness.DbWriteCheckInterval
+	if interval == 0 {
+		interval = DEFAULT_READINESS_DB_WRITE_CHECK_INTERVAL
+	}
+	if interval < 0 {
+		return true, "db writes are not checked"
+	}
+
+	a.dbWriteCheck.lock.Lock()
+	defer a.dbWriteCheck.lock.Unlock()
+	if time.Since(a.dbWriteCheck.at) >= time.Duration(interval)*time.Second {
+		a.dbWriteCheck.err = a.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(BOLTDB_BUCKET_DBATTRIBUTE))
+			if b == nil {
+				return ErrDbAccess
+			}
+			if err := b.Put([]byte("READINESS_CHECK"), []byte("1")); err != nil {
+				return err
+			}
+			return errReadinessRollback
+		})
+		a.dbWriteCheck.at = time.Now()
+	}
+	if a.dbWriteCheck.err != errReadinessRollback {
+		return false, fmt.Sprintf("unable to write to the db: %v",
+			a.dbWriteCheck.err)
+	}
+	return true, ""
+}
+
+// checkReadyAdminState fails when the server only accepts requests of
+// local clients. A read-only server still answers the requests that
+// do not change anything.
+func (a *App) checkReadyAdminState() (bool, string) {
+	if a.adminState == nil {
+		return true, ""
+	}
+	state := a.adminState.Get()
+	msg := fmt.Sprintf("server is %v", state)
+	return state != api.AdminStateLocal, msg
+}
+
+// checkReadyNodeHealth fails when nodes were checked and none of them
+// is up.
+func (a *App) checkReadyNodeHealth() (bool, string) {
+	if a.nhealth == nil {
+		return true, "node health monitor is disabled"
+	}
+	states := a.nhealth.States()
+	total := 0
+	for _, n := range states {
+		total += n
+	}
+	if total == 0 {
+		return true, "no node checked yet"
+	}
+	msg := fmt.Sprintf("%v nodes up, %v degraded, %v down, %v unknown",
+		states[api.NodeHealthUp], states[api.NodeHealthDegraded],
+		states[api.NodeHealthDown], states[api.NodeHealthUnknown])
+	return states[api.NodeHealthUp]+states[api.NodeHealthDegraded] > 0, msg
+}
+
+// checkReadyOperations fails when the operation queue is full or when
+// too many pending operations are left in the db.
+func (a *App) checkReadyOperations() (bool, string) {
+	var pending []string
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		pending, err = PendingOperationList(tx)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Sprintf("unable to list pending operations: %v", err)
+	}
+	inFlight, queued, _ := a.optracker.Counts()
+	msg := fmt.Sprintf("%v pending operations, %v in-flight, %v queued",
+		len(pending), inFlight, queued)
+
+	if a.optracker.QueueSize > 0 && queued >= a.optracker.QueueSize {
+		return false, msg + ": operation queue is full"
+	}
+	max := a.conf.Readiness.MaxPendingOperations
+	if max == 0 {
+		max = DEFAULT_READINESS_MAX_PENDING_OPS
+	}
+	if max > 0 && len(pending) > max {
+		return false, fmt.Sprintf("%v: more than %v pending operations",
+			msg, max)
+	}
+	return true, msg
+}
+
+// checkReadyTLSCertificate fails when the certificate served is
+// expired or expires within the configured number of days.
+func (a *App) checkReadyTLSCertificate() (bool, string) {
+	if a.tlsCert == nil {
+		return true, "TLS is not enabled"
+	}
+	notAfter, err := a.tlsCert.expiry()
+	if err != nil {
+		return false, fmt.Sprintf("unable to read %v: %v",
+			a.tlsCert.path, err)
+	}
+	now := time.Now()
+	expiry := notAfter.Format(time.RFC3339)
+	if !now.Before(notAfter) {
+		return false, "certificate expired on " + expiry
+	}
+	days := a.conf.Readiness.CertExpiryDays
+	if now.AddDate(0, 0, days).After(notAfter) {
+		return false, "certificate expires on " + expiry
+	}
+	return true, "certificate expires on " + expiry
+}
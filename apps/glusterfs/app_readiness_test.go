@@ -0,0 +1,214 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// writeTestCertificate writes a self-signed certificate expiring at
+// the given time to a temporary file.
+func writeTestCertificate(t *testing.T, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "heketi"},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	certFile := tests.Tempfile()
+	err = ioutil.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return certFile
+}
+
+func TestReadinessEndpoints(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	router.Methods("GET").Path("/healthz").HandlerFunc(app.Liveness)
+	router.Methods("GET").Path("/readyz").HandlerFunc(app.Readiness)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	getReadiness := func(query string, status int) map[string]api.ReadinessCheck {
+		r, err := http.Get(ts.URL + "/readyz" + query)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer r.Body.Close()
+		tests.Assert(t, r.StatusCode == status, query, r.StatusCode)
+		var rr api.ReadinessResponse
+		err = json.NewDecoder(r.Body).Decode(&rr)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		checks := map[string]api.ReadinessCheck{}
+		for _, c := range rr.Checks {
+			checks[c.Name] = c
+		}
+		if status == http.StatusOK {
+			tests.Assert(t, rr.Status == api.HealthCheckOk, rr)
+		} else {
+			tests.Assert(t, rr.Status == api.HealthCheckFailed, rr)
+		}
+		return checks
+	}
+
+	r, err := http.Get(ts.URL + "/healthz")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+
+	checks := getReadiness("", http.StatusOK)
+	tests.Assert(t, len(checks) == 5, checks)
+	for _, c := range checks {
+		tests.Assert(t, c.Status == api.HealthCheckOk, c)
+	}
+
+	// only local clients are accepted
+	adminState := &testAdminState{state: api.AdminStateLocal}
+	app.SetAdminState(adminState)
+	checks = getReadiness("", http.StatusServiceUnavailable)
+	tests.Assert(t, checks[api.ReadinessCheckAdminState].Status == api.HealthCheckFailed,
+		checks)
+	tests.Assert(t, checks[api.ReadinessCheckDb].Status == api.HealthCheckOk, checks)
+	checks = getReadiness("?exclude=admin_state", http.StatusOK)
+	tests.Assert(t, len(checks) == 4, checks)
+	_, found := checks[api.ReadinessCheckAdminState]
+	tests.Assert(t, !found, checks)
+	adminState.state = api.AdminStateReadOnly
+	getReadiness("", http.StatusOK)
+
+	// all the checked nodes are down
+	hc := NewNodeHealthCache(1, 0, app.db, app.executor)
+	hc.nodes["a"] = &NodeHealthStatus{NodeId: "a", State: api.NodeHealthDown}
+	hc.nodes["b"] = &NodeHealthStatus{NodeId: "b", State: api.NodeHealthDown}
+	prev := app.nhealth
+	app.nhealth = hc
+	defer func() { app.nhealth = prev }()
+	checks = getReadiness("", http.StatusServiceUnavailable)
+	c := checks[api.ReadinessCheckNodeHealth]
+	tests.Assert(t, c.Status == api.HealthCheckFailed, c)
+	tests.Assert(t, c.Message == "0 nodes up, 0 degraded, 2 down, 0 unknown", c)
+	hc.nodes["b"].State = api.NodeHealthDegraded
+	getReadiness("", http.StatusOK)
+
+	// too many pending operations
+	app.conf.Readiness.MaxPendingOperations = 1
+	for i := 0; i < 2; i++ {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 10
+		vc := NewVolumeCreateOperation(NewVolumeEntryFromRequest(req), app.db)
+		err = vc.Build()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	checks = getReadiness("", http.StatusServiceUnavailable)
+	c = checks[api.ReadinessCheckOperations]
+	tests.Assert(t, c.Status == api.HealthCheckFailed, c)
+	app.conf.Readiness.MaxPendingOperations = -1
+	getReadiness("", http.StatusOK)
+
+	// the certificate expires soon
+	certFile := writeTestCertificate(t, time.Now().AddDate(0, 0, 10))
+	defer os.Remove(certFile)
+	app.SetTLSCertificate(certFile)
+	getReadiness("", http.StatusOK)
+	app.conf.Readiness.CertExpiryDays = 30
+	checks = getReadiness("", http.StatusServiceUnavailable)
+	c = checks[api.ReadinessCheckTLSCertificate]
+	tests.Assert(t, c.Status == api.HealthCheckFailed, c)
+
+	// checks excluded by the configuration
+	app.conf.Readiness.ExcludeChecks = []string{api.ReadinessCheckTLSCertificate}
+	checks = getReadiness("", http.StatusOK)
+	tests.Assert(t, len(checks) == 4, checks)
+
+	expired := writeTestCertificate(t, time.Now().Add(-time.Hour))
+	defer os.Remove(expired)
+	app.SetTLSCertificate(expired)
+	app.conf.Readiness.ExcludeChecks = nil
+	app.conf.Readiness.CertExpiryDays = 0
+	checks = getReadiness("?exclude=db,operations", http.StatusServiceUnavailable)
+	tests.Assert(t, len(checks) == 3, checks)
+	c = checks[api.ReadinessCheckTLSCertificate]
+	tests.Assert(t, c.Status == api.HealthCheckFailed, c)
+
+	r, err = http.Get(ts.URL + "/readyz?exclude=unknown")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+}
+
+func TestReadinessCachedChecks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// the result of the write check is reused
+	ok, msg := app.checkReadyDb()
+	tests.Assert(t, ok, msg)
+	app.dbWriteCheck.err = errors.New("db is locked")
+	ok, msg = app.checkReadyDb()
+	tests.Assert(t, !ok, msg)
+	tests.Assert(t, msg == "unable to write to the db: db is locked", msg)
+	app.dbWriteCheck.at = time.Now().Add(-time.Hour)
+	ok, msg = app.checkReadyDb()
+	tests.Assert(t, ok, msg)
+
+	// writes are not checked
+	app.conf.Readiness.DbWriteCheckInterval = -1
+	app.dbWriteCheck.err = errors.New("db is locked")
+	ok, msg = app.checkReadyDb()
+	tests.Assert(t, ok, msg)
+
+	// the certificate is read again once renewed
+	certFile := writeTestCertificate(t, time.Now().Add(-time.Hour))
+	defer os.Remove(certFile)
+	app.SetTLSCertificate(certFile)
+	ok, msg = app.checkReadyTLSCertificate()
+	tests.Assert(t, !ok, msg)
+	renewed := writeTestCertificate(t, time.Now().AddDate(1, 0, 0))
+	defer os.Remove(renewed)
+	err := os.Rename(renewed, certFile)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	mtime := time.Now().Add(time.Minute)
+	err = os.Chtimes(certFile, mtime, mtime)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ok, msg = app.checkReadyTLSCertificate()
+	tests.Assert(t, ok, msg)
+}
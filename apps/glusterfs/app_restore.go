@@ -0,0 +1,238 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// AdminStateTracker gives access to the administrative state of the
+// server, which decides what requests the server accepts.
+type AdminStateTracker interface {
+	Get() api.AdminState
+	Set(api.AdminState)
+}
+
+// SetAdminState lets the app change the administrative state of the
+// server. The server is switched to read-only while the db is restored.
+func (a *App) SetAdminState(s AdminStateTracker) {
+	a.adminState = s
+}
+
+// DbRestoreResponse ... is the output of a db restore. It lists the path of
+// the copy of the replaced db and the check of the restored db.
+type DbRestoreResponse struct {
+	Backup string          `json:"backup"`
+	Check  DbCheckResponse `json:"check"`
+}
+
+// Restore ... Replaces the db of the running server with the uploaded
+// bolt db file or, if the content type is JSON, db dump. The upload is
+// only used if it passes the db check.
+func (a *App) Restore(w http.ResponseWriter, r *http.Request) {
+	a.restoreLock.Lock()
+	defer a.restoreLock.Unlock()
+
+	if a.dbReadOnly {
+		http.Error(w, "Unable to restore a read-only database", http.StatusConflict)
+		return
+	}
+
+	path, err := receiveRestoreDB(r, filepath.Dir(dbfilename))
+	if path != "" {
+		// nothing is left behind once the file was moved over the db
+		defer os.Remove(path)
+	}
+	if err != nil {
+		http.Error(w, "unable to load uploaded db: "+err.Error(), 422)
+		logger.LogError("unable to load uploaded db: %v", err)
+		return
+	}
+
+	restoreDb, err := OpenDB(path, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	check, err := dbCheckConsistency(restoreDb)
+	restoreDb.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if check.TotalInconsistencies > 0 {
+		http.Error(w, fmt.Sprintf(
+			"uploaded db has %v inconsistencies, see db check for details",
+			check.TotalInconsistencies), 422)
+		return
+	}
+
+	backup, err := a.swapDB(path)
+	if err == ErrOperationsInFlight {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Restored db, previous db saved to %v", backup)
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(DbRestoreResponse{Backup: backup, Check: check}); err != nil {
+		panic(err)
+	}
+}
+
+// receiveRestoreDB writes the uploaded db to a new file in dir and brings
+// it to the current schema. It returns the path of the file, which the
+// caller must remove, even when an error is returned.
+func receiveRestoreDB(r *http.Request, dir string) (string, error) {
+	fp, err := ioutil.TempFile(dir, ".heketi-restore-")
+	if err != nil {
+		return "", err
+	}
+	path := fp.Name()
+
+	var dump *Db
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if strings.HasSuffix(mediatype, "json") {
+		dump = &Db{}
+		err = json.NewDecoder(r.Body).Decode(dump)
+	} else {
+		_, err = io.Copy(fp, r.Body)
+	}
+	fp.Close()
+	if err != nil {
+		return path, err
+	}
+
+	db, err := OpenDB(path, false)
+	if err != nil {
+		return path, err
+	}
+	defer db.Close()
+
+	if dump != nil {
+		if err := dbLoadDump(db, *dump); err != nil {
+			return path, err
+		}
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return initializeBuckets(tx)
+	})
+	if err != nil {
+		return path, err
+	}
+	return path, migrateDB(db, latestDbMigration())
+}
+
+// swapDB replaces the db of the app with the db file at path. The
+// requests using the db are waited for and new ones wait until the db
+// is replaced. The background tasks are restarted on the new db. It
+// returns the path of the copy of the replaced db.
+func (a *App) swapDB(path string) (string, error) {
+	if a.adminState != nil {
+		prev := a.adminState.Get()
+		a.adminState.Set(api.AdminStateReadOnly)
+		defer func() {
+			// the server stays read-only if it has no usable db
+			if !a.dbReadOnly {
+				a.adminState.Set(prev)
+			}
+		}()
+	}
+
+	// requests not willing to wait for the db are answered at once
+	atomic.StoreInt32(&a.restoring, 1)
+	defer atomic.StoreInt32(&a.restoring, 0)
+	a.dbGate.Lock()
+	defer a.dbGate.Unlock()
+	// operations run beyond their requests, so none may be in-flight
+	// and none may start until the db is replaced
+	if !a.optracker.Pause() {
+		return "", ErrOperationsInFlight
+	}
+	defer a.optracker.Resume()
+
+	backup, err := backupDBFile(a.db, dbfilename, "restore")
+	if err != nil {
+		return "", err
+	}
+
+	a.stopBackgroundTasks()
+	a.db.Close()
+	old := a.db
+	renameErr := os.Rename(path, dbfilename)
+	if renameErr != nil {
+		logger.LogError("Unable to replace db: %v", renameErr)
+	}
+
+	// reopen the db, which is the old one if the rename failed
+	err = a.initDB()
+	if err != nil && renameErr == nil {
+		logger.LogError("Unable to open restored db: %v", err)
+		err = a.reopenDB(backup)
+		renameErr = fmt.Errorf("unable to open restored db, "+
+			"previous db reopened from %v", backup)
+	}
+	if err != nil {
+		// keep the closed db so requests fail instead of crashing
+		a.db = old
+		a.dbReadOnly = true
+		return "", fmt.Errorf("unable to reopen db, "+
+			"server is read-only until restarted: %v", err)
+	}
+	if renameErr == nil {
+		// operations of the restored db are not running on this server
+		if err := a.ServerReset(); err != nil {
+			logger.LogError("Unable to reset operations: %v", err)
+		}
+	}
+	a.initBackgroundTasks()
+
+	if renameErr != nil {
+		return "", renameErr
+	}
+	return backup, nil
+}
+
+// reopenDB copies the db file at path over the db of the app and opens
+// it.
+func (a *App) reopenDB(path string) error {
+	saved, err := OpenDB(path, true)
+	if err != nil {
+		return err
+	}
+	err = saved.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(dbfilename, 0600)
+	})
+	saved.Close()
+	if err != nil {
+		return err
+	}
+	return a.initDB()
+}
@@ -0,0 +1,359 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/idgen"
+)
+
+// testAdminState records the admin states set by the app.
+type testAdminState struct {
+	state api.AdminState
+	seen  []api.AdminState
+}
+
+func (s *testAdminState) Get() api.AdminState {
+	return s.state
+}
+
+func (s *testAdminState) Set(state api.AdminState) {
+	s.state = state
+	s.seen = append(s.seen, state)
+}
+
+func setupRestoreTest(t *testing.T, tmpfile string) (*App, *httptest.Server) {
+	app := NewTestApp(tmpfile)
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return app, ts
+}
+
+func countClusters(t *testing.T, app *App) int {
+	var clusters []string
+	err := app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return len(clusters)
+}
+
+func postRestore(t *testing.T, ts *httptest.Server,
+	contentType string, body []byte) (*http.Response, DbRestoreResponse) {
+
+	var restore DbRestoreResponse
+	r, err := http.Post(ts.URL+"/backup/restore", contentType,
+		bytes.NewReader(body))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusOK {
+		err = json.NewDecoder(r.Body).Decode(&restore)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	return r, restore
+}
+
+func TestRestoreBoltFile(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := setupRestoreTest(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+	adminState := &testAdminState{state: api.AdminStateNormal}
+	app.SetAdminState(adminState)
+
+	r, err := http.Get(ts.URL + "/backup/db")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	saved, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, countClusters(t, app) == 2)
+
+	r, restore := postRestore(t, ts, "application/octet-stream", saved)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	defer os.Remove(restore.Backup)
+	tests.Assert(t, restore.Check.TotalInconsistencies == 0, restore.Check)
+	tests.Assert(t, countClusters(t, app) == 1)
+
+	// the server was read-only during the swap and is normal again
+	tests.Assert(t, len(adminState.seen) == 2, adminState.seen)
+	tests.Assert(t, adminState.seen[0] == api.AdminStateReadOnly)
+	tests.Assert(t, adminState.state == api.AdminStateNormal)
+
+	// the replaced db was kept
+	old, err := OpenDB(restore.Backup, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer old.Close()
+	err = old.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, len(clusters) == 2, clusters)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the app keeps working on the restored db
+	err = setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, countClusters(t, app) == 2)
+}
+
+func TestRestoreJsonDump(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := setupRestoreTest(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	dump, err := dbDumpInternal(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	saved, err := json.Marshal(dump)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = setupSampleDbWithTopology(app, 2, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, countClusters(t, app) == 3)
+
+	r, restore := postRestore(t, ts, "application/json", saved)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	defer os.Remove(restore.Backup)
+	tests.Assert(t, countClusters(t, app) == 1)
+
+	restored, err := dbDumpInternal(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for id := range dump.Nodes {
+		_, found := restored.Nodes[id]
+		tests.Assert(t, found, "node not restored", id)
+	}
+}
+
+func TestRestoreRejected(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := setupRestoreTest(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	t.Run("garbage", func(t *testing.T) {
+		r, _ := postRestore(t, ts, "application/octet-stream",
+			[]byte("this is not a db"))
+		tests.Assert(t, r.StatusCode == 422, r.StatusCode)
+		r, _ = postRestore(t, ts, "application/json", []byte("{"))
+		tests.Assert(t, r.StatusCode == 422, r.StatusCode)
+		tests.Assert(t, countClusters(t, app) == 1)
+	})
+	t.Run("inconsistent", func(t *testing.T) {
+		dump, err := dbDumpInternal(app.db)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		for id, c := range dump.Clusters {
+			c.NodeAdd(idgen.GenUUID())
+			dump.Clusters[id] = c
+		}
+		saved, err := json.Marshal(dump)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		err = setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r, _ := postRestore(t, ts, "application/json", saved)
+		tests.Assert(t, r.StatusCode == 422, r.StatusCode)
+		tests.Assert(t, countClusters(t, app) == 2)
+	})
+	t.Run("operationsInFlight", func(t *testing.T) {
+		dump, err := dbDumpInternal(app.db)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		saved, err := json.Marshal(dump)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		app.optracker.Add("abc", TrackNormal)
+		defer app.optracker.Remove("abc")
+		r, _ := postRestore(t, ts, "application/json", saved)
+		tests.Assert(t, r.StatusCode == http.StatusConflict, r.StatusCode)
+	})
+}
+
+func TestRestoreUnusableDb(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := setupRestoreTest(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+	adminState := &testAdminState{state: api.AdminStateNormal}
+	app.SetAdminState(adminState)
+
+	// the restored db can not be opened, the previous db is used again
+	path := tests.Tempfile()
+	defer os.Remove(path)
+	err := ioutil.WriteFile(path, []byte("this is not a db"), 0600)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = app.swapDB(path)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "previous db"), err)
+	tests.Assert(t, adminState.state == api.AdminStateNormal, adminState.state)
+	tests.Assert(t, !app.dbReadOnly)
+	tests.Assert(t, countClusters(t, app) == 1)
+	err = setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, countClusters(t, app) == 2)
+}
+
+func TestRestoreWaitsForRequests(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := setupRestoreTest(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	// requests wait while the db is replaced
+	app.dbGate.Lock()
+	done := make(chan int)
+	go func() {
+		r, err := http.Get(ts.URL + "/clusters")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		done <- r.StatusCode
+	}()
+	select {
+	case <-done:
+		t.Fatalf("request did not wait for the db")
+	case <-time.After(100 * time.Millisecond):
+	}
+	app.dbGate.Unlock()
+	tests.Assert(t, <-done == http.StatusOK)
+
+	// a restore waits for the requests using the db
+	dump, err := dbDumpInternal(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	saved, err := json.Marshal(dump)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.dbGate.RLock()
+	restored := make(chan DbRestoreResponse)
+	go func() {
+		r, restore := postRestore(t, ts, "application/json", saved)
+		tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+		restored <- restore
+	}()
+	select {
+	case <-restored:
+		t.Fatalf("restore did not wait for the request")
+	case <-time.After(100 * time.Millisecond):
+	}
+	app.dbGate.RUnlock()
+	restore := <-restored
+	defer os.Remove(restore.Backup)
+	tests.Assert(t, countClusters(t, app) == 1)
+}
+
+func TestRestoreWithOpenEventStream(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := setupRestoreTest(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL+"/events", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Header.Set("Accept", "text/event-stream")
+	stream, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer stream.Body.Close()
+	tests.Assert(t, stream.StatusCode == http.StatusOK, stream.StatusCode)
+
+	// the open stream does not hold up the restore
+	dump, err := dbDumpInternal(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	saved, err := json.Marshal(dump)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	restored := make(chan DbRestoreResponse)
+	go func() {
+		r, restore := postRestore(t, ts, "application/json", saved)
+		tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+		restored <- restore
+	}()
+	select {
+	case restore := <-restored:
+		defer os.Remove(restore.Backup)
+	case <-time.After(10 * time.Second):
+		t.Fatalf("restore waited for the event stream")
+	}
+
+	r, err := http.Get(ts.URL + "/clusters")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+}
+
+func TestRestoreProbesUnavailable(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := setupRestoreTest(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	metrics := app.DbGatedOrUnavailable(func(w http.ResponseWriter,
+		r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// probes and scrapes are answered at once while the db is replaced
+	atomic.StoreInt32(&app.restoring, 1)
+	app.dbGate.Lock()
+	w := httptest.NewRecorder()
+	app.Readiness(w, httptest.NewRequest("GET", "/readyz", nil))
+	tests.Assert(t, w.Code == http.StatusServiceUnavailable, w.Code)
+	var ready api.ReadinessResponse
+	err := json.NewDecoder(w.Body).Decode(&ready)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, ready.Status == api.HealthCheckFailed, ready.Status)
+	tests.Assert(t, ready.Checks[0].Name == api.ReadinessCheckDb)
+	w = httptest.NewRecorder()
+	metrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	tests.Assert(t, w.Code == http.StatusServiceUnavailable, w.Code)
+	app.dbGate.Unlock()
+	atomic.StoreInt32(&app.restoring, 0)
+
+	w = httptest.NewRecorder()
+	metrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	tests.Assert(t, w.Code == http.StatusOK, w.Code)
+}
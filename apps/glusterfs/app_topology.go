@@ -71,6 +71,13 @@ func (a *App) TopologyInfo() (*api.TopologyInfoResponse, error) {
 	return topo, err
 }
 
+// VolumeMetricsLimit returns the number of volumes and block volumes
+// exported by the metrics endpoint with a series of their own. Zero
+// leaves the default to the metrics endpoint.
+func (a *App) VolumeMetricsLimit() int {
+	return a.conf.MetricsVolumeLimit
+}
+
 func clusterInfo(tx *bolt.Tx, id string) (*api.ClusterInfoResponse, error) {
 	var info *api.ClusterInfoResponse
 	entry, err := NewClusterEntryFromId(tx, id)
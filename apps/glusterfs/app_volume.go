@@ -381,6 +381,59 @@ func (a *App) VolumeClone(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *App) VolumeImport(w http.ResponseWriter, r *http.Request) {
+	var msg api.VolumeImportRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", http.StatusUnprocessableEntity)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(),
+			http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	err = a.db.View(func(tx *bolt.Tx) error {
+		if msg.Cluster == "" {
+			clusters, err := ClusterList(tx)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return err
+			}
+			if len(clusters) != 1 {
+				err := fmt.Errorf("A cluster must be specified when "+
+					"heketi manages %v clusters", len(clusters))
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return err
+			}
+			msg.Cluster = clusters[0]
+			return nil
+		}
+		_, err := NewClusterEntryFromId(tx, msg.Cluster)
+		if err == ErrNotFound {
+			http.Error(w, "Cluster id does not exist", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	op := NewVolumeImportOperation(a.db, msg.Name, msg.Cluster)
+	if err := AsyncHttpOperation(a, w, r, op); err != nil {
+		OperationHttpErrorf(w, err,
+			"Failed to import volume %v: %v", msg.Name, err)
+		return
+	}
+}
+
 func (a *App) VolumeSetBlockRestriction(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
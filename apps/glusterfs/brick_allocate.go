@@ -298,6 +298,7 @@ func (cds *ClusterDeviceSource) Devices() ([]DeviceAndNode, error) {
 	}
 
 	nodeUp := currentNodeHealthStatus()
+	nodeHealthy := currentNodeHealthy()
 
 	valid := [](DeviceAndNode){}
 	for _, nodeId := range cluster.Info.Nodes {
@@ -310,9 +311,11 @@ func (cds *ClusterDeviceSource) Devices() ([]DeviceAndNode, error) {
 		}
 		if up, found := nodeUp[nodeId]; found && !up {
 			// if the node is in the cache and we know it was not
-			// recently healthy, skip it
+			// recently up, skip it
 			continue
 		}
+		healthy, found := nodeHealthy[nodeId]
+		degraded := found && !healthy
 
 		for _, deviceId := range node.Devices {
 			device, err := NewDeviceEntryFromId(cds.tx, deviceId)
@@ -324,8 +327,9 @@ func (cds *ClusterDeviceSource) Devices() ([]DeviceAndNode, error) {
 			}
 
 			valid = append(valid, DeviceAndNode{
-				Device: device,
-				Node:   node,
+				Device:   device,
+				Node:     node,
+				Degraded: degraded,
 			})
 			// NOTE: it is extremely important not to overwrite
 			// existing cache items because the allocation algorithms
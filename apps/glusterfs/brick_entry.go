@@ -38,6 +38,10 @@ type BrickEntry struct {
 	LvmThinPool string
 	LvmLv       string
 
+	// MountPath is set for bricks of imported volumes whose brick
+	// directory is not the root of the mounted file system.
+	MountPath string
+
 	// currently sub type is only used when the brick is first created
 	// this is only exported for placer use and db serialization
 	SubType BrickSubType
@@ -233,6 +237,9 @@ func (b *BrickEntry) Create(db wdb.RODB, executor executors.Executor) error {
 }
 
 func (b *BrickEntry) destroyReq() *executors.BrickRequest {
+	if b.MountPath != "" {
+		return b.brickRequest(b.MountPath, false)
+	}
 	return b.brickRequest(strings.TrimSuffix(b.Info.Path, "/brick"), false)
 }
 
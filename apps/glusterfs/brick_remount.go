@@ -0,0 +1,200 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// BrickRemounter compares the bricks heketi has placed on the nodes
+// with the mounts of the nodes and mounts the missing bricks again,
+// typically after a node rebooted without mounting all of its fstab.
+// Every remount is applied as a state repair, which also restarts the
+// brick processes of the volume of the brick.
+type BrickRemounter struct {
+	db        *bolt.DB
+	executor  executors.Executor
+	optracker *OpTracker
+	// DryRun only reports the bricks that are not mounted
+	DryRun bool
+
+	// bricks found unmounted by the previous run, their event
+	// is only published when they are first found
+	unmounted map[string]bool
+}
+
+// Reconcile returns the fixes for the bricks that are not mounted on
+// the online nodes. Unless in dry-run mode the fixes are applied. The
+// nodes known to be down are skipped.
+func (br *BrickRemounter) Reconcile() ([]api.StateRepairFix, error) {
+	if !br.DryRun && br.optracker.Get() > 0 {
+		return nil, ErrOperationsInFlight
+	}
+
+	heketidb, err := dbDumpInternal(br.db)
+	if err != nil {
+		return nil, err
+	}
+	nodeUp := currentNodeHealthStatus()
+	exam := GlusterStateExaminationResponse{HeketiDB: heketidb}
+	hosts := map[string]string{}
+	for _, cluster := range heketidb.Clusters {
+		cdata := ClusterData{ClusterHeketiID: cluster.Info.Id}
+		for _, nodeId := range cluster.Info.Nodes {
+			node := heketidb.Nodes[nodeId]
+			if !node.isOnline() {
+				continue
+			}
+			if up, found := nodeUp[nodeId]; found && !up {
+				continue
+			}
+			host := node.ManageHostName()
+			hosts[nodeId] = host
+			mounts, err := br.executor.GetBrickMountStatus(host)
+			if err != nil {
+				logger.Warning("Unable to get the brick mounts of node %v: %v",
+					host, err)
+				continue
+			}
+			ndata := NodeData{NodeHeketiID: nodeId, BricksMountStatus: mounts}
+			cdata.NodesData = append(cdata.NodesData, ndata)
+			exam.Discrepancies = append(exam.Discrepancies,
+				findNodeDiscrepancies(heketidb, cluster.Info.Id, ndata)...)
+		}
+		exam.Clusters = append(exam.Clusters, cdata)
+	}
+
+	fixes := planRepairs(&exam,
+		[]api.DiscrepancyType{api.DiscrepancyBrickUnmounted})
+	unmounted := map[string]bool{}
+	for i := range fixes {
+		fix := &fixes[i]
+		d := fix.Discrepancy
+		unmounted[d.Brick] = true
+		if !br.unmounted[d.Brick] {
+			logger.Warning("%v", d.Description)
+			publishEvent(brickUnmountedEvent(fix, hosts[d.Node], br.DryRun))
+		}
+		if br.DryRun || fix.Action != api.RepairRemount {
+			continue
+		}
+		op := NewStateRepairOperation(br.db, fix)
+		fix.Operation = op.Id()
+		err := StateRepairer{
+			db:        br.db,
+			executor:  br.executor,
+			optracker: br.optracker,
+			caller:    internalCaller,
+		}.apply(op)
+		if err != nil {
+			logger.LogError("Unable to remount brick %v: %v", d.Brick, err)
+			fix.Error = err.Error()
+			continue
+		}
+		fix.Applied = true
+		delete(unmounted, d.Brick)
+	}
+	br.unmounted = unmounted
+	return fixes, nil
+}
+
+func brickUnmountedEvent(fix *api.StateRepairFix,
+	host string, dryRun bool) api.Event {
+
+	d := fix.Discrepancy
+	e := api.Event{
+		Type:       api.EventBrickUnmounted,
+		ResourceId: d.Brick,
+		Details: map[string]string{
+			"node":    d.Node,
+			"host":    host,
+			"volume":  d.Volume,
+			"path":    d.Path,
+			"action":  string(fix.Action),
+			"dry_run": strconv.FormatBool(dryRun),
+		},
+	}
+	if fix.Reason != "" {
+		e.Details["reason"] = fix.Reason
+	}
+	return e
+}
+
+// backgroundBrickRemounter periodically mounts the bricks that are
+// missing on the nodes.
+type backgroundBrickRemounter struct {
+	remounter *BrickRemounter
+
+	// timing params
+	StartInterval time.Duration
+	CheckInterval time.Duration
+
+	// to stop the remounter
+	stop chan<- interface{}
+}
+
+// Start creates a background goroutine to run periodic remounts.
+func (bbr *backgroundBrickRemounter) Start() {
+	startTimer := time.NewTimer(bbr.StartInterval)
+	ticker := time.NewTicker(bbr.CheckInterval)
+	stop := make(chan interface{})
+	bbr.stop = stop
+
+	go func() {
+		logger.Info("Started background brick remounter (dry run: %v)",
+			bbr.remounter.DryRun)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				logger.Info("Stopping background brick remounter")
+				return
+			case <-startTimer.C:
+				bbr.run()
+			case <-ticker.C:
+				bbr.run()
+			}
+		}
+	}()
+}
+
+// Stop the background brick remounter.
+func (bbr *backgroundBrickRemounter) Stop() {
+	bbr.stop <- true
+}
+
+func (bbr *backgroundBrickRemounter) run() {
+	fixes, err := bbr.remounter.Reconcile()
+	if err == ErrOperationsInFlight {
+		logger.Info("Background brick remounter skipped: operations in flight")
+		return
+	} else if err != nil {
+		logger.LogError("Background brick remounter: %v", err)
+		return
+	}
+	var applied, failed int
+	for _, fix := range fixes {
+		if fix.Applied {
+			applied++
+		} else if fix.Error != "" {
+			failed++
+		}
+	}
+	if len(fixes) > 0 {
+		logger.Info("Background brick remounter found %v unmounted bricks, "+
+			"remounted %v, failed %v", len(fixes), applied, failed)
+	}
+}
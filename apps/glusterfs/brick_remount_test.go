@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+func TestBrickRemounter(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	m, _ := setupStateTest(t, app)
+	host := m.firstHost()
+	unmounted := m.mounts[host][0].MountPoint
+	m.mounts[host][0].Mounted = false
+	// a brick without fstab entry is only reported
+	m.mounts[host] = m.mounts[host][:1]
+
+	mounted := []string{}
+	app.xo.MockMountBrick = func(h string, mountPoint string) error {
+		tests.Assert(t, h == host, h)
+		mounted = append(mounted, mountPoint)
+		for i := range m.mounts[h] {
+			if m.mounts[h][i].MountPoint == mountPoint {
+				m.mounts[h][i].Mounted = true
+			}
+		}
+		return nil
+	}
+	started := []string{}
+	app.xo.MockVolumeStartForce = func(h string, volume string) error {
+		started = append(started, volume)
+		return nil
+	}
+
+	countFixes := func(fixes []api.StateRepairFix) map[api.RepairAction]int {
+		counts := map[api.RepairAction]int{}
+		for _, fix := range fixes {
+			counts[fix.Action]++
+		}
+		return counts
+	}
+	eventsAfter := func(token string) ([]api.Event, string) {
+		events, next, _, _, err := eventLog.After(token)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return events, next
+	}
+	_, token := eventsAfter("")
+
+	br := &BrickRemounter{
+		db:        app.db,
+		executor:  app.executor,
+		optracker: app.optracker,
+		DryRun:    true,
+	}
+
+	// the dry run only reports the bricks
+	fixes, err := br.Reconcile()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(fixes) == 2, fixes)
+	counts := countFixes(fixes)
+	tests.Assert(t, counts[api.RepairRemount] == 1, counts)
+	tests.Assert(t, counts[api.RepairNone] == 1, counts)
+	for _, fix := range fixes {
+		tests.Assert(t, !fix.Applied && fix.Operation == "", fix)
+	}
+	tests.Assert(t, len(mounted) == 0, mounted)
+	events, token := eventsAfter(token)
+	tests.Assert(t, len(events) == 2, events)
+	for _, e := range events {
+		tests.Assert(t, e.Type == api.EventBrickUnmounted, e)
+		tests.Assert(t, e.Details["host"] == host, e)
+		tests.Assert(t, e.Details["dry_run"] == "true", e)
+	}
+
+	// the bricks already reported are not published again
+	fixes, err = br.Reconcile()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(fixes) == 2, fixes)
+	events, token = eventsAfter(token)
+	tests.Assert(t, len(events) == 0, events)
+
+	// the remounts wait for the operations in flight
+	br.DryRun = false
+	app.optracker.Add("abc", TrackNormal)
+	_, err = br.Reconcile()
+	tests.Assert(t, err == ErrOperationsInFlight, err)
+	app.optracker.Remove("abc")
+
+	fixes, err = br.Reconcile()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(fixes) == 2, fixes)
+	for _, fix := range fixes {
+		if fix.Action == api.RepairRemount {
+			tests.Assert(t, fix.Applied, fix)
+			tests.Assert(t, fix.Operation != "", fix)
+			tests.Assert(t, fix.Error == "", fix)
+		} else {
+			tests.Assert(t, !fix.Applied, fix)
+		}
+	}
+	tests.Assert(t, len(mounted) == 1 && mounted[0] == unmounted, mounted)
+	tests.Assert(t, len(started) == 1, started)
+	tests.Assert(t, started[0] == "vol1" || started[0] == "vol2", started)
+
+	events, token = eventsAfter(token)
+	remounted := 0
+	for _, e := range events {
+		tests.Assert(t, e.Type != api.EventBrickUnmounted, e)
+		if e.Type == api.EventBrickRemounted {
+			remounted++
+			tests.Assert(t, e.Details["host"] == host, e)
+			tests.Assert(t, e.Details["path"] != "", e)
+		}
+	}
+	tests.Assert(t, remounted == 1, events)
+
+	// only the brick without fstab entry is left
+	fixes, err = br.Reconcile()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(fixes) == 1, fixes)
+	tests.Assert(t, fixes[0].Action == api.RepairNone, fixes[0])
+	tests.Assert(t, len(mounted) == 1, mounted)
+}
@@ -0,0 +1,212 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/pkg/backup"
+)
+
+// dbBackupStatus records the time of the last successful db backup.
+// It is kept by the app so that it survives restarts of the scheduler.
+type dbBackupStatus struct {
+	lock sync.Mutex
+	last time.Time
+}
+
+func (s *dbBackupStatus) Set(t time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.last = t
+}
+
+func (s *dbBackupStatus) Get() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.last
+}
+
+// backgroundDbBackup periodically stores a copy of the db in a backup
+// target and deletes the copies beyond the retention count.
+type backgroundDbBackup struct {
+	db     *bolt.DB
+	target backup.Target
+	// number of backups to keep in the target
+	keep   int
+	status *dbBackupStatus
+
+	// timing params
+	StartInterval time.Duration
+	CheckInterval time.Duration
+
+	// to stop the backups
+	stop chan<- interface{}
+}
+
+// Start creates a background goroutine to run periodic backups.
+func (bdb *backgroundDbBackup) Start() {
+	startTimer := time.NewTimer(bdb.StartInterval)
+	ticker := time.NewTicker(bdb.CheckInterval)
+	stop := make(chan interface{})
+	bdb.stop = stop
+
+	go func() {
+		logger.Info("Started background db backups to %v", bdb.target)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				logger.Info("Stopping background db backups")
+				return
+			case <-startTimer.C:
+				bdb.run()
+			case <-ticker.C:
+				bdb.run()
+			}
+		}
+	}()
+}
+
+// Stop the background db backups. It does not wait for a backup in
+// progress to complete.
+func (bdb *backgroundDbBackup) Stop() {
+	close(bdb.stop)
+}
+
+func (bdb *backgroundDbBackup) run() {
+	b, err := bdb.Backup()
+	if err != nil {
+		logger.LogError("Background db backup: %v", err)
+		return
+	}
+	logger.Info("Saved db backup %v to %v", b.Name, bdb.target)
+}
+
+// Backup stores a consistent copy of the db in the target and prunes
+// the oldest backups. Failing to prune is only logged, the backup
+// itself succeeded.
+func (bdb *backgroundDbBackup) Backup() (*backup.Backup, error) {
+	var buf bytes.Buffer
+	now := time.Now()
+	err := bdb.db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(&buf)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to copy db: %v", err)
+	}
+
+	b := &backup.Backup{
+		Name: backup.NewName(now),
+		Size: int64(buf.Len()),
+		Time: now,
+	}
+	if err := bdb.target.Put(b.Name, &buf, b.Size); err != nil {
+		return nil, fmt.Errorf("unable to store backup in %v: %v", bdb.target, err)
+	}
+	if bdb.status != nil {
+		bdb.status.Set(now)
+	}
+
+	deleted, err := backup.Prune(bdb.target, bdb.keep)
+	for _, name := range deleted {
+		logger.Debug("Deleted old db backup %v", name)
+	}
+	if err != nil {
+		logger.LogError("Unable to delete old db backups: %v", err)
+	}
+	return b, nil
+}
+
+// DbBackupsList ... is the offline command to list the db backups
+// stored in the configured backup target.
+func DbBackupsList(conf *GlusterFSConfig) error {
+	target, err := backup.NewTarget(conf.DbBackup)
+	if err != nil {
+		return err
+	}
+	backups, err := target.List()
+	if err != nil {
+		return fmt.Errorf("Unable to list backups in %v: %v", target, err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(backups); err != nil {
+		return fmt.Errorf("Unable to encode the response into json: %v", err)
+	}
+	return nil
+}
+
+// DbBackupsRestore ... is the offline command to replace the db file
+// with a backup from the configured backup target. The most recent
+// backup is used if no name is given. An existing db file is kept next
+// to the restored one. It returns the name of the restored backup.
+func DbBackupsRestore(conf *GlusterFSConfig, name, dbfile string) (string, error) {
+	target, err := backup.NewTarget(conf.DbBackup)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		latest, err := backup.Latest(target)
+		if err != nil {
+			return "", err
+		}
+		name = latest.Name
+	}
+	if dbfile == "" {
+		dbfile = conf.DBfile
+	}
+	if dbfile == "" {
+		dbfile = dbfilename
+	}
+
+	fp, err := ioutil.TempFile(filepath.Dir(dbfile), ".heketi-restore-")
+	if err != nil {
+		return "", err
+	}
+	path := fp.Name()
+	defer os.Remove(path)
+	err = target.Get(name, fp)
+	fp.Close()
+	if err != nil {
+		return "", fmt.Errorf("Unable to get backup %v from %v: %v", name, target, err)
+	}
+
+	// make sure the download is a usable db before replacing anything
+	db, err := OpenDB(path, true)
+	if err != nil {
+		return "", fmt.Errorf("Backup %v is not a valid db: %v", name, err)
+	}
+	db.Close()
+
+	if _, err := os.Stat(dbfile); err == nil {
+		old := fmt.Sprintf("%v.pre-restore.%v",
+			dbfile, time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.Rename(dbfile, old); err != nil {
+			return "", err
+		}
+		logger.Info("Saved previous db to %v", old)
+	}
+	if err := os.Rename(path, dbfile); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/pkg/backup"
+)
+
+func TestDbBackupKeepsBackups(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	dir, err := ioutil.TempDir("", "heketi-backup-")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	err = setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.conf.DbBackup.Directory = dir
+	app.conf.DbBackup.Retention = 2
+	bdb, err := app.DbBackup()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, app.LastDbBackup().IsZero())
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		// backup names have a millisecond resolution
+		time.Sleep(2 * time.Millisecond)
+		b, err := bdb.Backup()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		names = append(names, b.Name)
+	}
+	tests.Assert(t, !app.LastDbBackup().IsZero())
+
+	backups, err := backup.NewLocalTarget(dir).List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 2, backups)
+	tests.Assert(t, backups[0].Name == names[1], backups, names)
+	tests.Assert(t, backups[1].Name == names[2], backups, names)
+
+	// the backup is a copy of the db
+	db, err := OpenDB(filepath.Join(dir, names[2]), true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, len(clusters) == 1, clusters)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestDbBackupScheduled(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	dir, err := ioutil.TempDir("", "heketi-backup-")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	app.conf.DbBackup.Directory = dir
+	bdb, err := app.DbBackup()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	bdb.StartInterval = 10 * time.Millisecond
+	bdb.CheckInterval = time.Hour
+	bdb.Start()
+	defer bdb.Stop()
+
+	for i := 0; i < 100 && app.LastDbBackup().IsZero(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, !app.LastDbBackup().IsZero())
+	backups, err := backup.NewLocalTarget(dir).List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 1, backups)
+}
+
+func TestDbBackupsRestore(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	dir, err := ioutil.TempDir("", "heketi-backup-")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	err = setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.conf.DbBackup.Directory = dir
+	bdb, err := app.DbBackup()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	first, err := bdb.Backup()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	time.Sleep(2 * time.Millisecond)
+	_, err = bdb.Backup()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	countIn := func(path string) int {
+		db, err := OpenDB(path, true)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer db.Close()
+		var clusters []string
+		err = db.View(func(tx *bolt.Tx) error {
+			clusters, err = ClusterList(tx)
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return len(clusters)
+	}
+
+	conf := &GlusterFSConfig{DbBackup: backup.Config{Directory: dir}}
+	restored := filepath.Join(dir, "restored.db")
+
+	// the most recent backup is used by default
+	name, err := DbBackupsRestore(conf, "", restored)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name != first.Name, name)
+	tests.Assert(t, countIn(restored) == 2)
+
+	// the replaced db file is kept
+	name, err = DbBackupsRestore(conf, first.Name, restored)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name == first.Name, name)
+	tests.Assert(t, countIn(restored) == 1)
+	saved, err := filepath.Glob(restored + ".pre-restore.*")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(saved) == 1, saved)
+	tests.Assert(t, countIn(saved[0]) == 2)
+
+	_, err = DbBackupsRestore(conf, "heketi-db-missing.db", restored)
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = DbBackupsRestore(&GlusterFSConfig{}, "", restored)
+	tests.Assert(t, err == backup.ErrNotConfigured, "expected ErrNotConfigured, got:", err)
+}
@@ -0,0 +1,362 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// DB_MIGRATION_PREFIX is the prefix of the db attribute keys that
+	// record the applied migrations. The key is followed by the version.
+	DB_MIGRATION_PREFIX = "DB_MIGRATION_"
+)
+
+// DbMigration is a named step that takes the db from the previous version
+// to Version. Up and Down each run in their own bolt transaction. Down is
+// nil for migrations that can not be reverted. The Up of an Always
+// migration is idempotent and runs at every migration, even once applied.
+type DbMigration struct {
+	Version int
+	Name    string
+	Up      func(tx *bolt.Tx) error
+	Down    func(tx *bolt.Tx) error
+	Always  bool
+}
+
+// DbMigrationStatus reports whether a migration was applied to the db.
+type DbMigrationStatus struct {
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	Applied    bool   `json:"applied"`
+	Reversible bool   `json:"reversible"`
+}
+
+// DbMigrationStatusResponse is the output of the migrate status command.
+type DbMigrationStatusResponse struct {
+	Version    int                 `json:"version"`
+	Latest     int                 `json:"latest"`
+	Migrations []DbMigrationStatus `json:"migrations"`
+	// Unknown lists applied versions this version of heketi does not know
+	Unknown []int `json:"unknown,omitempty"`
+}
+
+// dbMigrations is the ordered registry of migrations. New migrations
+// must be appended with the next version number and never reordered.
+// The buckets created by initializeBuckets predate the registry and are
+// created before the migrations run, as the migrations are recorded in
+// the db attributes bucket.
+var dbMigrations = []DbMigration{
+	{
+		Version: 1,
+		Name:    "state-reports-bucket",
+		Up: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_STATE_REPORTS))
+			return err
+		},
+		Down: func(tx *bolt.Tx) error {
+			err := tx.DeleteBucket([]byte(BOLTDB_BUCKET_STATE_REPORTS))
+			if err == bolt.ErrBucketNotFound {
+				return nil
+			}
+			return err
+		},
+	},
+	{
+		Version: 2,
+		Name:    "operation-history-bucket",
+		Up: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_OPERATION_HISTORY))
+			return err
+		},
+		Down: func(tx *bolt.Tx) error {
+			err := tx.DeleteBucket([]byte(BOLTDB_BUCKET_OPERATION_HISTORY))
+			if err == bolt.ErrBucketNotFound {
+				return nil
+			}
+			return err
+		},
+	},
+	{
+		Version: 3,
+		Name:    "entry-upgrades",
+		// the upgrade routines that predate the registry check their
+		// own flags. Their changes are understood by older versions,
+		// so reverting only forgets that they ran.
+		Up:     UpgradeDB,
+		Down:   func(tx *bolt.Tx) error { return nil },
+		Always: true,
+	},
+}
+
+func latestDbMigration() int {
+	if len(dbMigrations) == 0 {
+		return 0
+	}
+	return dbMigrations[len(dbMigrations)-1].Version
+}
+
+func dbMigrationKey(version int) string {
+	return fmt.Sprintf("%v%04d", DB_MIGRATION_PREFIX, version)
+}
+
+// appliedDbMigrations returns the versions of the migrations recorded
+// in the db attributes.
+func appliedDbMigrations(tx *bolt.Tx) (map[int]bool, error) {
+	applied := map[int]bool{}
+	for _, key := range EntryKeys(tx, BOLTDB_BUCKET_DBATTRIBUTE) {
+		if !strings.HasPrefix(key, DB_MIGRATION_PREFIX) {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimPrefix(key, DB_MIGRATION_PREFIX))
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration record %v: %v", key, err)
+		}
+		applied[v] = true
+	}
+	return applied, nil
+}
+
+// dbMigrationStatus lists the known migrations and whether they
+// were applied to the db.
+func dbMigrationStatus(tx *bolt.Tx) (*DbMigrationStatusResponse, error) {
+	applied, err := appliedDbMigrations(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DbMigrationStatusResponse{
+		Latest:     latestDbMigration(),
+		Migrations: []DbMigrationStatus{},
+	}
+	known := map[int]bool{}
+	contiguous := true
+	for _, m := range dbMigrations {
+		known[m.Version] = true
+		response.Migrations = append(response.Migrations, DbMigrationStatus{
+			Version:    m.Version,
+			Name:       m.Name,
+			Applied:    applied[m.Version],
+			Reversible: m.Down != nil,
+		})
+		// the db version is the last migration applied without gaps
+		if contiguous && applied[m.Version] {
+			response.Version = m.Version
+		} else {
+			contiguous = false
+		}
+	}
+	for v := range applied {
+		if !known[v] {
+			response.Unknown = append(response.Unknown, v)
+		}
+	}
+	sort.Ints(response.Unknown)
+	return response, nil
+}
+
+// checkUnknownDbMigrations fails if the db has migrations applied by
+// a newer version of heketi.
+func checkUnknownDbMigrations(applied map[int]bool) error {
+	for v := range applied {
+		if v > latestDbMigration() {
+			return fmt.Errorf(
+				"db has migration %v unknown to this version of heketi", v)
+		}
+	}
+	return nil
+}
+
+// dbMigrationsPending returns true if migrating the db to the given
+// version would run any migration.
+func dbMigrationsPending(db *bolt.DB, to int) (pending bool, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		applied, err := appliedDbMigrations(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkUnknownDbMigrations(applied); err != nil {
+			return err
+		}
+		for _, m := range dbMigrations {
+			if applied[m.Version] != (m.Version <= to) {
+				pending = true
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// migrateDB applies the migrations up to the given version and reverts
+// the ones above it. Every migration runs in its own transaction together
+// with the update of its record, so a failure leaves the db at the last
+// migration that succeeded. The applied Always migrations up to the
+// version run again.
+func migrateDB(db *bolt.DB, to int) error {
+	if to < 0 || to > latestDbMigration() {
+		return fmt.Errorf("unknown db version %v (latest is %v)",
+			to, latestDbMigration())
+	}
+
+	var applied map[int]bool
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		applied, err = appliedDbMigrations(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := checkUnknownDbMigrations(applied); err != nil {
+		return err
+	}
+	// revert from the newest migration down
+	for i := len(dbMigrations) - 1; i >= 0; i-- {
+		m := dbMigrations[i]
+		if m.Version <= to || !applied[m.Version] {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("migration %v (%v) can not be reverted",
+				m.Version, m.Name)
+		}
+		logger.Info("Reverting db migration %v (%v)", m.Version, m.Name)
+		err := db.Update(func(tx *bolt.Tx) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			entry := NewDbAttributeEntry()
+			entry.Key = dbMigrationKey(m.Version)
+			return entry.Delete(tx)
+		})
+		if err != nil {
+			return logger.LogError("Failed to revert db migration %v (%v): %v",
+				m.Version, m.Name, err)
+		}
+	}
+
+	for _, m := range dbMigrations {
+		if m.Version > to || (applied[m.Version] && !m.Always) {
+			continue
+		}
+		if !applied[m.Version] {
+			logger.Info("Applying db migration %v (%v)", m.Version, m.Name)
+		}
+		err := db.Update(func(tx *bolt.Tx) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			entry := NewDbAttributeEntry()
+			entry.Key = dbMigrationKey(m.Version)
+			entry.Value = m.Name
+			return entry.Save(tx)
+		})
+		if err != nil {
+			return logger.LogError("Failed to apply db migration %v (%v): %v",
+				m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// backupDBFile copies the db next to the given db file, naming the copy
+// after the change about to be made, and returns the path of the copy.
+func backupDBFile(db *bolt.DB, dbfile, change string) (string, error) {
+	path := fmt.Sprintf("%v.pre-%v.%v",
+		dbfile, change, time.Now().UTC().Format("20060102T150405Z"))
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to back up db to %v: %v", path, err)
+	}
+	return path, nil
+}
+
+// migrateDBWithBackup migrates the db to the given version, taking a
+// backup of the db file first if any migration is going to be applied
+// or reverted.
+func migrateDBWithBackup(db *bolt.DB, dbfile string, to int) error {
+	pending, err := dbMigrationsPending(db, to)
+	if err != nil {
+		return err
+	}
+	if pending {
+		path, err := backupDBFile(db, dbfile, "migration")
+		if err != nil {
+			return err
+		}
+		logger.Info("Saved db backup to %v before migration", path)
+	}
+	return migrateDB(db, to)
+}
+
+// DbMigrate ... is the offline command to migrate the db file to the given
+// version. A negative version migrates to the latest version.
+func DbMigrate(dbfile string, to int) error {
+
+	db, err := OpenDB(dbfile, false)
+	if err != nil {
+		return fmt.Errorf("Unable to open database: %v", err)
+	}
+	defer db.Close()
+
+	if to < 0 {
+		to = latestDbMigration()
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return initializeBuckets(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to initialize buckets: %v", err)
+	}
+	if err := migrateDBWithBackup(db, dbfile, to); err != nil {
+		return fmt.Errorf("Unable to migrate the database: %v", err)
+	}
+	return nil
+}
+
+// DbMigrateStatus ... is the offline command that prints the status of
+// the migrations of the db file as JSON.
+func DbMigrateStatus(dbfile string) error {
+
+	db, err := OpenDB(dbfile, true)
+	if err != nil {
+		return fmt.Errorf("Unable to open database: %v", err)
+	}
+	defer db.Close()
+
+	var status *DbMigrationStatusResponse
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		status, err = dbMigrationStatus(tx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to get migration status: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(status); err != nil {
+		return fmt.Errorf("Unable to encode the response into json: %v", err)
+	}
+	return nil
+}
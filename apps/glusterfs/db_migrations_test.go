@@ -0,0 +1,212 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+// testDbMigrations replaces the migration registry with migrations that
+// each record an attribute. Migration 2 can not be reverted and the
+// returned function makes migration 3 fail.
+func testDbMigrations() (restore func(), fail func()) {
+	orig := dbMigrations
+	failing := false
+	step := func(v int) func(tx *bolt.Tx) error {
+		return func(tx *bolt.Tx) error {
+			if v == 3 && failing {
+				return fmt.Errorf("migration failed")
+			}
+			entry := NewDbAttributeEntry()
+			entry.Key = fmt.Sprintf("TEST_STEP_%v", v)
+			entry.Value = "yes"
+			return entry.Save(tx)
+		}
+	}
+	undo := func(v int) func(tx *bolt.Tx) error {
+		return func(tx *bolt.Tx) error {
+			entry := NewDbAttributeEntry()
+			entry.Key = fmt.Sprintf("TEST_STEP_%v", v)
+			return entry.Delete(tx)
+		}
+	}
+	dbMigrations = []DbMigration{
+		{Version: 1, Name: "one", Up: step(1), Down: undo(1)},
+		{Version: 2, Name: "two", Up: step(2)},
+		{Version: 3, Name: "three", Up: step(3), Down: undo(3)},
+	}
+	return func() { dbMigrations = orig }, func() { failing = true }
+}
+
+func testDbMigrationStatus(t *testing.T, db *bolt.DB) *DbMigrationStatusResponse {
+	var status *DbMigrationStatusResponse
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		status, err = dbMigrationStatus(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return status
+}
+
+func TestDbMigrationsAppliedOnStart(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	status := testDbMigrationStatus(t, app.db)
+	tests.Assert(t, status.Version == latestDbMigration(), status)
+	tests.Assert(t, len(status.Migrations) == len(dbMigrations))
+	for _, m := range status.Migrations {
+		tests.Assert(t, m.Applied, m)
+	}
+	// the buckets and the entry upgrades are applied by the migrations
+	err := app.db.View(func(tx *bolt.Tx) error {
+		tests.Assert(t, tx.Bucket([]byte(BOLTDB_BUCKET_STATE_REPORTS)) != nil)
+		tests.Assert(t, tx.Bucket([]byte(BOLTDB_BUCKET_OPERATION_HISTORY)) != nil)
+		_, err := NewDbAttributeEntryFromKey(tx, DB_GENERATION_ID)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a new db needs no backup
+	matches, err := filepath.Glob(tmpfile + ".pre-migration.*")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(matches) == 0, matches)
+}
+
+func TestDbMigrationFailureOnStart(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	tests.Assert(t, !app.dbReadOnly)
+	// the db was migrated by a newer version of heketi
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		entry := NewDbAttributeEntry()
+		entry.Key = dbMigrationKey(latestDbMigration() + 1)
+		entry.Value = "newer"
+		return entry.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	tests.Assert(t, app.dbReadOnly, "expected read only db")
+	status := testDbMigrationStatus(t, app.db)
+	tests.Assert(t, len(status.Unknown) == 1, status)
+}
+
+func TestDbMigrateUpAndDown(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	db, err := OpenDB(tmpfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		return initializeBuckets(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	restore, fail := testDbMigrations()
+	defer restore()
+
+	hasStep := func(v int) bool {
+		found := false
+		db.View(func(tx *bolt.Tx) error {
+			_, err := NewDbAttributeEntryFromKey(tx, fmt.Sprintf("TEST_STEP_%v", v))
+			found = (err == nil)
+			return nil
+		})
+		return found
+	}
+
+	err = migrateDB(db, 2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	status := testDbMigrationStatus(t, db)
+	tests.Assert(t, status.Version == 2, status)
+	tests.Assert(t, status.Latest == 3, status)
+	tests.Assert(t, hasStep(1) && hasStep(2) && !hasStep(3))
+
+	err = migrateDB(db, 3)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, testDbMigrationStatus(t, db).Version == 3)
+	tests.Assert(t, hasStep(3))
+
+	err = migrateDB(db, 2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, testDbMigrationStatus(t, db).Version == 2)
+	tests.Assert(t, !hasStep(3))
+
+	// migration two can not be reverted
+	err = migrateDB(db, 0)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, testDbMigrationStatus(t, db).Version == 2)
+	tests.Assert(t, hasStep(1))
+
+	err = migrateDB(db, 4)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// a failed migration is not recorded
+	fail()
+	err = migrateDB(db, 3)
+	tests.Assert(t, err != nil, "expected err != nil")
+	status = testDbMigrationStatus(t, db)
+	tests.Assert(t, status.Version == 2, status)
+	tests.Assert(t, !status.Migrations[2].Applied, status)
+}
+
+func TestDbMigrateBackup(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	restore, _ := testDbMigrations()
+	defer restore()
+
+	app := NewTestApp(tmpfile)
+	app.Close()
+
+	// nothing to do, no backup is taken
+	err := DbMigrate(tmpfile, -1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	matches, err := filepath.Glob(tmpfile + ".pre-migration.*")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(matches) == 0, matches)
+
+	err = DbMigrate(tmpfile, 2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	matches, err = filepath.Glob(tmpfile + ".pre-migration.*")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(matches) == 1, matches)
+	defer os.Remove(matches[0])
+
+	// the backup has the db as it was before the migration
+	backup, err := OpenDB(matches[0], true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer backup.Close()
+	status := testDbMigrationStatus(t, backup)
+	tests.Assert(t, status.Version == 3, status)
+
+	db, err := OpenDB(tmpfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer db.Close()
+	status = testDbMigrationStatus(t, db)
+	tests.Assert(t, status.Version == 2, status)
+}
@@ -13,6 +13,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/boltdb/bolt"
@@ -274,7 +275,12 @@ func DbCreate(jsonfile string, dbfile string) error {
 	}
 	defer dbhandle.Close()
 
-	err = dbhandle.Update(func(tx *bolt.Tx) error {
+	return dbLoadDump(dbhandle, dump)
+}
+
+// dbLoadDump ... saves the entries of a dump into an empty db.
+func dbLoadDump(dbhandle *bolt.DB, dump Db) error {
+	err := dbhandle.Update(func(tx *bolt.Tx) error {
 		return initializeBuckets(tx)
 	})
 	if err != nil {
@@ -495,6 +501,11 @@ func dbCheckConsistency(db *bolt.DB) (response DbCheckResponse, err error) {
 		return response, fmt.Errorf("Could not construct dump from DB: %v", err.Error())
 	}
 
+	return dbCheckDump(dump), nil
+}
+
+// dbCheckDump ... checks the contents of a db dump for inconsistencies.
+func dbCheckDump(dump Db) (response DbCheckResponse) {
 	response.Volumes = dbCheckVolumes(dump)
 	response.TotalInconsistencies += len(response.Volumes.Inconsistencies)
 	response.Clusters = dbCheckClusters(dump)
@@ -650,3 +661,311 @@ func dbCheckPendingOps(dump Db) (pendingOpsCheckResponse DbBucketCheckResponse)
 
 	return
 }
+
+// DbCheckFix ... is the offline version of the db check fix. It prints
+// the changes made to the db (or only proposed if dryRun is set) as JSON.
+func DbCheckFix(dbfile string, dryRun bool) error {
+
+	db, err := OpenDB(dbfile, false)
+	if err != nil {
+		return fmt.Errorf("Unable to open database: %v", err)
+	}
+	defer db.Close()
+
+	fixresponse, err := dbFixConsistency(db, dryRun)
+	if err != nil {
+		return fmt.Errorf("Unable to fix the database: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+
+	if err := encoder.Encode(fixresponse); err != nil {
+		return fmt.Errorf("Unable to encode the response into json: %v", err)
+	}
+
+	return nil
+}
+
+// dbFixConsistency ... applies the safe repairs for inconsistencies found
+// by the db check. The dump, the fixes and the saving of the fixed entries
+// all happen in one transaction. If dryRun is set nothing is saved.
+func dbFixConsistency(db wdb.DB, dryRun bool) (response DbFixResponse, err error) {
+	response.DryRun = dryRun
+
+	run, wrap := db.Update, wdb.WrapTx
+	if dryRun {
+		run, wrap = db.View, wdb.WrapTxReadOnly
+	}
+	err = run(func(tx *bolt.Tx) error {
+		dump, err := dbDumpInternal(wrap(tx))
+		if err != nil {
+			return fmt.Errorf("Could not construct dump from DB: %v", err.Error())
+		}
+		response.Before = dbCheckDump(dump).TotalInconsistencies
+
+		f := newDbFixer(dump)
+		f.fix()
+		response.Changes = f.changes
+		response.Remaining = dbCheckDump(f.dump)
+
+		if dryRun {
+			return nil
+		}
+		return f.save(tx)
+	})
+	return
+}
+
+// dbFixer ... repairs the inconsistencies of a db dump that can be fixed
+// without guessing: ids of entries that no longer exist, device sizes
+// that do not match the bricks, and pending operations that no entry
+// refers to. The dump is updated in place and the ids of the touched
+// entries are tracked so that only those are saved.
+type dbFixer struct {
+	dump    Db
+	changes []string
+
+	clusters   map[string]bool
+	nodes      map[string]bool
+	devices    map[string]bool
+	volumes    map[string]bool
+	pendingOps map[string]bool
+}
+
+func newDbFixer(dump Db) *dbFixer {
+	return &dbFixer{
+		dump:       dump,
+		changes:    []string{},
+		clusters:   map[string]bool{},
+		nodes:      map[string]bool{},
+		devices:    map[string]bool{},
+		volumes:    map[string]bool{},
+		pendingOps: map[string]bool{},
+	}
+}
+
+func (f *dbFixer) change(format string, args ...interface{}) {
+	f.changes = append(f.changes, fmt.Sprintf(format, args...))
+}
+
+func (f *dbFixer) fix() {
+	f.fixPendingOps()
+	f.fixClusters()
+	f.fixNodes()
+	f.fixDevices()
+	f.fixVolumes()
+	sort.Strings(f.changes)
+}
+
+// removeUnknown ... returns ids without the ids rejected by known. The
+// order of the remaining ids is kept so sorted lists stay sorted.
+func removeUnknown(ids []string, known func(string) bool) (kept, removed []string) {
+	kept = []string{}
+	for _, id := range ids {
+		if known(id) {
+			kept = append(kept, id)
+		} else {
+			removed = append(removed, id)
+		}
+	}
+	return
+}
+
+func (f *dbFixer) fixPendingOps() {
+	for id, p := range f.dump.PendingOperations {
+		if f.pendingOpOrphaned(p) {
+			delete(f.dump.PendingOperations, id)
+			f.pendingOps[id] = true
+			f.change("Pending op %v: delete operation no entry refers to", id)
+		}
+	}
+}
+
+// pendingOpOrphaned ... returns true if none of the changes of the pending
+// operation refer to an entry that exists and is marked with the operation.
+func (f *dbFixer) pendingOpOrphaned(p PendingOperationEntry) bool {
+	for _, action := range p.Actions {
+		switch action.Change {
+		case OpAddBrick, OpDeleteBrick:
+			if b, found := f.dump.Bricks[action.Id]; found && b.Pending.Id == p.Id {
+				return false
+			}
+		case OpAddVolume, OpDeleteVolume, OpExpandVolume, OpCloneVolume, OpSnapshotVolume, OpAddVolumeClone:
+			if v, found := f.dump.Volumes[action.Id]; found && v.Pending.Id == p.Id {
+				return false
+			}
+		case OpAddBlockVolume, OpDeleteBlockVolume:
+			if bv, found := f.dump.BlockVolumes[action.Id]; found && bv.Pending.Id == p.Id {
+				return false
+			}
+		case OpRemoveDevice:
+			if _, found := f.dump.Devices[action.Id]; found {
+				return false
+			}
+		case OpRepairState:
+			_, vfound := f.dump.Volumes[action.Id]
+			_, nfound := f.dump.Nodes[action.Id]
+			if vfound || nfound {
+				return false
+			}
+		default:
+			// do not drop operations we do not understand
+			return false
+		}
+	}
+	return true
+}
+
+func (f *dbFixer) fixClusters() {
+	for id, c := range f.dump.Clusters {
+		var removed []string
+		c.Info.Nodes, removed = removeUnknown(c.Info.Nodes, func(n string) bool {
+			_, found := f.dump.Nodes[n]
+			return found
+		})
+		for _, n := range removed {
+			f.change("Cluster %v: remove unknown node %v", id, n)
+		}
+		changed := len(removed) > 0
+		c.Info.Volumes, removed = removeUnknown(c.Info.Volumes, func(v string) bool {
+			_, found := f.dump.Volumes[v]
+			return found
+		})
+		for _, v := range removed {
+			f.change("Cluster %v: remove unknown volume %v", id, v)
+		}
+		changed = changed || len(removed) > 0
+		c.Info.BlockVolumes, removed = removeUnknown(c.Info.BlockVolumes, func(bv string) bool {
+			_, found := f.dump.BlockVolumes[bv]
+			return found
+		})
+		for _, bv := range removed {
+			f.change("Cluster %v: remove unknown blockvolume %v", id, bv)
+		}
+		changed = changed || len(removed) > 0
+
+		if changed {
+			f.clusters[id] = true
+			f.dump.Clusters[id] = c
+		}
+	}
+}
+
+func (f *dbFixer) fixNodes() {
+	for id, n := range f.dump.Nodes {
+		var removed []string
+		n.Devices, removed = removeUnknown(n.Devices, func(d string) bool {
+			_, found := f.dump.Devices[d]
+			return found
+		})
+		for _, d := range removed {
+			f.change("Node %v: remove unknown device %v", id, d)
+		}
+		if len(removed) > 0 {
+			f.nodes[id] = true
+			f.dump.Nodes[id] = n
+		}
+	}
+}
+
+func (f *dbFixer) fixDevices() {
+	for id, d := range f.dump.Devices {
+		var removed []string
+		d.Bricks, removed = removeUnknown(d.Bricks, func(b string) bool {
+			_, found := f.dump.Bricks[b]
+			return found
+		})
+		for _, b := range removed {
+			f.change("Device %v: remove unknown brick %v", id, b)
+		}
+		changed := len(removed) > 0
+
+		var used uint64
+		for _, b := range d.Bricks {
+			brick := f.dump.Bricks[b]
+			used += brick.TpSize + brick.PoolMetadataSize
+		}
+		storage := d.Info.Storage
+		// sizes can only be recomputed if the bricks fit on the device
+		if used <= storage.Total &&
+			(storage.Used != used || storage.Free != storage.Total-used) {
+			f.change("Device %v: set Used %v -> %v, Free %v -> %v",
+				id, storage.Used, used, storage.Free, storage.Total-used)
+			d.Info.Storage.Used = used
+			d.Info.Storage.Free = storage.Total - used
+			changed = true
+		}
+
+		if changed {
+			f.devices[id] = true
+			f.dump.Devices[id] = d
+		}
+	}
+}
+
+func (f *dbFixer) fixVolumes() {
+	for id, v := range f.dump.Volumes {
+		var removed []string
+		v.Bricks, removed = removeUnknown(v.Bricks, func(b string) bool {
+			_, found := f.dump.Bricks[b]
+			return found
+		})
+		for _, b := range removed {
+			f.change("Volume %v: remove unknown brick %v", id, b)
+		}
+		changed := len(removed) > 0
+
+		v.Info.BlockInfo.BlockVolumes, removed = removeUnknown(v.Info.BlockInfo.BlockVolumes, func(bv string) bool {
+			_, found := f.dump.BlockVolumes[bv]
+			return found
+		})
+		for _, bv := range removed {
+			f.change("Volume %v: remove unknown blockvolume %v", id, bv)
+		}
+		changed = changed || len(removed) > 0
+
+		if changed {
+			f.volumes[id] = true
+			f.dump.Volumes[id] = v
+		}
+	}
+}
+
+// save ... writes the entries touched by the fixes to the db.
+func (f *dbFixer) save(tx *bolt.Tx) error {
+	for id := range f.pendingOps {
+		p, err := NewPendingOperationEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := p.Delete(tx); err != nil {
+			return err
+		}
+	}
+	for id := range f.clusters {
+		c := f.dump.Clusters[id]
+		if err := c.Save(tx); err != nil {
+			return err
+		}
+	}
+	for id := range f.nodes {
+		n := f.dump.Nodes[id]
+		if err := n.Save(tx); err != nil {
+			return err
+		}
+	}
+	for id := range f.devices {
+		d := f.dump.Devices[id]
+		if err := d.Save(tx); err != nil {
+			return err
+		}
+	}
+	for id := range f.volumes {
+		v := f.dump.Volumes[id]
+		if err := v.Save(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
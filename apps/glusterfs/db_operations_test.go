@@ -10,10 +10,16 @@
 package glusterfs
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/idgen"
 	"github.com/heketi/tests"
@@ -345,3 +351,203 @@ func TestDbDumpFileRoundTrip(t *testing.T) {
 	tests.Assert(t, len(db.BlockVolumes) == 1)
 	tests.Assert(t, len(db.PendingOperations) == 0)
 }
+
+// breakDbForFix makes the db inconsistent in ways the db check fix can
+// repair and returns the id of the brick that was removed.
+func breakDbForFix(t *testing.T, app *App) string {
+	var brickId string
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		// delete a brick without removing it from its volume and device
+		bricks, err := BrickList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			// keep the bricks of pending operations intact
+			if brick.Pending.Id != "" {
+				continue
+			}
+			brickId = brick.Info.Id
+			if err := brick.Delete(tx); err != nil {
+				return err
+			}
+			break
+		}
+
+		// add a node that does not exist to the cluster
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		cluster, err := NewClusterEntryFromId(tx, clusters[0])
+		if err != nil {
+			return err
+		}
+		cluster.NodeAdd(idgen.GenUUID())
+		if err := cluster.Save(tx); err != nil {
+			return err
+		}
+
+		// add a pending operation no entry refers to
+		op := NewPendingOperationEntry(NEW_ID)
+		op.recordChange(OpAddVolume, idgen.GenUUID())
+		op.Type = OperationCreateVolume
+		return op.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return brickId
+}
+
+func TestDbCheckFix(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	for i := 0; i < 2; i++ {
+		v := NewVolumeEntryFromRequest(req)
+		err := v.Create(app.db, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	// a pending operation in progress must be kept
+	v := NewVolumeEntryFromRequest(req)
+	vcr := NewVolumeCreateOperation(v, app.db)
+	err = vcr.Build()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	check, err := dbCheckConsistency(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, check.TotalInconsistencies == 0, check)
+
+	brickId := breakDbForFix(t, app)
+	check, err = dbCheckConsistency(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, check.TotalInconsistencies > 0, check)
+	before := check.TotalInconsistencies
+
+	t.Run("dryRun", func(t *testing.T) {
+		fix, err := dbFixConsistency(app.db, true)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, fix.DryRun)
+		tests.Assert(t, fix.Before == before, fix.Before, before)
+		tests.Assert(t, fix.Remaining.TotalInconsistencies == 0, fix.Remaining)
+		// brick removed from volume and device, device sizes,
+		// unknown node and the orphaned pending operation
+		tests.Assert(t, len(fix.Changes) == 5, fix.Changes)
+		var brickChanges int
+		for _, c := range fix.Changes {
+			if strings.Contains(c, brickId) {
+				brickChanges++
+			}
+		}
+		tests.Assert(t, brickChanges == 2, fix.Changes)
+
+		check, err := dbCheckConsistency(app.db)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, check.TotalInconsistencies == before, check)
+	})
+	t.Run("fix", func(t *testing.T) {
+		fix, err := dbFixConsistency(app.db, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, !fix.DryRun)
+		tests.Assert(t, len(fix.Changes) == 5, fix.Changes)
+
+		check, err := dbCheckConsistency(app.db)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, check.TotalInconsistencies == 0, check)
+
+		err = app.db.View(func(tx *bolt.Tx) error {
+			ops, err := PendingOperationList(tx)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, len(ops) == 1, ops)
+			tests.Assert(t, ops[0] == vcr.op.Id, ops)
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	})
+	t.Run("nothingToFix", func(t *testing.T) {
+		fix, err := dbFixConsistency(app.db, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, fix.Before == 0, fix.Before)
+		tests.Assert(t, len(fix.Changes) == 0, fix.Changes)
+	})
+}
+
+func TestDbCheckFixEndpoint(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		5*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	breakDbForFix(t, app)
+
+	post := func(dryRun bool) *http.Response {
+		body, err := json.Marshal(api.DbFixRequest{DryRun: dryRun})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r, err := http.Post(ts.URL+"/db/check/fix",
+			"application/json", bytes.NewReader(body))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return r
+	}
+
+	// fixes are refused while operations are in flight, dry runs are not
+	app.optracker.Add("abc", TrackNormal)
+	r := post(false)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusConflict, r.StatusCode)
+	r = post(true)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	var fix DbFixResponse
+	err = json.NewDecoder(r.Body).Decode(&fix)
+	r.Body.Close()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, fix.DryRun)
+	tests.Assert(t, len(fix.Changes) == 5, fix.Changes)
+	app.optracker.Remove("abc")
+
+	r = post(false)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	err = json.NewDecoder(r.Body).Decode(&fix)
+	r.Body.Close()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !fix.DryRun)
+	tests.Assert(t, fix.Remaining.TotalInconsistencies == 0, fix.Remaining)
+
+	check, err := dbCheckConsistency(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, check.TotalInconsistencies == 0, check)
+}
@@ -62,6 +62,16 @@ type DbCheckResponse struct {
 	TotalInconsistencies int                   `json:"totalinconsistencies"`
 }
 
+//DbFixResponse ... is the output of db check fix. It lists the changes made
+//to the db, or the changes that would be made on a dry run, and the
+//inconsistencies that remain afterwards.
+type DbFixResponse struct {
+	DryRun    bool            `json:"dryrun"`
+	Changes   []string        `json:"changes"`
+	Before    int             `json:"before"`
+	Remaining DbCheckResponse `json:"remaining"`
+}
+
 func initializeBuckets(tx *bolt.Tx) error {
 	// Create Cluster Bucket
 	_, err := tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_CLUSTER))
@@ -120,7 +130,8 @@ func initializeBuckets(tx *bolt.Tx) error {
 }
 
 // UpgradeDB runs all upgrade routines in order to to update the DB
-// to the latest "schemas" and data.
+// to the latest "schemas" and data. It is applied as a migration of
+// the dbMigrations registry.
 func UpgradeDB(tx *bolt.Tx) error {
 
 	err := ClusterEntryUpgrade(tx)
@@ -188,7 +188,7 @@ func (d *DeviceEntry) Delete(tx *bolt.Tx) error {
 }
 
 func (d *DeviceEntry) modifyState(db wdb.DB, s api.EntryState) error {
-	return db.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx *bolt.Tx) error {
 		// Save state
 		d.State = s
 		// Save new state
@@ -197,6 +197,10 @@ func (d *DeviceEntry) modifyState(db wdb.DB, s api.EntryState) error {
 		}
 		return nil
 	})
+	if err == nil {
+		publishEvent(deviceStateEvent(d))
+	}
+	return err
 }
 
 func (d *DeviceEntry) SetState(db wdb.DB,
@@ -285,6 +289,7 @@ func (d *DeviceEntry) NewInfoResponse(tx *bolt.Tx) (*api.DeviceInfoResponse, err
 	info.State = d.State
 	info.Bricks = make([]api.BrickInfo, 0)
 	info.Tags = copyTags(d.Info.Tags)
+	info.Identity = d.Info.Identity
 
 	// Add each drive information
 	for _, id := range d.Bricks {
@@ -455,12 +460,21 @@ func (d *DeviceEntry) Remove(db wdb.DB,
 
 }
 
+// removeBricksFromDevice replaces all bricks on the device. Before
+// each brick is replaced checkCanceled is called and, if it returns
+// an error, the bricks already replaced are kept and the error is
+// returned.
 func (d *DeviceEntry) removeBricksFromDevice(db wdb.DB,
-	executor executors.Executor) (e error) {
+	executor executors.Executor,
+	checkCanceled func() error) (e error) {
 
 	var errBrickWithEmptyPath error = fmt.Errorf("Brick has no path")
 
 	for _, brickId := range d.Bricks {
+		if err := checkCanceled(); err != nil {
+			logger.Info("Removal of device %v canceled", d.Id())
+			return err
+		}
 		var brickEntry *BrickEntry
 		var volumeEntry *VolumeEntry
 		err := db.View(func(tx *bolt.Tx) error {
@@ -565,8 +579,10 @@ func markEmptyDeviceFailed(db wdb.DB, id string) error {
 // returns nil. If ErrConflict is returned the device was not
 // empty. Any other error is a database failure.
 func markDeviceFailed(db wdb.DB, id string, force bool) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		d, err := NewDeviceEntryFromId(tx, id)
+	var d *DeviceEntry
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		d, err = NewDeviceEntryFromId(tx, id)
 		if err != nil {
 			return err
 		}
@@ -576,6 +592,10 @@ func markDeviceFailed(db wdb.DB, id string, force bool) error {
 		d.State = api.EntryStateFailed
 		return d.Save(tx)
 	})
+	if err == nil {
+		publishEvent(deviceStateEvent(d))
+	}
+	return err
 }
 
 func (d *DeviceEntry) DeleteBricksWithEmptyPath(tx *bolt.Tx) error {
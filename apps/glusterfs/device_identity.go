@@ -0,0 +1,202 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// SetIdentity records the persistent identifiers of the disk backing
+// the device, if the executor was able to determine them.
+func (d *DeviceEntry) SetIdentity(info *executors.DeviceInfo) {
+	if info.PvUUID == "" {
+		return
+	}
+	d.Info.Identity = api.DeviceIdentity{
+		Wwn:     info.Wwn,
+		IdPaths: append([]string{}, info.IdPaths...),
+		PvUUID:  info.PvUUID,
+		PvName:  info.PvName,
+	}
+}
+
+// knownPath returns true if the device name is known to have referred
+// to the disk backing the device at the time the identity was recorded.
+func (d *DeviceEntry) knownPath() bool {
+	id := d.Info.Identity
+	if id.PvUUID == "" {
+		// Devices added before identities were recorded. The only
+		// names we can safely assume are the kernel names.
+		return filepath.Dir(d.Info.Name) == "/dev"
+	}
+	if d.Info.Name == id.PvName {
+		return true
+	}
+	for _, p := range id.IdPaths {
+		if d.Info.Name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// currentPath returns true if the device name refers to the disk
+// described by info.
+func currentPath(name string, info *executors.DeviceInfo) bool {
+	if name == info.PvName {
+		return true
+	}
+	for _, p := range info.IdPaths {
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// persistentPath returns the most stable path to the disk described
+// by info. WWN based links are preferred over other by-id links and
+// the kernel name is only used if no by-id links exist.
+func persistentPath(info *executors.DeviceInfo) string {
+	for _, p := range info.IdPaths {
+		if strings.HasPrefix(filepath.Base(p), "wwn-") {
+			return p
+		}
+	}
+	if len(info.IdPaths) > 0 {
+		return info.IdPaths[0]
+	}
+	return info.PvName
+}
+
+// checkIdentity compares the identity of the disk found on the node with
+// the identity recorded for the device. It returns the name the device
+// should be known by, which differs from the current name when the
+// kernel has given the disk a new name.
+func (d *DeviceEntry) checkIdentity(info *executors.DeviceInfo) (string, error) {
+	if info.PvUUID == "" {
+		// nothing to compare against
+		return d.Info.Name, nil
+	}
+	if d.Info.Identity.PvUUID != "" && d.Info.Identity.PvUUID != info.PvUUID {
+		return "", fmt.Errorf(
+			"Physical volume %v of device %v does not match recorded uuid %v",
+			info.PvUUID, d.Info.Id, d.Info.Identity.PvUUID)
+	}
+	if currentPath(d.Info.Name, info) || !d.knownPath() {
+		return d.Info.Name, nil
+	}
+	return persistentPath(info), nil
+}
+
+// rename changes the name of the device, updating the registration
+// that keeps device names unique on a node.
+func (d *DeviceEntry) rename(tx *bolt.Tx, name string) error {
+	godbc.Require(tx != nil)
+	godbc.Require(name != "")
+
+	if err := d.Deregister(tx); err != nil {
+		return err
+	}
+	d.Info.Name = name
+	return d.Register(tx)
+}
+
+// updateIdentity renames the device if it is no longer found at its
+// recorded path and records the current identity of the disk.
+// Returns true if the device entry was changed and needs to be saved.
+func (d *DeviceEntry) updateIdentity(tx *bolt.Tx,
+	info *executors.DeviceInfo) (bool, error) {
+
+	if info.PvUUID == "" {
+		return false, nil
+	}
+
+	name, err := d.checkIdentity(info)
+	if err != nil {
+		return false, err
+	}
+	if name != d.Info.Name {
+		logger.Info("Device %v has been renamed from %v to %v",
+			d.Info.Id, d.Info.Name, name)
+		if err := d.rename(tx, name); err != nil {
+			return false, err
+		}
+	}
+
+	d.SetIdentity(info)
+	return true, nil
+}
+
+// refreshDeviceIdentities checks every device on the node against the
+// disks present on the node, updating the paths of devices that have
+// been renamed since they were added.
+func (a *App) refreshDeviceIdentities(nodeId string) error {
+	var (
+		node    *NodeEntry
+		devices []*DeviceEntry
+	)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		node, err = NewNodeEntryFromId(tx, nodeId)
+		if err != nil {
+			return err
+		}
+		for _, id := range node.Devices {
+			device, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			devices = append(devices, device)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		// failed devices may no longer have a volume group
+		if device.State == api.EntryStateFailed {
+			continue
+		}
+		info, err := a.executor.GetDeviceInfo(node.ManageHostName(),
+			device.Info.Name, device.Info.Id)
+		if err != nil {
+			logger.LogError("Unable to check identity of device %v: %v",
+				device.Info.Id, err)
+			continue
+		}
+		err = a.db.Update(func(tx *bolt.Tx) error {
+			device, err := NewDeviceEntryFromId(tx, device.Info.Id)
+			if err != nil {
+				return err
+			}
+			changed, err := device.updateIdentity(tx, info)
+			if err != nil || !changed {
+				return err
+			}
+			return device.Save(tx)
+		})
+		if err != nil {
+			logger.LogError("Unable to update identity of device %v: %v",
+				device.Info.Id, err)
+		}
+	}
+	return nil
+}
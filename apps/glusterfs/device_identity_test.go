@@ -0,0 +1,253 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+const (
+	testPvUUID = "rJ0bIG-3XNc-NoS0-fkKm-batK-dFyX-xbxHym"
+	testWwnId  = "/dev/disk/by-id/wwn-0x5000c500deadbeef"
+	testAtaId  = "/dev/disk/by-id/ata-FAST_SSD_1234"
+)
+
+func TestDeviceCheckIdentity(t *testing.T) {
+	info := &executors.DeviceInfo{
+		PvName:  "/dev/sdc",
+		PvUUID:  testPvUUID,
+		IdPaths: []string{testAtaId, testWwnId},
+	}
+
+	// legacy device still at the same kernel name
+	d := NewDeviceEntry()
+	d.Info.Name = "/dev/sdc"
+	name, err := d.checkIdentity(info)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name == "/dev/sdc", name)
+
+	// legacy device at a different kernel name
+	d.Info.Name = "/dev/sdb"
+	name, err = d.checkIdentity(info)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name == testWwnId, name)
+
+	// legacy device named by an unknown link is left alone
+	d.Info.Name = "/dev/mapper/mpatha"
+	name, err = d.checkIdentity(info)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name == "/dev/mapper/mpatha", name)
+
+	// device named by a persistent path is never renamed
+	d.Info.Name = testAtaId
+	d.Info.Identity = api.DeviceIdentity{
+		PvName:  "/dev/sdb",
+		PvUUID:  testPvUUID,
+		IdPaths: []string{testAtaId, testWwnId},
+	}
+	name, err = d.checkIdentity(info)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name == testAtaId, name)
+
+	// recorded device that was renamed by the kernel
+	d.Info.Name = "/dev/sdb"
+	name, err = d.checkIdentity(info)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name == testWwnId, name)
+
+	// without by-id links the kernel name is used
+	name, err = d.checkIdentity(&executors.DeviceInfo{
+		PvName: "/dev/sdc",
+		PvUUID: testPvUUID,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name == "/dev/sdc", name)
+
+	// a different physical volume must not be adopted
+	_, err = d.checkIdentity(&executors.DeviceInfo{
+		PvName: "/dev/sdb",
+		PvUUID: "AAAAAA-3XNc-NoS0-fkKm-batK-dFyX-xbxHym",
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// no identity reported
+	name, err = d.checkIdentity(&executors.DeviceInfo{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, name == "/dev/sdb", name)
+}
+
+func TestRefreshDeviceIdentities(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 1, 2, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var node *NodeEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, nodes[0])
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	renamedId := node.Devices[0]
+	sameId := node.Devices[1]
+
+	var oldName string
+	app.xo.MockGetDeviceInfo = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		d := &executors.DeviceInfo{
+			PvName: device,
+			PvUUID: vgid,
+		}
+		if vgid == renamedId {
+			oldName = device
+			d.PvName = "/dev/sdz"
+			d.IdPaths = []string{testWwnId}
+		}
+		return d, nil
+	}
+
+	err = app.refreshDeviceIdentities(node.Info.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, renamedId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, d.Info.Name == testWwnId, d.Info.Name)
+		tests.Assert(t, d.Info.Identity.PvUUID == renamedId)
+		tests.Assert(t, d.Info.Identity.PvName == "/dev/sdz")
+
+		d, err = NewDeviceEntryFromId(tx, sameId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, d.Info.Name != testWwnId, d.Info.Name)
+		tests.Assert(t, d.Info.Identity.PvUUID == sameId)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the old name is free to be used by another device
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		d := NewDeviceEntryFromRequest(&api.DeviceAddRequest{
+			Device: api.Device{Name: oldName},
+			NodeId: node.Info.Id,
+		})
+		return d.Register(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestDeviceResyncRenamed(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 1, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var deviceId string
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		node, err := NewNodeEntryFromId(tx, nodes[0])
+		if err != nil {
+			return err
+		}
+		deviceId = node.Devices[0]
+		device, err := NewDeviceEntryFromId(tx, deviceId)
+		if err != nil {
+			return err
+		}
+		device.Info.Identity = api.DeviceIdentity{
+			PvName: device.Info.Name,
+			PvUUID: testPvUUID,
+		}
+		return device.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	resync := func() int {
+		r, err := http.Get(ts.URL + "/devices/" + deviceId + "/resync")
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusAccepted)
+		location, err := r.Location()
+		tests.Assert(t, err == nil)
+		for {
+			r, err := http.Get(location.String())
+			tests.Assert(t, err == nil)
+			if r.Header.Get("X-Pending") != "true" {
+				return r.StatusCode
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	// a different physical volume fails the resync
+	app.xo.MockGetDeviceInfo = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		return &executors.DeviceInfo{
+			TotalSize:  500 * GB,
+			FreeSize:   500 * GB,
+			ExtentSize: 4096,
+			PvName:     "/dev/sdz",
+			PvUUID:     "AAAAAA-3XNc-NoS0-fkKm-batK-dFyX-xbxHym",
+		}, nil
+	}
+	tests.Assert(t, resync() == http.StatusInternalServerError)
+
+	app.xo.MockGetDeviceInfo = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		return &executors.DeviceInfo{
+			TotalSize:  500 * GB,
+			FreeSize:   500 * GB,
+			ExtentSize: 4096,
+			PvName:     "/dev/sdz",
+			PvUUID:     testPvUUID,
+			Wwn:        "0x5000c500deadbeef",
+			IdPaths:    []string{testWwnId},
+		}, nil
+	}
+	tests.Assert(t, resync() == http.StatusNoContent)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		device, err := NewDeviceEntryFromId(tx, deviceId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, device.Info.Name == testWwnId, device.Info.Name)
+		tests.Assert(t, device.Info.Identity.Wwn == "0x5000c500deadbeef")
+		tests.Assert(t, device.Info.Identity.PvName == "/dev/sdz")
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -32,4 +32,10 @@ var (
 
 	// returned by code related to operations load
 	ErrTooManyOperations = errors.New("Server handling too many operations")
+
+	// returned when state can not be repaired while operations run
+	ErrOperationsInFlight = errors.New("Operations are in flight, retry when they complete")
+
+	// returned by operations that stopped because they were canceled
+	ErrOperationCanceled = errors.New("Operation canceled")
 )
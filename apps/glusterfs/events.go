@@ -0,0 +1,267 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/idgen"
+)
+
+const (
+	DEFAULT_EVENT_BUFFER_SIZE = 1000
+)
+
+var (
+	ErrInvalidEventToken = fmt.Errorf("invalid event token")
+)
+
+// eventBroker keeps the most recent events in a ring buffer. Events
+// are numbered in the order they are published and the token of an
+// event is the epoch of the broker and its number. The epoch changes
+// when the server restarts so tokens of earlier runs are detected.
+// Like the running operations, the events are global and not per app.
+type eventBroker struct {
+	lock  sync.Mutex
+	epoch string
+	ring  []api.Event
+	// index in ring of the oldest event
+	first int
+	count int
+	// number of the next event published
+	next uint64
+	// closed, and replaced, when an event is published
+	published chan struct{}
+}
+
+var eventLog = newEventBroker(DEFAULT_EVENT_BUFFER_SIZE)
+
+func newEventBroker(size int) *eventBroker {
+	return &eventBroker{
+		epoch:     idgen.GenUUID()[:8],
+		ring:      make([]api.Event, size),
+		next:      1,
+		published: make(chan struct{}),
+	}
+}
+
+// publishEvent adds the event to the events of the server.
+func publishEvent(e api.Event) {
+	eventLog.Publish(e)
+}
+
+func (b *eventBroker) token(n uint64) string {
+	return fmt.Sprintf("%v-%v", b.epoch, n)
+}
+
+// SetSize sets the number of events kept, dropping the oldest ones
+// if needed.
+func (b *eventBroker) SetSize(size int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ring := make([]api.Event, size)
+	if b.count > size {
+		b.first = (b.first + b.count - size) % len(b.ring)
+		b.count = size
+	}
+	for i := 0; i < b.count; i++ {
+		ring[i] = b.ring[(b.first+i)%len(b.ring)]
+	}
+	b.ring = ring
+	b.first = 0
+}
+
+// Publish sets the id and the time of the event and adds it to the
+// buffer, waking up the readers waiting for new events.
+func (b *eventBroker) Publish(e api.Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	e.Id = b.token(b.next)
+	b.next++
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(b.ring) == 0 {
+		return
+	}
+	if b.count < len(b.ring) {
+		b.ring[(b.first+b.count)%len(b.ring)] = e
+		b.count++
+	} else {
+		b.ring[b.first] = e
+		b.first = (b.first + 1) % len(b.ring)
+	}
+	close(b.published)
+	b.published = make(chan struct{})
+}
+
+// After returns the events after the one with the given token, the
+// token of the last event and whether events after the token were
+// dropped. An empty token returns no events, only the current token.
+// The returned channel is closed once a later event is published.
+func (b *eventBroker) After(token string) (
+	events []api.Event, next string, lost bool,
+	published <-chan struct{}, err error) {
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	last := b.next - 1
+	after := last
+	if token != "" {
+		var epoch string
+		epoch, after, err = parseEventToken(token)
+		if err != nil {
+			return nil, "", false, nil, err
+		}
+		if epoch != b.epoch || after > last {
+			// token of an earlier run of the server
+			after = 0
+			lost = true
+		}
+	}
+
+	// number of the oldest event kept
+	oldest := b.next - uint64(b.count)
+	if after+1 < oldest {
+		after = oldest - 1
+		lost = true
+	}
+	events = []api.Event{}
+	for n := after + 1; n <= last; n++ {
+		i := (b.first + int(n-oldest)) % len(b.ring)
+		events = append(events, b.ring[i])
+	}
+	return events, b.token(last), lost, b.published, nil
+}
+
+func parseEventToken(token string) (string, uint64, error) {
+	i := strings.LastIndex(token, "-")
+	if i < 0 {
+		return "", 0, ErrInvalidEventToken
+	}
+	n, err := strconv.ParseUint(token[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidEventToken
+	}
+	return token[:i], n, nil
+}
+
+// operationEvent returns the event of an operation of the given type.
+// The resource of the operation is only known once it is built.
+func operationEvent(t api.EventType,
+	op Operation, opType string, built bool) api.Event {
+
+	e := api.Event{
+		Type:        t,
+		OperationId: op.Id(),
+		Details: map[string]string{
+			"label": op.Label(),
+			"type":  opType,
+		},
+	}
+	if built {
+		e.ResourceId = operationResourceId(op)
+	}
+	return e
+}
+
+// volumeEvents returns the events of the volumes changed by a
+// successful operation.
+func volumeEvents(op Operation) []api.Event {
+	var (
+		t    api.EventType
+		vol  *VolumeEntry
+		more map[string]string
+	)
+	switch o := op.(type) {
+	case *VolumeCreateOperation:
+		t, vol = api.EventVolumeCreated, o.vol
+	case *VolumeCloneOperation:
+		t, vol = api.EventVolumeCreated, o.clone
+		more = map[string]string{"clone_of": o.vol.Info.Id}
+	case *VolumeImportOperation:
+		t, vol = api.EventVolumeCreated, o.vol
+		more = map[string]string{"imported": "true"}
+	case *VolumeExpandOperation:
+		t, vol = api.EventVolumeExpanded, o.vol
+		more = map[string]string{"expand_size": strconv.Itoa(o.ExpandSize)}
+	case *VolumeDeleteOperation:
+		t, vol = api.EventVolumeDeleted, o.vol
+	default:
+		return nil
+	}
+	if vol == nil {
+		return nil
+	}
+	e := api.Event{
+		Type:        t,
+		ResourceId:  vol.Info.Id,
+		OperationId: op.Id(),
+		Details: map[string]string{
+			"name":    vol.Info.Name,
+			"cluster": vol.Info.Cluster,
+			"size":    strconv.Itoa(vol.Info.Size),
+		},
+	}
+	for k, v := range more {
+		e.Details[k] = v
+	}
+	return []api.Event{e}
+}
+
+// brickEvents returns the events of the bricks changed by a
+// successful operation.
+func brickEvents(op Operation) []api.Event {
+	sro, ok := op.(*StateRepairOperation)
+	if !ok || sro.fix.Action != api.RepairRemount {
+		return nil
+	}
+	d := sro.fix.Discrepancy
+	return []api.Event{{
+		Type:        api.EventBrickRemounted,
+		ResourceId:  d.Brick,
+		OperationId: op.Id(),
+		Details: map[string]string{
+			"node":   d.Node,
+			"host":   sro.host,
+			"volume": d.Volume,
+			"path":   d.Path,
+		},
+	}}
+}
+
+func deviceStateEvent(d *DeviceEntry) api.Event {
+	return api.Event{
+		Type:       api.EventDeviceStateChanged,
+		ResourceId: d.Info.Id,
+		Details: map[string]string{
+			"node":  d.NodeId,
+			"state": string(d.State),
+		},
+	}
+}
+
+func nodeHealthEvent(s *NodeHealthStatus) api.Event {
+	return api.Event{
+		Type:       api.EventNodeHealthChanged,
+		ResourceId: s.NodeId,
+		Time:       s.LastUpdate,
+		Details: map[string]string{
+			"host":  s.Host,
+			"up":    strconv.FormatBool(s.Up),
+			"state": string(s.State),
+		},
+	}
+}
@@ -0,0 +1,229 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+func TestEventBroker(t *testing.T) {
+	b := newEventBroker(3)
+
+	events, token, lost, _, err := b.After("")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(events) == 0 && !lost, events, lost)
+	tests.Assert(t, token == b.epoch+"-0", token)
+
+	b.Publish(api.Event{Type: api.EventVolumeCreated, ResourceId: "v1"})
+	b.Publish(api.Event{Type: api.EventVolumeDeleted, ResourceId: "v1"})
+	events, next, lost, _, err := b.After(token)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !lost)
+	tests.Assert(t, len(events) == 2, events)
+	tests.Assert(t, events[0].Type == api.EventVolumeCreated, events[0])
+	tests.Assert(t, events[0].Id == b.epoch+"-1", events[0].Id)
+	tests.Assert(t, !events[0].Time.IsZero())
+	tests.Assert(t, next == events[1].Id, next, events[1].Id)
+
+	// resuming after an event
+	events, _, _, _, _ = b.After(events[0].Id)
+	tests.Assert(t, len(events) == 1 && events[0].Type == api.EventVolumeDeleted,
+		events)
+
+	// readers are woken up by new events
+	_, _, _, published, _ := b.After(next)
+	select {
+	case <-published:
+		t.Fatalf("expected no new event")
+	default:
+	}
+	b.Publish(api.Event{Type: api.EventVolumeCreated, ResourceId: "v2"})
+	b.Publish(api.Event{Type: api.EventVolumeCreated, ResourceId: "v3"})
+	<-published
+
+	// the oldest events are dropped
+	events, _, lost, _, _ = b.After(token)
+	tests.Assert(t, lost)
+	tests.Assert(t, len(events) == 3, events)
+	tests.Assert(t, events[0].Type == api.EventVolumeDeleted, events[0])
+	events, _, lost, _, _ = b.After(next)
+	tests.Assert(t, !lost)
+	tests.Assert(t, len(events) == 2, events)
+
+	// tokens of another run of the server
+	events, _, lost, _, _ = b.After("abcdef12-2")
+	tests.Assert(t, lost)
+	tests.Assert(t, len(events) == 3, events)
+
+	_, _, _, _, err = b.After("garbage")
+	tests.Assert(t, err == ErrInvalidEventToken, err)
+
+	b.SetSize(1)
+	events, _, lost, _, _ = b.After(next)
+	tests.Assert(t, lost)
+	tests.Assert(t, len(events) == 1 && events[0].ResourceId == "v3", events)
+	b.SetSize(2)
+	b.Publish(api.Event{Type: api.EventVolumeCreated, ResourceId: "v4"})
+	events, _, _, _, _ = b.After(token)
+	tests.Assert(t, len(events) == 2, events)
+	tests.Assert(t, events[0].ResourceId == "v3", events)
+	tests.Assert(t, events[1].ResourceId == "v4", events)
+}
+
+func TestEventsEndpoint(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	getEvents := func(query string) *api.EventsResponse {
+		r, err := http.Get(ts.URL + "/events?" + query)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer r.Body.Close()
+		tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+		var er api.EventsResponse
+		err = json.NewDecoder(r.Body).Decode(&er)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return &er
+	}
+
+	// no events are waited for with a zero timeout
+	er := getEvents("timeout=0")
+	tests.Assert(t, len(er.Events) == 0, er.Events)
+	token := er.Next
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	err = RunOperation(vc, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	er = getEvents("after=" + token)
+	tests.Assert(t, !er.Lost)
+	types := []api.EventType{}
+	for _, e := range er.Events {
+		types = append(types, e.Type)
+		tests.Assert(t, e.OperationId == vc.Id(), e)
+		tests.Assert(t, e.ResourceId == vol.Info.Id, e)
+	}
+	tests.Assert(t, len(types) == 3, types)
+	tests.Assert(t, types[0] == api.EventOperationStarted, types)
+	tests.Assert(t, types[1] == api.EventVolumeCreated, types)
+	tests.Assert(t, types[2] == api.EventOperationFinished, types)
+	tests.Assert(t, er.Events[1].Details["name"] == vol.Info.Name, er.Events[1])
+	tests.Assert(t, er.Events[2].Details["type"] == "create-volume",
+		er.Events[2])
+	tests.Assert(t, er.Next == er.Events[2].Id, er.Next)
+	token = er.Next
+
+	// long-poll requests wait for the next event
+	var device *DeviceEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		ids, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		device, err = NewDeviceEntryFromId(tx, ids[0])
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		device.SetState(app.db, app.executor, api.EntryStateOffline)
+	}()
+	er = getEvents("timeout=10&after=" + token)
+	tests.Assert(t, len(er.Events) == 1, er.Events)
+	e := er.Events[0]
+	tests.Assert(t, e.Type == api.EventDeviceStateChanged, e)
+	tests.Assert(t, e.ResourceId == device.Info.Id, e)
+	tests.Assert(t, e.Details["state"] == "offline", e)
+
+	for _, query := range []string{"after=garbage", "timeout=-1", "timeout=1000"} {
+		r, err := http.Get(ts.URL + "/events?" + query)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		tests.Assert(t, r.StatusCode == http.StatusBadRequest, query, r.StatusCode)
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	publishEvent(api.Event{Type: api.EventVolumeCreated, ResourceId: "before"})
+	_, token, _, _, _ := eventLog.After("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequest("GET", ts.URL+"/events", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", token)
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	tests.Assert(t, r.Header.Get("Content-Type") == "text/event-stream",
+		r.Header.Get("Content-Type"))
+
+	publishEvent(api.Event{Type: api.EventVolumeDeleted, ResourceId: "after"})
+
+	// read the fields of the first event
+	fields := map[string]string{}
+	s := bufio.NewScanner(r.Body)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			break
+		}
+		kv := strings.SplitN(line, ": ", 2)
+		tests.Assert(t, len(kv) == 2, line)
+		fields[kv[0]] = kv[1]
+	}
+	tests.Assert(t, fields["event"] == string(api.EventVolumeDeleted), fields)
+	var e api.Event
+	err = json.Unmarshal([]byte(fields["data"]), &e)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, e.ResourceId == "after", e)
+	tests.Assert(t, fields["id"] == e.Id, fields, e.Id)
+}
@@ -11,18 +11,23 @@ package glusterfs
 
 import (
 	"fmt"
+	"path"
 	"reflect"
 	"sort"
+	"strings"
 
 	"github.com/boltdb/bolt"
 	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/paths"
 )
 
 type ExaminerMode string
 
 const (
-	OnDemandExaminer ExaminerMode = "ondemand"
-	OfflineExaminer  ExaminerMode = "offline"
+	OnDemandExaminer   ExaminerMode = "ondemand"
+	OfflineExaminer    ExaminerMode = "offline"
+	BackgroundExaminer ExaminerMode = "background"
 )
 
 type Examiner struct {
@@ -48,9 +53,10 @@ type ClusterData struct {
 }
 
 type GlusterStateExaminationResponse struct {
-	HeketiDB Db            `json:"heketidb"`
-	Report   []string      `json:"report"`
-	Clusters []ClusterData `json:"clusters"`
+	HeketiDB      Db                `json:"heketidb"`
+	Report        []string          `json:"report"`
+	Discrepancies []api.Discrepancy `json:"discrepancies"`
+	Clusters      []ClusterData     `json:"clusters"`
 }
 
 func (examiner Examiner) fetchClusterData(cluster ClusterEntry, heketidb Db) (clusterdata ClusterData, errorstrings []string) {
@@ -151,6 +157,201 @@ func compareHeketiAndGluster(heketidb Db, cdata ClusterData) (errorstrings []str
 	return
 }
 
+// glusterVolumes returns the volumes reported by the first node of the
+// cluster that returned volume info, indexed by name. Nil is returned
+// if no node reported volume info.
+func glusterVolumes(cdata ClusterData) map[string]*executors.Volume {
+	for _, node := range cdata.NodesData {
+		if node.VolumeInfo == nil {
+			continue
+		}
+		volumes := map[string]*executors.Volume{}
+		for i := range node.VolumeInfo.Volumes.VolumeList {
+			v := &node.VolumeInfo.Volumes.VolumeList[i]
+			volumes[v.VolumeName] = v
+		}
+		return volumes
+	}
+	return nil
+}
+
+// brickMountPoint returns the directory where the file system of
+// the brick is mounted or an empty string if it is not known.
+func brickMountPoint(b *BrickEntry) string {
+	if b.MountPath != "" {
+		return b.MountPath
+	}
+	if path.Base(b.Info.Path) != "brick" {
+		return ""
+	}
+	return path.Dir(b.Info.Path)
+}
+
+// findVolumeDiscrepancies compares the volumes and bricks of a cluster
+// in the heketi db with the volumes known to gluster.
+func findVolumeDiscrepancies(heketidb Db, cdata ClusterData) (found []api.Discrepancy) {
+	gvolumes := glusterVolumes(cdata)
+	if gvolumes == nil {
+		return
+	}
+
+	known := map[string]bool{}
+	for _, id := range heketidb.Clusters[cdata.ClusterHeketiID].Info.Volumes {
+		volume := heketidb.Volumes[id]
+		known[volume.Info.Name] = true
+		if volume.Pending.Id != "" {
+			continue
+		}
+		gvol, ok := gvolumes[volume.Info.Name]
+		if !ok {
+			found = append(found, api.Discrepancy{
+				Type:       api.DiscrepancyVolumeMissing,
+				Cluster:    cdata.ClusterHeketiID,
+				Volume:     volume.Info.Id,
+				VolumeName: volume.Info.Name,
+				Description: fmt.Sprintf("volume %v (%v) does not exist in gluster",
+					volume.Info.Name, volume.Info.Id),
+			})
+			continue
+		}
+
+		gbricks := map[string]bool{}
+		for _, b := range gvol.Bricks.BrickList {
+			gbricks[b.Name] = true
+		}
+		for _, brickId := range volume.Bricks {
+			brick := heketidb.Bricks[brickId]
+			node := heketidb.Nodes[brick.Info.NodeId]
+			if !brickInGluster(gbricks, &node, brick.Info.Path) {
+				found = append(found, api.Discrepancy{
+					Type:       api.DiscrepancyBrickPathMismatch,
+					Cluster:    cdata.ClusterHeketiID,
+					Node:       node.Info.Id,
+					Volume:     volume.Info.Id,
+					VolumeName: volume.Info.Name,
+					Brick:      brick.Info.Id,
+					Path:       node.StorageHostName() + ":" + brick.Info.Path,
+					Description: fmt.Sprintf("brick %v:%v of volume %v is not part of the gluster volume",
+						node.StorageHostName(), brick.Info.Path, volume.Info.Name),
+				})
+			}
+		}
+	}
+
+	var names []string
+	for name := range gvolumes {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		found = append(found, api.Discrepancy{
+			Type:        api.DiscrepancyVolumeExtra,
+			Cluster:     cdata.ClusterHeketiID,
+			VolumeName:  name,
+			Description: fmt.Sprintf("gluster volume %v is not managed by heketi", name),
+		})
+	}
+	return
+}
+
+func brickInGluster(gbricks map[string]bool, node *NodeEntry, brickPath string) bool {
+	hosts := append([]string{}, node.Info.Hostnames.Storage...)
+	hosts = append(hosts, node.Info.Hostnames.Manage...)
+	for _, h := range hosts {
+		if gbricks[h+":"+brickPath] {
+			return true
+		}
+	}
+	return false
+}
+
+// findNodeDiscrepancies compares the bricks heketi has placed on a
+// node with the mounts and logical volumes found on the node.
+func findNodeDiscrepancies(heketidb Db, cluster string, ndata NodeData) (found []api.Discrepancy) {
+	node := heketidb.Nodes[ndata.NodeHeketiID]
+
+	mounts := map[string]executors.BrickMountStatus{}
+	if ndata.BricksMountStatus != nil {
+		for _, s := range ndata.BricksMountStatus.Statuses {
+			mounts[s.MountPoint] = s
+		}
+	}
+
+	vgs := map[string]bool{}
+	usedLvs := map[string]bool{}
+	for _, deviceId := range node.Devices {
+		device := heketidb.Devices[deviceId]
+		vg := paths.VgIdToName(deviceId)
+		vgs[vg] = true
+		for _, brickId := range device.Bricks {
+			brick := heketidb.Bricks[brickId]
+			usedLvs[vg+"/"+brick.LvName()] = true
+			usedLvs[vg+"/"+brick.TpName()] = true
+
+			mp := brickMountPoint(&brick)
+			if brick.Pending.Id != "" || mp == "" || ndata.BricksMountStatus == nil {
+				continue
+			}
+			s, ok := mounts[mp]
+			if ok && s.Mounted {
+				continue
+			}
+			desc := fmt.Sprintf("brick %v on node %v is not mounted at %v",
+				brick.Info.Id, node.ManageHostName(), mp)
+			if !ok {
+				desc = fmt.Sprintf("brick %v on node %v has no fstab entry for %v",
+					brick.Info.Id, node.ManageHostName(), mp)
+			}
+			found = append(found, api.Discrepancy{
+				Type:        api.DiscrepancyBrickUnmounted,
+				Cluster:     cluster,
+				Node:        node.Info.Id,
+				Volume:      brick.Info.VolumeId,
+				Brick:       brick.Info.Id,
+				Path:        mp,
+				Description: desc,
+			})
+		}
+	}
+
+	if ndata.LVMLVInfo == nil {
+		return
+	}
+	for _, report := range ndata.LVMLVInfo.LVSReport {
+		for _, lv := range report.LVS {
+			if !vgs[lv.VGName] || strings.HasPrefix(lv.LVName, "[") {
+				continue
+			}
+			name := lv.VGName + "/" + lv.LVName
+			if usedLvs[name] {
+				continue
+			}
+			found = append(found, api.Discrepancy{
+				Type:    api.DiscrepancyOrphanedLv,
+				Cluster: cluster,
+				Node:    node.Info.Id,
+				Path:    name,
+				Description: fmt.Sprintf("logical volume %v on node %v is not used by any brick",
+					name, node.ManageHostName()),
+			})
+		}
+	}
+	return
+}
+
+// findDiscrepancies returns the typed differences between the heketi
+// db and the data collected from the nodes of a cluster.
+func findDiscrepancies(heketidb Db, cdata ClusterData) []api.Discrepancy {
+	found := findVolumeDiscrepancies(heketidb, cdata)
+	for _, ndata := range cdata.NodesData {
+		found = append(found,
+			findNodeDiscrepancies(heketidb, cdata.ClusterHeketiID, ndata)...)
+	}
+	return found
+}
+
 // ExamineGluster ... fetches information about resources heketi is managing
 // from the database and then queries information for each of those resources.
 // It matches the information from heketi and Gluster resources and reports any
@@ -158,9 +359,13 @@ func compareHeketiAndGluster(heketidb Db, cdata ClusterData) (errorstrings []str
 func (examiner Examiner) ExamineGluster() (response GlusterStateExaminationResponse, err error) {
 	logger.Debug("Examining Gluster")
 
-	if examiner.mode == OnDemandExaminer {
+	switch examiner.mode {
+	case OnDemandExaminer:
 		trackedOps := examiner.optracker.Get()
 		response.Report = append(response.Report, fmt.Sprintf("OnDemand Examiner invoked while %v ops are in flight", trackedOps))
+	case BackgroundExaminer:
+		trackedOps := examiner.optracker.Get()
+		response.Report = append(response.Report, fmt.Sprintf("Background Examiner invoked while %v ops are in flight", trackedOps))
 	}
 
 	// Fetch information from Heketi DB
@@ -189,6 +394,11 @@ func (examiner Examiner) ExamineGluster() (response GlusterStateExaminationRespo
 		if len(compareErrors) > 0 {
 			response.Report = append(response.Report, compareErrors...)
 		}
+
+		for _, d := range findDiscrepancies(response.HeketiDB, clusterdata) {
+			response.Discrepancies = append(response.Discrepancies, d)
+			response.Report = append(response.Report, d.Description)
+		}
 	}
 
 	return
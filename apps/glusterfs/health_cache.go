@@ -10,6 +10,8 @@
 package glusterfs
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +20,12 @@ import (
 
 	"github.com/heketi/heketi/executors"
 	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+const (
+	// number of health transitions kept per node
+	nodeHealthHistorySize = 10
 )
 
 var (
@@ -29,6 +37,20 @@ type NodeHealthStatus struct {
 	Host       string
 	Up         bool
 	LastUpdate time.Time
+
+	// State is down if glusterd is not running on the node and
+	// degraded if one of the other checks failed. Since is the
+	// time the node got its current state.
+	State   api.NodeHealthState
+	Since   time.Time
+	Checks  []api.NodeHealthCheck
+	History []api.NodeHealthTransition
+
+	clusterId string
+	// the manage and storage hostnames of the node
+	hostnames []string
+	// names of the failed checks, to record changes in the history
+	failed string
 }
 
 type NodeHealthCache struct {
@@ -37,6 +59,10 @@ type NodeHealthCache struct {
 	CheckInterval time.Duration
 	Expiration    time.Duration
 
+	// called, outside of the cache lock, when a node that was
+	// down or not yet known is found to be up
+	NodeUp func(nodeId string)
+
 	db    wdb.RODB
 	exec  executors.Executor
 	nodes map[string]*NodeHealthStatus
@@ -67,28 +93,88 @@ func (hc *NodeHealthCache) Status() map[string]bool {
 	return healthy
 }
 
+// Healthy returns a map of node ids to true if the node is up
+// and none of its health checks failed.
+func (hc *NodeHealthCache) Healthy() map[string]bool {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	healthy := map[string]bool{}
+	for k, v := range hc.nodes {
+		healthy[k] = v.State == api.NodeHealthUp
+	}
+	return healthy
+}
+
+// States returns the number of checked nodes in each health state.
+func (hc *NodeHealthCache) States() map[api.NodeHealthState]int {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	states := map[api.NodeHealthState]int{}
+	for _, v := range hc.nodes {
+		states[v.State]++
+	}
+	return states
+}
+
+// Health returns the health of the node, or false if the node has
+// not been checked.
+func (hc *NodeHealthCache) Health(nodeId string) (*api.NodeHealthResponse, bool) {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+	s, found := hc.nodes[nodeId]
+	if !found {
+		return nil, false
+	}
+	return &api.NodeHealthResponse{
+		NodeId:     s.NodeId,
+		Host:       s.Host,
+		State:      s.State,
+		Since:      s.Since,
+		LastUpdate: s.LastUpdate,
+		Checks:     append([]api.NodeHealthCheck{}, s.Checks...),
+		History:    append([]api.NodeHealthTransition{}, s.History...),
+	}, true
+}
+
 func (hc *NodeHealthCache) Refresh() error {
 	logger.Info("Starting Node Health Status refresh")
 	sl, err := hc.toProbe()
 	if err != nil {
 		return err
 	}
+	checks := hc.check(sl)
 	for _, s := range sl {
-		hc.updateNode(s)
+		if hc.updateNode(s, checks[s.NodeId]) && hc.NodeUp != nil {
+			hc.NodeUp(s.NodeId)
+		}
 	}
 	hc.cleanOld()
 	return nil
 }
 
-func (hc *NodeHealthCache) updateNode(s *NodeHealthStatus) {
+// updateNode records the results of the checks of the node and
+// returns true if the node has come up since the previous check.
+// A node health event is published when the health of a node is
+// first known or changes.
+func (hc *NodeHealthCache) updateNode(s *NodeHealthStatus,
+	checks []api.NodeHealthCheck) bool {
+
 	hc.lock.Lock()
 	defer hc.lock.Unlock()
-	if prev, found := hc.nodes[s.NodeId]; found {
+	prev, found := hc.nodes[s.NodeId]
+	if found {
+		prev.Host = s.Host
+		prev.clusterId = s.clusterId
+		prev.hostnames = s.hostnames
 		s = prev
 	} else {
 		hc.nodes[s.NodeId] = s
 	}
-	s.update(hc.exec)
+	wasUp := s.Up
+	if s.update(checks) || !found {
+		publishEvent(nodeHealthEvent(s))
+	}
+	return s.Up && !wasUp
 }
 
 func (hc *NodeHealthCache) cleanOld() {
@@ -159,9 +245,12 @@ func (hc *NodeHealthCache) toProbe() ([]*NodeHealthStatus, error) {
 				continue
 			}
 			nhs := &NodeHealthStatus{
-				NodeId: nodeId,
-				Host:   node.Info.Hostnames.Manage[0],
+				NodeId:    nodeId,
+				Host:      node.Info.Hostnames.Manage[0],
+				clusterId: node.Info.ClusterId,
 			}
+			nhs.hostnames = append(nhs.hostnames, node.Info.Hostnames.Manage...)
+			nhs.hostnames = append(nhs.hostnames, node.Info.Hostnames.Storage...)
 			probeNodes = append(probeNodes, nhs)
 		}
 		return nil
@@ -169,13 +258,222 @@ func (hc *NodeHealthCache) toProbe() ([]*NodeHealthStatus, error) {
 	return probeNodes, err
 }
 
-func (s *NodeHealthStatus) update(e executors.Executor) {
-	// TODO: add ability to skip check if node was already recently checked
-	err := e.GlusterdCheck(s.Host)
-	s.Up = (err == nil)
-	s.LastUpdate = healthNow()
-	logger.Info("Periodic health check status: node %v up=%v",
-		s.NodeId, s.Up)
+// check runs the health checks of the nodes and returns their
+// results by node id. Glusterd is checked first as the other checks
+// are only run on the nodes where it is running.
+func (hc *NodeHealthCache) check(sl []*NodeHealthStatus) map[string][]api.NodeHealthCheck {
+	results := map[string][]api.NodeHealthCheck{}
+	clusters := map[string][]*NodeHealthStatus{}
+	for _, s := range sl {
+		// TODO: add ability to skip check if node was already recently checked
+		if err := hc.exec.GlusterdCheck(s.Host); err != nil {
+			results[s.NodeId] = []api.NodeHealthCheck{
+				{Name: api.HealthCheckGlusterd, Status: api.HealthCheckFailed,
+					Message: err.Error()},
+				{Name: api.HealthCheckPeers, Status: api.HealthCheckUnknown},
+				{Name: api.HealthCheckBrickProcesses, Status: api.HealthCheckUnknown},
+				{Name: api.HealthCheckBrickMounts, Status: api.HealthCheckUnknown},
+			}
+			continue
+		}
+		clusters[s.clusterId] = append(clusters[s.clusterId], s)
+	}
+	for _, up := range clusters {
+		peers := hc.checkPeers(up)
+		bricks := hc.checkBrickProcesses(up)
+		for _, s := range up {
+			results[s.NodeId] = []api.NodeHealthCheck{
+				{Name: api.HealthCheckGlusterd, Status: api.HealthCheckOk},
+				peers[s.NodeId],
+				bricks[s.NodeId],
+				hc.checkBrickMounts(s),
+			}
+		}
+	}
+	return results
+}
+
+// checkPeers checks that the nodes are connected to the other nodes
+// of the cluster, as seen in the peer status of the other nodes.
+func (hc *NodeHealthCache) checkPeers(up []*NodeHealthStatus) map[string]api.NodeHealthCheck {
+	// hosts of the nodes seeing a node disconnected, by node id
+	disconnected := map[string][]string{}
+	seen := map[string]bool{}
+	for _, reporter := range up {
+		ps, err := hc.exec.PeerStatus(reporter.Host)
+		if err != nil {
+			logger.Warning("Unable to get peer status of %v: %v",
+				reporter.Host, err)
+			continue
+		}
+		for _, p := range ps.Peers {
+			s := nodeWithHostname(up, append([]string{p.Hostname}, p.Hostnames...))
+			if s == nil || s == reporter {
+				continue
+			}
+			seen[s.NodeId] = true
+			if p.Connected != 1 {
+				disconnected[s.NodeId] = append(disconnected[s.NodeId], reporter.Host)
+			}
+		}
+	}
+	checks := map[string]api.NodeHealthCheck{}
+	for _, s := range up {
+		c := api.NodeHealthCheck{Name: api.HealthCheckPeers}
+		switch {
+		case len(disconnected[s.NodeId]) > 0:
+			c.Status = api.HealthCheckFailed
+			c.Message = fmt.Sprintf("disconnected from %v",
+				strings.Join(disconnected[s.NodeId], ", "))
+		case seen[s.NodeId]:
+			c.Status = api.HealthCheckOk
+		default:
+			c.Status = api.HealthCheckUnknown
+		}
+		checks[s.NodeId] = c
+	}
+	return checks
+}
+
+// checkBrickProcesses checks that the processes of the bricks on the
+// nodes are running, as seen in the status of the started volumes.
+func (hc *NodeHealthCache) checkBrickProcesses(up []*NodeHealthStatus) map[string]api.NodeHealthCheck {
+	var (
+		vs  *executors.VolStatus
+		err error
+	)
+	for _, s := range up {
+		vs, err = hc.exec.VolumesStatus(s.Host)
+		if err == nil {
+			break
+		}
+		logger.Warning("Unable to get volume status from %v: %v", s.Host, err)
+	}
+	offline := map[string][]string{}
+	if vs != nil {
+		for _, v := range vs.Volumes {
+			for _, b := range v.Nodes {
+				// the paths of the daemons are not absolute
+				if !strings.HasPrefix(b.Path, "/") || b.Status == 1 {
+					continue
+				}
+				if s := nodeWithHostname(up, []string{b.Hostname}); s != nil {
+					offline[s.NodeId] = append(offline[s.NodeId],
+						v.VolumeName+":"+b.Path)
+				}
+			}
+		}
+	}
+	checks := map[string]api.NodeHealthCheck{}
+	for _, s := range up {
+		c := api.NodeHealthCheck{Name: api.HealthCheckBrickProcesses}
+		switch {
+		case vs == nil:
+			c.Status = api.HealthCheckUnknown
+		case len(offline[s.NodeId]) > 0:
+			c.Status = api.HealthCheckFailed
+			c.Message = fmt.Sprintf("bricks offline: %v",
+				strings.Join(offline[s.NodeId], ", "))
+		default:
+			c.Status = api.HealthCheckOk
+		}
+		checks[s.NodeId] = c
+	}
+	return checks
+}
+
+// checkBrickMounts checks that the bricks in the fstab of the node
+// are mounted.
+func (hc *NodeHealthCache) checkBrickMounts(s *NodeHealthStatus) api.NodeHealthCheck {
+	c := api.NodeHealthCheck{Name: api.HealthCheckBrickMounts}
+	mounts, err := hc.exec.GetBrickMountStatus(s.Host)
+	if err != nil {
+		c.Status = api.HealthCheckUnknown
+		c.Message = err.Error()
+		return c
+	}
+	unmounted := []string{}
+	for _, m := range mounts.Statuses {
+		vg, _, ok := lvFromDevicePath(m.Device)
+		if ok && strings.HasPrefix(vg, "vg_") && !m.Mounted {
+			unmounted = append(unmounted, m.MountPoint)
+		}
+	}
+	c.Status = api.HealthCheckOk
+	if len(unmounted) > 0 {
+		c.Status = api.HealthCheckFailed
+		c.Message = fmt.Sprintf("bricks not mounted: %v",
+			strings.Join(unmounted, ", "))
+	}
+	return c
+}
+
+// nodeWithHostname returns the node known by one of the hostnames.
+func nodeWithHostname(sl []*NodeHealthStatus, hostnames []string) *NodeHealthStatus {
+	for _, s := range sl {
+		for _, h := range s.hostnames {
+			for _, name := range hostnames {
+				if h == name {
+					return s
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// update records the results of the checks and returns true if the
+// state of the node changed.
+func (s *NodeHealthStatus) update(checks []api.NodeHealthCheck) bool {
+	now := healthNow()
+	prev := map[string]api.NodeHealthCheck{}
+	for _, c := range s.Checks {
+		prev[c.Name] = c
+	}
+	state := api.NodeHealthUp
+	failed := []string{}
+	reasons := []string{}
+	for i := range checks {
+		c := &checks[i]
+		c.Since = now
+		if p, ok := prev[c.Name]; ok && p.Status == c.Status {
+			c.Since = p.Since
+		}
+		if c.Status != api.HealthCheckFailed {
+			continue
+		}
+		failed = append(failed, c.Name)
+		reasons = append(reasons, c.Name+": "+c.Message)
+		if c.Name == api.HealthCheckGlusterd {
+			state = api.NodeHealthDown
+		} else if state == api.NodeHealthUp {
+			state = api.NodeHealthDegraded
+		}
+	}
+	sort.Strings(failed)
+
+	changed := state != s.State
+	if changed || strings.Join(failed, ",") != s.failed {
+		if changed {
+			s.Since = now
+		}
+		s.History = append(s.History, api.NodeHealthTransition{
+			Time:   now,
+			State:  state,
+			Reason: strings.Join(reasons, "; "),
+		})
+		if len(s.History) > nodeHealthHistorySize {
+			s.History = s.History[len(s.History)-nodeHealthHistorySize:]
+		}
+	}
+	s.State = state
+	s.Up = state != api.NodeHealthDown
+	s.Checks = checks
+	s.failed = strings.Join(failed, ",")
+	s.LastUpdate = now
+	logger.Info("Periodic health check status: node %v up=%v state=%v",
+		s.NodeId, s.Up, s.State)
+	return changed
 }
 
 func (s *NodeHealthStatus) old(hc *NodeHealthCache) bool {
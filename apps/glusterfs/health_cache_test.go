@@ -10,16 +10,23 @@
 package glusterfs
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
 	"github.com/heketi/tests"
 
+	"github.com/heketi/heketi/executors"
 	wdb "github.com/heketi/heketi/pkg/db"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/idgen"
 )
 
 func TestCreateNodeHeathCache(t *testing.T) {
@@ -341,3 +348,403 @@ func TestNodeHeathCacheExpireNodes(t *testing.T) {
 		tests.Assert(t, v)
 	}
 }
+
+func TestNodeHeathCacheNodeUp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app (I'm being lazy here. An app is not strictly
+	// needed but it is convenient.
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1, // clusters
+		3, // nodes_per_cluster
+		1, // devices_per_node,
+		6*TB,
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	down := false
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if down {
+			return fmt.Errorf("node down")
+		}
+		return nil
+	}
+
+	upCount := map[string]int{}
+	hc := NewNodeHealthCache(1, 0, app.db, app.executor)
+	hc.NodeUp = func(nodeId string) {
+		upCount[nodeId]++
+	}
+
+	// nodes not known before count as coming up
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(upCount) == 3, "expected len(upCount) == 3, got:", upCount)
+
+	// nodes that stay up are not reported again
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, c := range upCount {
+		tests.Assert(t, c == 1, "expected c == 1, got:", c)
+	}
+
+	down = true
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	down = false
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, c := range upCount {
+		tests.Assert(t, c == 2, "expected c == 2, got:", c)
+	}
+}
+
+func TestNodeHeathCacheEvents(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1, // clusters
+		3, // nodes_per_cluster
+		1, // devices_per_node,
+		6*TB,
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	down := false
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if down {
+			return fmt.Errorf("node down")
+		}
+		return nil
+	}
+	// health events published since the given token, by node
+	healthEvents := func(token string) (map[string]api.Event, string) {
+		events, next, _, _, err := eventLog.After(token)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		m := map[string]api.Event{}
+		for _, e := range events {
+			if e.Type == api.EventNodeHealthChanged {
+				m[e.ResourceId] = e
+			}
+		}
+		return m, next
+	}
+
+	_, token := healthEvents("")
+	hc := NewNodeHealthCache(1, 0, app.db, app.executor)
+
+	// the health of nodes not known before is published
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	events, token := healthEvents(token)
+	tests.Assert(t, len(events) == 3, "expected len(events) == 3, got:", events)
+	for _, e := range events {
+		tests.Assert(t, e.Details["up"] == "true", e)
+		tests.Assert(t, e.Details["host"] != "", e)
+	}
+
+	// unchanged health is not
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	events, token = healthEvents(token)
+	tests.Assert(t, len(events) == 0, "expected len(events) == 0, got:", events)
+
+	down = true
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	events, _ = healthEvents(token)
+	tests.Assert(t, len(events) == 3, "expected len(events) == 3, got:", events)
+	for _, e := range events {
+		tests.Assert(t, e.Details["up"] == "false", e)
+	}
+}
+
+func TestNodeHeathCacheChecks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	nowfunc := healthNow
+	defer func() { healthNow = nowfunc }()
+	currTime := time.Now()
+	healthNow = func() time.Time { return currTime }
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1, // clusters
+		3, // nodes_per_cluster
+		1, // devices_per_node,
+		6*TB,
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var nodes []*NodeEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		ids, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			n, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			nodes = append(nodes, n)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var (
+		glusterdDown = map[string]bool{}
+		disconnected = map[string]bool{}
+		brickOffline = map[string]bool{}
+		unmounted    = map[string]bool{}
+	)
+	app.xo.MockGlusterdCheck = func(host string) error {
+		if glusterdDown[host] {
+			return fmt.Errorf("glusterd down")
+		}
+		return nil
+	}
+	// the peers are known by their storage hostnames
+	app.xo.MockPeerStatus = func(host string) (*executors.PeerStatus, error) {
+		ps := &executors.PeerStatus{}
+		for _, n := range nodes {
+			if n.ManageHostName() == host {
+				continue
+			}
+			connected := 1
+			if disconnected[n.ManageHostName()] {
+				connected = 0
+			}
+			ps.Peers = append(ps.Peers, executors.Peer{
+				Hostname:  n.StorageHostName(),
+				Connected: connected,
+			})
+		}
+		return ps, nil
+	}
+	app.xo.MockVolumesStatus = func(host string) (*executors.VolStatus, error) {
+		v := executors.VolumeStatus{VolumeName: "vol_1"}
+		for _, n := range nodes {
+			status := 1
+			if brickOffline[n.ManageHostName()] {
+				status = 0
+			}
+			v.Nodes = append(v.Nodes, executors.BrickStatus{
+				Hostname: n.StorageHostName(),
+				Path:     "/var/lib/heketi/mounts/vg_1/brick_1/brick",
+				Status:   status,
+			}, executors.BrickStatus{
+				Hostname: "Self-heal Daemon",
+				Path:     n.StorageHostName(),
+			})
+		}
+		return &executors.VolStatus{Volumes: []executors.VolumeStatus{v}}, nil
+	}
+	app.xo.MockGetBrickMountStatus = func(host string) (*executors.BricksMountStatus, error) {
+		return &executors.BricksMountStatus{
+			Statuses: []executors.BrickMountStatus{
+				{
+					Device:     "/dev/mapper/rhel-root",
+					MountPoint: "/",
+					Mounted:    true,
+				},
+				{
+					Device:     "/dev/mapper/vg_1-brick_1",
+					MountPoint: "/var/lib/heketi/mounts/vg_1/brick_1",
+					Mounted:    !unmounted[host],
+				},
+			},
+		}, nil
+	}
+
+	hc := NewNodeHealthCache(1, 0, app.db, app.executor)
+	prevCache := currentNodeHealthCache
+	currentNodeHealthCache = hc
+	defer func() { currentNodeHealthCache = prevCache }()
+	start := currTime
+
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, n := range nodes {
+		h, found := hc.Health(n.Info.Id)
+		tests.Assert(t, found)
+		tests.Assert(t, h.State == api.NodeHealthUp, h)
+		tests.Assert(t, len(h.Checks) == 4, h.Checks)
+		for _, c := range h.Checks {
+			tests.Assert(t, c.Status == api.HealthCheckOk, c)
+		}
+		tests.Assert(t, len(h.History) == 1, h.History)
+	}
+	for _, healthy := range hc.Healthy() {
+		tests.Assert(t, healthy)
+	}
+
+	// a node with a brick not mounted is degraded and only gets
+	// bricks once the other nodes can not take them
+	currTime = currTime.Add(time.Minute)
+	unmounted[nodes[2].ManageHostName()] = true
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	h, _ := hc.Health(nodes[2].Info.Id)
+	tests.Assert(t, h.State == api.NodeHealthDegraded, h)
+	tests.Assert(t, h.Since.Equal(currTime), h.Since)
+	tests.Assert(t, h.Checks[0].Since.Equal(start), h.Checks[0])
+	c := h.Checks[3]
+	tests.Assert(t, c.Name == api.HealthCheckBrickMounts, c)
+	tests.Assert(t, c.Status == api.HealthCheckFailed, c)
+	tests.Assert(t, c.Since.Equal(currTime), c)
+	tests.Assert(t, strings.Contains(c.Message, "/var/lib/heketi/mounts/vg_1/brick_1"), c)
+	tests.Assert(t, len(h.History) == 2, h.History)
+	tests.Assert(t, h.History[1].State == api.NodeHealthDegraded, h.History)
+	tests.Assert(t, hc.Status()[nodes[2].Info.Id])
+	tests.Assert(t, !hc.Healthy()[nodes[2].Info.Id])
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		dsrc := NewClusterDeviceSource(tx, nodes[0].Info.ClusterId)
+		dl, err := dsrc.Devices()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(dl) == 3, "expected len(dl) == 3, got:", len(dl))
+		for _, dn := range dl {
+			tests.Assert(t, dn.Degraded == (dn.Node.Info.Id == nodes[2].Info.Id), dn)
+		}
+
+		devices, done, err := NewSimpleAllocator().GetNodesFromDeviceSource(
+			dsrc, idgen.GenUUID())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer close(done)
+		ids := []string{}
+		for id := range devices {
+			ids = append(ids, id)
+		}
+		tests.Assert(t, len(ids) == 3, ids)
+		tests.Assert(t, ids[2] == nodes[2].Devices[0], ids)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// peers and brick processes, seen from the other nodes
+	currTime = currTime.Add(time.Minute)
+	disconnected[nodes[1].ManageHostName()] = true
+	brickOffline[nodes[0].ManageHostName()] = true
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	h, _ = hc.Health(nodes[1].Info.Id)
+	tests.Assert(t, h.State == api.NodeHealthDegraded, h)
+	c = h.Checks[1]
+	tests.Assert(t, c.Name == api.HealthCheckPeers, c)
+	tests.Assert(t, c.Status == api.HealthCheckFailed, c)
+	tests.Assert(t, strings.Contains(c.Message, nodes[0].ManageHostName()), c)
+	tests.Assert(t, strings.Contains(c.Message, nodes[2].ManageHostName()), c)
+	h, _ = hc.Health(nodes[0].Info.Id)
+	tests.Assert(t, h.State == api.NodeHealthDegraded, h)
+	c = h.Checks[2]
+	tests.Assert(t, c.Name == api.HealthCheckBrickProcesses, c)
+	tests.Assert(t, c.Status == api.HealthCheckFailed, c)
+	tests.Assert(t, c.Message == "bricks offline: vol_1:/var/lib/heketi/mounts/vg_1/brick_1/brick", c)
+	// a new failed check is recorded even if the state is the same
+	unmounted[nodes[0].ManageHostName()] = true
+	currTime = currTime.Add(time.Minute)
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	h, _ = hc.Health(nodes[0].Info.Id)
+	tests.Assert(t, len(h.History) == 3, h.History)
+	tests.Assert(t, h.Since.Equal(start.Add(2*time.Minute)), h.Since)
+
+	// the other checks are not run without glusterd
+	glusterdDown[nodes[0].ManageHostName()] = true
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	h, _ = hc.Health(nodes[0].Info.Id)
+	tests.Assert(t, h.State == api.NodeHealthDown, h)
+	tests.Assert(t, h.Checks[0].Status == api.HealthCheckFailed, h.Checks)
+	for _, c := range h.Checks[1:] {
+		tests.Assert(t, c.Status == api.HealthCheckUnknown, c)
+	}
+	tests.Assert(t, !hc.Status()[nodes[0].Info.Id])
+	// no peer reports the nodes without glusterd
+	h, _ = hc.Health(nodes[1].Info.Id)
+	tests.Assert(t, strings.Contains(h.Checks[1].Message, nodes[2].ManageHostName()), h.Checks[1])
+	tests.Assert(t, !strings.Contains(h.Checks[1].Message, nodes[0].ManageHostName()), h.Checks[1])
+
+	// the history is bounded
+	for i := 0; i < nodeHealthHistorySize; i++ {
+		glusterdDown[nodes[0].ManageHostName()] = i%2 == 1
+		err = hc.Refresh()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	h, _ = hc.Health(nodes[0].Info.Id)
+	tests.Assert(t, len(h.History) == nodeHealthHistorySize, h.History)
+	tests.Assert(t, h.History[nodeHealthHistorySize-1].State == api.NodeHealthDown,
+		h.History)
+}
+
+func TestNodeHealthEndpoint(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	var nodeId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		ids, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		nodeId = ids[0]
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	getHealth := func(id string) (*api.NodeHealthResponse, int) {
+		r, err := http.Get(ts.URL + "/nodes/" + id + "/health")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			return nil, r.StatusCode
+		}
+		var h api.NodeHealthResponse
+		err = json.NewDecoder(r.Body).Decode(&h)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return &h, r.StatusCode
+	}
+
+	// not checked yet
+	h, status := getHealth(nodeId)
+	tests.Assert(t, status == http.StatusOK, status)
+	tests.Assert(t, h.State == api.NodeHealthUnknown, h)
+	tests.Assert(t, h.Host != "", h)
+
+	// the monitor is not started, the cache is not to be stopped
+	app.nhealth = NewNodeHealthCache(1, 0, app.db, app.executor)
+	defer func() { app.nhealth = nil }()
+	err = app.nhealth.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	h, status = getHealth(nodeId)
+	tests.Assert(t, status == http.StatusOK, status)
+	tests.Assert(t, h.NodeId == nodeId, h)
+	tests.Assert(t, h.State == api.NodeHealthUp, h)
+	tests.Assert(t, len(h.Checks) == 4, h.Checks)
+	tests.Assert(t, len(h.History) == 1, h.History)
+
+	_, status = getHealth("abc123")
+	tests.Assert(t, status == http.StatusNotFound, status)
+}
@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+const (
+	BOLTDB_BUCKET_OPERATION_HISTORY = "OPERATION_HISTORY"
+)
+
+// OperationHistoryEntry records an operation once it has completed
+// or failed. Entries are keyed by the time the operation finished
+// followed by the operation id, so keys sort in the order the
+// operations finished.
+type OperationHistoryEntry struct {
+	Key  string
+	Info api.OperationHistoryInfo
+}
+
+func NewOperationHistoryEntry() *OperationHistoryEntry {
+	return &OperationHistoryEntry{}
+}
+
+func NewOperationHistoryEntryFromKey(tx *bolt.Tx, key string) (*OperationHistoryEntry, error) {
+	entry := NewOperationHistoryEntry()
+	err := EntryLoad(tx, entry, key)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (oh *OperationHistoryEntry) BucketName() string {
+	return BOLTDB_BUCKET_OPERATION_HISTORY
+}
+
+func (oh *OperationHistoryEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(oh.Info.Id) > 0)
+
+	if oh.Key == "" {
+		oh.Key = fmt.Sprintf("%016x-%v",
+			oh.Info.Finished.UnixNano(), oh.Info.Id)
+	}
+	return EntrySave(tx, oh, oh.Key)
+}
+
+func (oh *OperationHistoryEntry) Delete(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+
+	return EntryDelete(tx, oh, oh.Key)
+}
+
+func (oh *OperationHistoryEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*oh)
+
+	return buffer.Bytes(), err
+}
+
+func (oh *OperationHistoryEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(oh)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Matches returns true if the entry is selected by the filter.
+func (oh *OperationHistoryEntry) Matches(f api.OperationHistoryFilter) bool {
+	info := &oh.Info
+	switch {
+	case f.TypeName != "" && f.TypeName != info.TypeName:
+		return false
+	case f.Status != "" && f.Status != info.Status:
+		return false
+	case f.Caller != "" && f.Caller != info.Caller:
+		return false
+	case f.Since != 0 && info.Finished.Unix() < f.Since:
+		return false
+	case f.Until != 0 && info.Finished.Unix() > f.Until:
+		return false
+	}
+	if f.Resource == "" {
+		return true
+	}
+	for _, r := range info.Resources {
+		if r.Id == f.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// OperationHistoryList returns the keys of the operation history
+// entries, oldest first.
+func OperationHistoryList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_OPERATION_HISTORY)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// OperationHistory returns the history entries selected by the
+// filter, most recent first.
+func OperationHistory(tx *bolt.Tx,
+	f api.OperationHistoryFilter) ([]api.OperationHistoryInfo, error) {
+
+	list, err := OperationHistoryList(tx)
+	if err != nil {
+		return nil, err
+	}
+	ops := []api.OperationHistoryInfo{}
+	for i := len(list) - 1; i >= 0; i-- {
+		if f.Limit > 0 && len(ops) >= f.Limit {
+			break
+		}
+		entry, err := NewOperationHistoryEntryFromKey(tx, list[i])
+		if err != nil {
+			return nil, err
+		}
+		if entry.Matches(f) {
+			ops = append(ops, entry.Info)
+		}
+	}
+	return ops, nil
+}
+
+// pruneOperationHistory deletes the oldest history entries so that at
+// most keep entries remain and, if maxAge is not zero, no entry is
+// older than maxAge.
+func pruneOperationHistory(tx *bolt.Tx, keep int, maxAge time.Duration) error {
+	list, err := OperationHistoryList(tx)
+	if err != nil {
+		return err
+	}
+	var cutoff string
+	if maxAge > 0 {
+		cutoff = fmt.Sprintf("%016x", time.Now().Add(-maxAge).UnixNano())
+	}
+	for len(list) > 0 && (len(list) > keep || list[0] < cutoff) {
+		entry := &OperationHistoryEntry{Key: list[0]}
+		if err := entry.Delete(tx); err != nil {
+			return err
+		}
+		list = list[1:]
+	}
+	return nil
+}
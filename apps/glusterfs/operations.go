@@ -14,6 +14,7 @@ import (
 
 	"github.com/heketi/heketi/executors"
 	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/logging"
 
 	"github.com/boltdb/bolt"
 )
@@ -128,6 +129,29 @@ func (n *noRetriesOperation) MaxRetries() int {
 type OperationManager struct {
 	db wdb.DB
 	op *PendingOperationEntry
+	// clusters and nodes touched by the operation
+	scope opScope
+	// claims the clusters and nodes touched by the operation, set
+	// once the operation is tracked
+	tracker *OpTracker
+	// set when the first build of the operation may complete while a
+	// cluster or node it touches is at its limit, so the built
+	// operation waits in the queue
+	scopeWait bool
+	// set when the operation was built while a cluster or node it
+	// touches was at its limit
+	scopeThrottled bool
+	// logs the lines of the operation with its ids, set once the
+	// operation runs
+	oplog *logging.Logger
+}
+
+// log returns the logger of the operation.
+func (om *OperationManager) log() *logging.Logger {
+	if om.oplog == nil {
+		return logger
+	}
+	return om.oplog
 }
 
 // Id returns the id of this operation's pending operation entry.
@@ -100,7 +100,7 @@ func (bvc *BlockVolumeCreateOperation) Build() error {
 				BlockHostingVolumeSize, bvc.bvol.Info.Size, reducedSize)
 		} else {
 			if found, err := hasPendingBlockHostingVolume(tx); found {
-				logger.Warning(
+				bvc.log().Warning(
 					"temporarily rejecting block volume request:" +
 						" pending block-hosting-volume found")
 				return ErrTooManyOperations
@@ -124,6 +124,9 @@ func (bvc *BlockVolumeCreateOperation) Build() error {
 				}
 			}
 			bvc.op.RecordAddHostingVolume(vol)
+			if e := bvc.touch(vol.Info.Cluster, brick_entries); e != nil {
+				return e
+			}
 			if e := vol.Save(tx); e != nil {
 				return e
 			}
@@ -138,6 +141,9 @@ func (bvc *BlockVolumeCreateOperation) Build() error {
 		// we've figured out what block-volume, hosting volume, and bricks we
 		// will be using for the next phase of the operation, save our pending sate
 		bvc.op.RecordAddBlockVolume(bvc.bvol)
+		if e := bvc.touch(bvc.bvol.Info.Cluster, nil); e != nil {
+			return e
+		}
 		if e := bvc.bvol.Save(tx); e != nil {
 			return e
 		}
@@ -157,7 +163,7 @@ func (bvc *BlockVolumeCreateOperation) volAndBricks(db wdb.RODB) (
 	vol = nil
 	volume_entries, err := volumesFromOp(db, bvc.op)
 	if err != nil {
-		logger.LogError("Failed to get volumes from op: %v", err)
+		bvc.log().LogError("Failed to get volumes from op: %v", err)
 		return
 	}
 	// try to get gid now even though we haven't done any sanity checks
@@ -168,21 +174,21 @@ func (bvc *BlockVolumeCreateOperation) volAndBricks(db wdb.RODB) (
 	}
 	brick_entries, err = bricksFromOp(db, bvc.op, brickGid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		bvc.log().LogError("Failed to get bricks from op: %v", err)
 		return
 	}
 
 	if len(volume_entries) > 1 {
-		err = logger.LogError("Unexpected number of new volume entries (%v)",
+		err = bvc.log().LogError("Unexpected number of new volume entries (%v)",
 			len(volume_entries))
 		return
 	}
 	if len(volume_entries) > 0 && len(brick_entries) == 0 {
-		err = logger.LogError("Cannot create a new block hosting volume without bricks")
+		err = bvc.log().LogError("Cannot create a new block hosting volume without bricks")
 		return
 	}
 	if len(volume_entries) == 0 && len(brick_entries) > 0 {
-		err = logger.LogError("Cannot create bricks without a hosting volume")
+		err = bvc.log().LogError("Cannot create bricks without a hosting volume")
 		return
 	}
 
@@ -202,7 +208,7 @@ func (bvc *BlockVolumeCreateOperation) Exec(executor executors.Executor) error {
 	if vol != nil {
 		err = vol.createVolumeExec(bvc.db, executor, brick_entries)
 		if err != nil {
-			logger.LogError("Error executing create volume: %v", err)
+			bvc.log().LogError("Error executing create volume: %v", err)
 			return err
 		}
 	}
@@ -212,7 +218,7 @@ func (bvc *BlockVolumeCreateOperation) Exec(executor executors.Executor) error {
 	// resumeable if we ever add resume support to normal volume create.
 	err = bvc.bvol.createBlockVolume(bvc.db, executor, bvc.bvol.Info.BlockHostingVolume)
 	if err != nil {
-		logger.LogError("Error executing create block volume: %v", err)
+		bvc.log().LogError("Error executing create block volume: %v", err)
 	}
 	return err
 }
@@ -266,7 +272,7 @@ func (bvc *BlockVolumeCreateOperation) Rollback(executor executors.Executor) err
 }
 
 func (bvc *BlockVolumeCreateOperation) Clean(executor executors.Executor) error {
-	logger.Info("Starting Clean for %v op:%v", bvc.Label(), bvc.op.Id)
+	bvc.log().Info("Starting Clean for %v op:%v", bvc.Label(), bvc.op.Id)
 	var (
 		err error
 		bv  *BlockVolumeEntry
@@ -280,7 +286,7 @@ func (bvc *BlockVolumeCreateOperation) Clean(executor executors.Executor) error
 		// mapping of bricks to clean up, only used if hv is non-nil
 		bmap brickHostMap
 	)
-	logger.Info("preparing to remove block volume %v in op:%v",
+	bvc.log().Info("preparing to remove block volume %v in op:%v",
 		bvc.bvol.Info.Id, bvc.op.Id)
 	err = bvc.db.View(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
@@ -314,12 +320,12 @@ func (bvc *BlockVolumeCreateOperation) Clean(executor executors.Executor) error
 		return nil
 	})
 	if err != nil {
-		logger.LogError(
+		bvc.log().LogError(
 			"failed to get state needed to destroy block volume: %v", err)
 		return err
 	}
 	// nothing past this point needs a db reference
-	logger.Info("executing removal of block volume %v in op:%v",
+	bvc.log().Info("executing removal of block volume %v in op:%v",
 		bvc.bvol.Info.Id, bvc.op.Id)
 	err = newTryOnHosts(bvHosts).once().run(func(h string) error {
 		return bv.destroyFromHost(executor, hvname, h)
@@ -343,7 +349,7 @@ func (bvc *BlockVolumeCreateOperation) Clean(executor executors.Executor) error
 }
 
 func (bvc *BlockVolumeCreateOperation) CleanDone() error {
-	logger.Info("Clean is done for %v op:%v", bvc.Label(), bvc.op.Id)
+	bvc.log().Info("Clean is done for %v op:%v", bvc.Label(), bvc.op.Id)
 	return bvc.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		bv, err := NewBlockVolumeEntryFromId(tx, bvc.bvol.Info.Id)
@@ -429,11 +435,14 @@ func (vdel *BlockVolumeDeleteOperation) Build() error {
 		}
 		vdel.bvol = v
 		if vdel.bvol.Pending.Id != "" {
-			logger.LogError("Pending block volume %v can not be deleted",
+			vdel.log().LogError("Pending block volume %v can not be deleted",
 				vdel.bvol.Info.Id)
 			return ErrConflict
 		}
 		vdel.op.RecordDeleteBlockVolume(vdel.bvol)
+		if e := vdel.touch(vdel.bvol.Info.Cluster, nil); e != nil {
+			return e
+		}
 		if e := vdel.op.Save(tx); e != nil {
 			return e
 		}
@@ -469,12 +478,12 @@ func (vdel *BlockVolumeDeleteOperation) Exec(executor executors.Executor) error
 		return nil
 	})
 	if err != nil {
-		logger.LogError(
+		vdel.log().LogError(
 			"failed to get state needed to destroy block volume: %v", err)
 		return err
 	}
 	// nothing past this point needs a db reference
-	logger.Info("executing removal of block volume %v in op:%v",
+	vdel.log().Info("executing removal of block volume %v in op:%v",
 		vdel.bvol.Info.Id, vdel.op.Id)
 	return newTryOnHosts(bvHosts).once().run(func(h string) error {
 		return bv.destroyFromHost(executor, hvname, h)
@@ -504,7 +513,7 @@ func (vdel *BlockVolumeDeleteOperation) Finalize() error {
 	return vdel.db.Update(func(tx *bolt.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		if e := vdel.bvol.removeComponents(txdb, false); e != nil {
-			logger.LogError("Failed to remove block volume from db")
+			vdel.log().LogError("Failed to remove block volume from db")
 			return e
 		}
 
@@ -516,13 +525,13 @@ func (vdel *BlockVolumeDeleteOperation) Finalize() error {
 func (vdel *BlockVolumeDeleteOperation) Clean(executor executors.Executor) error {
 	// for a delete, clean is essentially a replay of exec
 	// because exec must be robust against restarts now we can just call Exec
-	logger.Info("Starting Clean for %v op:%v", vdel.Label(), vdel.op.Id)
+	vdel.log().Info("Starting Clean for %v op:%v", vdel.Label(), vdel.op.Id)
 	return vdel.Exec(executor)
 }
 
 func (vdel *BlockVolumeDeleteOperation) CleanDone() error {
 	// for a delete, clean done is essentially a replay of finalize
-	logger.Info("Clean is done for %v op:%v", vdel.Label(), vdel.op.Id)
+	vdel.log().Info("Clean is done for %v op:%v", vdel.Label(), vdel.op.Id)
 	return vdel.Finalize()
 }
 
@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CancelableOperation is any operation that can be canceled while
+// it runs. A canceled operation stops at the next point where it
+// checks for cancellation, fails with ErrOperationCanceled and is
+// then rolled back.
+type CancelableOperation interface {
+	Operation
+
+	// Cancel requests that the operation stop. It does not wait
+	// for the operation to stop.
+	Cancel()
+}
+
+// operationCanceler keeps the operations that are currently running
+// and can be canceled, keyed by the id of the pending operation.
+// Some operations are started deep within other requests (device
+// remove from a device state change) so, like the operation
+// history, the running operations are kept globally and not per
+// http request.
+type operationCanceler struct {
+	lock sync.Mutex
+	ops  map[string]CancelableOperation
+}
+
+var runningOperations = &operationCanceler{
+	ops: map[string]CancelableOperation{},
+}
+
+func (oc *operationCanceler) add(op CancelableOperation) {
+	oc.lock.Lock()
+	defer oc.lock.Unlock()
+	oc.ops[op.Id()] = op
+}
+
+func (oc *operationCanceler) remove(op CancelableOperation) {
+	oc.lock.Lock()
+	defer oc.lock.Unlock()
+	delete(oc.ops, op.Id())
+}
+
+// Cancel requests the running operation with the given id to stop.
+// It returns false if no such operation is running or the operation
+// can not be canceled.
+func (oc *operationCanceler) Cancel(id string) bool {
+	oc.lock.Lock()
+	defer oc.lock.Unlock()
+	op, ok := oc.ops[id]
+	if !ok {
+		return false
+	}
+	logger.Info("Canceling operation %v: %v", op.Label(), id)
+	op.Cancel()
+	return true
+}
+
+// trackCancelable registers the operation as running if it can be
+// canceled and returns a function to unregister it.
+func trackCancelable(o Operation) func() {
+	co, ok := o.(CancelableOperation)
+	if !ok {
+		return func() {}
+	}
+	runningOperations.add(co)
+	return func() {
+		runningOperations.remove(co)
+	}
+}
+
+// cancelFlag is embedded in operations that support being canceled.
+type cancelFlag struct {
+	canceled int32
+}
+
+// Cancel marks the operation as canceled.
+func (cf *cancelFlag) Cancel() {
+	atomic.StoreInt32(&cf.canceled, 1)
+}
+
+// checkCanceled returns ErrOperationCanceled if the operation was
+// canceled and nil otherwise.
+func (cf *cancelFlag) checkCanceled() error {
+	if atomic.LoadInt32(&cf.canceled) != 0 {
+		return ErrOperationCanceled
+	}
+	return nil
+}
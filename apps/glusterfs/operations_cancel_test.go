@@ -0,0 +1,215 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+func TestVolumeCreateCanceled(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vc := NewVolumeCreateOperation(NewVolumeEntryFromRequest(req), app.db)
+
+	// cancel the operation while the bricks are created
+	var once sync.Once
+	brickCreate := app.xo.MockBrickCreate
+	app.xo.MockBrickCreate = func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		once.Do(func() {
+			tests.Assert(t, runningOperations.Cancel(vc.Id()))
+		})
+		return brickCreate(host, brick)
+	}
+	volumeCreated := false
+	app.xo.MockVolumeCreate = func(host string, volume *executors.VolumeRequest) (*executors.Volume, error) {
+		volumeCreated = true
+		return &executors.Volume{}, nil
+	}
+
+	err = RunOperation(vc, app.executor)
+	tests.Assert(t, err == ErrOperationCanceled, "expected ErrOperationCanceled, got:", err)
+	tests.Assert(t, !volumeCreated, "volume created after cancel")
+	tests.Assert(t, !runningOperations.Cancel(vc.Id()), "operation still running")
+
+	// the operation was rolled back
+	err = app.db.View(func(tx *bolt.Tx) error {
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got:", len(vl))
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(bl) == 0, "expected len(bl) == 0, got:", len(bl))
+		pl, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pl) == 0, "expected len(pl) == 0, got:", len(pl))
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	ops := listOperationHistory(t, app, api.OperationHistoryFilter{})
+	tests.Assert(t, len(ops) == 1, ops)
+	tests.Assert(t, ops[0].Status == api.OperationFailed, ops[0])
+	tests.Assert(t, ops[0].Error == ErrOperationCanceled.Error(), ops[0].Error)
+	names := phaseNames(ops[0])
+	tests.Assert(t, len(names) == 3, names)
+	tests.Assert(t, names[1] == "exec" && names[2] == "rollback", names)
+}
+
+func TestDeviceRemoveCanceled(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	err := setupSampleDbWithTopology(app, 1, 3, 3, 8*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	for i := 0; i < 6; i++ {
+		v := NewVolumeEntryFromRequest(vreq)
+		err = v.Create(app.db, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	// grab the device with the most bricks
+	var d *DeviceEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range dl {
+			e, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if d == nil || len(e.Bricks) > len(d.Bricks) {
+				d = e
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	bricks := len(d.Bricks)
+	tests.Assert(t, bricks >= 2, "expected at least two bricks, got:", bricks)
+
+	err = d.SetState(app.db, app.executor, api.EntryStateOffline)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	// cancel the operation while the first brick is replaced
+	dro := NewDeviceRemoveOperation(d.Info.Id, app.db)
+	replaced := 0
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		replaced++
+		tests.Assert(t, runningOperations.Cancel(dro.Id()))
+		return nil
+	}
+
+	err = RunOperation(dro, app.executor)
+	tests.Assert(t, err == ErrOperationCanceled, "expected ErrOperationCanceled, got:", err)
+	tests.Assert(t, replaced == 1, "expected replaced == 1, got:", replaced)
+
+	// the replaced brick stays replaced, the others are kept and
+	// the device is not marked failed
+	err = app.db.View(func(tx *bolt.Tx) error {
+		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
+		if err != nil {
+			return err
+		}
+		pl, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pl) == 0, "expected len(pl) == 0, got:", len(pl))
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(d.Bricks) == bricks-1,
+		"expected len(d.Bricks) == bricks-1, got:", len(d.Bricks), bricks)
+	tests.Assert(t, d.State == api.EntryStateOffline, d.State)
+}
+
+func TestPendingOperationCancelEndpoint(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	cancel := func(id string) int {
+		req, err := http.NewRequest("DELETE", ts.URL+"/operations/pending/"+id, nil)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r, err := http.DefaultClient.Do(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		return r.StatusCode
+	}
+
+	// no such operation
+	code := cancel("abc123")
+	tests.Assert(t, code == http.StatusNotFound, code)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vc := NewVolumeCreateOperation(NewVolumeEntryFromRequest(req), app.db)
+	err = vc.Build()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a pending operation that is not running
+	code = cancel(vc.Id())
+	tests.Assert(t, code == http.StatusConflict, code)
+
+	untrack := trackCancelable(vc)
+	code = cancel(vc.Id())
+	untrack()
+	tests.Assert(t, code == http.StatusAccepted, code)
+	tests.Assert(t, vc.checkCanceled() == ErrOperationCanceled)
+
+	err = vc.Rollback(app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -25,6 +25,7 @@ import (
 type DeviceRemoveOperation struct {
 	OperationManager
 	noRetriesOperation
+	cancelFlag
 	DeviceId string
 }
 
@@ -71,7 +72,7 @@ func (dro *DeviceRemoveOperation) Build() error {
 		if p, err := PendingOperationsOnDevice(txdb, d.Info.Id); err != nil {
 			return err
 		} else if p {
-			logger.LogError("Found operations still pending on device."+
+			dro.log().LogError("Found operations still pending on device."+
 				" Can not remove device %v at this time.",
 				d.Info.Id)
 			return ErrConflict
@@ -115,7 +116,7 @@ func (dro *DeviceRemoveOperation) Exec(executor executors.Executor) error {
 		return e
 	}
 
-	return d.removeBricksFromDevice(dro.db, executor)
+	return d.removeBricksFromDevice(dro.db, executor, dro.checkCanceled)
 }
 
 func (dro *DeviceRemoveOperation) Rollback(executor executors.Executor) error {
@@ -0,0 +1,265 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/boltdb/bolt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/context"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/middleware"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/logging"
+	"github.com/heketi/heketi/pkg/metrics"
+	"github.com/heketi/heketi/pkg/tracing"
+)
+
+const (
+	// caller of the operations heketi starts on its own
+	internalCaller = "heketi"
+
+	DEFAULT_OPERATION_HISTORY_ENTRIES = 1000
+)
+
+var (
+	// global vars for the retention of the operation history, set
+	// from the configuration when the app is created.
+	operationHistoryEntries = DEFAULT_OPERATION_HISTORY_ENTRIES
+	operationHistoryMaxAge  time.Duration
+)
+
+// managedOperation is an operation that tracks its changes with a
+// pending operation entry.
+type managedOperation interface {
+	Operation
+	manager() *OperationManager
+}
+
+func (om *OperationManager) manager() *OperationManager {
+	return om
+}
+
+// loggedExecutor is implemented by executors that can log the commands
+// they run with a given logger.
+type loggedExecutor interface {
+	Logged(l *logging.Logger) executors.Executor
+}
+
+// tracedExecutor is implemented by executors that can record the
+// commands they run as child spans of a given span.
+type tracedExecutor interface {
+	Traced(parent tracing.SpanContext) executors.Executor
+}
+
+// operationRecorder collects the phases of a running operation and
+// stores the operation in the operation history once it is done.
+// Operations without a pending operation entry are not recorded.
+// The operation and its phases are traced as children of the parent
+// span, if valid, and the commands run by recorded operations are
+// kept in their transcript.
+type operationRecorder struct {
+	op         Operation
+	db         wdb.DB
+	info       api.OperationHistoryInfo
+	transcript *transcriptRecorder
+
+	span      *tracing.Span
+	phaseSpan *tracing.Span
+
+	// logs the lines of the operation with its ids
+	log *logging.Logger
+}
+
+func newOperationRecorder(op Operation,
+	caller string, parent tracing.SpanContext) *operationRecorder {
+
+	r := &operationRecorder{op: op}
+	if mo, ok := op.(managedOperation); ok {
+		r.db = mo.manager().db
+		r.transcript = operationTranscripts.recorder(op.Id())
+	}
+	r.logWith(logging.Fields{logging.OperationIdKey: op.Id()})
+	r.info.Label = op.Label()
+	r.info.Caller = caller
+	r.info.Started = time.Now()
+	r.span = tracing.StartSpan(op.Label(), tracing.SpanKindInternal, parent)
+	r.span.SetAttribute("operation.id", op.Id())
+	r.span.SetAttribute("caller", caller)
+	return r
+}
+
+// phase runs f as the named phase of the operation.
+func (r *operationRecorder) phase(name string, f func() error) error {
+	r.phaseSpan = tracing.StartSpan(name,
+		tracing.SpanKindInternal, r.span.Context())
+	defer func() {
+		r.phaseSpan = nil
+	}()
+
+	p := api.OperationPhase{Name: name, Start: time.Now()}
+	err := f()
+	p.End = time.Now()
+	if err != nil {
+		p.Error = err.Error()
+	}
+	r.phaseSpan.SetError(err)
+	r.phaseSpan.End()
+	r.info.Phases = append(r.info.Phases, p)
+	r.snapshot()
+	metrics.ObserveOperationPhase(r.typeName(), name, p.End.Sub(p.Start))
+	return err
+}
+
+// logWith adds the fields to the lines logged for the operation, by
+// the recorder and by the operation itself.
+func (r *operationRecorder) logWith(f logging.Fields) {
+	if r.log == nil {
+		r.log = logger
+	}
+	r.log = r.log.WithFields(f)
+	if mo, ok := r.op.(managedOperation); ok {
+		mo.manager().oplog = r.log
+	}
+}
+
+// executor returns an executor that logs the commands it runs with the
+// ids of the operation, records them in the transcript of the
+// operation, if recorded, and as children of the span of the running
+// phase, if traced. Executors that support none of these are returned
+// as is.
+func (r *operationRecorder) executor(executor executors.Executor) executors.Executor {
+	if le, ok := executor.(loggedExecutor); ok {
+		executor = le.Logged(r.log)
+	}
+	if te, ok := executor.(transcribedExecutor); ok && r.transcript != nil {
+		executor = te.Transcribed(r.transcript)
+	}
+	if te, ok := executor.(tracedExecutor); ok && r.phaseSpan != nil {
+		executor = te.Traced(r.phaseSpan.Context())
+	}
+	return executor
+}
+
+// typeName returns the type of the operation, once known.
+func (r *operationRecorder) typeName() string {
+	if r.info.TypeName == "" {
+		return OperationUnknown.Name()
+	}
+	return r.info.TypeName
+}
+
+// snapshot copies the type and changes of the pending operation entry.
+// The entry is reset when the operation is finalized or rolled back so
+// the copy taken after an earlier phase is kept then.
+func (r *operationRecorder) snapshot() {
+	mo, ok := r.op.(managedOperation)
+	if !ok {
+		return
+	}
+	pop := mo.manager().op
+	if pop == nil || pop.Type == OperationUnknown {
+		return
+	}
+	r.info.TypeName = pop.Type.Name()
+	r.info.Resources = []api.OperationResource{}
+	for _, a := range pop.Actions {
+		r.info.Resources = append(r.info.Resources, api.OperationResource{
+			Id:          a.Id,
+			Description: a.Change.Name(),
+		})
+	}
+}
+
+// done records the duration of the operation and stores the operation
+// in the history. Failing to store the history is only logged.
+func (r *operationRecorder) done(err error) {
+	r.info.Id = r.op.Id()
+	r.info.Finished = time.Now()
+	r.info.Status = api.OperationSucceeded
+	if err != nil {
+		r.info.Status = api.OperationFailed
+		r.info.Error = err.Error()
+	}
+	r.info.TypeName = r.typeName()
+	metrics.ObserveOperation(r.info.TypeName, string(r.info.Status),
+		r.info.Finished.Sub(r.info.Started))
+	r.span.SetAttribute("operation.type", r.info.TypeName)
+	r.span.SetError(err)
+	r.span.End()
+	r.publish(err)
+	if r.db == nil {
+		return
+	}
+
+	entry := NewOperationHistoryEntry()
+	entry.Info = r.info
+	uerr := r.db.Update(func(tx *bolt.Tx) error {
+		if err := entry.Save(tx); err != nil {
+			return err
+		}
+		return pruneOperationHistory(tx,
+			operationHistoryEntries, operationHistoryMaxAge)
+	})
+	if uerr != nil {
+		r.log.LogError("Unable to save history of operation %v: %v",
+			r.info.Id, uerr)
+	}
+}
+
+// built returns true if the last build of the operation succeeded.
+func (r *operationRecorder) built() bool {
+	for i := len(r.info.Phases) - 1; i >= 0; i-- {
+		if r.info.Phases[i].Name == "build" {
+			return r.info.Phases[i].Error == ""
+		}
+	}
+	return false
+}
+
+// publish publishes the events of the operation once it is done.
+func (r *operationRecorder) publish(err error) {
+	if err != nil {
+		e := operationEvent(api.EventOperationFailed,
+			r.op, r.info.TypeName, r.built())
+		e.Details["error"] = err.Error()
+		publishEvent(e)
+		return
+	}
+	for _, e := range volumeEvents(r.op) {
+		publishEvent(e)
+	}
+	for _, e := range brickEvents(r.op) {
+		publishEvent(e)
+	}
+	publishEvent(operationEvent(api.EventOperationFinished,
+		r.op, r.info.TypeName, true))
+}
+
+// requestCaller returns the caller of a request: the issuer of the
+// JWT token if the request was authenticated and the remote host
+// otherwise.
+func requestCaller(r *http.Request) string {
+	if token, ok := context.Get(r, "jwt").(*jwt.Token); ok {
+		if claims, ok := token.Claims.(*middleware.HeketiJwtClaims); ok {
+			return claims.Issuer
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,316 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/tracing"
+)
+
+func createTestVolume(t *testing.T, app *App) (*VolumeEntry, error) {
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	vol := NewVolumeEntryFromRequest(req)
+	return vol, RunOperation(NewVolumeCreateOperation(vol, app.db), app.executor)
+}
+
+func listOperationHistory(t *testing.T,
+	app *App, f api.OperationHistoryFilter) []api.OperationHistoryInfo {
+
+	var ops []api.OperationHistoryInfo
+	err := app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ops, err = OperationHistory(tx, f)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return ops
+}
+
+func phaseNames(info api.OperationHistoryInfo) []string {
+	names := []string{}
+	for _, p := range info.Phases {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestOperationHistoryRecorded(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vol, err := createTestVolume(t, app)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeCreate = func(host string, volume *executors.VolumeRequest) (*executors.Volume, error) {
+		return nil, fmt.Errorf("volume create failed")
+	}
+	_, err = createTestVolume(t, app)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	ops := listOperationHistory(t, app, api.OperationHistoryFilter{})
+	tests.Assert(t, len(ops) == 2, ops)
+
+	// most recent first
+	failed, succeeded := ops[0], ops[1]
+	tests.Assert(t, succeeded.Status == api.OperationSucceeded, succeeded)
+	tests.Assert(t, succeeded.TypeName == "create-volume", succeeded.TypeName)
+	tests.Assert(t, succeeded.Label == "Create Volume", succeeded.Label)
+	tests.Assert(t, succeeded.Caller == internalCaller, succeeded.Caller)
+	tests.Assert(t, succeeded.Error == "", succeeded.Error)
+	names := phaseNames(succeeded)
+	tests.Assert(t, len(names) == 3, names)
+	tests.Assert(t, names[0] == "build" && names[1] == "exec" && names[2] == "finalize", names)
+	for _, p := range succeeded.Phases {
+		tests.Assert(t, !p.End.Before(p.Start), p)
+		tests.Assert(t, !p.Start.Before(succeeded.Started), p)
+		tests.Assert(t, !succeeded.Finished.Before(p.End), p)
+	}
+	found := false
+	for _, r := range succeeded.Resources {
+		found = found || r.Id == vol.Info.Id
+	}
+	tests.Assert(t, found, "volume not in resources", succeeded.Resources)
+	// the volume and its three bricks
+	tests.Assert(t, len(succeeded.Resources) == 4, succeeded.Resources)
+
+	tests.Assert(t, failed.Status == api.OperationFailed, failed)
+	tests.Assert(t, failed.Error != "", failed)
+	names = phaseNames(failed)
+	tests.Assert(t, names[0] == "build" && names[1] == "exec" && names[2] == "rollback", names)
+	tests.Assert(t, failed.Phases[1].Error != "", failed.Phases[1])
+
+	// filters
+	ops = listOperationHistory(t, app, api.OperationHistoryFilter{
+		Status: api.OperationSucceeded,
+	})
+	tests.Assert(t, len(ops) == 1 && ops[0].Id == succeeded.Id, ops)
+	ops = listOperationHistory(t, app, api.OperationHistoryFilter{
+		Resource: vol.Info.Id,
+	})
+	tests.Assert(t, len(ops) == 1 && ops[0].Id == succeeded.Id, ops)
+	ops = listOperationHistory(t, app, api.OperationHistoryFilter{Limit: 1})
+	tests.Assert(t, len(ops) == 1 && ops[0].Id == failed.Id, ops)
+	ops = listOperationHistory(t, app, api.OperationHistoryFilter{
+		TypeName: "delete-volume",
+	})
+	tests.Assert(t, len(ops) == 0, ops)
+	ops = listOperationHistory(t, app, api.OperationHistoryFilter{
+		Since: time.Now().Add(time.Hour).Unix(),
+	})
+	tests.Assert(t, len(ops) == 0, ops)
+}
+
+func TestOperationHistoryRetention(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	now := time.Now()
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		for i := 0; i < 6; i++ {
+			entry := NewOperationHistoryEntry()
+			entry.Info.Id = fmt.Sprintf("op%v", i)
+			entry.Info.Finished = now.Add(time.Duration(i-5) * time.Hour)
+			if err := entry.Save(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		return pruneOperationHistory(tx, 4, 0)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ops := listOperationHistory(t, app, api.OperationHistoryFilter{})
+	tests.Assert(t, len(ops) == 4, ops)
+	tests.Assert(t, ops[3].Id == "op2", ops)
+
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		return pruneOperationHistory(tx, 4, 90*time.Minute)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ops = listOperationHistory(t, app, api.OperationHistoryFilter{})
+	tests.Assert(t, len(ops) == 2, ops)
+	tests.Assert(t, ops[0].Id == "op5" && ops[1].Id == "op4", ops)
+}
+
+func TestOperationHistoryEndpoint(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for i := 0; i < 3; i++ {
+		_, err := createTestVolume(t, app)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	get := func(query string) (*http.Response, api.OperationHistoryResponse) {
+		var history api.OperationHistoryResponse
+		r, err := http.Get(ts.URL + "/operations/history" + query)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer r.Body.Close()
+		if r.StatusCode == http.StatusOK {
+			err = json.NewDecoder(r.Body).Decode(&history)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+		return r, history
+	}
+
+	r, history := get("")
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	tests.Assert(t, len(history.Operations) == 3, history.Operations)
+
+	q := api.OperationHistoryFilter{
+		TypeName: "create-volume",
+		Status:   api.OperationSucceeded,
+		Limit:    2,
+	}.Query().Encode()
+	r, history = get("?" + q)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	tests.Assert(t, len(history.Operations) == 2, history.Operations)
+
+	r, _ = get("?status=pending")
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+	r, _ = get("?limit=many")
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+}
+
+func TestRequestCaller(t *testing.T) {
+	r := httptest.NewRequest("GET", "/volumes", nil)
+	r.RemoteAddr = "192.0.2.10:40000"
+	tests.Assert(t, requestCaller(r) == "192.0.2.10", requestCaller(r))
+}
+
+func TestOperationTracing(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	var buf bytes.Buffer
+	tracing.SetExporter(tracing.NewJSONExporter(&buf, "test"))
+	defer tracing.SetExporter(nil)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	b, err := json.Marshal(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	hreq, err := http.NewRequest("POST", ts.URL+"/volumes", bytes.NewBuffer(b))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("traceparent", traceparent)
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	r, err := client.Do(hreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	location := r.Header.Get("Location")
+	for i := 0; ; i++ {
+		tests.Assert(t, i < 100, "operation did not complete")
+		r, err = client.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, r.StatusCode)
+
+	type span struct {
+		TraceId      string `json:"traceId"`
+		SpanId       string `json:"spanId"`
+		ParentSpanId string `json:"parentSpanId"`
+	}
+	spans := map[string]span{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []struct {
+						span
+						Name string `json:"name"`
+					} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		err := json.Unmarshal([]byte(line), &req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		s := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+		spans[s.Name] = s.span
+	}
+
+	// request -> operation -> phases, all in the trace of the caller
+	request, ok := spans["VolumeCreate"]
+	tests.Assert(t, ok, spans)
+	tests.Assert(t, request.TraceId == "4bf92f3577b34da6a3ce929d0e0e4736", request)
+	tests.Assert(t, request.ParentSpanId == "00f067aa0ba902b7", request)
+	op, ok := spans["Create Volume"]
+	tests.Assert(t, ok, spans)
+	tests.Assert(t, op.TraceId == request.TraceId, op)
+	tests.Assert(t, op.ParentSpanId == request.SpanId, op)
+	for _, phase := range []string{"build", "exec", "finalize"} {
+		p, ok := spans[phase]
+		tests.Assert(t, ok, "missing span", phase, spans)
+		tests.Assert(t, p.TraceId == request.TraceId, p)
+		tests.Assert(t, p.ParentSpanId == op.SpanId, p)
+	}
+}
@@ -0,0 +1,251 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// ScopedOperation is any operation that declares the clusters and
+// nodes it touches while it is built. The in-flight operations on a
+// single cluster or node can be limited for scoped operations. When a
+// limit is reached the built operation waits in the queue, or its
+// build fails with ErrTooManyOperations if queuing is disabled.
+type ScopedOperation interface {
+	Operation
+
+	// Scope returns the clusters and nodes touched by the operation.
+	// Only valid after Build.
+	Scope() (clusters []string, nodes []string)
+}
+
+// opScope is the set of clusters and nodes touched by an operation.
+type opScope struct {
+	clusters []string
+	nodes    []string
+}
+
+func appendUnique(list []string, id string) []string {
+	if id == "" {
+		return list
+	}
+	for _, s := range list {
+		if s == id {
+			return list
+		}
+	}
+	return append(list, id)
+}
+
+// touch declares that the operation touches the given cluster and
+// the nodes of the given bricks. Operations call touch in Build before
+// saving their pending operation entry. If the operation is tracked and
+// one of the clusters or nodes already has as many operations in-flight
+// as its limit, the built operation has to wait in the queue. If
+// queuing is disabled, or the operation is rebuilt for a retry, touch
+// returns ErrTooManyOperations instead and the build is expected to
+// fail without changing the db.
+func (om *OperationManager) touch(clusterId string, bricks []*BrickEntry) error {
+	clusters := appendUnique([]string{}, clusterId)
+	nodes := []string{}
+	for _, b := range bricks {
+		nodes = appendUnique(nodes, b.Info.NodeId)
+	}
+	for _, c := range clusters {
+		om.scope.clusters = appendUnique(om.scope.clusters, c)
+	}
+	for _, n := range nodes {
+		om.scope.nodes = appendUnique(om.scope.nodes, n)
+	}
+	if om.tracker == nil || om.scopeThrottled {
+		return nil
+	}
+	if om.tracker.ClaimOrThrottle(om.op.Id, clusters, nodes) {
+		if !om.scopeWait {
+			return ErrTooManyOperations
+		}
+		om.scopeThrottled = true
+	}
+	return nil
+}
+
+// Scope returns the clusters and nodes declared by the operation.
+func (om *OperationManager) Scope() ([]string, []string) {
+	return om.scope.clusters, om.scope.nodes
+}
+
+// trackScope makes the builds of the operation claim the clusters and
+// nodes they touch from the tracker.
+func trackScope(ot *OpTracker, o Operation) {
+	if mo, ok := o.(managedOperation); ok {
+		mo.manager().tracker = ot
+		mo.manager().scopeWait = ot.QueueSize > 0
+	}
+}
+
+// scopeThrottled returns true if the operation was built while one of
+// the clusters or nodes it touches was at its limit. Later builds of
+// the operation fail instead of waiting.
+func scopeThrottled(o Operation) bool {
+	mo, ok := o.(managedOperation)
+	if !ok {
+		return false
+	}
+	throttled := mo.manager().scopeThrottled
+	mo.manager().scopeWait = false
+	mo.manager().scopeThrottled = false
+	return throttled
+}
+
+// ClaimOrThrottle returns true if one of the clusters or nodes not yet
+// claimed by the operation already has as many operations in-flight as
+// the per cluster or per node limit, otherwise it records the tracked
+// operation against the clusters and nodes and returns false. The
+// operation is released from them when it is removed.
+func (ot *OpTracker) ClaimOrThrottle(id string, clusters, nodes []string) bool {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	godbc.Require(ot.normalOps[id] || ot.bgOps[id], "id not tracked", id)
+	claimed := ot.scopes[id]
+	clusters = notIn(clusters, claimed.clusters)
+	nodes = notIn(nodes, claimed.nodes)
+	if ot.ClusterLimit > 0 {
+		for _, c := range clusters {
+			if ot.clusterOps[c] >= ot.ClusterLimit {
+				logger.Warning(
+					"operations in-flight on cluster %v (%v) exceeds limit (%v)",
+					c, ot.clusterOps[c], ot.ClusterLimit)
+				ot.throttledOps++
+				return true
+			}
+		}
+	}
+	if ot.NodeLimit > 0 {
+		for _, n := range nodes {
+			if ot.nodeOps[n] >= ot.NodeLimit {
+				logger.Warning(
+					"operations in-flight on node %v (%v) exceeds limit (%v)",
+					n, ot.nodeOps[n], ot.NodeLimit)
+				ot.throttledOps++
+				return true
+			}
+		}
+	}
+	ot.claim(id, clusters, nodes)
+	return false
+}
+
+// claim records the operation against the clusters and nodes.
+// Must be called with the lock held.
+func (ot *OpTracker) claim(id string, clusters, nodes []string) {
+	claimed := ot.scopes[id]
+	for _, c := range clusters {
+		ot.clusterOps[c]++
+		claimed.clusters = append(claimed.clusters, c)
+	}
+	for _, n := range nodes {
+		ot.nodeOps[n]++
+		claimed.nodes = append(claimed.nodes, n)
+	}
+	ot.scopes[id] = claimed
+}
+
+// notIn returns the ids of list that are not in other.
+func notIn(list, other []string) []string {
+	out := []string{}
+	for _, id := range list {
+		found := false
+		for _, s := range other {
+			if s == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// scopeFull returns true if one of the clusters or nodes of the scope
+// has as many operations in-flight as its limit.
+// Must be called with the lock held.
+func (ot *OpTracker) scopeFull(s opScope) bool {
+	if ot.ClusterLimit > 0 {
+		for _, c := range s.clusters {
+			if ot.clusterOps[c] >= ot.ClusterLimit {
+				return true
+			}
+		}
+	}
+	if ot.NodeLimit > 0 {
+		for _, n := range s.nodes {
+			if ot.nodeOps[n] >= ot.NodeLimit {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// release removes the claims of the operation on clusters and nodes.
+// Must be called with the lock held.
+func (ot *OpTracker) release(id string) {
+	s, ok := ot.scopes[id]
+	if !ok {
+		return
+	}
+	for _, c := range s.clusters {
+		if ot.clusterOps[c]--; ot.clusterOps[c] == 0 {
+			delete(ot.clusterOps, c)
+		}
+	}
+	for _, n := range s.nodes {
+		if ot.nodeOps[n]--; ot.nodeOps[n] == 0 {
+			delete(ot.nodeOps, n)
+		}
+	}
+	delete(ot.scopes, id)
+}
+
+// Limits returns the limits on in-flight operations and the number of
+// operations in-flight on each cluster and node.
+func (ot *OpTracker) Limits() api.OperationLimits {
+	ot.lock.RLock()
+	defer ot.lock.RUnlock()
+	l := api.OperationLimits{
+		Max:             ot.Limit,
+		MaxPerCluster:   ot.ClusterLimit,
+		MaxPerNode:      ot.NodeLimit,
+		ClusterInFlight: map[string]uint64{},
+		NodeInFlight:    map[string]uint64{},
+	}
+	for c, n := range ot.clusterOps {
+		l.ClusterInFlight[c] = n
+	}
+	for node, n := range ot.nodeOps {
+		l.NodeInFlight[node] = n
+	}
+	return l
+}
+
+// OperationLimits returns the limits on in-flight operations.
+func (a *App) OperationLimits() api.OperationLimits {
+	return a.optracker.Limits()
+}
+
+// OperationCounts returns the number of operations in-flight, queued
+// and rejected.
+func (a *App) OperationCounts() (inFlight, queued, throttled uint64) {
+	return a.optracker.Counts()
+}
@@ -0,0 +1,276 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+func TestOpTrackerClaims(t *testing.T) {
+	ot := newOpTracker(10)
+	ot.ClusterLimit = 1
+	ot.NodeLimit = 2
+
+	ot.Add("a", TrackNormal)
+	tests.Assert(t, !ot.ClaimOrThrottle("a", []string{"c1"}, []string{"n1", "n2"}))
+	// claiming again is a no-op
+	tests.Assert(t, !ot.ClaimOrThrottle("a", []string{"c1"}, []string{"n1", "n2"}))
+
+	// cluster c1 is at its limit
+	ot.Add("b", TrackNormal)
+	tests.Assert(t, ot.ClaimOrThrottle("b", []string{"c1"}, []string{"n3"}))
+
+	ot.Add("c", TrackNormal)
+	tests.Assert(t, !ot.ClaimOrThrottle("c", []string{"c2"}, []string{"n1"}))
+
+	// node n1 is at its limit
+	ot.Add("d", TrackNormal)
+	tests.Assert(t, ot.ClaimOrThrottle("d", []string{"c3"}, []string{"n1"}))
+
+	inFlight, queued, throttled := ot.Counts()
+	tests.Assert(t, inFlight == 4 && queued == 0 && throttled == 2,
+		inFlight, queued, throttled)
+
+	l := ot.Limits()
+	tests.Assert(t, l.Max == 10 && l.MaxPerCluster == 1 && l.MaxPerNode == 2, l)
+	tests.Assert(t, len(l.ClusterInFlight) == 2, l.ClusterInFlight)
+	tests.Assert(t, l.ClusterInFlight["c1"] == 1, l.ClusterInFlight)
+	tests.Assert(t, l.NodeInFlight["n1"] == 2, l.NodeInFlight)
+	tests.Assert(t, l.NodeInFlight["n2"] == 1, l.NodeInFlight)
+
+	ot.Remove("a")
+	tests.Assert(t, !ot.ClaimOrThrottle("b", []string{"c1"}, []string{"n3"}))
+	tests.Assert(t, !ot.ClaimOrThrottle("d", []string{"c3"}, []string{"n1"}))
+
+	ot.Remove("b")
+	ot.Remove("c")
+	ot.Remove("d")
+	l = ot.Limits()
+	tests.Assert(t, len(l.ClusterInFlight) == 0, l.ClusterInFlight)
+	tests.Assert(t, len(l.NodeInFlight) == 0, l.NodeInFlight)
+}
+
+func TestOpTrackerRequeue(t *testing.T) {
+	ot := newOpTracker(10)
+	ot.ClusterLimit = 1
+
+	ot.Add("a", TrackNormal)
+	tests.Assert(t, !ot.ClaimOrThrottle("a", []string{"c1"}, nil))
+
+	ot.Add("b", TrackNormal)
+	tests.Assert(t, ot.ClaimOrThrottle("b", []string{"c1"}, nil))
+	ready := ot.Requeue("b", PriorityUser, []string{"c1"}, nil)
+	tests.Assert(t, !isReady(ready))
+	// the built operation is still tracked but not in-flight
+	tests.Assert(t, ot.Tracked()["b"])
+	tests.Assert(t, ot.Queued() == 1, ot.Queued())
+	inFlight, _, _ := ot.Counts()
+	tests.Assert(t, inFlight == 1, inFlight)
+
+	// operations on other clusters are not held by it
+	queued, _, err := ot.QueueOrAdd("c", PriorityUser)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !queued)
+	tests.Assert(t, !ot.ThrottleOrAdd("d", TrackNormal))
+
+	// the operation claims the cluster as it leaves the queue
+	ot.Remove("a")
+	tests.Assert(t, isReady(ready))
+	tests.Assert(t, ot.Tracked()["b"])
+	tests.Assert(t, ot.Queued() == 0, ot.Queued())
+	tests.Assert(t, ot.Limits().ClusterInFlight["c1"] == 1, ot.Limits())
+
+	// a canceled built operation stays tracked until it is removed
+	ot.Add("e", TrackNormal)
+	tests.Assert(t, ot.ClaimOrThrottle("e", []string{"c1"}, nil))
+	ready = ot.Requeue("e", PriorityUser, []string{"c1"}, nil)
+	tests.Assert(t, ot.CancelQueued("e"))
+	tests.Assert(t, <-ready == ErrOperationCanceled)
+	tests.Assert(t, ot.Tracked()["e"])
+	ot.Remove("e")
+	tests.Assert(t, !ot.Tracked()["e"])
+}
+
+func TestVolumeCreateScope(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	err := setupSampleDbWithTopology(app, 2, 4, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vc := NewVolumeCreateOperation(NewVolumeEntryFromRequest(req), app.db)
+	err = vc.Build()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	clusters, nodes := vc.Scope()
+	tests.Assert(t, len(clusters) == 1, clusters)
+	tests.Assert(t, clusters[0] == vc.vol.Info.Cluster, clusters)
+	tests.Assert(t, len(nodes) == 3, nodes)
+
+	err = vc.Rollback(app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestAsyncHttpOperationClusterLimit(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		cl, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		clusterId = cl[0]
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// another operation is in-flight on the only cluster
+	app.optracker.ClusterLimit = 1
+	throttled, token := app.optracker.ThrottleOrToken()
+	tests.Assert(t, !throttled)
+	tests.Assert(t, !app.optracker.ClaimOrThrottle(token, []string{clusterId}, nil))
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	createVolume := func() *http.Response {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 10
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = 3
+		b, err := json.Marshal(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r, err := client.Post(ts.URL+"/volumes",
+			"application/json", bytes.NewBuffer(b))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		return r
+	}
+
+	destroyed := 0
+	mockBrickDestroy := app.xo.MockBrickDestroy
+	app.xo.MockBrickDestroy = func(host string,
+		brick *executors.BrickRequest) (bool, error) {
+		destroyed++
+		return mockBrickDestroy(host, brick)
+	}
+
+	r := createVolume()
+	tests.Assert(t, r.StatusCode == http.StatusTooManyRequests, r.StatusCode)
+	tests.Assert(t, app.optracker.Get() == 1, app.optracker.Get())
+	// nothing was created, so nothing was destroyed
+	tests.Assert(t, destroyed == 0, destroyed)
+
+	// the rejected operation left nothing in the db
+	err = app.db.View(func(tx *bolt.Tx) error {
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got:", len(vl))
+		bl, err := BrickList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(bl) == 0, "expected len(bl) == 0, got:", len(bl))
+		pl, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pl) == 0, "expected len(pl) == 0, got:", len(pl))
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.optracker.Remove(token)
+	r = createVolume()
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	location := r.Header.Get("Location")
+	for i := 0; ; i++ {
+		tests.Assert(t, i < 100, "operation did not complete")
+		r, err = client.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, r.StatusCode)
+	l := app.optracker.Limits()
+	tests.Assert(t, len(l.ClusterInFlight) == 0, l.ClusterInFlight)
+	tests.Assert(t, len(l.NodeInFlight) == 0, l.NodeInFlight)
+
+	// with queuing enabled the operation waits for the cluster
+	app.optracker.QueueSize = 1
+	throttled, token = app.optracker.ThrottleOrToken()
+	tests.Assert(t, !throttled)
+	tests.Assert(t, !app.optracker.ClaimOrThrottle(token, []string{clusterId}, nil))
+	r = createVolume()
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	location = r.Header.Get("Location")
+	r, err = client.Get(ts.URL + location)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	tests.Assert(t, r.Header.Get("X-Queue-Position") == "1",
+		r.Header.Get("X-Queue-Position"))
+	tests.Assert(t, app.optracker.Get() == 1, app.optracker.Get())
+	// the operation was built and waits with its pending operation
+	err = app.db.View(func(tx *bolt.Tx) error {
+		pl, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pl) == 1, "expected len(pl) == 1, got:", len(pl))
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.optracker.Remove(token)
+	for i := 0; ; i++ {
+		tests.Assert(t, i < 100, "operation did not complete")
+		r, err = client.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, r.StatusCode)
+	tests.Assert(t, app.optracker.Get() == 0, app.optracker.Get())
+	tests.Assert(t, destroyed == 0, destroyed)
+}
@@ -12,12 +12,17 @@ package glusterfs
 import (
 	"fmt"
 	"net/http"
+	"path"
 	"sync"
 
+	"github.com/gorilla/mux"
 	"github.com/lpabon/godbc"
 
 	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/idgen"
+	"github.com/heketi/heketi/pkg/logging"
+	"github.com/heketi/heketi/pkg/tracing"
 )
 
 type OpClass int
@@ -33,18 +38,43 @@ const (
 type OpTracker struct {
 	// configuration
 	Limit uint64
+	// maximum number of operations waiting for the number of
+	// in-flight operations to drop below the limit, zero disables
+	// queuing
+	QueueSize uint64
+	// maximum number of in-flight operations touching a single
+	// cluster or node, zero is unlimited
+	ClusterLimit uint64
+	NodeLimit    uint64
 
 	// internals
 	lock      sync.RWMutex
 	normalOps map[string]bool
 	bgOps     map[string]bool
+	queue     []*queuedOp
+	// ids of the async requests of the in-flight operations that
+	// were queued
+	handles map[string]string
+	// number of operations rejected
+	throttledOps uint64
+	// set while no operation may start, such as while the db is
+	// replaced
+	paused bool
+	// clusters and nodes claimed by operations
+	scopes     map[string]opScope
+	clusterOps map[string]uint64
+	nodeOps    map[string]uint64
 }
 
 func newOpTracker(limit uint64) *OpTracker {
 	return &OpTracker{
-		Limit:     limit,
-		normalOps: make(map[string]bool),
-		bgOps:     make(map[string]bool),
+		Limit:      limit,
+		normalOps:  make(map[string]bool),
+		bgOps:      make(map[string]bool),
+		handles:    make(map[string]string),
+		scopes:     make(map[string]opScope),
+		clusterOps: make(map[string]uint64),
+		nodeOps:    make(map[string]uint64),
 	}
 }
 
@@ -75,6 +105,9 @@ func (ot *OpTracker) Remove(id string) {
 	godbc.Require(ot.normalOps[id] || ot.bgOps[id], "id not tracked", id)
 	delete(ot.normalOps, id)
 	delete(ot.bgOps, id)
+	delete(ot.handles, id)
+	ot.release(id)
+	ot.dispatch()
 }
 
 // Get returns the number of operations currently tracked.
@@ -84,8 +117,17 @@ func (ot *OpTracker) Get() uint64 {
 	return uint64(len(ot.normalOps) + len(ot.bgOps))
 }
 
+// Counts returns the number of operations in-flight and queued and
+// the number of operations that were rejected.
+func (ot *OpTracker) Counts() (inFlight, queued, throttled uint64) {
+	ot.lock.RLock()
+	defer ot.lock.RUnlock()
+	return uint64(len(ot.normalOps) + len(ot.bgOps)),
+		uint64(len(ot.queue)), ot.throttledOps
+}
+
 // Tracked returns a mapping of tracked IDs to booleans.
-// Booleans are always true.
+// Booleans are always true. Queued operations are tracked as well.
 func (ot *OpTracker) Tracked() map[string]bool {
 	ot.lock.RLock()
 	defer ot.lock.RUnlock()
@@ -97,6 +139,9 @@ func (ot *OpTracker) Tracked() map[string]bool {
 	for k := range ot.bgOps {
 		out[k] = true
 	}
+	for _, qop := range ot.queue {
+		out[qop.id] = true
+	}
 	return out
 }
 
@@ -107,6 +152,21 @@ func (ot *OpTracker) Tracked() map[string]bool {
 func (ot *OpTracker) ThrottleOrAdd(id string, c OpClass) bool {
 	ot.lock.Lock()
 	defer ot.lock.Unlock()
+	if ot.throttled(c) {
+		ot.throttledOps++
+		return true
+	}
+	ot.insert(id, c)
+	return false
+}
+
+// throttled returns true if an operation of the given class can not
+// be added now. Must be called with the lock held.
+func (ot *OpTracker) throttled(c OpClass) bool {
+	if ot.paused {
+		logger.Warning("operations are paused")
+		return true
+	}
 	n := len(ot.normalOps)
 	b := len(ot.bgOps)
 	if c == TrackClean && b > 0 {
@@ -123,10 +183,37 @@ func (ot *OpTracker) ThrottleOrAdd(id string, c OpClass) bool {
 			"operations in-flight (%v) exceeds limit (%v)", n, ot.Limit)
 		return true
 	}
-	ot.insert(id, c)
+	// queued operations go first, unless they wait for a cluster
+	// or node to be below its limit
+	if ot.dispatchable() >= 0 {
+		logger.Warning(
+			"operations queued (%v), new operations wait", len(ot.queue))
+		return true
+	}
 	return false
 }
 
+// Pause stops new operations from being added, or queued, until Resume
+// is called. It returns false, and does not pause, if operations are
+// in-flight or queued. Pause exists to perform the check and set
+// atomically.
+func (ot *OpTracker) Pause() bool {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	if len(ot.normalOps)+len(ot.bgOps)+len(ot.queue) > 0 {
+		return false
+	}
+	ot.paused = true
+	return true
+}
+
+// Resume lets new operations be added again after Pause.
+func (ot *OpTracker) Resume() {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	ot.paused = false
+}
+
 // ThrottleOrToken exists for use cases where throttling is required
 // but a pre-existing unique identifier does not. It will return
 // true and an empty-string if the number of operations is over the limit,
@@ -141,53 +228,70 @@ func (ot *OpTracker) ThrottleOrToken() (bool, string) {
 }
 
 func runOperationAfterBuild(o Operation,
-	executor executors.Executor) (err error) {
+	executor executors.Executor,
+	rec *operationRecorder) (err error) {
 
 	label := o.Label()
 	max_tries := o.MaxRetries() + 1
 
+	untrack := trackCancelable(o)
+	defer untrack()
+
+	publishEvent(operationEvent(api.EventOperationStarted,
+		o, rec.typeName(), true))
+
 	for attempt := 1; ; attempt++ {
-		logger.Info("Trying %v (attempt #%v/%v)", label, attempt, max_tries)
+		rec.log.Info("Trying %v (attempt #%v/%v)", label, attempt, max_tries)
 
-		err = o.Exec(executor)
+		err = rec.phase("exec", func() error {
+			return o.Exec(rec.executor(executor))
+		})
 		if err == nil {
 			// success, exit
 			break
 		}
 
-		logger.LogError("%v Failed: %v", label, err)
+		rec.log.LogError("%v Failed: %v", label, err)
 
 		oerr, isRetryError := err.(OperationRetryError)
 		if isRetryError {
 			err = oerr.OriginalError
 		}
 
-		if rerr := o.Rollback(executor); rerr != nil {
-			logger.LogError("%v Rollback error: %v", label, rerr)
+		rerr := rec.phase("rollback", func() error {
+			return o.Rollback(rec.executor(executor))
+		})
+		if rerr != nil {
+			rec.log.LogError("%v Rollback error: %v", label, rerr)
 			markFailedIfSupported(o)
 			return err
 		}
 
 		if attempt >= max_tries {
-			logger.LogError("Max tries (%v) consumed", max_tries)
+			rec.log.LogError("Max tries (%v) consumed", max_tries)
+			return err
+		}
+
+		if err == ErrOperationCanceled {
+			rec.log.Info("%v canceled", label)
 			return err
 		}
 
 		if !isRetryError {
-			logger.LogError("Operation not retryable")
+			rec.log.LogError("Operation not retryable")
 			return err
 		}
 
-		logger.Info("Retrying %v", label)
+		rec.log.Info("Retrying %v", label)
 
-		if err := o.Build(); err != nil {
-			logger.LogError("%v Build Failed: %v", label, err)
+		if err := rec.phase("build", o.Build); err != nil {
+			rec.log.LogError("%v Build Failed: %v", label, err)
 			return err
 		}
 	}
 
 	// if we reach this, we have succeeded
-	return o.Finalize()
+	return rec.phase("finalize", o.Finalize)
 }
 
 // AsyncHttpOperation runs all the steps of an operation with the long-running
@@ -195,40 +299,157 @@ func runOperationAfterBuild(o Operation,
 // then it has started the async function and the caller should respond to the
 // client with success - otherwise an error object is returned. In the async
 // function the Exec and Finalize or Rollback steps of the operation will be
-// performed.
+// performed. If too many operations are in-flight and queuing is enabled the
+// operation is queued and the Build step is performed in the async function
+// as well, once the operation leaves the queue.
 func AsyncHttpOperation(app *App,
 	w http.ResponseWriter,
 	r *http.Request,
 	op Operation) error {
 
-	// check if the request needs to be rate limited
-	if app.optracker.ThrottleOrAdd(op.Id(), TrackNormal) {
-		return ErrTooManyOperations
+	resourceId := mux.Vars(r)["id"]
+	priority := requestPriority(r)
+
+	// check if the request needs to be rate limited or queued
+	queued, ready, err := app.optracker.QueueOrAdd(op.Id(), priority)
+	if err != nil {
+		return err
 	}
+	trackScope(app.optracker, op)
 
 	label := op.Label()
-	if err := op.Build(); err != nil {
-		logger.LogError("%v Build Failed: %v", label, err)
-		// creating the operation db data failed. this is no longer
-		// an in-flight operation
-		app.optracker.Remove(op.Id())
+	rec := newOperationRecorder(op, requestCaller(r),
+		tracing.RequestSpan(r).Context())
+	rec.logWith(logging.RequestFields(r))
+	rec.logWith(operationLogFields(op, resourceId, false))
+
+	// build builds the operation and, if one of the clusters or nodes
+	// it touches is at its limit, puts it back in the queue
+	build := func() (waiting bool, err error) {
+		if err := rec.phase("build", op.Build); err != nil {
+			rec.log.LogError("%v Build Failed: %v", label, err)
+			return false, err
+		}
+		rec.logWith(operationLogFields(op, resourceId, true))
+		if !scopeThrottled(op) {
+			return false, nil
+		}
+		clusters, nodes := op.(ScopedOperation).Scope()
+		ready = app.optracker.Requeue(op.Id(), priority, clusters, nodes)
+		return true, nil
+	}
+	// wait waits until the operation leaves the queue. A built
+	// operation that is canceled while queued is rolled back.
+	wait := func(built bool) error {
+		err := <-ready
+		if err == nil {
+			return nil
+		}
+		rec.log.Info("Queued async operation %v: %v", label, err)
+		if built {
+			rerr := rec.phase("rollback", func() error {
+				return op.Rollback(rec.executor(app.executor))
+			})
+			if rerr != nil {
+				rec.log.LogError("%v Rollback error: %v", label, rerr)
+				markFailedIfSupported(op)
+			}
+			app.optracker.Remove(op.Id())
+		}
 		return err
 	}
 
+	built, waiting := false, false
+	if !queued {
+		waiting, err = build()
+		if err != nil {
+			rec.done(err)
+			// creating the operation db data failed. this is no longer
+			// an in-flight operation
+			app.optracker.Remove(op.Id())
+			return err
+		}
+		if !waiting {
+			app.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+				// decrement the op counter once the operation is done
+				// either success or failure
+				defer app.optracker.Remove(op.Id())
+				rec.log.Info("Started async operation: %v", label)
+				err := runOperationAfterBuild(op, app.executor, rec)
+				rec.done(err)
+				if err != nil {
+					return "", err
+				}
+
+				return op.ResourceUrl(), nil
+			})
+			return nil
+		}
+		built = true
+	}
+
+	// the operation is built once it is no longer queued, so any
+	// failure to build is reported by the async request
 	app.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		// decrement the op counter once the operation is done
-		// either success or failure
+		if !built {
+			if err := wait(false); err != nil {
+				rec.done(err)
+				return "", err
+			}
+			rec.log.Info("Started queued async operation: %v", label)
+			var err error
+			waiting, err = build()
+			if err != nil {
+				rec.done(err)
+				app.optracker.Remove(op.Id())
+				return "", err
+			}
+		}
+		if waiting {
+			if err := wait(true); err != nil {
+				rec.done(err)
+				return "", err
+			}
+			rec.log.Info("Started async operation: %v", label)
+		}
 		defer app.optracker.Remove(op.Id())
-		logger.Info("Started async operation: %v", label)
-		if err := runOperationAfterBuild(op, app.executor); err != nil {
+		err := runOperationAfterBuild(op, app.executor, rec)
+		rec.done(err)
+		if err != nil {
 			return "", err
 		}
-
 		return op.ResourceUrl(), nil
 	})
+	app.optracker.SetQueueHandle(op.Id(), asyncHandle(w))
 	return nil
 }
 
+// operationLogFields returns the fields added to the lines logged while
+// the operation runs: the id of the operation and the id of the
+// resource it works on. Unless given, the resource id is only known
+// once the operation is built.
+func operationLogFields(op Operation,
+	resourceId string, built bool) logging.Fields {
+
+	f := logging.Fields{logging.OperationIdKey: op.Id()}
+	if resourceId == "" && built {
+		resourceId = operationResourceId(op)
+	}
+	if resourceId != "" {
+		f[logging.ResourceIdKey] = resourceId
+	}
+	return f
+}
+
+// operationResourceId returns the id of the resource a built operation
+// works on, if any.
+func operationResourceId(op Operation) string {
+	if u := op.ResourceUrl(); u != "" {
+		return path.Base(u)
+	}
+	return ""
+}
+
 // RunOperation performs all steps of an Operation and returns
 // an error if any of those steps fail. This function is meant to
 // make it easy to run an operation outside of the rest endpoints
@@ -237,19 +458,22 @@ func RunOperation(o Operation,
 	executor executors.Executor) (err error) {
 
 	label := o.Label()
+	rec := newOperationRecorder(o, internalCaller, tracing.SpanContext{})
 	defer func() {
 		if err != nil {
-			logger.LogError("Error in %v: %v", label, err)
+			rec.log.LogError("Error in %v: %v", label, err)
 		}
+		rec.done(err)
 	}()
 
-	logger.Info("Running %v", o.Label())
-	if err := o.Build(); err != nil {
-		logger.LogError("%v Build Failed: %v", label, err)
+	rec.log.Info("Running %v", o.Label())
+	if err := rec.phase("build", o.Build); err != nil {
+		rec.log.LogError("%v Build Failed: %v", label, err)
 		return err
 	}
+	rec.logWith(operationLogFields(o, "", true))
 
-	return runOperationAfterBuild(o, executor)
+	return runOperationAfterBuild(o, executor, rec)
 }
 
 // rollbackViaClean runs a CleanableOperation's clean methods as
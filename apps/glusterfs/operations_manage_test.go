@@ -10,11 +10,24 @@
 package glusterfs
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/heketi/tests"
 
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/mockexec"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/idgen"
+	"github.com/heketi/heketi/pkg/logging"
 )
 
 func TestOpTrackerCounts(t *testing.T) {
@@ -160,6 +173,28 @@ func TestOpTrackerGetTracked(t *testing.T) {
 	tests.Assert(t, r[b1])
 }
 
+func TestOpTrackerPause(t *testing.T) {
+	ot := newOpTracker(5)
+	ot.QueueSize = 5
+
+	ot.Add("a", TrackNormal)
+	tests.Assert(t, !ot.Pause())
+	tests.Assert(t, !ot.ThrottleOrAdd("b", TrackNormal))
+	ot.Remove("a")
+	ot.Remove("b")
+
+	tests.Assert(t, ot.Pause())
+	tests.Assert(t, ot.ThrottleOrAdd("c", TrackNormal))
+	tests.Assert(t, ot.ThrottleOrAdd("d", TrackClean))
+	_, _, err := ot.QueueOrAdd("e", PriorityUser)
+	tests.Assert(t, err == ErrTooManyOperations, err)
+	tests.Assert(t, ot.Get() == 0, ot.Get())
+	tests.Assert(t, ot.Queued() == 0, ot.Queued())
+
+	ot.Resume()
+	tests.Assert(t, !ot.ThrottleOrAdd("c", TrackNormal))
+}
+
 func TestOpTrackerAssertions(t *testing.T) {
 	ot := newOpTracker(5)
 	var (
@@ -207,3 +242,84 @@ func TestOpTrackerAssertions(t *testing.T) {
 	})
 	tests.Assert(t, ot.Get() == 3)
 }
+
+func TestOperationLogContext(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the operation logs the commands it runs with the fields of
+	// the executor it is given
+	xo := &loggedMockExecutor{MockExecutor: app.xo}
+	app.executor = xo
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	b, err := json.Marshal(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	hreq, err := http.NewRequest("POST", ts.URL+"/volumes", bytes.NewBuffer(b))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set(logging.RequestIdHeader, "req-1")
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	r, err := client.Do(hreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	tests.Assert(t, r.Header.Get(logging.RequestIdHeader) == "req-1")
+	location := r.Header.Get("Location")
+	for i := 0; ; i++ {
+		tests.Assert(t, i < 100, "operation did not complete")
+		r, err = client.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, r.StatusCode)
+	volumeId := path.Base(r.Header.Get("Location"))
+
+	hl := listOperationHistory(t, app, api.OperationHistoryFilter{})
+	tests.Assert(t, len(hl) == 1, hl)
+
+	xo.lock.Lock()
+	defer xo.lock.Unlock()
+	tests.Assert(t, len(xo.seen) > 0, xo.seen)
+	for _, f := range xo.seen {
+		tests.Assert(t, f[logging.RequestIdKey] == "req-1", f)
+		tests.Assert(t, f[logging.OperationIdKey] == hl[0].Id, f)
+		tests.Assert(t, f[logging.ResourceIdKey] == volumeId, f)
+	}
+}
+
+// loggedMockExecutor records the fields of the loggers it is asked to
+// log the commands with.
+type loggedMockExecutor struct {
+	*mockexec.MockExecutor
+	lock sync.Mutex
+	seen []logging.Fields
+}
+
+func (m *loggedMockExecutor) Logged(l *logging.Logger) executors.Executor {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.seen = append(m.seen, l.Fields())
+	return m
+}
@@ -0,0 +1,250 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/middleware"
+)
+
+type OpPriority int
+
+const (
+	// operations requested by the "user" JWT issuer
+	PriorityUser OpPriority = iota
+	// operations requested by the "admin" JWT issuer or, when
+	// authentication is disabled, by anyone
+	PriorityAdmin
+)
+
+// queuedOp is an operation waiting for the number of in-flight
+// operations to drop below the limit.
+type queuedOp struct {
+	id       string
+	priority OpPriority
+	// id of the async request that reports on the operation
+	handle string
+	// closed once the operation is in-flight, or given
+	// ErrOperationCanceled if the operation left the queue
+	ready chan error
+	// clusters and nodes touched by an operation that was built
+	// while one of them was at its limit. The operation waits until
+	// they are below their limits and claims them as it leaves.
+	scope opScope
+	// set for an operation that was built before it was queued
+	built bool
+}
+
+// QueueOrAdd adds the operation if the number of in-flight operations
+// is below the limit. Otherwise the operation is put at the end of
+// the queue of its priority and the returned channel is closed once
+// the operation has been added, or yields ErrOperationCanceled if the
+// operation was canceled instead. If the queue is full or not enabled,
+// or the tracker is paused, ErrTooManyOperations is returned.
+func (ot *OpTracker) QueueOrAdd(id string,
+	p OpPriority) (queued bool, ready <-chan error, err error) {
+
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	if !ot.throttled(TrackNormal) {
+		ot.insert(id, TrackNormal)
+		return false, nil, nil
+	}
+	if ot.paused || uint64(len(ot.queue)) >= ot.QueueSize {
+		ot.throttledOps++
+		logger.Warning(
+			"operations queued (%v) exceeds queue size (%v)",
+			len(ot.queue), ot.QueueSize)
+		return false, nil, ErrTooManyOperations
+	}
+	qop := &queuedOp{
+		id:       id,
+		priority: p,
+		ready:    make(chan error, 1),
+	}
+	ot.queue = append(ot.queue, qop)
+	logger.Info("Operation %v queued", id)
+	return true, qop.ready, nil
+}
+
+// Requeue puts an in-flight operation that was built while one of the
+// clusters or nodes it touches was at its limit back in the queue,
+// ahead of the other queued operations of its priority. The operation
+// leaves the queue once the clusters and nodes are below their limits.
+// Built operations in the queue are still tracked, so their pending
+// operation entries are not cleaned up. The size of the queue is not
+// checked, as the operation was already admitted.
+func (ot *OpTracker) Requeue(id string, p OpPriority,
+	clusters, nodes []string) (ready <-chan error) {
+
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	godbc.Require(ot.normalOps[id], "id not tracked", id)
+	qop := &queuedOp{
+		id:       id,
+		priority: p,
+		handle:   ot.handles[id],
+		ready:    make(chan error, 1),
+		scope:    opScope{clusters: clusters, nodes: nodes},
+		built:    true,
+	}
+	delete(ot.normalOps, id)
+	delete(ot.handles, id)
+	ot.release(id)
+	ot.queue = append([]*queuedOp{qop}, ot.queue...)
+	logger.Info("Operation %v queued until its clusters and nodes have room", id)
+	ot.dispatch()
+	return qop.ready
+}
+
+// SetQueueHandle associates the queued operation with the id of the
+// async request that reports on it.
+func (ot *OpTracker) SetQueueHandle(id, handle string) {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	for _, qop := range ot.queue {
+		if qop.id == id {
+			qop.handle = handle
+			return
+		}
+	}
+	// the operation may have left the queue already
+	if ot.normalOps[id] {
+		ot.handles[id] = handle
+	}
+}
+
+// CancelQueued removes the queued operation with the given id, or
+// reported on by the async request with the given id, from the queue.
+// It returns false if no such operation is queued. An operation that
+// was built before it was queued stays tracked until it is removed
+// once rolled back.
+func (ot *OpTracker) CancelQueued(id string) bool {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	for i, qop := range ot.queue {
+		if qop.id != id && qop.handle != id {
+			continue
+		}
+		ot.queue = append(ot.queue[:i], ot.queue[i+1:]...)
+		if qop.built {
+			// the operation is tracked while it is rolled back
+			ot.normalOps[qop.id] = true
+		}
+		qop.ready <- ErrOperationCanceled
+		logger.Info("Queued operation %v canceled", qop.id)
+		return true
+	}
+	return false
+}
+
+// QueuePosition returns the position, starting at one, of the queued
+// operation reported on by the async request with the given id.
+func (ot *OpTracker) QueuePosition(handle string) (int, bool) {
+	ot.lock.RLock()
+	defer ot.lock.RUnlock()
+	for i, qop := range ot.queue {
+		if qop.handle != handle {
+			continue
+		}
+		pos := 1
+		for j, other := range ot.queue {
+			if other.priority > qop.priority ||
+				(other.priority == qop.priority && j < i) {
+				pos++
+			}
+		}
+		return pos, true
+	}
+	return 0, false
+}
+
+// Queued returns the number of queued operations.
+func (ot *OpTracker) Queued() uint64 {
+	ot.lock.RLock()
+	defer ot.lock.RUnlock()
+	return uint64(len(ot.queue))
+}
+
+// dispatchable returns the index of the queued operation to start
+// next, the first of the highest priority whose clusters and nodes are
+// below their limits, or -1 if there is none.
+// Must be called with the lock held.
+func (ot *OpTracker) dispatchable() int {
+	next := -1
+	for i, qop := range ot.queue {
+		if ot.scopeFull(qop.scope) {
+			continue
+		}
+		if next < 0 || qop.priority > ot.queue[next].priority {
+			next = i
+		}
+	}
+	return next
+}
+
+// dispatch starts queued operations, highest priority first, while
+// the number of in-flight operations is below the limit.
+// Must be called with the lock held.
+func (ot *OpTracker) dispatch() {
+	for uint64(len(ot.normalOps)) < ot.Limit {
+		next := ot.dispatchable()
+		if next < 0 {
+			return
+		}
+		qop := ot.queue[next]
+		ot.queue = append(ot.queue[:next], ot.queue[next+1:]...)
+		godbc.Check(!ot.normalOps[qop.id], "id already tracked", qop.id)
+		ot.normalOps[qop.id] = true
+		if qop.handle != "" {
+			ot.handles[qop.id] = qop.handle
+		}
+		ot.claim(qop.id, qop.scope.clusters, qop.scope.nodes)
+		logger.Info("Starting queued operation %v", qop.id)
+		close(qop.ready)
+	}
+}
+
+// requestPriority returns the priority of the operations started by
+// the request.
+func requestPriority(r *http.Request) OpPriority {
+	if token, ok := context.Get(r, "jwt").(*jwt.Token); ok {
+		if claims, ok := token.Claims.(*middleware.HeketiJwtClaims); ok &&
+			claims.Issuer == "user" {
+			return PriorityUser
+		}
+	}
+	return PriorityAdmin
+}
+
+// asyncHandle returns the id of the async request the response
+// redirects to.
+func asyncHandle(w http.ResponseWriter) string {
+	return path.Base(w.Header().Get("Location"))
+}
+
+// AsyncStatus reports on an async request like the async manager
+// does, and adds the position in the queue of a queued operation
+// as the X-Queue-Position header.
+func (a *App) AsyncStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if pos, ok := a.optracker.QueuePosition(vars["id"]); ok {
+		w.Header().Set("X-Queue-Position", strconv.Itoa(pos))
+	}
+	a.asyncManager.HandlerStatus(w, r)
+}
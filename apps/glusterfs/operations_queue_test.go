@@ -0,0 +1,225 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+func isReady(c <-chan error) bool {
+	select {
+	case err := <-c:
+		return err == nil
+	default:
+		return false
+	}
+}
+
+func TestOpTrackerQueue(t *testing.T) {
+	ot := newOpTracker(1)
+
+	// queuing is disabled by default
+	queued, _, err := ot.QueueOrAdd("a", PriorityAdmin)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !queued)
+	_, _, err = ot.QueueOrAdd("b", PriorityAdmin)
+	tests.Assert(t, err == ErrTooManyOperations, "expected ErrTooManyOperations, got:", err)
+
+	ot.QueueSize = 2
+	queued, userReady, err := ot.QueueOrAdd("u1", PriorityUser)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, queued)
+	ot.SetQueueHandle("u1", "hu1")
+	queued, adminReady, err := ot.QueueOrAdd("a1", PriorityAdmin)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, queued)
+	ot.SetQueueHandle("a1", "ha1")
+	_, _, err = ot.QueueOrAdd("u2", PriorityUser)
+	tests.Assert(t, err == ErrTooManyOperations, "expected ErrTooManyOperations, got:", err)
+	tests.Assert(t, ot.Queued() == 2, ot.Queued())
+
+	// admin operations go first
+	pos, ok := ot.QueuePosition("ha1")
+	tests.Assert(t, ok && pos == 1, ok, pos)
+	pos, ok = ot.QueuePosition("hu1")
+	tests.Assert(t, ok && pos == 2, ok, pos)
+	_, ok = ot.QueuePosition("missing")
+	tests.Assert(t, !ok)
+
+	ot.Remove("a")
+	tests.Assert(t, isReady(adminReady))
+	tests.Assert(t, !isReady(userReady))
+	tests.Assert(t, ot.Get() == 1, ot.Get())
+	tests.Assert(t, ot.Tracked()["a1"])
+	pos, ok = ot.QueuePosition("hu1")
+	tests.Assert(t, ok && pos == 1, ok, pos)
+
+	// new operations do not overtake queued ones
+	ot.Limit = 2
+	tests.Assert(t, ot.ThrottleOrAdd("t", TrackNormal))
+
+	ot.Remove("a1")
+	tests.Assert(t, isReady(userReady))
+	tests.Assert(t, ot.Queued() == 0, ot.Queued())
+	tests.Assert(t, !ot.ThrottleOrAdd("t", TrackNormal))
+}
+
+func TestOpTrackerCancelQueued(t *testing.T) {
+	ot := newOpTracker(1)
+	ot.QueueSize = 2
+	ot.Add("a", TrackNormal)
+
+	_, ready1, err := ot.QueueOrAdd("q1", PriorityAdmin)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, ready2, err := ot.QueueOrAdd("q2", PriorityAdmin)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ot.SetQueueHandle("q2", "h2")
+
+	// by operation id or by async request id
+	tests.Assert(t, ot.CancelQueued("q1"))
+	tests.Assert(t, ot.CancelQueued("h2"))
+	tests.Assert(t, !ot.CancelQueued("q1"))
+	tests.Assert(t, !ot.CancelQueued("a"))
+	tests.Assert(t, ot.Queued() == 0, ot.Queued())
+	tests.Assert(t, <-ready1 == ErrOperationCanceled)
+	tests.Assert(t, <-ready2 == ErrOperationCanceled)
+
+	// canceled operations are not started
+	ot.Remove("a")
+	tests.Assert(t, ot.Get() == 0, ot.Get())
+}
+
+func TestAsyncHttpOperationQueued(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// fill the only slot
+	app.optracker.Limit = 1
+	app.optracker.QueueSize = 1
+	throttled, token := app.optracker.ThrottleOrToken()
+	tests.Assert(t, !throttled)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	createVolume := func() *http.Response {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 10
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = 3
+		b, err := json.Marshal(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r, err := client.Post(ts.URL+"/volumes",
+			"application/json", bytes.NewBuffer(b))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		return r
+	}
+
+	r := createVolume()
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	location := r.Header.Get("Location")
+	tests.Assert(t, location != "")
+
+	// the queue is full
+	r = createVolume()
+	tests.Assert(t, r.StatusCode == http.StatusTooManyRequests, r.StatusCode)
+
+	r, err = client.Get(ts.URL + location)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	tests.Assert(t, r.Header.Get("X-Pending") == "true")
+	tests.Assert(t, r.Header.Get("X-Queue-Position") == "1",
+		r.Header.Get("X-Queue-Position"))
+
+	// the queued operation is not built yet
+	countVolumes := func() int {
+		var vl []string
+		err := app.db.View(func(tx *bolt.Tx) error {
+			var err error
+			vl, err = VolumeList(tx)
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return len(vl)
+	}
+	tests.Assert(t, countVolumes() == 0)
+
+	app.optracker.Remove(token)
+	for i := 0; ; i++ {
+		tests.Assert(t, i < 100, "operation did not complete")
+		r, err = client.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, r.StatusCode)
+	tests.Assert(t, r.Header.Get("X-Queue-Position") == "")
+	tests.Assert(t, countVolumes() == 1)
+	tests.Assert(t, app.optracker.Get() == 0, app.optracker.Get())
+
+	// a queued operation is canceled by the id of its async request
+	throttled, token = app.optracker.ThrottleOrToken()
+	tests.Assert(t, !throttled)
+	r = createVolume()
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	location = r.Header.Get("Location")
+	req, err := http.NewRequest("DELETE",
+		ts.URL+"/operations/pending/"+path.Base(location), nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r, err = client.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, r.StatusCode)
+	for i := 0; ; i++ {
+		tests.Assert(t, i < 100, "operation did not complete")
+		r, err = client.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError, r.StatusCode)
+	tests.Assert(t, app.optracker.Queued() == 0, app.optracker.Queued())
+	app.optracker.Remove(token)
+	tests.Assert(t, app.optracker.Get() == 0, app.optracker.Get())
+	tests.Assert(t, countVolumes() == 1)
+}
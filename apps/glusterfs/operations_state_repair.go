@@ -0,0 +1,221 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/paths"
+)
+
+// StateRepairOperation implements the operation functions used to
+// apply a single fix proposed by a state repair.
+type StateRepairOperation struct {
+	OperationManager
+	noRetriesOperation
+
+	fix *api.StateRepairFix
+
+	// set in Build()
+	host string
+	// volume of the brick to remount, if any
+	volumeName string
+}
+
+// NewStateRepairOperation returns a new StateRepairOperation that
+// applies the given fix.
+func NewStateRepairOperation(
+	db wdb.DB, fix *api.StateRepairFix) *StateRepairOperation {
+
+	return &StateRepairOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		fix: fix,
+	}
+}
+
+func (sro *StateRepairOperation) Label() string {
+	return fmt.Sprintf("Repair State (%v)", sro.fix.Action)
+}
+
+func (sro *StateRepairOperation) ResourceUrl() string {
+	return ""
+}
+
+// Build checks that the item to fix is still in the state the fix
+// was planned for and records the operation in the db.
+func (sro *StateRepairOperation) Build() error {
+	d := sro.fix.Discrepancy
+	return sro.db.Update(func(tx *bolt.Tx) error {
+		var id string
+		switch sro.fix.Action {
+		case api.RepairMark, api.RepairUnmark:
+			v, err := NewVolumeEntryFromId(tx, d.Volume)
+			if err != nil {
+				return err
+			}
+			if v.Pending.Id != "" {
+				return fmt.Errorf("Volume %v has a pending operation",
+					v.Info.Id)
+			}
+			id = v.Info.Id
+		case api.RepairRemount, api.RepairRemoveLv:
+			node, err := NewNodeEntryFromId(tx, d.Node)
+			if err != nil {
+				return err
+			}
+			if sro.fix.Action == api.RepairRemoveLv {
+				if err := checkLvUnused(tx, node, d.Path); err != nil {
+					return err
+				}
+			}
+			if sro.fix.Action == api.RepairRemount && d.Volume != "" {
+				v, err := NewVolumeEntryFromId(tx, d.Volume)
+				if err != nil {
+					return err
+				}
+				sro.volumeName = v.Info.Name
+			}
+			sro.host = node.ManageHostName()
+			id = node.Info.Id
+		default:
+			return fmt.Errorf("Unsupported repair action: %v",
+				sro.fix.Action)
+		}
+		sro.op.RecordRepairState(id)
+		return sro.op.Save(tx)
+	})
+}
+
+// checkLvUnused returns an error if any brick on the node, including
+// bricks of pending operations, is stored on the given logical volume.
+func checkLvUnused(tx *bolt.Tx, node *NodeEntry, lv string) error {
+	for _, deviceId := range node.Devices {
+		device, err := NewDeviceEntryFromId(tx, deviceId)
+		if err != nil {
+			return err
+		}
+		vg := paths.VgIdToName(deviceId)
+		for _, brickId := range device.Bricks {
+			brick, err := NewBrickEntryFromId(tx, brickId)
+			if err != nil {
+				return err
+			}
+			if lv == vg+"/"+brick.LvName() || lv == vg+"/"+brick.TpName() {
+				return fmt.Errorf("Logical volume %v is used by brick %v",
+					lv, brick.Info.Id)
+			}
+		}
+	}
+	return nil
+}
+
+func (sro *StateRepairOperation) Exec(executor executors.Executor) error {
+	switch sro.fix.Action {
+	case api.RepairRemount:
+		err := executor.MountBrick(sro.host, sro.fix.Discrepancy.Path)
+		if err != nil || sro.volumeName == "" {
+			return err
+		}
+		// the process of a brick exits when its file system is
+		// missing and is only restarted by a forced start
+		return executor.VolumeStartForce(sro.host, sro.volumeName)
+	case api.RepairRemoveLv:
+		return sro.removeLv(executor)
+	}
+	return nil
+}
+
+// removeLv deletes the logical volume after checking on the node
+// that it is neither mounted nor a thin pool that is still in use.
+func (sro *StateRepairOperation) removeLv(executor executors.Executor) error {
+	name := sro.fix.Discrepancy.Path
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid logical volume name: %v", name)
+	}
+	vg, lv := parts[0], parts[1]
+
+	lvs, err := executor.LVS(sro.host)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, report := range lvs.LVSReport {
+		for _, l := range report.LVS {
+			if l.VGName != vg {
+				continue
+			}
+			if l.LVName == lv {
+				found = true
+			}
+			if l.PoolLV == lv {
+				return fmt.Errorf("Thin pool %v is used by %v/%v",
+					name, vg, l.LVName)
+			}
+		}
+	}
+	if !found {
+		sro.log().Info("Logical volume %v already removed from %v",
+			name, sro.host)
+		return nil
+	}
+
+	mounts, err := executor.GetBrickMountStatus(sro.host)
+	if err != nil {
+		return err
+	}
+	for _, s := range mounts.Statuses {
+		mvg, mlv, ok := lvFromDevicePath(s.Device)
+		if ok && s.Mounted && mvg == vg && mlv == lv {
+			return fmt.Errorf("Logical volume %v is mounted at %v",
+				name, s.MountPoint)
+		}
+	}
+
+	return executor.LVRemove(sro.host, name)
+}
+
+func (sro *StateRepairOperation) Rollback(executor executors.Executor) error {
+	return sro.db.Update(func(tx *bolt.Tx) error {
+		return sro.op.Delete(tx)
+	})
+}
+
+// Finalize records the mark on the volume, if any, and removes the
+// operation from the db.
+func (sro *StateRepairOperation) Finalize() error {
+	d := sro.fix.Discrepancy
+	return sro.db.Update(func(tx *bolt.Tx) error {
+		switch sro.fix.Action {
+		case api.RepairMark, api.RepairUnmark:
+			v, err := NewVolumeEntryFromId(tx, d.Volume)
+			if err != nil {
+				return err
+			}
+			v.Info.Discrepancy = ""
+			if sro.fix.Action == api.RepairMark {
+				v.Info.Discrepancy = d.Description
+			}
+			if err := v.Save(tx); err != nil {
+				return err
+			}
+		}
+		return sro.op.Delete(tx)
+	})
+}
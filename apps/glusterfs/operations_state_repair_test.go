@@ -0,0 +1,374 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/paths"
+)
+
+type testLv struct {
+	vg, name, pool string
+}
+
+// glusterStateMock reports the state of the heketi db as the state of
+// gluster. The fields can be changed to add discrepancies.
+type glusterStateMock struct {
+	volumes   map[string][]string
+	mounts    map[string][]executors.BrickMountStatus
+	lvs       map[string][]testLv
+	hostNodes map[string]string
+}
+
+func newGlusterStateMock(t *testing.T, app *App) *glusterStateMock {
+	m := &glusterStateMock{
+		volumes:   map[string][]string{},
+		mounts:    map[string][]executors.BrickMountStatus{},
+		lvs:       map[string][]testLv{},
+		hostNodes: map[string]string{},
+	}
+	err := app.db.View(func(tx *bolt.Tx) error {
+		bricks, err := BrickList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range bricks {
+			b, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			v, err := NewVolumeEntryFromId(tx, b.Info.VolumeId)
+			if err != nil {
+				return err
+			}
+			n, err := NewNodeEntryFromId(tx, b.Info.NodeId)
+			if err != nil {
+				return err
+			}
+			host := n.ManageHostName()
+			m.hostNodes[host] = n.Info.Id
+			vg := paths.VgIdToName(b.Info.DeviceId)
+			m.volumes[v.Info.Name] = append(m.volumes[v.Info.Name],
+				n.StorageHostName()+":"+b.Info.Path)
+			m.mounts[host] = append(m.mounts[host], executors.BrickMountStatus{
+				Device:     "/dev/mapper/" + vg + "-" + b.LvName(),
+				MountPoint: path.Dir(b.Info.Path),
+				Mounted:    true,
+			})
+			m.lvs[host] = append(m.lvs[host],
+				testLv{vg, b.LvName(), b.TpName()},
+				testLv{vg, b.TpName(), ""})
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumesInfo = func(host string) (*executors.VolInfo, error) {
+		vi := &executors.VolInfo{}
+		for name, bricks := range m.volumes {
+			v := executors.Volume{VolumeName: name}
+			for _, b := range bricks {
+				v.Bricks.BrickList = append(v.Bricks.BrickList,
+					executors.Brick{Name: b})
+			}
+			vi.Volumes.VolumeList = append(vi.Volumes.VolumeList, v)
+		}
+		return vi, nil
+	}
+	app.xo.MockGetBrickMountStatus = func(host string) (*executors.BricksMountStatus, error) {
+		return &executors.BricksMountStatus{Statuses: m.mounts[host]}, nil
+	}
+	app.xo.MockLVS = func(host string) (*executors.LVSCommandOutput, error) {
+		var lvs []map[string]string
+		for _, lv := range m.lvs[host] {
+			lvs = append(lvs, map[string]string{
+				"lv_name": lv.name,
+				"vg_name": lv.vg,
+				"pool_lv": lv.pool,
+			})
+		}
+		data, err := json.Marshal(map[string]interface{}{
+			"report": []interface{}{map[string]interface{}{"lv": lvs}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		out := &executors.LVSCommandOutput{}
+		err = json.Unmarshal(data, out)
+		return out, err
+	}
+	return m
+}
+
+func createStateTestVolume(t *testing.T, app *App, name string) *VolumeEntry {
+	req := &api.VolumeCreateRequest{}
+	req.Name = name
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	err := RunOperation(vc, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return vol
+}
+
+func setupStateTest(t *testing.T, app *App) (*glusterStateMock, []*VolumeEntry) {
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vols := []*VolumeEntry{
+		createStateTestVolume(t, app, "vol1"),
+		createStateTestVolume(t, app, "vol2"),
+	}
+	return newGlusterStateMock(t, app), vols
+}
+
+// firstHost returns a host of the mock, in a stable order.
+func (m *glusterStateMock) firstHost() string {
+	first := ""
+	for host := range m.mounts {
+		if first == "" || host < first {
+			first = host
+		}
+	}
+	return first
+}
+
+func countDiscrepancies(ds []api.Discrepancy) map[api.DiscrepancyType]int {
+	counts := map[api.DiscrepancyType]int{}
+	for _, d := range ds {
+		counts[d.Type]++
+	}
+	return counts
+}
+
+func TestExamineGlusterDiscrepancies(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	m, vols := setupStateTest(t, app)
+
+	response, err := app.OnDemandExaminer().ExamineGluster()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(response.Discrepancies) == 0, response.Discrepancies)
+
+	host := m.firstHost()
+	vg := m.lvs[host][0].vg
+	delete(m.volumes, "vol2")
+	m.volumes["vol1"] = m.volumes["vol1"][1:]
+	m.volumes["extra"] = []string{"foo:/bricks/extra/brick"}
+	m.mounts[host][0].Mounted = false
+	m.mounts[host] = m.mounts[host][:1]
+	m.lvs[host] = append(m.lvs[host],
+		testLv{"rhel", "root", ""},
+		testLv{vg, "[lvol0_pmspare]", ""},
+		testLv{vg, "brick_dead", "tp_dead"},
+		testLv{vg, "tp_dead", ""})
+
+	response, err = app.OnDemandExaminer().ExamineGluster()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	counts := countDiscrepancies(response.Discrepancies)
+	tests.Assert(t, len(counts) == 5, counts)
+	tests.Assert(t, counts[api.DiscrepancyVolumeMissing] == 1, counts)
+	tests.Assert(t, counts[api.DiscrepancyVolumeExtra] == 1, counts)
+	tests.Assert(t, counts[api.DiscrepancyBrickPathMismatch] == 1, counts)
+	tests.Assert(t, counts[api.DiscrepancyBrickUnmounted] == 2, counts)
+	tests.Assert(t, counts[api.DiscrepancyOrphanedLv] == 2, counts)
+
+	for _, d := range response.Discrepancies {
+		switch d.Type {
+		case api.DiscrepancyVolumeMissing:
+			tests.Assert(t, d.Volume == vols[1].Info.Id, d)
+			tests.Assert(t, d.VolumeName == "vol2", d)
+		case api.DiscrepancyVolumeExtra:
+			tests.Assert(t, d.VolumeName == "extra", d)
+		case api.DiscrepancyBrickPathMismatch:
+			tests.Assert(t, d.Volume == vols[0].Info.Id, d)
+		case api.DiscrepancyBrickUnmounted:
+			tests.Assert(t, d.Node == m.hostNodes[host], d)
+		case api.DiscrepancyOrphanedLv:
+			tests.Assert(t, d.Node == m.hostNodes[host], d)
+			tests.Assert(t, d.Path == vg+"/brick_dead" || d.Path == vg+"/tp_dead", d)
+		}
+	}
+}
+
+func TestStateRepair(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	m, vols := setupStateTest(t, app)
+
+	host := m.firstHost()
+	vg := m.lvs[host][0].vg
+	unmounted := m.mounts[host][0].MountPoint
+	vol2Bricks := m.volumes["vol2"]
+	delete(m.volumes, "vol2")
+	m.volumes["extra"] = []string{"foo:/bricks/extra/brick"}
+	m.mounts[host][0].Mounted = false
+	m.lvs[host] = append(m.lvs[host],
+		testLv{vg, "tp_dead", ""},
+		testLv{vg, "brick_dead", "tp_dead"},
+		testLv{vg, "brick_busy", ""})
+	m.mounts[host] = append(m.mounts[host], executors.BrickMountStatus{
+		Device:     "/dev/mapper/" + vg + "-brick_busy",
+		MountPoint: "/mnt/busy",
+		Mounted:    true,
+	})
+
+	var (
+		mounted []string
+		removed []string
+	)
+	app.xo.MockMountBrick = func(h string, mountPoint string) error {
+		tests.Assert(t, h == host, h)
+		mounted = append(mounted, mountPoint)
+		m.mounts[host][0].Mounted = true
+		return nil
+	}
+	app.xo.MockLVRemove = func(h string, lv string) error {
+		tests.Assert(t, h == host, h)
+		removed = append(removed, lv)
+		var lvs []testLv
+		for _, l := range m.lvs[host] {
+			if l.vg+"/"+l.name != lv {
+				lvs = append(lvs, l)
+			}
+		}
+		m.lvs[host] = lvs
+		return nil
+	}
+
+	actions := func(fixes []api.StateRepairFix) map[api.RepairAction]int {
+		counts := map[api.RepairAction]int{}
+		for _, fix := range fixes {
+			counts[fix.Action]++
+		}
+		return counts
+	}
+
+	// a dry run changes nothing
+	response, err := app.OnDemandRepairer().Repair(
+		&api.StateRepairRequest{DryRun: true})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(response.Fixes) == 6, response.Fixes)
+	counts := actions(response.Fixes)
+	tests.Assert(t, counts[api.RepairMark] == 1, counts)
+	tests.Assert(t, counts[api.RepairRemount] == 1, counts)
+	tests.Assert(t, counts[api.RepairRemoveLv] == 2, counts)
+	tests.Assert(t, counts[api.RepairNone] == 2, counts)
+	for _, fix := range response.Fixes {
+		tests.Assert(t, !fix.Applied, fix)
+		tests.Assert(t, fix.Operation == "", fix)
+	}
+	tests.Assert(t, len(mounted) == 0, mounted)
+	tests.Assert(t, len(removed) == 0, removed)
+
+	// the type filter limits the fixes
+	response, err = app.OnDemandRepairer().Repair(&api.StateRepairRequest{
+		DryRun: true,
+		Types:  []api.DiscrepancyType{api.DiscrepancyBrickUnmounted},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(response.Fixes) == 1, response.Fixes)
+	tests.Assert(t, response.Fixes[0].Action == api.RepairRemount)
+
+	response, err = app.OnDemandRepairer().Repair(&api.StateRepairRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for _, fix := range response.Fixes {
+		if fix.Action == api.RepairNone {
+			tests.Assert(t, !fix.Applied, fix)
+			continue
+		}
+		tests.Assert(t, fix.Applied, fix)
+		tests.Assert(t, fix.Error == "", fix)
+		tests.Assert(t, fix.Operation != "", fix)
+	}
+	tests.Assert(t, len(mounted) == 1, mounted)
+	tests.Assert(t, mounted[0] == unmounted, mounted)
+	// the thin pool is removed after the volume in it
+	tests.Assert(t, len(removed) == 2, removed)
+	tests.Assert(t, removed[0] == vg+"/brick_dead", removed)
+	tests.Assert(t, removed[1] == vg+"/tp_dead", removed)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, vols[1].Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, v.Info.Discrepancy != "", v.Info.Discrepancy)
+		v, err = NewVolumeEntryFromId(tx, vols[0].Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, v.Info.Discrepancy == "", v.Info.Discrepancy)
+		pol, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pol) == 0, pol)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// repeating the repair does not mark the volume again
+	response, err = app.OnDemandRepairer().Repair(&api.StateRepairRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	counts = actions(response.Fixes)
+	tests.Assert(t, len(counts) == 1, counts)
+	tests.Assert(t, counts[api.RepairNone] == 3, counts)
+
+	// once the volume is back the mark is cleared
+	m.volumes["vol2"] = vol2Bricks
+	delete(m.volumes, "extra")
+	m.lvs[host] = m.lvs[host][:len(m.lvs[host])-1]
+	m.mounts[host] = m.mounts[host][:len(m.mounts[host])-1]
+	response, err = app.OnDemandRepairer().Repair(&api.StateRepairRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(response.Fixes) == 1, response.Fixes)
+	tests.Assert(t, response.Fixes[0].Action == api.RepairUnmark)
+	tests.Assert(t, response.Fixes[0].Applied)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, vols[1].Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, v.Info.Discrepancy == "", v.Info.Discrepancy)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestStateRepairOperationsInFlight(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	app.optracker.Add("abc", TrackNormal)
+	_, err := app.OnDemandRepairer().Repair(&api.StateRepairRequest{})
+	tests.Assert(t, err == ErrOperationsInFlight, err)
+
+	// a dry run is allowed
+	_, err = app.OnDemandRepairer().Repair(
+		&api.StateRepairRequest{DryRun: true})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
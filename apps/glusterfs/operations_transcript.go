@@ -0,0 +1,194 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/cmdexec"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+)
+
+const (
+	DEFAULT_OPERATION_TRANSCRIPT_ENTRIES = 100
+	DEFAULT_OPERATION_TRANSCRIPT_BYTES   = 32 * 1024 * 1024
+
+	// bounds of the transcript of a single operation
+	transcriptMaxCommands = 500
+	transcriptMaxOutput   = 64 * 1024
+	transcriptMaxBytes    = 1024 * 1024
+)
+
+// transcribedExecutor is implemented by executors that can pass the
+// commands they run to a recorder.
+type transcribedExecutor interface {
+	Transcribed(r cmdexec.CommandRecorder) executors.Executor
+}
+
+// transcriptStore keeps the transcripts of the commands run by the
+// most recent operations. Transcripts are only kept in memory, the
+// oldest being dropped once the store holds too many transcripts or
+// too many bytes. Like the running operations, the store is global and
+// not per app.
+type transcriptStore struct {
+	lock        sync.Mutex
+	max         int
+	maxBytes    int
+	transcripts map[string]*api.OperationTranscript
+	// ids of the operations, oldest first
+	order []string
+	// bytes of each transcript and of all of them
+	sizes map[string]int
+	total int
+}
+
+var operationTranscripts = newTranscriptStore(
+	DEFAULT_OPERATION_TRANSCRIPT_ENTRIES,
+	DEFAULT_OPERATION_TRANSCRIPT_BYTES)
+
+func newTranscriptStore(max, maxBytes int) *transcriptStore {
+	return &transcriptStore{
+		max:         max,
+		maxBytes:    maxBytes,
+		transcripts: map[string]*api.OperationTranscript{},
+		sizes:       map[string]int{},
+	}
+}
+
+// SetMax sets the number of operations the store keeps transcripts of.
+func (s *transcriptStore) SetMax(max int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.max = max
+	s.prune()
+}
+
+// SetMaxBytes sets the number of bytes the store keeps for all of the
+// transcripts.
+func (s *transcriptStore) SetMaxBytes(maxBytes int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.maxBytes = maxBytes
+	s.prune()
+}
+
+func (s *transcriptStore) prune() {
+	for len(s.order) > s.max || s.total > s.maxBytes {
+		s.total -= s.sizes[s.order[0]]
+		delete(s.sizes, s.order[0])
+		delete(s.transcripts, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get returns a copy of the transcript of the operation with the
+// given id.
+func (s *transcriptStore) Get(id string) (*api.OperationTranscript, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t, ok := s.transcripts[id]
+	if !ok {
+		return nil, false
+	}
+	c := *t
+	c.Commands = append([]api.CommandTranscript{}, t.Commands...)
+	return &c, true
+}
+
+// recorder starts the transcript of the operation with the given id
+// and returns a recorder adding commands to it.
+func (s *transcriptStore) recorder(id string) *transcriptRecorder {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.transcripts[id]; !ok {
+		s.transcripts[id] = &api.OperationTranscript{
+			Id:       id,
+			Commands: []api.CommandTranscript{},
+		}
+		s.order = append(s.order, id)
+		s.prune()
+	}
+	return &transcriptRecorder{store: s, id: id}
+}
+
+// transcriptRecorder adds the commands it receives to the transcript
+// of an operation. Commands of operations already dropped from the
+// store are ignored. Once the transcript is over its bytes, the output
+// of the commands is left out.
+type transcriptRecorder struct {
+	store *transcriptStore
+	id    string
+}
+
+func (r *transcriptRecorder) RecordCommand(host, command string,
+	started time.Time, result rex.Result) {
+
+	c := api.CommandTranscript{
+		Host:       host,
+		Command:    command,
+		Completed:  result.Completed,
+		ExitStatus: result.ExitStatus,
+		Started:    started,
+		Finished:   started.Add(result.Duration),
+	}
+	var cut bool
+	c.Output, cut = truncateOutput(result.Output)
+	c.Truncated = c.Truncated || cut
+	c.ErrOutput, cut = truncateOutput(result.ErrOutput)
+	c.Truncated = c.Truncated || cut
+	if result.Err != nil {
+		c.Error = result.Err.Error()
+	}
+
+	s := r.store
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t, ok := s.transcripts[r.id]
+	if !ok {
+		return
+	}
+	limit := transcriptMaxBytes
+	if s.maxBytes < limit {
+		limit = s.maxBytes
+	}
+	size := commandSize(c)
+	if s.sizes[r.id]+size > limit {
+		c.Output, c.ErrOutput = "", ""
+		c.Truncated = true
+		size = commandSize(c)
+	}
+	if len(t.Commands) >= transcriptMaxCommands ||
+		s.sizes[r.id]+size > limit {
+		t.Dropped++
+		return
+	}
+	t.Commands = append(t.Commands, c)
+	s.sizes[r.id] += size
+	s.total += size
+	s.prune()
+}
+
+// commandSize returns the bytes a command takes in a transcript.
+func commandSize(c api.CommandTranscript) int {
+	return len(c.Host) + len(c.Command) + len(c.Output) +
+		len(c.ErrOutput) + len(c.Error)
+}
+
+// truncateOutput cuts the output of a command to its last bytes, where
+// the errors usually are.
+func truncateOutput(s string) (string, bool) {
+	if len(s) <= transcriptMaxOutput {
+		return s, false
+	}
+	return "..." + s[len(s)-transcriptMaxOutput:], true
+}
@@ -0,0 +1,197 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/cmdexec"
+	"github.com/heketi/heketi/executors/mockexec"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+)
+
+// transcribedMockExecutor records a failing gluster command for every
+// volume create, as a command executor would.
+type transcribedMockExecutor struct {
+	*mockexec.MockExecutor
+	recorder cmdexec.CommandRecorder
+}
+
+func (m *transcribedMockExecutor) Transcribed(
+	r cmdexec.CommandRecorder) executors.Executor {
+
+	return &transcribedMockExecutor{MockExecutor: m.MockExecutor, recorder: r}
+}
+
+func (m *transcribedMockExecutor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	r := rex.Result{
+		Completed:  true,
+		ExitStatus: 1,
+		ErrOutput:  "volume create: " + volume.Name + ": failed: brick busy",
+		Duration:   time.Millisecond,
+	}
+	if m.recorder != nil {
+		m.recorder.RecordCommand(host,
+			"gluster --mode=script volume create "+volume.Name,
+			time.Now(), r)
+	}
+	return nil, r
+}
+
+func TestTranscriptStore(t *testing.T) {
+	s := newTranscriptStore(2, DEFAULT_OPERATION_TRANSCRIPT_BYTES)
+	r1 := s.recorder("op1")
+	s.recorder("op2")
+	r1.RecordCommand("host1", "lvs", time.Now(), rex.Result{
+		Completed: true,
+		Output:    strings.Repeat("x", transcriptMaxOutput+10),
+	})
+
+	ot, ok := s.Get("op1")
+	tests.Assert(t, ok)
+	tests.Assert(t, len(ot.Commands) == 1, ot.Commands)
+	c := ot.Commands[0]
+	tests.Assert(t, c.Host == "host1" && c.Command == "lvs", c)
+	tests.Assert(t, c.Truncated)
+	tests.Assert(t, len(c.Output) == transcriptMaxOutput+3, len(c.Output))
+
+	// starting a transcript again keeps the commands
+	s.recorder("op1")
+	ot, _ = s.Get("op1")
+	tests.Assert(t, len(ot.Commands) == 1, ot.Commands)
+
+	// the oldest transcript is dropped
+	s.recorder("op3")
+	_, ok = s.Get("op1")
+	tests.Assert(t, !ok)
+	_, ok = s.Get("op3")
+	tests.Assert(t, ok)
+	// and the commands of its operation ignored
+	r1.RecordCommand("host1", "lvs", time.Now(), rex.Result{})
+	_, ok = s.Get("op1")
+	tests.Assert(t, !ok)
+
+	// commands over the limit are counted
+	r3 := s.recorder("op3")
+	for i := 0; i < transcriptMaxCommands+2; i++ {
+		r3.RecordCommand("host1", fmt.Sprintf("cmd%v", i),
+			time.Now(), rex.Result{Completed: true})
+	}
+	ot, _ = s.Get("op3")
+	tests.Assert(t, len(ot.Commands) == transcriptMaxCommands, len(ot.Commands))
+	tests.Assert(t, ot.Dropped == 2, ot.Dropped)
+
+	s.SetMax(1)
+	_, ok = s.Get("op2")
+	tests.Assert(t, !ok)
+	_, ok = s.Get("op3")
+	tests.Assert(t, ok)
+}
+
+func TestTranscriptStoreBytes(t *testing.T) {
+	s := newTranscriptStore(10, 3*transcriptMaxBytes)
+	output := rex.Result{
+		Completed: true,
+		Output:    strings.Repeat("x", transcriptMaxOutput),
+	}
+
+	// the output is left out once the transcript is over its bytes
+	r1 := s.recorder("op1")
+	n := transcriptMaxBytes / transcriptMaxOutput
+	for i := 0; i < n+2; i++ {
+		r1.RecordCommand("host1", "lvs", time.Now(), output)
+	}
+	ot, _ := s.Get("op1")
+	tests.Assert(t, len(ot.Commands) == n+2, len(ot.Commands))
+	tests.Assert(t, ot.Dropped == 0, ot.Dropped)
+	c := ot.Commands[n+1]
+	tests.Assert(t, c.Truncated && c.Output == "", c)
+	tests.Assert(t, s.sizes["op1"] <= transcriptMaxBytes, s.sizes["op1"])
+
+	// the oldest transcripts are dropped once the store is over its
+	// bytes
+	for _, id := range []string{"op2", "op3", "op4"} {
+		r := s.recorder(id)
+		for i := 0; i < n; i++ {
+			r.RecordCommand("host1", "lvs", time.Now(), output)
+		}
+	}
+	_, ok := s.Get("op1")
+	tests.Assert(t, !ok)
+	_, ok = s.Get("op4")
+	tests.Assert(t, ok)
+	tests.Assert(t, s.total <= 3*transcriptMaxBytes, s.total)
+
+	s.SetMaxBytes(transcriptMaxBytes)
+	tests.Assert(t, len(s.order) == 1, s.order)
+	tests.Assert(t, s.total <= transcriptMaxBytes, s.total)
+}
+
+func TestOperationTranscript(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	err = RunOperation(vc,
+		&transcribedMockExecutor{MockExecutor: app.xo})
+	tests.Assert(t, err != nil)
+
+	r, err := http.Get(ts.URL + "/operations/" + vc.Id() + "/transcript")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	var ot api.OperationTranscript
+	err = json.NewDecoder(r.Body).Decode(&ot)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, ot.Id == vc.Id(), ot.Id)
+	// the volume create is tried on other nodes and retried
+	tests.Assert(t, len(ot.Commands) > 1, ot.Commands)
+	for _, c := range ot.Commands {
+		tests.Assert(t, c.Host != "", c)
+		tests.Assert(t, c.Command == "gluster --mode=script volume create "+vol.Info.Name, c)
+		tests.Assert(t, c.Completed && c.ExitStatus == 1, c)
+		tests.Assert(t, strings.Contains(c.ErrOutput, "brick busy"), c)
+		tests.Assert(t, !c.Finished.Before(c.Started), c)
+	}
+
+	r, err = http.Get(ts.URL + "/operations/abc123/transcript")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, r.StatusCode)
+}
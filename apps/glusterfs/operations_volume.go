@@ -22,6 +22,7 @@ import (
 // create a new volume.
 type VolumeCreateOperation struct {
 	OperationManager
+	cancelFlag
 	vol        *VolumeEntry
 	maxRetries int
 	reclaimed  ReclaimMap // gets set by Clean() call
@@ -96,6 +97,9 @@ func (vc *VolumeCreateOperation) Build() error {
 			}
 		}
 		vc.op.RecordAddVolume(vc.vol)
+		if e := vc.touch(vc.vol.Info.Cluster, brick_entries); e != nil {
+			return e
+		}
 		if e := vc.vol.Save(tx); e != nil {
 			return e
 		}
@@ -107,15 +111,28 @@ func (vc *VolumeCreateOperation) Build() error {
 }
 
 // Exec creates new bricks and volume on the underlying glusterfs storage system.
+// If the operation is canceled it stops before creating the bricks or
+// before creating the volume.
 func (vc *VolumeCreateOperation) Exec(executor executors.Executor) error {
 	brick_entries, err := bricksFromOp(vc.db, vc.op, vc.vol.Info.Gid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		vc.log().LogError("Failed to get bricks from op: %v", err)
+		return err
+	}
+	if err := vc.checkCanceled(); err != nil {
 		return err
 	}
-	err = vc.vol.createVolumeExec(vc.db, executor, brick_entries)
+	err = CreateBricks(vc.db, executor, brick_entries)
 	if err != nil {
-		logger.LogError("Error executing create volume: %v", err)
+		vc.log().LogError("Error executing create volume: %v", err)
+		return OperationRetryError{err}
+	}
+	if err := vc.checkCanceled(); err != nil {
+		return err
+	}
+	err = vc.vol.createVolume(vc.db, executor, brick_entries)
+	if err != nil {
+		vc.log().LogError("Error executing create volume: %v", err)
 		return OperationRetryError{err}
 	}
 	return nil
@@ -126,7 +143,7 @@ func (vc *VolumeCreateOperation) Finalize() error {
 	return vc.db.Update(func(tx *bolt.Tx) error {
 		brick_entries, err := bricksFromOp(wdb.WrapTx(tx), vc.op, vc.vol.Info.Gid)
 		if err != nil {
-			logger.LogError("Failed to get bricks from op: %v", err)
+			vc.log().LogError("Failed to get bricks from op: %v", err)
 			return err
 		}
 		for _, brick := range brick_entries {
@@ -154,16 +171,16 @@ func (vc *VolumeCreateOperation) Rollback(executor executors.Executor) error {
 
 func (vc *VolumeCreateOperation) Clean(executor executors.Executor) error {
 	var err error
-	logger.Info("Starting Clean for %v op:%v", vc.Label(), vc.op.Id)
+	vc.log().Info("Starting Clean for %v op:%v", vc.Label(), vc.op.Id)
 	vc.reclaimed, err = removeVolumeWithOp(
 		vc.db, executor, vc.op, vc.vol.Info.Id)
 	return err
 }
 
 func (vc *VolumeCreateOperation) CleanDone() error {
-	logger.Info("Clean is done for %v op:%v", vc.Label(), vc.op.Id)
+	vc.log().Info("Clean is done for %v op:%v", vc.Label(), vc.op.Id)
 	if vc.reclaimed == nil || len(vc.reclaimed) == 0 {
-		return logger.LogError("brick reclaim map is empty (was Clean called?)")
+		return vc.log().LogError("brick reclaim map is empty (was Clean called?)")
 	}
 	var err error
 	// set in-memory copy of volume to match (torn down) db state
@@ -248,6 +265,9 @@ func (ve *VolumeExpandOperation) Build() error {
 			}
 		}
 		ve.op.RecordExpandVolume(ve.vol, ve.ExpandSize)
+		if e := ve.touch(ve.vol.Info.Cluster, brick_entries); e != nil {
+			return e
+		}
 		if e := ve.op.Save(tx); e != nil {
 			return e
 		}
@@ -259,12 +279,12 @@ func (ve *VolumeExpandOperation) Build() error {
 func (ve *VolumeExpandOperation) Exec(executor executors.Executor) error {
 	brick_entries, err := bricksFromOp(ve.db, ve.op, ve.vol.Info.Gid)
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		ve.log().LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
 	err = ve.vol.expandVolumeExec(ve.db, executor, brick_entries)
 	if err != nil {
-		logger.LogError("Error executing expand volume: %v", err)
+		ve.log().LogError("Error executing expand volume: %v", err)
 	}
 	return err
 }
@@ -281,12 +301,12 @@ func (ve *VolumeExpandOperation) Finalize() error {
 	return ve.db.Update(func(tx *bolt.Tx) error {
 		brick_entries, err := bricksFromOp(wdb.WrapTx(tx), ve.op, ve.vol.Info.Gid)
 		if err != nil {
-			logger.LogError("Failed to get bricks from op: %v", err)
+			ve.log().LogError("Failed to get bricks from op: %v", err)
 			return err
 		}
 		sizeDelta, err := expandSizeFromOp(ve.op)
 		if err != nil {
-			logger.LogError("Failed to get expansion size from op: %v", err)
+			ve.log().LogError("Failed to get expansion size from op: %v", err)
 			return err
 		}
 
@@ -313,7 +333,7 @@ func (ve *VolumeExpandOperation) Finalize() error {
 }
 
 func (ve *VolumeExpandOperation) Clean(executor executors.Executor) error {
-	logger.Info("Starting Clean for %v op:%v", ve.Label(), ve.op.Id)
+	ve.log().Info("Starting Clean for %v op:%v", ve.Label(), ve.op.Id)
 	var (
 		err  error
 		bmap brickHostMap
@@ -332,20 +352,20 @@ func (ve *VolumeExpandOperation) Clean(executor executors.Executor) error {
 		return err
 	})
 	if err != nil {
-		logger.LogError("Failed to get bricks from op: %v", err)
+		ve.log().LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
 	// nothing past this point needs a db reference
 	ve.reclaimed, err = bmap.destroy(executor)
 	if err != nil {
-		logger.LogError("Failed to destroy bricks: %v", err)
+		ve.log().LogError("Failed to destroy bricks: %v", err)
 		return err
 	}
 	return nil
 }
 
 func (ve *VolumeExpandOperation) CleanDone() error {
-	logger.Info("Clean is done for %v op:%v", ve.Label(), ve.op.Id)
+	ve.log().Info("Clean is done for %v op:%v", ve.Label(), ve.op.Id)
 	// reminder: a volume's size is expanded during finalize and
 	// thus retains the original size until op succeeds
 	return ve.db.Update(func(tx *bolt.Tx) error {
@@ -431,7 +451,7 @@ func (vdel *VolumeDeleteOperation) Build() error {
 		}
 		vdel.vol = v
 		if vdel.vol.Pending.Id != "" {
-			logger.LogError("Pending volume %v can not be deleted",
+			vdel.log().LogError("Pending volume %v can not be deleted",
 				vdel.vol.Info.Id)
 			return ErrConflict
 		}
@@ -442,7 +462,7 @@ func (vdel *VolumeDeleteOperation) Build() error {
 		}
 		for _, brick := range brick_entries {
 			if brick.Pending.Id != "" {
-				logger.LogError("Pending brick %v can not be deleted",
+				vdel.log().LogError("Pending brick %v can not be deleted",
 					brick.Info.Id)
 				return ErrConflict
 			}
@@ -452,6 +472,9 @@ func (vdel *VolumeDeleteOperation) Build() error {
 			}
 		}
 		vdel.op.RecordDeleteVolume(vdel.vol)
+		if e := vdel.touch(vdel.vol.Info.Cluster, brick_entries); e != nil {
+			return e
+		}
 		if e := vdel.op.Save(tx); e != nil {
 			return e
 		}
@@ -468,7 +491,7 @@ func (vdel *VolumeDeleteOperation) Exec(executor executors.Executor) error {
 	vdel.reclaimed, err = removeVolumeWithOp(
 		vdel.db, executor, vdel.op, vdel.vol.Info.Id)
 	if err != nil {
-		logger.LogError("Error executing delete volume: %v", err)
+		vdel.log().LogError("Error executing delete volume: %v", err)
 	}
 	return err
 }
@@ -481,7 +504,7 @@ func (vdel *VolumeDeleteOperation) Rollback(executor executors.Executor) error {
 		txdb := wdb.WrapTx(tx)
 		brick_entries, err := bricksFromOp(txdb, vdel.op, vdel.vol.Info.Gid)
 		if err != nil {
-			logger.LogError("Failed to get bricks from op: %v", err)
+			vdel.log().LogError("Failed to get bricks from op: %v", err)
 			return err
 		}
 
@@ -505,7 +528,7 @@ func (vdel *VolumeDeleteOperation) Rollback(executor executors.Executor) error {
 // fully deleted.
 func (vdel *VolumeDeleteOperation) Finalize() error {
 	if vdel.reclaimed == nil || len(vdel.reclaimed) == 0 {
-		return logger.LogError("brick reclaim map is empty (was Exec called?)")
+		return vdel.log().LogError("brick reclaim map is empty (was Exec called?)")
 	}
 	_, err := expungeVolumeWithOp(vdel.db, vdel.op, vdel.vol.Info.Id, vdel.reclaimed)
 	return err
@@ -515,13 +538,13 @@ func (vdel *VolumeDeleteOperation) Finalize() error {
 func (vdel *VolumeDeleteOperation) Clean(executor executors.Executor) error {
 	// for a delete, clean is essentially a replay of exec
 	// because exec must be robust against restarts now we can just call Exec
-	logger.Info("Starting Clean for %v op:%v", vdel.Label(), vdel.op.Id)
+	vdel.log().Info("Starting Clean for %v op:%v", vdel.Label(), vdel.op.Id)
 	return vdel.Exec(executor)
 }
 
 func (vdel *VolumeDeleteOperation) CleanDone() error {
 	// for a delete, clean done is essentially a replay of finalize
-	logger.Info("Clean is done for %v op:%v", vdel.Label(), vdel.op.Id)
+	vdel.log().Info("Clean is done for %v op:%v", vdel.Label(), vdel.op.Id)
 	return vdel.Finalize()
 }
 
@@ -576,6 +599,9 @@ func (vc *VolumeCloneOperation) Build() error {
 		vc.bricks = bricks
 		vc.devices = devices
 		vc.op.RecordAddVolumeClone(vc.clone)
+		if e := vc.touch(vc.clone.Info.Cluster, bricks); e != nil {
+			return e
+		}
 		// record new bricks
 		for _, b := range bricks {
 			vc.op.RecordAddBrick(b)
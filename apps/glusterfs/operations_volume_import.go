@@ -0,0 +1,517 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/executors"
+	wdb "github.com/heketi/heketi/pkg/db"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/paths"
+)
+
+const (
+	glusterOwnerGidOption = "storage.owner-gid"
+)
+
+// VolumeImportError is returned when a gluster volume can not be
+// imported. The report lists every brick that could not be matched
+// to storage managed by heketi.
+type VolumeImportError struct {
+	Volume string
+	Report []string
+}
+
+func (e *VolumeImportError) Error() string {
+	return fmt.Sprintf("Unable to import volume %v:\n  %v",
+		e.Volume, strings.Join(e.Report, "\n  "))
+}
+
+// importBrick describes a brick of a volume being imported, as found
+// on the node hosting it.
+type importBrick struct {
+	path    string
+	mount   string
+	arbiter bool
+	node    *NodeEntry
+	device  *DeviceEntry
+	lv      string
+	pool    string
+	size    uint64
+	tpSize  uint64
+}
+
+// importNodeData holds the state of a node needed to locate the
+// storage backing the bricks of an imported volume.
+type importNodeData struct {
+	lvs    *executors.LVSCommandOutput
+	mounts *executors.BricksMountStatus
+}
+
+// VolumeImportOperation implements the operation functions used to
+// take over a gluster volume that was created outside of heketi.
+type VolumeImportOperation struct {
+	OperationManager
+	noRetriesOperation
+
+	name      string
+	clusterId string
+
+	// set in Exec()
+	vol     *VolumeEntry
+	bricks  []*BrickEntry
+	devices map[string]*executors.DeviceInfo
+}
+
+// NewVolumeImportOperation returns a new VolumeImportOperation that
+// imports the gluster volume with the given name from the given cluster.
+func NewVolumeImportOperation(
+	db wdb.DB, name, clusterId string) *VolumeImportOperation {
+
+	return &VolumeImportOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		name:      name,
+		clusterId: clusterId,
+	}
+}
+
+func (vi *VolumeImportOperation) Label() string {
+	return "Import Volume"
+}
+
+func (vi *VolumeImportOperation) ResourceUrl() string {
+	// the volume is only known once it has been inspected
+	if vi.vol == nil {
+		return ""
+	}
+	return fmt.Sprintf("/volumes/%v", vi.vol.Info.Id)
+}
+
+// Build checks that the volume is not already known to heketi.
+// Nothing is written to the db until the volume has been inspected.
+func (vi *VolumeImportOperation) Build() error {
+	return vi.db.View(func(tx *bolt.Tx) error {
+		return vi.checkName(tx)
+	})
+}
+
+func (vi *VolumeImportOperation) checkName(tx *bolt.Tx) error {
+	cluster, err := NewClusterEntryFromId(tx, vi.clusterId)
+	if err != nil {
+		return err
+	}
+	found, err := volumeNameExistsInCluster(tx, cluster, vi.name)
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("Volume %v is already managed by heketi",
+			vi.name)
+	}
+	return nil
+}
+
+// Exec reads the volume and the state of the nodes hosting its bricks
+// and prepares the db entries for the volume. It does not change
+// anything on the nodes.
+func (vi *VolumeImportOperation) Exec(executor executors.Executor) error {
+	var (
+		cluster   *ClusterEntry
+		hostNodes = map[string]*NodeEntry{}
+		usedLvs   = map[string]bool{}
+	)
+	err := vi.db.View(func(tx *bolt.Tx) error {
+		var err error
+		cluster, err = NewClusterEntryFromId(tx, vi.clusterId)
+		if err != nil {
+			return err
+		}
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, h := range node.Info.Hostnames.Storage {
+				hostNodes[h] = node
+			}
+			for _, h := range node.Info.Hostnames.Manage {
+				hostNodes[h] = node
+			}
+		}
+		bricks, err := BrickList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range bricks {
+			b, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			usedLvs[paths.VgIdToName(b.Info.DeviceId)+"/"+b.LvName()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	hosts, err := cluster.hosts(vi.db)
+	if err != nil {
+		return err
+	}
+	var volinfo *executors.VolInfo
+	err = newTryOnHosts(hosts).run(func(host string) error {
+		var err error
+		volinfo, err = executor.VolumesInfo(host)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var gvol *executors.Volume
+	for i := range volinfo.Volumes.VolumeList {
+		if volinfo.Volumes.VolumeList[i].VolumeName == vi.name {
+			gvol = &volinfo.Volumes.VolumeList[i]
+			break
+		}
+	}
+	if gvol == nil {
+		return fmt.Errorf("Volume %v not found in cluster %v",
+			vi.name, vi.clusterId)
+	}
+
+	var (
+		report   []string
+		ibricks  []*importBrick
+		nodeData = map[string]*importNodeData{}
+	)
+	for _, b := range gvol.Bricks.BrickList {
+		ib := &importBrick{arbiter: b.IsArbiter == 1}
+		parts := strings.SplitN(b.Name, ":", 2)
+		if len(parts) != 2 {
+			report = append(report, fmt.Sprintf(
+				"brick %v: unable to parse brick name", b.Name))
+			continue
+		}
+		ib.path = parts[1]
+		node, ok := hostNodes[parts[0]]
+		if !ok {
+			report = append(report, fmt.Sprintf(
+				"brick %v: host %v is not a heketi node", b.Name, parts[0]))
+			continue
+		}
+		if node.Info.ClusterId != vi.clusterId {
+			report = append(report, fmt.Sprintf(
+				"brick %v: node %v belongs to cluster %v",
+				b.Name, node.Info.Id, node.Info.ClusterId))
+			continue
+		}
+		ib.node = node
+
+		nd, ok := nodeData[node.Info.Id]
+		if !ok {
+			nd = &importNodeData{}
+			host := node.ManageHostName()
+			if nd.lvs, err = executor.LVS(host); err != nil {
+				return err
+			}
+			if nd.mounts, err = executor.GetBrickMountStatus(host); err != nil {
+				return err
+			}
+			nodeData[node.Info.Id] = nd
+		}
+		if msg := vi.locateBrick(ib, nd, usedLvs); msg != "" {
+			report = append(report, fmt.Sprintf("brick %v: %v", b.Name, msg))
+			continue
+		}
+		ibricks = append(ibricks, ib)
+	}
+	if len(report) > 0 {
+		return &VolumeImportError{Volume: vi.name, Report: report}
+	}
+
+	vi.devices = map[string]*executors.DeviceInfo{}
+	for _, ib := range ibricks {
+		id := ib.device.Info.Id
+		if _, ok := vi.devices[id]; ok {
+			continue
+		}
+		info, err := executor.GetDeviceInfo(ib.node.ManageHostName(),
+			ib.device.Info.Name, id)
+		if err != nil {
+			return err
+		}
+		vi.devices[id] = info
+	}
+
+	return vi.prepare(gvol, ibricks)
+}
+
+// locateBrick finds the logical volume and heketi device backing the
+// brick. It returns a description of the problem if the brick is not
+// on storage heketi can manage.
+func (vi *VolumeImportOperation) locateBrick(ib *importBrick,
+	nd *importNodeData, usedLvs map[string]bool) string {
+
+	var mount *executors.BrickMountStatus
+	for i, m := range nd.mounts.Statuses {
+		if !m.Mounted || (ib.path != m.MountPoint &&
+			!strings.HasPrefix(ib.path, m.MountPoint+"/")) {
+			continue
+		}
+		if mount == nil || len(m.MountPoint) > len(mount.MountPoint) {
+			mount = &nd.mounts.Statuses[i]
+		}
+	}
+	if mount == nil {
+		return "no mounted fstab entry contains the brick path"
+	}
+	ib.mount = mount.MountPoint
+
+	vg, lv, ok := lvFromDevicePath(mount.Device)
+	if !ok {
+		return fmt.Sprintf("%v is not a logical volume", mount.Device)
+	}
+	devId := strings.TrimPrefix(vg, "vg_")
+	if devId == vg {
+		return fmt.Sprintf("volume group %v is not a heketi device", vg)
+	}
+	err := vi.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ib.device, err = NewDeviceEntryFromId(tx, devId)
+		return err
+	})
+	if err != nil || ib.device.NodeId != ib.node.Info.Id {
+		return fmt.Sprintf("volume group %v is not a heketi device of node %v",
+			vg, ib.node.Info.Id)
+	}
+	if usedLvs[vg+"/"+lv] {
+		return fmt.Sprintf("logical volume %v/%v is already used by heketi",
+			vg, lv)
+	}
+
+	sizes := map[string]uint64{}
+	pools := map[string]string{}
+	for _, r := range nd.lvs.LVSReport {
+		for _, l := range r.LVS {
+			if l.VGName != vg {
+				continue
+			}
+			s, err := parseLvmSizeKb(l.LVSize)
+			if err != nil {
+				return fmt.Sprintf("logical volume %v/%v: %v", vg, l.LVName, err)
+			}
+			sizes[l.LVName] = s
+			pools[l.LVName] = l.PoolLV
+		}
+	}
+	size, ok := sizes[lv]
+	if !ok {
+		return fmt.Sprintf("logical volume %v/%v not found", vg, lv)
+	}
+	ib.lv = lv
+	ib.size = size
+	ib.tpSize = size
+	if pool := pools[lv]; pool != "" {
+		ib.pool = pool
+		if tpSize, ok := sizes[pool]; ok {
+			ib.tpSize = tpSize
+		}
+	}
+	return ""
+}
+
+// prepare creates the volume and brick entries from the gluster
+// volume and the bricks found on the nodes.
+func (vi *VolumeImportOperation) prepare(gvol *executors.Volume,
+	ibricks []*importBrick) error {
+
+	req := &api.VolumeCreateRequest{}
+	req.Name = vi.name
+	req.Clusters = []string{vi.clusterId}
+
+	options := []string{}
+	for _, o := range gvol.Options.OptionList {
+		options = append(options, o.Name+" "+o.Value)
+		if o.Name == glusterOwnerGidOption {
+			if gid, err := strconv.ParseInt(o.Value, 10, 64); err == nil {
+				req.Gid = gid
+			}
+		}
+	}
+
+	n := len(ibricks)
+	dataBricks := n
+	switch {
+	case gvol.DisperseCount > 0:
+		req.Durability.Type = api.DurabilityEC
+		req.Durability.Disperse.Data = gvol.DisperseCount - gvol.RedundancyCount
+		req.Durability.Disperse.Redundancy = gvol.RedundancyCount
+		dataBricks = n / gvol.DisperseCount * req.Durability.Disperse.Data
+	case gvol.ReplicaCount > 1:
+		req.Durability.Type = api.DurabilityReplicate
+		req.Durability.Replicate.Replica = gvol.ReplicaCount
+		dataBricks = n / gvol.ReplicaCount
+		if gvol.ArbiterCount > 0 {
+			options = append(options, HEKETI_ARBITER_KEY+" true")
+		}
+	default:
+		req.Durability.Type = api.DurabilityDistributeOnly
+	}
+
+	var brickSize, tpSize uint64
+	for _, ib := range ibricks {
+		if ib.arbiter {
+			continue
+		}
+		if brickSize == 0 || ib.size < brickSize {
+			brickSize = ib.size
+			tpSize = ib.tpSize
+		}
+	}
+	req.Size = int(brickSize * uint64(dataBricks) / GB)
+	if req.Size == 0 {
+		return &VolumeImportError{Volume: vi.name, Report: []string{
+			"volume is smaller than 1GiB"}}
+	}
+	if tpSize > brickSize {
+		req.Snapshot.Enable = true
+		req.Snapshot.Factor = float32(tpSize) / float32(brickSize)
+	}
+
+	vol := NewVolumeEntryFromRequest(req)
+	vol.Info.Cluster = vi.clusterId
+	vol.GlusterVolumeOptions = options
+
+	vi.bricks = []*BrickEntry{}
+	for _, ib := range ibricks {
+		var pmSize uint64
+		if ib.pool != "" {
+			pmSize = ib.device.poolMetadataSize(ib.tpSize)
+		}
+		brick := NewBrickEntry(ib.size, ib.tpSize, pmSize,
+			ib.device.Info.Id, ib.node.Info.Id, req.Gid, vol.Info.Id)
+		brick.Info.Path = ib.path
+		brick.MountPath = ib.mount
+		brick.LvmLv = ib.lv
+		if ib.pool != "" {
+			brick.LvmThinPool = ib.pool
+		}
+		brick.SubType = NormalSubType
+		if ib.arbiter {
+			brick.SubType = ArbiterSubType
+		}
+		vol.BrickAdd(brick.Id())
+		vi.bricks = append(vi.bricks, brick)
+	}
+	vi.vol = vol
+	return nil
+}
+
+// Rollback does nothing for this operation type. Nothing is changed
+// on the nodes or in the db before Finalize.
+func (vi *VolumeImportOperation) Rollback(executor executors.Executor) error {
+	return nil
+}
+
+// Finalize saves the new volume and brick entries and updates the
+// usage of the devices hosting the bricks.
+func (vi *VolumeImportOperation) Finalize() error {
+	return vi.db.Update(func(tx *bolt.Tx) error {
+		if err := vi.checkName(tx); err != nil {
+			return err
+		}
+
+		devices := map[string]*DeviceEntry{}
+		for id, info := range vi.devices {
+			device, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			device.StorageSet(info.TotalSize, info.FreeSize, info.UsedSize)
+			devices[id] = device
+		}
+		for _, brick := range vi.bricks {
+			devices[brick.Info.DeviceId].BrickAdd(brick.Id())
+			if err := brick.Save(tx); err != nil {
+				return err
+			}
+		}
+		for _, device := range devices {
+			if err := device.Save(tx); err != nil {
+				return err
+			}
+		}
+
+		if err := vi.vol.updateMountInfo(wdb.WrapTx(tx)); err != nil {
+			return err
+		}
+		if err := vi.vol.Save(tx); err != nil {
+			return err
+		}
+		cluster, err := NewClusterEntryFromId(tx, vi.clusterId)
+		if err != nil {
+			return err
+		}
+		cluster.VolumeAdd(vi.vol.Info.Id)
+		return cluster.Save(tx)
+	})
+}
+
+// lvFromDevicePath returns the volume group and logical volume names
+// of a device mapper (/dev/mapper/vg-lv) or LVM (/dev/vg/lv) path.
+func lvFromDevicePath(dev string) (vg, lv string, ok bool) {
+	dir, name := path.Split(path.Clean(dev))
+	dir = path.Clean(dir)
+	if dir == "/dev/mapper" {
+		// dashes within the vg and lv names are doubled
+		for i := 0; i < len(name); i++ {
+			if name[i] != '-' {
+				continue
+			}
+			if i+1 < len(name) && name[i+1] == '-' {
+				i++
+				continue
+			}
+			vg = strings.Replace(name[:i], "--", "-", -1)
+			lv = strings.Replace(name[i+1:], "--", "-", -1)
+			return vg, lv, vg != "" && lv != ""
+		}
+		return "", "", false
+	}
+	if path.Dir(dir) == "/dev" && dir != "/dev" {
+		return path.Base(dir), name, name != ""
+	}
+	return "", "", false
+}
+
+// parseLvmSizeKb parses a size reported by lvs when run with
+// "--units k".
+func parseLvmSizeKb(s string) (uint64, error) {
+	v := strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(s), "<"), "k")
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse size %q", s)
+	}
+	return uint64(f), nil
+}
@@ -0,0 +1,243 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// mockImportVolume sets up the executor mocks to report a replica 3
+// volume named gv0 with one brick on the first device of every node.
+// The vgName function returns the volume group backing the brick of
+// a node.
+func mockImportVolume(t *testing.T, app *App, vgName func(n *NodeEntry) string) {
+	nodes := map[string]*NodeEntry{}
+	volume := executors.Volume{
+		VolumeName:   "gv0",
+		ReplicaCount: 3,
+	}
+	volume.Options.OptionList = []executors.Option{
+		executors.Option{Name: "storage.owner-gid", Value: "2001"},
+		executors.Option{Name: "performance.readdir-ahead", Value: "on"},
+	}
+	err := app.db.View(func(tx *bolt.Tx) error {
+		ids, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			nodes[node.ManageHostName()] = node
+			volume.Bricks.BrickList = append(volume.Bricks.BrickList,
+				executors.Brick{
+					Name: node.StorageHostName() + ":/bricks/gv0/brick",
+				})
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumesInfo = func(host string) (*executors.VolInfo, error) {
+		vi := &executors.VolInfo{}
+		vi.Volumes.VolumeList = []executors.Volume{volume}
+		return vi, nil
+	}
+	app.xo.MockGetBrickMountStatus = func(host string) (*executors.BricksMountStatus, error) {
+		return &executors.BricksMountStatus{
+			Statuses: []executors.BrickMountStatus{
+				executors.BrickMountStatus{
+					Device:     "/dev/mapper/rhel-root",
+					MountPoint: "/",
+					Mounted:    true,
+				},
+				executors.BrickMountStatus{
+					Device:     "/dev/mapper/" + vgName(nodes[host]) + "-gv0",
+					MountPoint: "/bricks/gv0",
+					Mounted:    true,
+				},
+			},
+		}, nil
+	}
+	app.xo.MockLVS = func(host string) (*executors.LVSCommandOutput, error) {
+		vg := vgName(nodes[host])
+		out := &executors.LVSCommandOutput{}
+		err := json.Unmarshal([]byte(fmt.Sprintf(`{"report": [{"lv": [
+			{"lv_name": "root", "vg_name": "rhel", "lv_size": "8388608.00k"},
+			{"lv_name": "gv0", "vg_name": "%v", "lv_size": "10485760.00k",
+				"pool_lv": "pool0"},
+			{"lv_name": "pool0", "vg_name": "%v", "lv_size": "20971520.00k"}
+		]}]}`, vg, vg)), out)
+		return out, err
+	}
+	app.xo.MockGetDeviceInfo = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		return &executors.DeviceInfo{
+			TotalSize:  500 * GB,
+			FreeSize:   480 * GB,
+			UsedSize:   20 * GB,
+			ExtentSize: 4096,
+		}, nil
+	}
+}
+
+func TestVolumeImport(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		clusterId = clusters[0]
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	mockImportVolume(t, app, func(n *NodeEntry) string {
+		return "vg_" + n.Devices[0]
+	})
+
+	vi := NewVolumeImportOperation(app.db, "gv0", clusterId)
+	err = RunOperation(vi, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, vi.vol.Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, v.Info.Name == "gv0", v.Info.Name)
+		tests.Assert(t, v.Info.Cluster == clusterId)
+		tests.Assert(t, v.Info.Size == 10, v.Info.Size)
+		tests.Assert(t, v.Info.Gid == 2001, v.Info.Gid)
+		tests.Assert(t, v.Info.Durability.Type == api.DurabilityReplicate)
+		tests.Assert(t, v.Info.Durability.Replicate.Replica == 3)
+		tests.Assert(t, v.Info.Snapshot.Enable)
+		tests.Assert(t, v.Info.Snapshot.Factor == 2, v.Info.Snapshot.Factor)
+		tests.Assert(t, len(v.Bricks) == 3, len(v.Bricks))
+		tests.Assert(t, len(v.Info.Mount.GlusterFS.Hosts) == 3)
+
+		for _, id := range v.Bricks {
+			b, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, b.Info.Path == "/bricks/gv0/brick", b.Info.Path)
+			tests.Assert(t, b.MountPath == "/bricks/gv0", b.MountPath)
+			tests.Assert(t, b.LvName() == "gv0", b.LvName())
+			tests.Assert(t, b.TpName() == "pool0", b.TpName())
+			tests.Assert(t, b.Info.Size == 10*GB, b.Info.Size)
+			tests.Assert(t, b.TpSize == 20*GB, b.TpSize)
+
+			d, err := NewDeviceEntryFromId(tx, b.Info.DeviceId)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, d.NodeId == b.Info.NodeId)
+			tests.Assert(t, len(d.Bricks) == 1, d.Bricks)
+			tests.Assert(t, d.Info.Storage.Used == 20*GB, d.Info.Storage.Used)
+		}
+
+		c, err := NewClusterEntryFromId(tx, clusterId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(c.Info.Volumes) == 1)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the volume can not be imported twice
+	vi = NewVolumeImportOperation(app.db, "gv0", clusterId)
+	err = RunOperation(vi, app.executor)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestVolumeImportForeignDevice(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var (
+		clusterId string
+		foreign   string
+	)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		clusterId = clusters[0]
+		c, err := NewClusterEntryFromId(tx, clusterId)
+		foreign = c.Info.Nodes[0]
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	mockImportVolume(t, app, func(n *NodeEntry) string {
+		if n.Info.Id == foreign {
+			return "vg_data"
+		}
+		return "vg_" + n.Devices[0]
+	})
+
+	vi := NewVolumeImportOperation(app.db, "gv0", clusterId)
+	err = RunOperation(vi, app.executor)
+	tests.Assert(t, err != nil, "expected err != nil")
+	ierr, ok := err.(*VolumeImportError)
+	tests.Assert(t, ok, "expected VolumeImportError, got:", err)
+	tests.Assert(t, len(ierr.Report) == 1, ierr.Report)
+	tests.Assert(t, strings.Contains(ierr.Report[0], "vg_data"), ierr.Report)
+
+	// nothing was recorded
+	err = app.db.View(func(tx *bolt.Tx) error {
+		volumes, err := VolumeList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(volumes) == 0, volumes)
+		bricks, err := BrickList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(bricks) == 0, bricks)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestLvFromDevicePath(t *testing.T) {
+	for _, c := range []struct {
+		dev, vg, lv string
+		ok          bool
+	}{
+		{"/dev/mapper/vg_abc-brick_123", "vg_abc", "brick_123", true},
+		{"/dev/mapper/my--vg-my--lv", "my-vg", "my-lv", true},
+		{"/dev/vg_abc/gv0", "vg_abc", "gv0", true},
+		{"/dev/mapper/mpatha", "", "", false},
+		{"/dev/sdb1", "", "", false},
+		{"UUID=1234-abcd", "", "", false},
+	} {
+		vg, lv, ok := lvFromDevicePath(c.dev)
+		tests.Assert(t, ok == c.ok, c.dev, ok)
+		tests.Assert(t, vg == c.vg, c.dev, vg)
+		tests.Assert(t, lv == c.lv, c.dev, lv)
+	}
+}
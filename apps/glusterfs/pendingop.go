@@ -36,6 +36,7 @@ const (
 	OperationDeleteBlockVolume
 	OperationRemoveDevice
 	OperationCloneVolume
+	OperationRepairState
 )
 
 // PendingChangeType identifies what kind of lower-level new item or change
@@ -55,6 +56,7 @@ const (
 	OpCloneVolume
 	OpSnapshotVolume
 	OpAddVolumeClone
+	OpRepairState
 )
 
 // PendingOperationAction tracks individual changes to entries within the
@@ -113,6 +115,8 @@ func (v PendingOperationType) Name() string {
 		return "remove-device"
 	case OperationCloneVolume:
 		return "clone-volume"
+	case OperationRepairState:
+		return "repair-state"
 	}
 	return "unknown"
 }
@@ -142,6 +146,8 @@ func (c PendingChangeType) Name() string {
 		return "Snapshot volume"
 	case OpAddVolumeClone:
 		return "Expand volume to"
+	case OpRepairState:
+		return "Repair state of"
 	}
 	return "Unknown"
 }
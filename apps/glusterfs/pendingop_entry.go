@@ -291,6 +291,13 @@ func (p *PendingOperationEntry) RecordRemoveDevice(d *DeviceEntry) {
 	p.Type = OperationRemoveDevice
 }
 
+// RecordRepairState adds tracking metadata for a fix of the item
+// (volume or node) with the given id.
+func (p *PendingOperationEntry) RecordRepairState(id string) {
+	p.recordChange(OpRepairState, id)
+	p.Type = OperationRepairState
+}
+
 func (p *PendingOperationEntry) ToInfo() api.PendingOperationInfo {
 	return api.PendingOperationInfo{
 		Id:       p.Id,
@@ -398,7 +405,7 @@ func (p *PendingOperationEntry) consistencyCheck(db Db) (response DbEntryCheckRe
 			if p.Id != db.BlockVolumes[action.Id].Pending.Id {
 				response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("pending op %v id in change missing %v not found in blockvolumes", p.Id, action.Id))
 			}
-		case OpRemoveDevice:
+		case OpRemoveDevice, OpRepairState:
 			// This is a noop
 		default:
 			response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Pending Op %v unexpected change type %v", p.Id, action.Change))
@@ -28,6 +28,7 @@ func TestPendingOperationTypeName(t *testing.T) {
 		{OperationDeleteBlockVolume, "delete-block-volume"},
 		{OperationRemoveDevice, "remove-device"},
 		{OperationCloneVolume, "clone-volume"},
+		{OperationRepairState, "repair-state"},
 		{OperationUnknown, "unknown"},
 		{nope, "unknown"},
 	}
@@ -55,6 +56,7 @@ func TestPendingChangeTypeName(t *testing.T) {
 		{OpCloneVolume, "Clone volume from"},
 		{OpSnapshotVolume, "Snapshot volume"},
 		{OpAddVolumeClone, "Expand volume to"},
+		{OpRepairState, "Repair state of"},
 		{OpUnknown, "Unknown"},
 		{nope, "Unknown"},
 	}
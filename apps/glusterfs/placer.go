@@ -12,6 +12,9 @@ package glusterfs
 type DeviceAndNode struct {
 	Device *DeviceEntry
 	Node   *NodeEntry
+	// Degraded is true if the node is up but failed some of its
+	// health checks. Its devices are only tried after the others.
+	Degraded bool
 }
 
 // DeviceSource is an abstraction used by the BrickPlacer to
@@ -345,6 +345,10 @@ func (bp *ArbiterBrickPlacer) Scanner(dsrc DeviceSource) (
 	dataRing := NewSimpleAllocatorRing()
 	arbiterRing := NewSimpleAllocatorRing()
 	anyRing := NewSimpleAllocatorRing()
+	// the devices of degraded nodes are the last resort
+	degradedDataRing := NewSimpleAllocatorRing()
+	degradedArbiterRing := NewSimpleAllocatorRing()
+	degradedAnyRing := NewSimpleAllocatorRing()
 	dnl, err := dsrc.Devices()
 	if err != nil {
 		return nil, err
@@ -360,10 +364,16 @@ func (bp *ArbiterBrickPlacer) Scanner(dsrc DeviceSource) (
 		arbiterOk := bp.canHostArbiter(dan.Device, dsrc)
 		dataOk := bp.canHostData(dan.Device, dsrc)
 		switch {
+		case arbiterOk && dataOk && dan.Degraded:
+			degradedAnyRing.Add(sd)
 		case arbiterOk && dataOk:
 			anyRing.Add(sd)
+		case arbiterOk && dan.Degraded:
+			degradedArbiterRing.Add(sd)
 		case arbiterOk:
 			arbiterRing.Add(sd)
+		case dataOk && dan.Degraded:
+			degradedDataRing.Add(sd)
 		case dataOk:
 			dataRing.Add(sd)
 		default:
@@ -374,8 +384,10 @@ func (bp *ArbiterBrickPlacer) Scanner(dsrc DeviceSource) (
 
 	id := idgen.GenUUID()
 	return &arbiterDeviceScanner{
-		arbiter: deviceFeedFromRings(id, arbiterRing, anyRing),
-		data:    deviceFeedFromRings(id, dataRing, anyRing),
+		arbiter: deviceFeedFromRings(id, arbiterRing, anyRing,
+			degradedArbiterRing, degradedAnyRing),
+		data: deviceFeedFromRings(id, dataRing, anyRing,
+			degradedDataRing, degradedAnyRing),
 	}, nil
 }
 
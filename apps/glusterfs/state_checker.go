@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// backgroundStateChecker periodically checks the consistency of the
+// db and compares the db with the state of gluster. The reports of
+// the most recent checks are kept in the db.
+type backgroundStateChecker struct {
+	db       *bolt.DB
+	examiner Examiner
+	// number of reports to keep in the db
+	keep int
+
+	// timing params
+	StartInterval time.Duration
+	CheckInterval time.Duration
+
+	// to stop the checker
+	stop chan<- interface{}
+}
+
+// Start creates a background goroutine to run periodic checks.
+func (bsc *backgroundStateChecker) Start() {
+	startTimer := time.NewTimer(bsc.StartInterval)
+	ticker := time.NewTicker(bsc.CheckInterval)
+	stop := make(chan interface{})
+	bsc.stop = stop
+
+	go func() {
+		logger.Info("Started background state checker")
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				logger.Info("Stopping background state checker")
+				return
+			case <-startTimer.C:
+				bsc.run()
+			case <-ticker.C:
+				bsc.run()
+			}
+		}
+	}()
+}
+
+// Stop the background state checker.
+func (bsc *backgroundStateChecker) Stop() {
+	bsc.stop <- true
+}
+
+func (bsc *backgroundStateChecker) run() {
+	report, err := bsc.Check()
+	if err != nil {
+		logger.LogError("Background state checker: %v", err)
+		return
+	}
+	if n := report.DbCheck.TotalInconsistencies; n > 0 {
+		logger.Warning("Background state checker found %v db inconsistencies", n)
+	}
+	if n := len(report.Discrepancies); n > 0 {
+		logger.Warning("Background state checker found %v differences with gluster", n)
+	}
+}
+
+// Check runs the db check and the gluster examination and stores
+// the report in the db. Failures of the individual checks are listed
+// in the report, only failing to store the report is an error.
+func (bsc *backgroundStateChecker) Check() (*StateReportEntry, error) {
+	report := NewStateReportEntry()
+
+	dbcheck, err := dbCheckConsistency(bsc.db)
+	if err != nil {
+		report.Errors = append(report.Errors,
+			fmt.Sprintf("db check failed: %v", err))
+	}
+	report.DbCheck = dbcheck
+
+	exam, err := bsc.examiner.ExamineGluster()
+	if err != nil {
+		report.Errors = append(report.Errors,
+			fmt.Sprintf("gluster examination failed: %v", err))
+	}
+	for _, c := range exam.Clusters {
+		report.Clusters = append(report.Clusters, c.ClusterHeketiID)
+	}
+	report.Discrepancies = exam.Discrepancies
+	report.Report = exam.Report
+
+	err = bsc.db.Update(func(tx *bolt.Tx) error {
+		if err := report.Save(tx); err != nil {
+			return err
+		}
+		return pruneStateReports(tx, bsc.keep)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to save state report: %v", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,107 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+func TestStateCheckerKeepsReports(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	m, _ := setupStateTest(t, app)
+	host := m.firstHost()
+	m.lvs[host] = append(m.lvs[host],
+		testLv{m.lvs[host][0].vg, "brick_dead", ""})
+
+	app.conf.StateCheckerReports = 3
+	checker := app.StateChecker()
+
+	summary, err := app.StateCheckSummary()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, summary == nil, summary)
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		report, err := checker.Check()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(report.Errors) == 0, report.Errors)
+		tests.Assert(t, report.DbCheck.TotalInconsistencies == 0)
+		tests.Assert(t, len(report.Discrepancies) == 1, report.Discrepancies)
+		ids = append(ids, report.Id)
+	}
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		list, err := StateReportList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(list) == 3, list)
+		tests.Assert(t, list[0] == ids[2], list, ids)
+		latest, err := LatestStateReport(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, latest.Id == ids[4], latest.Id)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	summary, err = app.StateCheckSummary()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, summary != nil)
+	tests.Assert(t, len(summary.Discrepancies) == 1, summary.Discrepancies)
+	for _, counts := range summary.Discrepancies {
+		tests.Assert(t, len(counts) == len(api.DiscrepancyTypes), counts)
+		tests.Assert(t, counts[api.DiscrepancyOrphanedLv] == 1, counts)
+		tests.Assert(t, counts[api.DiscrepancyVolumeMissing] == 0, counts)
+	}
+}
+
+func TestStateReportEndpoint(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	r, err := http.Get(ts.URL + "/internal/state/report")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, r.StatusCode)
+
+	setupStateTest(t, app)
+	report, err := app.StateChecker().Check()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	r, err = http.Get(ts.URL + "/internal/state/report")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK, r.StatusCode)
+	var latest StateReportEntry
+	err = json.NewDecoder(r.Body).Decode(&latest)
+	r.Body.Close()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, latest.Id == report.Id, latest.Id)
+	tests.Assert(t, len(latest.Clusters) == 1, latest.Clusters)
+}
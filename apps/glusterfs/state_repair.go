@@ -0,0 +1,269 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/tracing"
+)
+
+// StateRepairer proposes and applies fixes for the discrepancies
+// found by examining the state of heketi and gluster. Every fix
+// that is applied runs as its own operation.
+type StateRepairer struct {
+	db        *bolt.DB
+	executor  executors.Executor
+	optracker *OpTracker
+	// recorded in the operation history of the fixes
+	caller string
+	// span the fixes are traced under
+	parent tracing.SpanContext
+}
+
+// Repair examines the state of gluster and returns the fixes for
+// the discrepancies found. Unless a dry run is requested the fixes
+// are applied.
+func (sr StateRepairer) Repair(
+	req *api.StateRepairRequest) (*api.StateRepairResponse, error) {
+
+	if !req.DryRun && sr.optracker.Get() > 0 {
+		return nil, ErrOperationsInFlight
+	}
+
+	exam, err := Examiner{
+		db:        sr.db,
+		executor:  sr.executor,
+		optracker: sr.optracker,
+		mode:      OnDemandExaminer,
+	}.ExamineGluster()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &api.StateRepairResponse{
+		DryRun: req.DryRun,
+		Fixes:  planRepairs(&exam, req.Types),
+		Report: exam.Report,
+	}
+	if req.DryRun {
+		return response, nil
+	}
+
+	for i := range response.Fixes {
+		fix := &response.Fixes[i]
+		if fix.Action == api.RepairNone {
+			continue
+		}
+		op := NewStateRepairOperation(sr.db, fix)
+		fix.Operation = op.Id()
+		if err := sr.apply(op); err != nil {
+			fix.Error = err.Error()
+			continue
+		}
+		fix.Applied = true
+	}
+	return response, nil
+}
+
+func (sr StateRepairer) apply(op *StateRepairOperation) error {
+	if sr.optracker.ThrottleOrAdd(op.Id(), TrackNormal) {
+		return ErrTooManyOperations
+	}
+	defer sr.optracker.Remove(op.Id())
+	resourceId := op.fix.Discrepancy.Volume
+	if resourceId == "" {
+		resourceId = op.fix.Discrepancy.Brick
+	}
+
+	rec := newOperationRecorder(op, sr.caller, sr.parent)
+	rec.logWith(operationLogFields(op, resourceId, true))
+	err := rec.phase("build", op.Build)
+	if err != nil {
+		rec.log.LogError("%v Build Failed: %v", op.Label(), err)
+	} else {
+		err = runOperationAfterBuild(op, sr.executor, rec)
+	}
+	rec.done(err)
+	return err
+}
+
+// planRepairs returns a fix for every discrepancy of the requested
+// types. Discrepancies heketi can not fix get the RepairNone action
+// and a reason. Volumes marked by an earlier repair that match gluster
+// again get a fix that clears the mark.
+func planRepairs(exam *GlusterStateExaminationResponse,
+	types []api.DiscrepancyType) []api.StateRepairFix {
+
+	wanted := map[api.DiscrepancyType]bool{}
+	for _, t := range types {
+		wanted[t] = true
+	}
+	want := func(t api.DiscrepancyType) bool {
+		return len(wanted) == 0 || wanted[t]
+	}
+
+	nodes := map[string]NodeData{}
+	for _, cdata := range exam.Clusters {
+		for _, ndata := range cdata.NodesData {
+			nodes[ndata.NodeHeketiID] = ndata
+		}
+	}
+	orphans := map[string]bool{}
+	flagged := map[string]bool{}
+	for _, d := range exam.Discrepancies {
+		switch d.Type {
+		case api.DiscrepancyOrphanedLv:
+			orphans[d.Node+":"+d.Path] = true
+		case api.DiscrepancyVolumeMissing, api.DiscrepancyBrickPathMismatch:
+			flagged[d.Volume] = true
+		}
+	}
+
+	var fixes, poolFixes []api.StateRepairFix
+	marked := map[string]bool{}
+	for _, d := range exam.Discrepancies {
+		if !want(d.Type) {
+			continue
+		}
+		fix := api.StateRepairFix{
+			Discrepancy: d,
+			Action:      api.RepairNone,
+		}
+		switch d.Type {
+		case api.DiscrepancyVolumeMissing, api.DiscrepancyBrickPathMismatch:
+			v := exam.HeketiDB.Volumes[d.Volume]
+			switch {
+			case marked[d.Volume]:
+				fix.Reason = "volume is marked by another fix"
+			case v.Info.Discrepancy == d.Description:
+				fix.Reason = "volume is already marked"
+			default:
+				fix.Action = api.RepairMark
+			}
+			marked[d.Volume] = true
+		case api.DiscrepancyVolumeExtra:
+			fix.Reason = "use volume import to let heketi manage the volume"
+		case api.DiscrepancyBrickUnmounted:
+			if _, ok := fstabEntry(nodes[d.Node], d.Path); ok {
+				fix.Action = api.RepairRemount
+			} else {
+				fix.Reason = "brick has no fstab entry"
+			}
+		case api.DiscrepancyOrphanedLv:
+			ndata := nodes[d.Node]
+			if mp := lvMountPoint(ndata, d.Path); mp != "" {
+				fix.Reason = fmt.Sprintf("logical volume is mounted at %v", mp)
+				break
+			}
+			users := thinPoolUsers(ndata, d.Path)
+			if len(users) == 0 {
+				fix.Action = api.RepairRemoveLv
+				break
+			}
+			var used []string
+			for _, u := range users {
+				if !orphans[d.Node+":"+u] {
+					used = append(used, u)
+				}
+			}
+			if len(used) > 0 {
+				fix.Reason = fmt.Sprintf("thin pool is used by %v",
+					strings.Join(used, ", "))
+				break
+			}
+			// pools can only be removed after the volumes in them
+			fix.Action = api.RepairRemoveLv
+			poolFixes = append(poolFixes, fix)
+			continue
+		}
+		fixes = append(fixes, fix)
+	}
+	fixes = append(fixes, poolFixes...)
+
+	if !want(api.DiscrepancyVolumeMissing) || !want(api.DiscrepancyBrickPathMismatch) {
+		return fixes
+	}
+	for _, cdata := range exam.Clusters {
+		if glusterVolumes(cdata) == nil {
+			continue
+		}
+		var ids []string
+		ids = append(ids, exam.HeketiDB.Clusters[cdata.ClusterHeketiID].Info.Volumes...)
+		sort.Strings(ids)
+		for _, id := range ids {
+			v := exam.HeketiDB.Volumes[id]
+			if v.Info.Discrepancy == "" || v.Pending.Id != "" || flagged[id] {
+				continue
+			}
+			fixes = append(fixes, api.StateRepairFix{
+				Discrepancy: api.Discrepancy{
+					Cluster:    cdata.ClusterHeketiID,
+					Volume:     id,
+					VolumeName: v.Info.Name,
+					Description: fmt.Sprintf("volume %v matches gluster again",
+						v.Info.Name),
+				},
+				Action: api.RepairUnmark,
+			})
+		}
+	}
+	return fixes
+}
+
+// fstabEntry returns the fstab entry of the node for the given
+// mount point.
+func fstabEntry(ndata NodeData, mountPoint string) (executors.BrickMountStatus, bool) {
+	if ndata.BricksMountStatus != nil {
+		for _, s := range ndata.BricksMountStatus.Statuses {
+			if s.MountPoint == mountPoint {
+				return s, true
+			}
+		}
+	}
+	return executors.BrickMountStatus{}, false
+}
+
+// lvMountPoint returns where the logical volume, given as "vg/lv",
+// is mounted on the node or an empty string if it is not mounted.
+func lvMountPoint(ndata NodeData, name string) string {
+	if ndata.BricksMountStatus == nil {
+		return ""
+	}
+	for _, s := range ndata.BricksMountStatus.Statuses {
+		vg, lv, ok := lvFromDevicePath(s.Device)
+		if ok && s.Mounted && vg+"/"+lv == name {
+			return s.MountPoint
+		}
+	}
+	return ""
+}
+
+// thinPoolUsers returns the logical volumes stored in the thin pool,
+// given as "vg/lv", on the node.
+func thinPoolUsers(ndata NodeData, name string) (users []string) {
+	if ndata.LVMLVInfo == nil {
+		return
+	}
+	for _, report := range ndata.LVMLVInfo.LVSReport {
+		for _, lv := range report.LVS {
+			if lv.PoolLV != "" && lv.VGName+"/"+lv.PoolLV == name {
+				users = append(users, lv.VGName+"/"+lv.LVName)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,156 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+const (
+	BOLTDB_BUCKET_STATE_REPORTS = "STATE_REPORTS"
+)
+
+// StateReportEntry holds the results of one run of the state checker.
+// Entries are keyed by an id that sorts in the order the reports were
+// created.
+type StateReportEntry struct {
+	Id            string            `json:"id"`
+	Timestamp     int64             `json:"timestamp"`
+	DbCheck       DbCheckResponse   `json:"dbcheck"`
+	Clusters      []string          `json:"clusters"`
+	Discrepancies []api.Discrepancy `json:"discrepancies"`
+	Report        []string          `json:"report"`
+	// Errors lists the checks that could not be run
+	Errors []string `json:"errors"`
+}
+
+func NewStateReportEntry() *StateReportEntry {
+	now := time.Now()
+	return &StateReportEntry{
+		Id:        fmt.Sprintf("%016x", now.UnixNano()),
+		Timestamp: now.Unix(),
+	}
+}
+
+func NewStateReportEntryFromId(tx *bolt.Tx, id string) (*StateReportEntry, error) {
+	entry := &StateReportEntry{}
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (sr *StateReportEntry) BucketName() string {
+	return BOLTDB_BUCKET_STATE_REPORTS
+}
+
+func (sr *StateReportEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(sr.Id) > 0)
+
+	return EntrySave(tx, sr, sr.Id)
+}
+
+func (sr *StateReportEntry) Delete(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+
+	return EntryDelete(tx, sr, sr.Id)
+}
+
+func (sr *StateReportEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*sr)
+
+	return buffer.Bytes(), err
+}
+
+func (sr *StateReportEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(sr)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Summary returns the counts of problems found by the report.
+func (sr *StateReportEntry) Summary() *api.StateCheckSummary {
+	s := &api.StateCheckSummary{
+		Timestamp:         sr.Timestamp,
+		DbInconsistencies: sr.DbCheck.TotalInconsistencies,
+		Discrepancies:     map[string]map[api.DiscrepancyType]int{},
+	}
+	for _, c := range sr.Clusters {
+		s.Discrepancies[c] = map[api.DiscrepancyType]int{}
+		for _, t := range api.DiscrepancyTypes {
+			s.Discrepancies[c][t] = 0
+		}
+	}
+	for _, d := range sr.Discrepancies {
+		if s.Discrepancies[d.Cluster] == nil {
+			s.Discrepancies[d.Cluster] = map[api.DiscrepancyType]int{}
+		}
+		s.Discrepancies[d.Cluster][d.Type]++
+	}
+	return s
+}
+
+// StateReportList returns the ids of the stored state reports,
+// oldest first.
+func StateReportList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_STATE_REPORTS)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// LatestStateReport returns the most recent state report or
+// ErrNotFound if there is none.
+func LatestStateReport(tx *bolt.Tx) (*StateReportEntry, error) {
+	list, err := StateReportList(tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return NewStateReportEntryFromId(tx, list[len(list)-1])
+}
+
+// pruneStateReports deletes the oldest state reports so that at
+// most keep reports remain.
+func pruneStateReports(tx *bolt.Tx, keep int) error {
+	list, err := StateReportList(tx)
+	if err != nil {
+		return err
+	}
+	for len(list) > keep {
+		entry := &StateReportEntry{Id: list[0]}
+		if err := entry.Delete(tx); err != nil {
+			return err
+		}
+		list = list[1:]
+	}
+	return nil
+}
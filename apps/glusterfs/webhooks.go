@@ -0,0 +1,149 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/webhook"
+)
+
+var validEventTypes = map[api.EventType]bool{
+	api.EventVolumeCreated:      true,
+	api.EventVolumeDeleted:      true,
+	api.EventVolumeExpanded:     true,
+	api.EventDeviceStateChanged: true,
+	api.EventNodeHealthChanged:  true,
+	api.EventBrickUnmounted:     true,
+	api.EventBrickRemounted:     true,
+	api.EventOperationStarted:   true,
+	api.EventOperationFinished:  true,
+	api.EventOperationFailed:    true,
+}
+
+// webhookPayload is the JSON body of the notifications. The text makes
+// the payload usable as is by chat services.
+type webhookPayload struct {
+	Text  string    `json:"text"`
+	Event api.Event `json:"event"`
+}
+
+// webhookForwarder sends the events of the server to the webhooks.
+// Events are read from the event log so the operations and the health
+// checks publishing them never wait for the webhooks.
+type webhookForwarder struct {
+	dispatcher *webhook.Dispatcher
+	token      string
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func (app *App) initWebhooks() {
+	if len(app.conf.Webhooks.Hooks) == 0 {
+		return
+	}
+	for _, h := range app.conf.Webhooks.Hooks {
+		for _, t := range h.Events {
+			if !validEventTypes[api.EventType(t)] {
+				logger.LogError("Unable to start webhooks: unknown event type %v", t)
+				return
+			}
+		}
+	}
+	d, err := webhook.NewDispatcher(app.conf.Webhooks)
+	if err != nil {
+		logger.LogError("Unable to start webhooks: %v", err)
+		return
+	}
+	logger.Info("Sending events to %v webhooks", len(app.conf.Webhooks.Hooks))
+	_, token, _, _, _ := eventLog.After("")
+	app.webhooks = &webhookForwarder{
+		dispatcher: d,
+		token:      token,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go app.webhooks.run()
+}
+
+func (f *webhookForwarder) run() {
+	defer close(f.done)
+	for {
+		events, next, lost, published, err := eventLog.After(f.token)
+		if err != nil {
+			logger.LogError("Unable to read events for the webhooks: %v", err)
+			return
+		}
+		if lost {
+			logger.Warning("Events were dropped before they were sent to the webhooks")
+		}
+		for _, e := range events {
+			f.dispatcher.Send(webhook.Message{
+				Type: string(e.Type),
+				Id:   e.Id,
+				Payload: webhookPayload{
+					Text:  eventSummary(e),
+					Event: e,
+				},
+			})
+		}
+		f.token = next
+		select {
+		case <-published:
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// Stop stops forwarding events. The notifications not delivered yet
+// are recorded in the dead-letter log.
+func (f *webhookForwarder) Stop() {
+	close(f.stop)
+	<-f.done
+	if err := f.dispatcher.Close(); err != nil {
+		logger.LogError("Unable to close webhooks: %v", err)
+	}
+}
+
+// eventSummary describes an event in a sentence.
+func eventSummary(e api.Event) string {
+	d := e.Details
+	switch e.Type {
+	case api.EventVolumeCreated:
+		return fmt.Sprintf("heketi: volume %v (%v) created", d["name"], e.ResourceId)
+	case api.EventVolumeDeleted:
+		return fmt.Sprintf("heketi: volume %v (%v) deleted", d["name"], e.ResourceId)
+	case api.EventVolumeExpanded:
+		return fmt.Sprintf("heketi: volume %v (%v) expanded to %vGiB",
+			d["name"], e.ResourceId, d["size"])
+	case api.EventDeviceStateChanged:
+		return fmt.Sprintf("heketi: device %v on node %v is %v",
+			e.ResourceId, d["node"], d["state"])
+	case api.EventNodeHealthChanged:
+		return fmt.Sprintf("heketi: node %v (%v) is %v",
+			e.ResourceId, d["host"], d["state"])
+	case api.EventBrickUnmounted:
+		return fmt.Sprintf("heketi: brick %v on node %v is not mounted at %v",
+			e.ResourceId, d["host"], d["path"])
+	case api.EventBrickRemounted:
+		return fmt.Sprintf("heketi: brick %v on node %v is mounted again at %v",
+			e.ResourceId, d["host"], d["path"])
+	case api.EventOperationStarted:
+		return fmt.Sprintf("heketi: %v %v started", d["label"], e.OperationId)
+	case api.EventOperationFinished:
+		return fmt.Sprintf("heketi: %v %v finished", d["label"], e.OperationId)
+	case api.EventOperationFailed:
+		return fmt.Sprintf("heketi: %v %v failed: %v",
+			d["label"], e.OperationId, d["error"])
+	}
+	return fmt.Sprintf("heketi: %v", e.Type)
+}
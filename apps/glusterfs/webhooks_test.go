@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/webhook"
+)
+
+func newWebhookTestApp(dbfile string, hooks ...webhook.HookConfig) *App {
+	return NewApp(&GlusterFSConfig{
+		DBfile:                dbfile,
+		Executor:              "mock",
+		MaxInflightOperations: 64,
+		Webhooks:              webhook.Config{Hooks: hooks},
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	type notification struct {
+		signature string
+		body      []byte
+	}
+	received := make(chan notification, 10)
+	standIn := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received <- notification{
+				signature: r.Header.Get(webhook.SignatureHeader),
+				body:      body,
+			}
+		}))
+	defer standIn.Close()
+
+	app := newWebhookTestApp(tmpfile, webhook.HookConfig{
+		URL:    standIn.URL,
+		Secret: "s3cr3t",
+		Events: []string{"operation_failed", "node_health_changed"},
+	})
+	defer app.Close()
+	tests.Assert(t, app.webhooks != nil)
+
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 6*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeCreate = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+		return nil, fmt.Errorf("volume create: failed")
+	}
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vc := NewVolumeCreateOperation(NewVolumeEntryFromRequest(req), app.db)
+	err = RunOperation(vc, app.executor)
+	tests.Assert(t, err != nil)
+
+	app.xo.MockGlusterdCheck = func(host string) error {
+		return fmt.Errorf("node down")
+	}
+	hc := NewNodeHealthCache(1, 0, app.db, app.executor)
+	err = hc.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	payloads := map[api.EventType][]webhookPayload{}
+	for i := 0; i < 4; i++ {
+		select {
+		case n := <-received:
+			tests.Assert(t, webhook.Verify("s3cr3t", n.body, n.signature),
+				"bad signature", n.signature)
+			var p webhookPayload
+			err := json.Unmarshal(n.body, &p)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			payloads[p.Event.Type] = append(payloads[p.Event.Type], p)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 4 notifications, got %v", i)
+		}
+	}
+	tests.Assert(t, len(payloads[api.EventOperationFailed]) == 1, payloads)
+	p := payloads[api.EventOperationFailed][0]
+	tests.Assert(t, p.Event.OperationId == vc.Id(), p.Event)
+	tests.Assert(t, strings.Contains(p.Text, "Create Volume "+vc.Id()+" failed"), p.Text)
+	tests.Assert(t, len(payloads[api.EventNodeHealthChanged]) == 3, payloads)
+	p = payloads[api.EventNodeHealthChanged][0]
+	tests.Assert(t, strings.HasSuffix(p.Text, "is down"), p.Text)
+}
+
+func TestWebhooksConfig(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := newWebhookTestApp(tmpfile, webhook.HookConfig{
+		URL:    "http://localhost:1",
+		Events: []string{"device_removed"},
+	})
+	defer app.Close()
+	tests.Assert(t, app.webhooks == nil)
+}
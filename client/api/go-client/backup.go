@@ -14,6 +14,7 @@ package client
 
 import (
 	"io"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/heketi/heketi/pkg/utils"
@@ -47,3 +48,41 @@ func (c *Client) BackupDb(w io.Writer) error {
 
 	return err
 }
+
+// BackupRestore replaces the db of the server with the db read from r,
+// which is a bolt db file or, if isJson is set, a JSON dump of a db.
+// It provides a JSON summary of the restore.
+func (c *Client) BackupRestore(r io.Reader, isJson bool) (string, error) {
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/backup/restore", r)
+	if err != nil {
+		return "", err
+	}
+	if isJson {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return "", err
+	}
+
+	// Send request
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", utils.GetErrorFromResponse(resp)
+	}
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(respBytes), nil
+}
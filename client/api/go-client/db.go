@@ -13,9 +13,12 @@
 package client
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 )
 
@@ -82,3 +85,44 @@ func (c *Client) DbCheck() (string, error) {
 	respJSON := string(respBytes)
 	return respJSON, nil
 }
+
+// DbCheckFix repairs the inconsistencies of the DB that are safe to fix
+// and provides a JSON summary of the changes. The changes are only
+// listed when request.DryRun is set.
+func (c *Client) DbCheckFix(request *api.DbFixRequest) (string, error) {
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", c.host+"/db/check/fix", bytes.NewBuffer(buffer))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return "", err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return "", utils.GetErrorFromResponse(r)
+	}
+
+	respBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+
+	respJSON := string(respBytes)
+	return respJSON, nil
+}
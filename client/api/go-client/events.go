@@ -0,0 +1,63 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), as published by the Free Software Foundation,
+// or under the Apache License, Version 2.0 <LICENSE-APACHE2 or
+// http://www.apache.org/licenses/LICENSE-2.0>.
+//
+// You may not use this file except in compliance with those terms.
+//
+
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// Events returns the events of the server after the given token,
+// waiting up to timeout for one if there are none. An empty token
+// waits for the next event. The Next token of the response is the
+// token of the following call.
+func (c *Client) Events(
+	after string, timeout time.Duration) (*api.EventsResponse, error) {
+
+	q := url.Values{}
+	if after != "" {
+		q.Set("after", after)
+	}
+	q.Set("timeout", strconv.Itoa(int(timeout/time.Second)))
+	req, err := http.NewRequest("GET", c.host+"/events?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+	var er api.EventsResponse
+	err = utils.GetJsonFromResponse(r, &er)
+	if err != nil {
+		return nil, err
+	}
+	return &er, nil
+}
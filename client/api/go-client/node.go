@@ -217,3 +217,124 @@ func (c *Client) NodeSetTags(id string, request *api.TagsChangeRequest) error {
 	}
 	return nil
 }
+
+func (c *Client) NodeDisks(id string) (*api.NodeDisksResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/nodes/"+id+"/disks", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var disks api.NodeDisksResponse
+	err = utils.GetJsonFromResponse(r, &disks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &disks, nil
+}
+
+func (c *Client) NodeDisksAdd(id string,
+	request *api.NodeDisksAddRequest) (*api.NodeInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/nodes/"+id+"/disks/autoadd",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Millisecond*250)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var node api.NodeInfoResponse
+	err = utils.GetJsonFromResponse(r, &node)
+	if err != nil {
+		return nil, err
+	}
+
+	return &node, nil
+}
+
+func (c *Client) NodeHealth(id string) (*api.NodeHealthResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/nodes/"+id+"/health", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var health api.NodeHealthResponse
+	err = utils.GetJsonFromResponse(r, &health)
+	if err != nil {
+		return nil, err
+	}
+
+	return &health, nil
+}
@@ -111,6 +111,79 @@ func (c *Client) PendingOperationDetails(
 	return &pd, nil
 }
 
+// OperationHistory returns the completed and failed operations
+// selected by the filter, most recent first.
+func (c *Client) OperationHistory(
+	filter *api.OperationHistoryFilter) (*api.OperationHistoryResponse, error) {
+
+	u := c.host + "/operations/history"
+	if filter != nil {
+		if q := filter.Query().Encode(); q != "" {
+			u += "?" + q
+		}
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+	var oh api.OperationHistoryResponse
+	err = utils.GetJsonFromResponse(r, &oh)
+	if err != nil {
+		return nil, err
+	}
+	return &oh, nil
+}
+
+// OperationTranscript returns the commands run by a running or
+// recently finished operation.
+func (c *Client) OperationTranscript(
+	id string) (*api.OperationTranscript, error) {
+
+	req, err := http.NewRequest("GET",
+		c.host+"/operations/"+id+"/transcript", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+	var ot api.OperationTranscript
+	err = utils.GetJsonFromResponse(r, &ot)
+	if err != nil {
+		return nil, err
+	}
+	return &ot, nil
+}
+
 func (c *Client) PendingOperationCleanUp(
 	request *api.PendingOperationsCleanRequest) error {
 
@@ -160,3 +233,30 @@ func (c *Client) PendingOperationCleanUp(
 	}
 	return nil
 }
+
+// PendingOperationCancel requests that the running operation with
+// the given id stop. The operation stops and is rolled back in the
+// background, so the call returns once the request is accepted.
+func (c *Client) PendingOperationCancel(id string) error {
+	req, err := http.NewRequest("DELETE", c.host+"/operations/pending/"+id, nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+	return nil
+}
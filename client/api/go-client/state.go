@@ -13,9 +13,12 @@
 package client
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 )
 
@@ -50,3 +53,76 @@ func (c *Client) StateExamineGluster() (string, error) {
 	respJSON := string(respBytes)
 	return respJSON, nil
 }
+
+// StateReport returns the most recent report of the background
+// state checker
+func (c *Client) StateReport() (string, error) {
+	req, err := http.NewRequest("GET", c.host+"/internal/state/report", nil)
+	if err != nil {
+		return "", err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return "", err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return "", utils.GetErrorFromResponse(r)
+	}
+
+	respBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(respBytes), nil
+}
+
+// StateRepair requests fixes for the differences between the DB and
+// Gluster. The fixes are only listed when request.DryRun is set.
+func (c *Client) StateRepair(request *api.StateRepairRequest) (
+	*api.StateRepairResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", c.host+"/internal/state/repair", bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var response api.StateRepairResponse
+	err = utils.GetJsonFromResponse(r, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -10,17 +10,37 @@
 package cmds
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/spf13/cobra"
 )
 
+var (
+	dbCheckFix    bool
+	dbCheckDryRun bool
+	dbRestoreFile string
+	dbRestoreJson bool
+)
+
 func init() {
 	RootCmd.AddCommand(dbCommand)
 	dbCommand.AddCommand(dumpDbCommand)
 	dumpDbCommand.SilenceUsage = true
 	dbCommand.AddCommand(checkDbCommand)
+	checkDbCommand.Flags().BoolVar(&dbCheckFix, "fix", false,
+		"\n\tRepair the inconsistencies that are safe to fix")
+	checkDbCommand.Flags().BoolVar(&dbCheckDryRun, "dry-run", false,
+		"\n\tWith --fix, only list the changes without saving them")
 	checkDbCommand.SilenceUsage = true
+	dbCommand.AddCommand(restoreDbCommand)
+	restoreDbCommand.Flags().StringVar(&dbRestoreFile, "file", "",
+		"\n\tFile with the db to restore")
+	restoreDbCommand.Flags().BoolVar(&dbRestoreJson, "json", false,
+		"\n\tThe file is a JSON dump of the db instead of a db file")
+	restoreDbCommand.SilenceUsage = true
 }
 
 var dbCommand = &cobra.Command{
@@ -52,16 +72,38 @@ var dumpDbCommand = &cobra.Command{
 }
 
 var checkDbCommand = &cobra.Command{
-	Use:     "check",
-	Short:   "checks the db and provides a summary in json format",
-	Long:    "checks the db and provides a summary in json format",
-	Example: "  $ heketi-cli db check",
+	Use:   "check",
+	Short: "checks the db and provides a summary in json format",
+	Long:  "checks the db and provides a summary in json format",
+	Example: `  * Check the db
+      $ heketi-cli db check
+
+  * List the changes that would repair the db
+      $ heketi-cli db check --fix --dry-run
+
+  * Repair the db
+      $ heketi-cli db check --fix`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if dbCheckDryRun && !dbCheckFix {
+			return fmt.Errorf("--dry-run requires --fix")
+		}
+
 		heketi, err := newHeketiClient()
 		if err != nil {
 			return err
 		}
 
+		if dbCheckFix {
+			fixResponse, err := heketi.DbCheckFix(&api.DbFixRequest{
+				DryRun: dbCheckDryRun,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, fixResponse)
+			return nil
+		}
+
 		checkResponse, err := heketi.DbCheck()
 		if err != nil {
 			return err
@@ -72,3 +114,39 @@ var checkDbCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var restoreDbCommand = &cobra.Command{
+	Use:   "restore",
+	Short: "replaces the db of the server",
+	Long: "replaces the db of the server with a db file or a JSON dump " +
+		"after checking it for inconsistencies",
+	Example: `  * Restore a db file saved from the server
+      $ heketi-cli db restore --file=heketi.db
+
+  * Restore a JSON dump of the db
+      $ heketi-cli db restore --file=dump.json --json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if dbRestoreFile == "" {
+			return errors.New("Missing file with the db to restore")
+		}
+		fp, err := os.Open(dbRestoreFile)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		restoreResponse, err := heketi.BackupRestore(fp, dbRestoreJson)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, restoreResponse)
+
+		return nil
+	},
+}
@@ -235,6 +235,19 @@ var deviceInfoCommand = &cobra.Command{
 					fmt.Fprintf(stdout, "  %v: %v\n", k, v)
 				}
 			}
+			if info.Identity.PvUUID != "" {
+				fmt.Fprintf(stdout, "Identity:\n"+
+					"  PV UUID: %v\n"+
+					"  Kernel Name: %v\n",
+					info.Identity.PvUUID,
+					info.Identity.PvName)
+				if info.Identity.Wwn != "" {
+					fmt.Fprintf(stdout, "  WWN: %v\n", info.Identity.Wwn)
+				}
+				for _, p := range info.Identity.IdPaths {
+					fmt.Fprintf(stdout, "  %v\n", p)
+				}
+			}
 
 			fmt.Fprintf(stdout, "Bricks:\n")
 			for _, d := range info.Bricks {
@@ -13,6 +13,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/spf13/cobra"
@@ -36,6 +37,9 @@ func init() {
 	nodeCommand.AddCommand(nodeRemoveCommand)
 	nodeCommand.AddCommand(nodeSetTagsCommand)
 	nodeCommand.AddCommand(nodeRmTagsCommand)
+	nodeCommand.AddCommand(nodeDisksCommand)
+	nodeCommand.AddCommand(nodeAutoAddDisksCommand)
+	nodeCommand.AddCommand(nodeHealthCommand)
 	nodeAddCommand.Flags().IntVar(&zone, "zone", 0, "The zone in which the node should reside")
 	nodeAddCommand.Flags().StringVar(&clusterId, "cluster", "", "The cluster in which the node should reside")
 	nodeAddCommand.Flags().StringVar(&managmentHostNames, "management-host-name", "", "Management host name")
@@ -44,12 +48,23 @@ func init() {
 		"Set the object to this exact set of tags. Overwrites existing tags.")
 	nodeRmTagsCommand.Flags().Bool("all", false,
 		"Remove all tags.")
+	nodeAutoAddDisksCommand.Flags().String("path-glob", "",
+		"Add unused disks with a path matching this pattern (e.g. /dev/disk/by-id/wwn-*)")
+	nodeAutoAddDisksCommand.Flags().StringSlice("tags", []string{},
+		"Tags (tag:value) to set on all added devices")
+	nodeAutoAddDisksCommand.Flags().StringSlice("ssd-tags", []string{},
+		"Tags (tag:value) to set on added non-rotational devices")
+	nodeAutoAddDisksCommand.Flags().StringSlice("hdd-tags", []string{},
+		"Tags (tag:value) to set on added rotational devices")
 	nodeAddCommand.SilenceUsage = true
 	nodeDeleteCommand.SilenceUsage = true
 	nodeInfoCommand.SilenceUsage = true
 	nodeListCommand.SilenceUsage = true
 	nodeRemoveCommand.SilenceUsage = true
 	nodeSetTagsCommand.SilenceUsage = true
+	nodeDisksCommand.SilenceUsage = true
+	nodeAutoAddDisksCommand.SilenceUsage = true
+	nodeHealthCommand.SilenceUsage = true
 }
 
 var nodeCommand = &cobra.Command{
@@ -405,3 +420,208 @@ var nodeRmTagsCommand = &cobra.Command{
 		return rmTagsCommand(cmd, heketi.NodeSetTags)
 	},
 }
+
+var nodeDisksCommand = &cobra.Command{
+	Use:     "disks [node_id]",
+	Short:   "Lists the disks present on a node",
+	Long:    "Lists the raw disks present on a node and whether they can be used by Heketi",
+	Example: "  $ heketi-cli node disks 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Node id missing")
+		}
+
+		// Set node id
+		nodeId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		info, err := heketi.NodeDisks(nodeId)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else {
+			for _, d := range info.Disks {
+				media := api.DiskMediaSSD
+				if d.Rotational {
+					media = api.DiskMediaHDD
+				}
+				status := "available"
+				if d.DeviceId != "" {
+					status = "device:" + d.DeviceId
+				} else if !d.Candidate() {
+					status = "in-use"
+				}
+				fmt.Fprintf(stdout, "Name:%-20v"+
+					"Size (GiB):%-8v"+
+					"Media:%-5v"+
+					"Status:%v\n",
+					d.Name,
+					d.Size/(1024*1024),
+					media,
+					status)
+				for _, p := range d.IdPaths {
+					fmt.Fprintf(stdout, "  %v\n", p)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+var nodeHealthCommand = &cobra.Command{
+	Use:     "health [node_id]",
+	Short:   "Shows the health of a node",
+	Long:    "Shows the health checks of a node and the latest changes of its health",
+	Example: "  $ heketi-cli node health 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Node id missing")
+		}
+
+		// Set node id
+		nodeId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		health, err := heketi.NodeHealth(nodeId)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(health)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else {
+			fmt.Fprintf(stdout, "Node Id: %v\n"+
+				"Host: %v\n"+
+				"State: %v\n",
+				health.NodeId,
+				health.Host,
+				health.State)
+			if !health.LastUpdate.IsZero() {
+				fmt.Fprintf(stdout, "Since: %v\n"+
+					"Last Update: %v\n",
+					health.Since.Format(time.RFC3339),
+					health.LastUpdate.Format(time.RFC3339))
+			}
+			if len(health.Checks) > 0 {
+				fmt.Fprintf(stdout, "Checks:\n")
+			}
+			for _, c := range health.Checks {
+				fmt.Fprintf(stdout, "  %-16v%-8v since %v  %v\n",
+					c.Name,
+					c.Status,
+					c.Since.Format(time.RFC3339),
+					c.Message)
+			}
+			if len(health.History) > 0 {
+				fmt.Fprintf(stdout, "History:\n")
+			}
+			for _, t := range health.History {
+				fmt.Fprintf(stdout, "  %v  %-9v %v\n",
+					t.Time.Format(time.RFC3339),
+					t.State,
+					t.Reason)
+			}
+		}
+		return nil
+	},
+}
+
+var nodeAutoAddDisksCommand = &cobra.Command{
+	Use:   "autoadd-disks [node_id]",
+	Short: "Adds unused disks on a node as devices",
+	Long: "Adds all unused disks on a node matching a path pattern as devices. " +
+		"Disks that are mounted or contain any signatures are never added.",
+	Example: `  * Add all unused disks with a WWN, tagging SSDs
+      $ heketi-cli node autoadd-disks 886a86a868711bef83001 \
+          --path-glob="/dev/disk/by-id/wwn-*" --ssd-tags=media:ssd`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Node id missing")
+		}
+		nodeId := cmd.Flags().Arg(0)
+
+		pathGlob, err := cmd.Flags().GetString("path-glob")
+		if err != nil {
+			return err
+		}
+		if pathGlob == "" {
+			return errors.New("Missing path glob")
+		}
+
+		req := &api.NodeDisksAddRequest{PathGlob: pathGlob}
+		for _, r := range []struct {
+			flag  string
+			media api.DiskMedia
+		}{
+			{"tags", api.DiskMediaAny},
+			{"ssd-tags", api.DiskMediaSSD},
+			{"hdd-tags", api.DiskMediaHDD},
+		} {
+			values, err := cmd.Flags().GetStringSlice(r.flag)
+			if err != nil {
+				return err
+			}
+			if len(values) == 0 {
+				continue
+			}
+			tags, err := parseTagValues(values)
+			if err != nil {
+				return err
+			}
+			req.TagRules = append(req.TagRules, api.DiskTagRule{
+				Media: r.media,
+				Tags:  tags,
+			})
+		}
+
+		// Create a client
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		info, err := heketi.NodeDisksAdd(nodeId, req)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else {
+			fmt.Fprintf(stdout, "Node %v has %v devices\n",
+				info.Id, len(info.DevicesInfo))
+		}
+		return nil
+	},
+}
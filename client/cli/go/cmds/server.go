@@ -13,9 +13,13 @@
 package cmds
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 
@@ -37,9 +41,20 @@ var operationsCommand = &cobra.Command{
 var opInfoTemplate = `Operation Counts:
   Total: {{.Total}}
   In-Flight: {{.InFlight}}
+  Queued: {{.Queued}}
   New: {{.New}}
   Failed: {{.Failed}}
   Stale: {{.Stale}}
+Operation Limits:
+  In-Flight: {{.Limits.Max}}
+  In-Flight Per Cluster: {{if .Limits.MaxPerCluster}}{{.Limits.MaxPerCluster}}{{else}}unlimited{{end}}
+  In-Flight Per Node: {{if .Limits.MaxPerNode}}{{.Limits.MaxPerNode}}{{else}}unlimited{{end}}
+{{- range $id, $n := .Limits.ClusterInFlight}}
+  In-Flight On Cluster {{$id}}: {{$n}}
+{{- end}}
+{{- range $id, $n := .Limits.NodeInFlight}}
+  In-Flight On Node {{$id}}: {{$n}}
+{{- end}}
 `
 
 var popListTemplate = `
@@ -167,6 +182,167 @@ var operationsCleanUpCommand = &cobra.Command{
 	},
 }
 
+var operationsCancelCommand = &cobra.Command{
+	Use:   "cancel [operation_id]",
+	Short: "Cancel a running operation",
+	Long: "Cancel a running operation. The operation stops at its next" +
+		" safe point and is rolled back.",
+	Example: `  $ heketi-cli server operations cancel 886a86a868711bef83001`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("Operation id missing")
+		}
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		id := args[0]
+		if err := heketi.PendingOperationCancel(id); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Cancellation of operation %v requested\n", id)
+		return nil
+	},
+}
+
+var opHistoryTemplate = `
+{{- range .Operations -}}
+Id:{{.Id}}  Type:{{.TypeName}}  Status:{{.Status}}  Caller:{{.Caller}}  Finished:{{.Finished.Format "2006-01-02T15:04:05Z07:00"}}  Duration:{{duration .Started .Finished}}
+{{- if .Error}}
+    Error: {{.Error}}
+{{- end}}
+{{- range .Resources}}
+    {{.Description}}: {{.Id}}
+{{- end}}
+{{ end -}}
+`
+
+var operationsHistoryCommand = &cobra.Command{
+	Use:   "history",
+	Short: "Get a list of completed and failed operations",
+	Long:  "Get a list of completed and failed operations, most recent first",
+	Example: `  $ heketi-cli server operations history
+  $ heketi-cli server operations history --status=failed --since=24h`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter := &api.OperationHistoryFilter{}
+		var err error
+		var status string
+		var since time.Duration
+		if filter.TypeName, err = cmd.Flags().GetString("type"); err != nil {
+			return err
+		}
+		if status, err = cmd.Flags().GetString("status"); err != nil {
+			return err
+		}
+		filter.Status = api.OperationHistoryStatus(status)
+		if filter.Caller, err = cmd.Flags().GetString("caller"); err != nil {
+			return err
+		}
+		if filter.Resource, err = cmd.Flags().GetString("resource"); err != nil {
+			return err
+		}
+		if since, err = cmd.Flags().GetDuration("since"); err != nil {
+			return err
+		}
+		if since > 0 {
+			filter.Since = time.Now().Add(-since).Unix()
+		}
+		if filter.Limit, err = cmd.Flags().GetInt("limit"); err != nil {
+			return err
+		}
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		history, err := heketi.OperationHistory(filter)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(history)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%v\n", string(data))
+			return nil
+		}
+		t, err := template.New("opHistory").Funcs(template.FuncMap{
+			"duration": func(start, end time.Time) time.Duration {
+				return end.Sub(start).Round(time.Millisecond)
+			},
+		}).Parse(opHistoryTemplate)
+		if err != nil {
+			return err
+		}
+		return t.Execute(stdout, history)
+	},
+}
+
+var opTranscriptTemplate = `
+{{- range .Commands -}}
+Host:{{.Host}}  Started:{{.Started.Format "2006-01-02T15:04:05Z07:00"}}  Duration:{{duration .Started .Finished}}  {{if .Completed}}Exit status:{{.ExitStatus}}{{else}}Not completed{{end}}
+    Command: {{.Command}}
+{{- if .Error}}
+    Error: {{.Error}}
+{{- end}}
+{{- if .Output}}
+    Output:
+{{indent .Output}}
+{{- end}}
+{{- if .ErrOutput}}
+    Error output:
+{{indent .ErrOutput}}
+{{- end}}
+{{ end -}}
+{{- if .Dropped}}{{.Dropped}} more commands not kept
+{{ end -}}
+`
+
+var operationsTranscriptCommand = &cobra.Command{
+	Use:   "transcript [operation_id]",
+	Short: "Get the commands run by an operation",
+	Long: "Get the commands run by a running or recently finished" +
+		" operation, with their output",
+	Example: `  $ heketi-cli server operations transcript 886a86a868711bef83001`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("Operation id missing")
+		}
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		transcript, err := heketi.OperationTranscript(args[0])
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(transcript)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%v\n", string(data))
+			return nil
+		}
+		t, err := template.New("opTranscript").Funcs(template.FuncMap{
+			"duration": func(start, end time.Time) time.Duration {
+				return end.Sub(start).Round(time.Millisecond)
+			},
+			"indent": func(s string) string {
+				s = strings.TrimRight(s, "\n")
+				return "        " + strings.Replace(s, "\n", "\n        ", -1)
+			},
+		}).Parse(opTranscriptTemplate)
+		if err != nil {
+			return err
+		}
+		return t.Execute(stdout, transcript)
+	},
+}
+
 var modeCommand = &cobra.Command{
 	Use:   "mode",
 	Short: "Manage server mode",
@@ -249,6 +425,92 @@ var stateExamineGlusterCommand = &cobra.Command{
 	},
 }
 
+var stateReportCommand = &cobra.Command{
+	Use:     "report",
+	Short:   "Show the most recent report of the state checker",
+	Long:    "Show the most recent report of the background state checker",
+	Example: `  $ heketi-cli server state report`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		result, err := heketi.StateReport()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "%v", result)
+
+		return nil
+	},
+}
+
+var stateRepairCommand = &cobra.Command{
+	Use:   "repair",
+	Short: "Repair differences between state of server and gluster",
+	Long: "Examine the state of gluster and fix the differences found.\n" +
+		"Unmounted bricks are mounted again, logical volumes not used by\n" +
+		"any brick are removed and volumes that do not match gluster are\n" +
+		"marked. Use --dry-run to only list the fixes.",
+	Example: `  $ heketi-cli server state repair --dry-run
+  $ heketi-cli server state repair --type=brick-unmounted`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		types, err := cmd.Flags().GetStringSlice("type")
+		if err != nil {
+			return err
+		}
+		req := &api.StateRepairRequest{DryRun: dryRun}
+		for _, t := range types {
+			req.Types = append(req.Types, api.DiscrepancyType(t))
+		}
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		response, err := heketi.StateRepair(req)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(response)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%v\n", string(data))
+			return nil
+		}
+
+		if len(response.Fixes) == 0 {
+			fmt.Fprintf(stdout, "No discrepancies found\n")
+			return nil
+		}
+		for _, fix := range response.Fixes {
+			var status string
+			switch {
+			case fix.Action == api.RepairNone:
+				status = "skipped: " + fix.Reason
+			case fix.Error != "":
+				status = "failed: " + fix.Error
+			case fix.Applied:
+				status = "applied"
+			default:
+				status = "proposed"
+			}
+			fmt.Fprintf(stdout, "%v [%v] %v\n",
+				fix.Action, status, fix.Discrepancy.Description)
+		}
+		return nil
+	},
+}
+
 func init() {
 	RootCmd.AddCommand(serverCommand)
 	// operations command(s)
@@ -260,6 +522,24 @@ func init() {
 	operationsListCommand.SilenceUsage = true
 	operationsCommand.AddCommand(operationsCleanUpCommand)
 	operationsCleanUpCommand.SilenceUsage = true
+	operationsCommand.AddCommand(operationsCancelCommand)
+	operationsCancelCommand.SilenceUsage = true
+	operationsCommand.AddCommand(operationsHistoryCommand)
+	operationsHistoryCommand.SilenceUsage = true
+	operationsCommand.AddCommand(operationsTranscriptCommand)
+	operationsTranscriptCommand.SilenceUsage = true
+	operationsHistoryCommand.Flags().String("type", "",
+		"Only list operations of the given type, e.g. create-volume")
+	operationsHistoryCommand.Flags().String("status", "",
+		"Only list operations with the given status: succeeded, failed")
+	operationsHistoryCommand.Flags().String("caller", "",
+		"Only list operations started by the given caller")
+	operationsHistoryCommand.Flags().String("resource", "",
+		"Only list operations that changed the item with the given id")
+	operationsHistoryCommand.Flags().Duration("since", 0,
+		"Only list operations finished within the given time, e.g. 24h")
+	operationsHistoryCommand.Flags().Int("limit", 0,
+		"Maximum number of operations listed")
 	// admin mode command(s)
 	serverCommand.AddCommand(modeCommand)
 	modeCommand.SilenceUsage = true
@@ -274,4 +554,13 @@ func init() {
 	stateExamineCommand.SilenceUsage = true
 	stateExamineCommand.AddCommand(stateExamineGlusterCommand)
 	stateExamineGlusterCommand.SilenceUsage = true
+	stateCommand.AddCommand(stateReportCommand)
+	stateReportCommand.SilenceUsage = true
+	stateCommand.AddCommand(stateRepairCommand)
+	stateRepairCommand.SilenceUsage = true
+	stateRepairCommand.Flags().Bool("dry-run", false,
+		"Only list the fixes without applying them")
+	stateRepairCommand.Flags().StringSlice("type", []string{},
+		"Only fix discrepancies of the given types: volume-missing, "+
+			"volume-extra, brick-path-mismatch, brick-unmounted, orphaned-lv")
 }
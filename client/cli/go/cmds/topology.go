@@ -13,7 +13,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -33,6 +35,8 @@ var jsonConfigFile string
 type ConfigFileDeviceOptions struct {
 	api.Device
 	DestroyData bool `json:"destroydata,omitempty"`
+	// State is only used by topology apply
+	State api.EntryState `json:"state,omitempty"`
 }
 
 type ConfigFileDevice struct {
@@ -41,6 +45,8 @@ type ConfigFileDevice struct {
 type ConfigFileNode struct {
 	Devices []*ConfigFileDevice `json:"devices"`
 	Node    api.NodeAddRequest  `json:"node"`
+	// State is only used by topology apply
+	State api.EntryState `json:"state,omitempty"`
 }
 type ConfigFileCluster struct {
 	Nodes []ConfigFileNode `json:"nodes"`
@@ -76,17 +82,46 @@ func (device *ConfigFileDevice) UnmarshalJSON(b []byte) error {
 	device.Name = d.Name
 	device.Tags = d.Tags
 	device.DestroyData = d.DestroyData
+	device.State = d.State
 	return nil
 }
 
+// loadTopologyFile reads and parses a topology configuration file.
+func loadTopologyFile(path string) (*ConfigFile, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("Unable to open config file")
+	}
+	defer fp.Close()
+	configParser := json.NewDecoder(fp)
+	var topology ConfigFile
+	if err = configParser.Decode(&topology); err != nil {
+		return nil, errors.New("Unable to parse config file")
+	}
+	return &topology, nil
+}
+
 func init() {
 	RootCmd.AddCommand(topologyCommand)
 	topologyCommand.AddCommand(topologyLoadCommand)
 	topologyCommand.AddCommand(topologyInfoCommand)
+	topologyCommand.AddCommand(topologyApplyCommand)
+	topologyCommand.AddCommand(topologyExportCommand)
 	topologyLoadCommand.Flags().StringVarP(&jsonConfigFile, "json", "j", "",
 		"\n\tConfiguration containing devices, nodes, and clusters, in"+
 			"\n\tJSON format.")
+	topologyApplyCommand.Flags().StringVarP(&jsonConfigFile, "json", "j", "",
+		"\n\tConfiguration containing devices, nodes, and clusters, in"+
+			"\n\tJSON format.")
+	topologyApplyCommand.Flags().Bool("prune", false,
+		"\n\tRemove nodes and devices that are not in the configuration file.")
+	topologyApplyCommand.Flags().Bool("dry-run", false,
+		"\n\tOnly print the changes that would be made.")
 	topologyLoadCommand.SilenceUsage = true
+	topologyExportCommand.Flags().StringP("output", "o", "",
+		"\n\tFile to write the configuration to. Defaults to stdout.")
+	topologyApplyCommand.SilenceUsage = true
+	topologyExportCommand.SilenceUsage = true
 	topologyInfoCommand.SilenceUsage = true
 }
 
@@ -142,15 +177,9 @@ var topologyLoadCommand = &cobra.Command{
 		}
 
 		// Load config file
-		fp, err := os.Open(jsonConfigFile)
+		topology, err := loadTopologyFile(jsonConfigFile)
 		if err != nil {
-			return errors.New("Unable to open config file")
-		}
-		defer fp.Close()
-		configParser := json.NewDecoder(fp)
-		var topology ConfigFile
-		if err = configParser.Decode(&topology); err != nil {
-			return errors.New("Unable to parse config file")
+			return err
 		}
 
 		// Create client
@@ -272,6 +301,89 @@ var topologyLoadCommand = &cobra.Command{
 	},
 }
 
+// exportTopology converts the current topology into a configuration
+// file accepted by topology load. Removed nodes and devices are left
+// out as they would not be added to a new cluster.
+func exportTopology(t *api.TopologyInfoResponse) *ConfigFile {
+	topology := &ConfigFile{Clusters: []ConfigFileCluster{}}
+	for _, c := range t.ClusterList {
+		block, file := c.Block, c.File
+		cluster := ConfigFileCluster{
+			Nodes: []ConfigFileNode{},
+			Block: &block,
+			File:  &file,
+		}
+		for _, n := range c.Nodes {
+			if n.State == api.EntryStateFailed {
+				continue
+			}
+			node := ConfigFileNode{
+				Devices: []*ConfigFileDevice{},
+				Node:    n.NodeAddRequest,
+			}
+			node.Node.ClusterId = ""
+			if n.State != api.EntryStateOnline {
+				node.State = n.State
+			}
+			for _, d := range n.DevicesInfo {
+				if d.State == api.EntryStateFailed {
+					continue
+				}
+				device := &ConfigFileDevice{}
+				device.Device = d.Device
+				if d.State != api.EntryStateOnline {
+					device.State = d.State
+				}
+				node.Devices = append(node.Devices, device)
+			}
+			sort.Slice(node.Devices, func(i, j int) bool {
+				return node.Devices[i].Name < node.Devices[j].Name
+			})
+			cluster.Nodes = append(cluster.Nodes, node)
+		}
+		sort.Slice(cluster.Nodes, func(i, j int) bool {
+			return cluster.Nodes[i].Node.Hostnames.Manage[0] <
+				cluster.Nodes[j].Node.Hostnames.Manage[0]
+		})
+		topology.Clusters = append(topology.Clusters, cluster)
+	}
+	return topology
+}
+
+var topologyExportCommand = &cobra.Command{
+	Use:   "export",
+	Short: "Writes the current Topology as a configuration file",
+	Long: "Writes the current Topology in the format used by " +
+		"topology load and topology apply",
+	Example: " $ heketi-cli topology export -o topo.json",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		topoinfo, err := heketi.TopologyInfo()
+		if err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(exportTopology(topoinfo), "", "    ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		if output == "" {
+			_, err = stdout.Write(data)
+			return err
+		}
+		return ioutil.WriteFile(output, data, 0644)
+	},
+}
+
 var topologyInfoCommand = &cobra.Command{
 	Use:     "info",
 	Short:   "Retrieves information about the current Topology",
@@ -0,0 +1,543 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+// topologyStep is a single change needed to make heketi match
+// a topology file.
+type topologyStep struct {
+	// symbol is "+" for additions, "~" for changes and "-" for removals
+	symbol string
+	desc   string
+	run    func() error
+}
+
+// topologyPlan is the ordered list of changes needed to make heketi
+// match a topology file, along with the differences that can not
+// be applied by heketi.
+type topologyPlan struct {
+	steps    []*topologyStep
+	warnings []string
+}
+
+func (p *topologyPlan) add(symbol, desc string, run func() error) {
+	p.steps = append(p.steps, &topologyStep{
+		symbol: symbol,
+		desc:   desc,
+		run:    run,
+	})
+}
+
+func (p *topologyPlan) warn(f string, v ...interface{}) {
+	p.warnings = append(p.warnings, fmt.Sprintf(f, v...))
+}
+
+func (p *topologyPlan) print() {
+	if len(p.steps) == 0 {
+		fmt.Fprintf(stdout, "No changes. Heketi matches the topology file.\n")
+	} else {
+		fmt.Fprintf(stdout, "Plan:\n")
+		for _, s := range p.steps {
+			fmt.Fprintf(stdout, "  %v %v\n", s.symbol, s.desc)
+		}
+	}
+	if len(p.warnings) != 0 {
+		fmt.Fprintf(stdout, "Not applied:\n")
+		for _, w := range p.warnings {
+			fmt.Fprintf(stdout, "  ! %v\n", w)
+		}
+	}
+}
+
+func (p *topologyPlan) apply() error {
+	for _, s := range p.steps {
+		fmt.Fprintf(stdout, "%v %v ... ", s.symbol, s.desc)
+		if err := s.run(); err != nil {
+			fmt.Fprintf(stdout, "FAILED\n")
+			return fmt.Errorf("Unable to %v: %v", s.desc, err)
+		}
+		fmt.Fprintf(stdout, "OK\n")
+	}
+	return nil
+}
+
+func tagsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func tagsString(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "(none)"
+	}
+	keys := []string{}
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s := []string{}
+	for _, k := range keys {
+		s = append(s, k+":"+tags[k])
+	}
+	return strings.Join(s, " ")
+}
+
+// stateChangeVerb returns the plan description of moving an
+// online node or device to the given state.
+func stateChangeVerb(s api.EntryState) string {
+	if s == api.EntryStateOffline {
+		return "disable"
+	}
+	return "enable"
+}
+
+// topologyClient is the part of the heketi client used to apply a
+// topology plan.
+type topologyClient interface {
+	ClusterCreate(request *api.ClusterCreateRequest) (*api.ClusterInfoResponse, error)
+	ClusterSetFlags(id string, request *api.ClusterSetFlagsRequest) error
+	ClusterDelete(id string) error
+	NodeAdd(request *api.NodeAddRequest) (*api.NodeInfoResponse, error)
+	NodeInfo(id string) (*api.NodeInfoResponse, error)
+	NodeState(id string, request *api.StateRequest) error
+	NodeSetTags(id string, request *api.TagsChangeRequest) error
+	NodeDelete(id string) error
+	DeviceAdd(request *api.DeviceAddRequest) error
+	DeviceState(id string, request *api.StateRequest) error
+	DeviceSetTags(id string, request *api.TagsChangeRequest) error
+	DeviceDelete(id string) error
+}
+
+// planTopology returns the changes needed to make heketi, whose
+// current topology is given, match the topology file. The steps of the
+// plan are applied with the given client. Nodes and devices not in the
+// file are only removed if prune is set.
+func planTopology(heketi topologyClient, current *api.TopologyInfoResponse,
+	topology *ConfigFile, prune bool) *topologyPlan {
+
+	tp := &topologyPlanner{
+		heketi:       heketi,
+		current:      current,
+		prune:        prune,
+		plan:         &topologyPlan{},
+		fileNodes:    map[string]bool{},
+		fileClusters: map[string]bool{},
+	}
+	for _, cluster := range topology.Clusters {
+		tp.planCluster(cluster)
+	}
+	if tp.prune {
+		tp.planPrune()
+	}
+	return tp.plan
+}
+
+// topologyPlanner computes the plan for a topology file.
+type topologyPlanner struct {
+	heketi  topologyClient
+	current *api.TopologyInfoResponse
+	prune   bool
+	plan    *topologyPlan
+
+	// manage hostnames of the nodes in the topology file
+	fileNodes map[string]bool
+	// ids of the clusters matched by clusters in the topology file
+	fileClusters map[string]bool
+}
+
+func (tp *topologyPlanner) planCluster(cluster ConfigFileCluster) {
+	// the cluster is identified by the nodes it contains
+	var existing *api.Cluster
+	for _, node := range cluster.Nodes {
+		if n := getNodeIdFromHeketiTopology(tp.current,
+			node.Node.Hostnames.Manage[0]); n != nil {
+			existing = tp.clusterById(n.ClusterId)
+			break
+		}
+	}
+
+	flags := api.ClusterFlags{Block: true, File: true}
+	if cluster.Block != nil {
+		flags.Block = *cluster.Block
+	}
+	if cluster.File != nil {
+		flags.File = *cluster.File
+	}
+
+	clusterId := new(string)
+	if existing == nil {
+		tp.plan.add("+", fmt.Sprintf("create cluster (file: %v, block: %v)",
+			flags.File, flags.Block),
+			func() error {
+				req := &api.ClusterCreateRequest{ClusterFlags: flags}
+				info, err := tp.heketi.ClusterCreate(req)
+				if err != nil {
+					return err
+				}
+				*clusterId = info.Id
+				return nil
+			})
+	} else {
+		*clusterId = existing.Id
+		tp.fileClusters[existing.Id] = true
+		if (cluster.Block != nil && *cluster.Block != existing.Block) ||
+			(cluster.File != nil && *cluster.File != existing.File) {
+			// unspecified flags keep their current value
+			if cluster.Block == nil {
+				flags.Block = existing.Block
+			}
+			if cluster.File == nil {
+				flags.File = existing.File
+			}
+			tp.plan.add("~", fmt.Sprintf(
+				"set flags of cluster %v (file: %v, block: %v)",
+				existing.Id, flags.File, flags.Block),
+				func() error {
+					req := &api.ClusterSetFlagsRequest{ClusterFlags: flags}
+					return tp.heketi.ClusterSetFlags(existing.Id, req)
+				})
+		}
+	}
+
+	for _, node := range cluster.Nodes {
+		tp.planNode(node, clusterId, existing)
+	}
+}
+
+func (tp *topologyPlanner) clusterById(id string) *api.Cluster {
+	for i := range tp.current.ClusterList {
+		if tp.current.ClusterList[i].Id == id {
+			return &tp.current.ClusterList[i]
+		}
+	}
+	return nil
+}
+
+func (tp *topologyPlanner) planNode(node ConfigFileNode,
+	clusterId *string, cluster *api.Cluster) {
+
+	host := node.Node.Hostnames.Manage[0]
+	tp.fileNodes[host] = true
+
+	existing := getNodeIdFromHeketiTopology(tp.current, host)
+	nodeId := new(string)
+	if existing == nil {
+		tp.plan.add("+", fmt.Sprintf("add node %v (zone: %v)",
+			host, node.Node.Zone),
+			func() error {
+				req := node.Node
+				req.ClusterId = *clusterId
+				info, err := tp.heketi.NodeAdd(&req)
+				if err != nil {
+					return err
+				}
+				*nodeId = info.Id
+				return nil
+			})
+		if node.State == api.EntryStateOffline {
+			tp.plan.add("~", fmt.Sprintf("disable node %v", host),
+				func() error {
+					return tp.heketi.NodeState(*nodeId,
+						&api.StateRequest{State: api.EntryStateOffline})
+				})
+		}
+		for _, device := range node.Devices {
+			tp.planDevice(device, host, nodeId, nil)
+		}
+		return
+	}
+
+	*nodeId = existing.Id
+	if cluster != nil && existing.ClusterId != cluster.Id {
+		tp.plan.warn("node %v is in cluster %v, not %v: "+
+			"nodes can not be moved between clusters",
+			host, existing.ClusterId, cluster.Id)
+	}
+	if node.Node.Zone != existing.Zone {
+		tp.plan.warn("zone of node %v: %v -> %v: "+
+			"the zone of a node can not be changed",
+			host, existing.Zone, node.Node.Zone)
+	}
+	if strings.Join(node.Node.Hostnames.Storage, ",") !=
+		strings.Join(existing.Hostnames.Storage, ",") {
+		tp.plan.warn("storage hostnames of node %v: %v -> %v: "+
+			"the hostnames of a node can not be changed",
+			host, existing.Hostnames.Storage, node.Node.Hostnames.Storage)
+	}
+	if !tagsEqual(node.Node.Tags, existing.Tags) {
+		tags := node.Node.Tags
+		tp.plan.add("~", fmt.Sprintf("set tags of node %v: %v -> %v",
+			host, tagsString(existing.Tags), tagsString(tags)),
+			func() error {
+				return tp.heketi.NodeSetTags(existing.Id, &api.TagsChangeRequest{
+					Tags:   tags,
+					Change: api.SetTags,
+				})
+			})
+	}
+	tp.planState(fmt.Sprintf("node %v", host), existing.State, node.State,
+		func(s api.EntryState) error {
+			return tp.heketi.NodeState(existing.Id, &api.StateRequest{State: s})
+		})
+
+	for _, device := range node.Devices {
+		tp.planDevice(device, host, nodeId, existing)
+	}
+	if tp.prune {
+		for _, d := range existing.DevicesInfo {
+			if !configHasDevice(node, d.Name) {
+				tp.planRemoveDevice(host, d)
+			}
+		}
+	}
+}
+
+// planState adds the steps moving a node or device between the online
+// and offline states. Removed entities are never brought back.
+func (tp *topologyPlanner) planState(what string,
+	current, desired api.EntryState, set func(api.EntryState) error) {
+
+	if desired == "" {
+		desired = api.EntryStateOnline
+	}
+	if current == desired {
+		return
+	}
+	if current == api.EntryStateFailed {
+		tp.plan.warn("%v is removed and can not be set %v", what, desired)
+		return
+	}
+	tp.plan.add("~", fmt.Sprintf("%v %v", stateChangeVerb(desired), what),
+		func() error {
+			return set(desired)
+		})
+}
+
+func configHasDevice(node ConfigFileNode, name string) bool {
+	for _, d := range node.Devices {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (tp *topologyPlanner) planDevice(device *ConfigFileDevice,
+	host string, nodeId *string, node *api.NodeInfoResponse) {
+
+	what := fmt.Sprintf("device %v:%v", host, device.Name)
+
+	var existing *api.DeviceInfoResponse
+	if node != nil {
+		existing = getDeviceIdFromHeketiTopology(tp.current, host, device.Name)
+	}
+	if existing == nil {
+		deviceId := new(string)
+		tp.plan.add("+", fmt.Sprintf("add %v", what),
+			func() error {
+				req := &api.DeviceAddRequest{}
+				req.Name = device.Name
+				req.NodeId = *nodeId
+				req.Tags = device.Tags
+				req.DestroyData = device.DestroyData
+				if err := tp.heketi.DeviceAdd(req); err != nil {
+					return err
+				}
+				// the device id is needed if the device is to be disabled
+				info, err := tp.heketi.NodeInfo(*nodeId)
+				if err != nil {
+					return err
+				}
+				for _, d := range info.DevicesInfo {
+					if d.Name == device.Name {
+						*deviceId = d.Id
+					}
+				}
+				return nil
+			})
+		if device.State == api.EntryStateOffline {
+			tp.plan.add("~", fmt.Sprintf("disable %v", what),
+				func() error {
+					return tp.heketi.DeviceState(*deviceId,
+						&api.StateRequest{State: api.EntryStateOffline})
+				})
+		}
+		return
+	}
+
+	if !tagsEqual(device.Tags, existing.Tags) {
+		tags := device.Tags
+		tp.plan.add("~", fmt.Sprintf("set tags of %v: %v -> %v",
+			what, tagsString(existing.Tags), tagsString(tags)),
+			func() error {
+				return tp.heketi.DeviceSetTags(existing.Id, &api.TagsChangeRequest{
+					Tags:   tags,
+					Change: api.SetTags,
+				})
+			})
+	}
+	tp.planState(what, existing.State, device.State,
+		func(s api.EntryState) error {
+			return tp.heketi.DeviceState(existing.Id, &api.StateRequest{State: s})
+		})
+}
+
+// planRemoveDevice adds the steps needed to remove a device: the device
+// is disabled, its bricks are moved to other devices and the device
+// is deleted.
+func (tp *topologyPlanner) planRemoveDevice(host string,
+	d api.DeviceInfoResponse) {
+
+	tp.plan.add("-", fmt.Sprintf("remove device %v:%v (%v bricks)",
+		host, d.Name, len(d.Bricks)),
+		func() error {
+			return tp.removeDevice(d.Id, d.State)
+		})
+}
+
+func (tp *topologyPlanner) removeDevice(id string, state api.EntryState) error {
+	if state == api.EntryStateOnline {
+		err := tp.heketi.DeviceState(id,
+			&api.StateRequest{State: api.EntryStateOffline})
+		if err != nil {
+			return err
+		}
+	}
+	if state != api.EntryStateFailed {
+		err := tp.heketi.DeviceState(id,
+			&api.StateRequest{State: api.EntryStateFailed})
+		if err != nil {
+			return err
+		}
+	}
+	return tp.heketi.DeviceDelete(id)
+}
+
+// planPrune adds the steps removing the nodes that are not in the
+// topology file, as well as the clusters left empty.
+func (tp *topologyPlanner) planPrune() {
+	for _, c := range tp.current.ClusterList {
+		pruned := 0
+		for _, n := range c.Nodes {
+			host := n.Hostnames.Manage[0]
+			if tp.fileNodes[host] {
+				continue
+			}
+			pruned++
+			node := n
+			tp.plan.add("-", fmt.Sprintf("remove node %v (%v devices)",
+				host, len(node.DevicesInfo)),
+				func() error {
+					return tp.removeNode(node)
+				})
+		}
+		if tp.fileClusters[c.Id] || pruned != len(c.Nodes) {
+			continue
+		}
+		if len(c.Volumes) != 0 {
+			tp.plan.warn("cluster %v is not in the topology file "+
+				"but has %v volumes", c.Id, len(c.Volumes))
+			continue
+		}
+		id := c.Id
+		tp.plan.add("-", fmt.Sprintf("delete cluster %v", id),
+			func() error {
+				return tp.heketi.ClusterDelete(id)
+			})
+	}
+}
+
+func (tp *topologyPlanner) removeNode(node api.NodeInfoResponse) error {
+	if node.State == api.EntryStateOnline {
+		err := tp.heketi.NodeState(node.Id,
+			&api.StateRequest{State: api.EntryStateOffline})
+		if err != nil {
+			return err
+		}
+	}
+	if node.State != api.EntryStateFailed {
+		err := tp.heketi.NodeState(node.Id,
+			&api.StateRequest{State: api.EntryStateFailed})
+		if err != nil {
+			return err
+		}
+	}
+	// removing the node has failed all of its devices
+	for _, d := range node.DevicesInfo {
+		if err := tp.removeDevice(d.Id, api.EntryStateFailed); err != nil {
+			return err
+		}
+	}
+	return tp.heketi.NodeDelete(node.Id)
+}
+
+var topologyApplyCommand = &cobra.Command{
+	Use:   "apply",
+	Short: "Make Heketi match a configuration file",
+	Long: "Compares a configuration file with the current topology, " +
+		"prints the changes needed and applies them. Nodes and devices " +
+		"not in the file are only removed when --prune is given.",
+	Example: `  * Show the changes that would be made:
+      $ heketi-cli topology apply --json=topo.json --dry-run
+
+  * Apply the file, removing nodes and devices not in the file:
+      $ heketi-cli topology apply --json=topo.json --prune`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if jsonConfigFile == "" {
+			return errors.New("Missing configuration file")
+		}
+		prune, err := cmd.Flags().GetBool("prune")
+		if err != nil {
+			return err
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		topology, err := loadTopologyFile(jsonConfigFile)
+		if err != nil {
+			return err
+		}
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		current, err := heketi.TopologyInfo()
+		if err != nil {
+			return fmt.Errorf("Unable to get topology information: %v", err)
+		}
+
+		plan := planTopology(heketi, current, topology, prune)
+		plan.print()
+		if dryRun || len(plan.steps) == 0 {
+			return nil
+		}
+		fmt.Fprintf(stdout, "\n")
+		return plan.apply()
+	},
+}
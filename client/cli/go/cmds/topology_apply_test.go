@@ -0,0 +1,334 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// fakeTopologyClient records the calls made while a plan is applied.
+type fakeTopologyClient struct {
+	calls []string
+}
+
+func (f *fakeTopologyClient) call(format string, v ...interface{}) {
+	f.calls = append(f.calls, fmt.Sprintf(format, v...))
+}
+
+func (f *fakeTopologyClient) ClusterCreate(
+	request *api.ClusterCreateRequest) (*api.ClusterInfoResponse, error) {
+
+	f.call("ClusterCreate")
+	return &api.ClusterInfoResponse{Id: "new-cluster"}, nil
+}
+
+func (f *fakeTopologyClient) ClusterSetFlags(id string,
+	request *api.ClusterSetFlagsRequest) error {
+
+	f.call("ClusterSetFlags %v", id)
+	return nil
+}
+
+func (f *fakeTopologyClient) ClusterDelete(id string) error {
+	f.call("ClusterDelete %v", id)
+	return nil
+}
+
+func (f *fakeTopologyClient) NodeAdd(
+	request *api.NodeAddRequest) (*api.NodeInfoResponse, error) {
+
+	f.call("NodeAdd %v %v", request.Hostnames.Manage[0], request.ClusterId)
+	n := &api.NodeInfoResponse{}
+	n.Id = "new-node"
+	return n, nil
+}
+
+func (f *fakeTopologyClient) NodeInfo(id string) (*api.NodeInfoResponse, error) {
+	f.call("NodeInfo %v", id)
+	return &api.NodeInfoResponse{}, nil
+}
+
+func (f *fakeTopologyClient) NodeState(id string, request *api.StateRequest) error {
+	f.call("NodeState %v %v", id, request.State)
+	return nil
+}
+
+func (f *fakeTopologyClient) NodeSetTags(id string,
+	request *api.TagsChangeRequest) error {
+
+	f.call("NodeSetTags %v", id)
+	return nil
+}
+
+func (f *fakeTopologyClient) NodeDelete(id string) error {
+	f.call("NodeDelete %v", id)
+	return nil
+}
+
+func (f *fakeTopologyClient) DeviceAdd(request *api.DeviceAddRequest) error {
+	f.call("DeviceAdd %v %v", request.NodeId, request.Name)
+	return nil
+}
+
+func (f *fakeTopologyClient) DeviceState(id string, request *api.StateRequest) error {
+	f.call("DeviceState %v %v", id, request.State)
+	return nil
+}
+
+func (f *fakeTopologyClient) DeviceSetTags(id string,
+	request *api.TagsChangeRequest) error {
+
+	f.call("DeviceSetTags %v", id)
+	return nil
+}
+
+func (f *fakeTopologyClient) DeviceDelete(id string) error {
+	f.call("DeviceDelete %v", id)
+	return nil
+}
+
+func testNode(host string, zone int, devices ...string) api.NodeInfoResponse {
+	n := api.NodeInfoResponse{State: api.EntryStateOnline}
+	n.Id = host + "-id"
+	n.Zone = zone
+	n.Hostnames.Manage = []string{host}
+	n.Hostnames.Storage = []string{host + "-storage"}
+	for _, name := range devices {
+		d := api.DeviceInfoResponse{State: api.EntryStateOnline}
+		d.Id = host + name + "-id"
+		d.Name = name
+		n.DevicesInfo = append(n.DevicesInfo, d)
+	}
+	return n
+}
+
+func testCluster(id string, nodes ...api.NodeInfoResponse) api.Cluster {
+	c := api.Cluster{Id: id, Nodes: nodes}
+	c.Block, c.File = true, true
+	for i := range c.Nodes {
+		c.Nodes[i].ClusterId = id
+	}
+	return c
+}
+
+func testFileNode(host string, zone int, devices ...string) ConfigFileNode {
+	n := ConfigFileNode{}
+	n.Node.Zone = zone
+	n.Node.Hostnames.Manage = []string{host}
+	n.Node.Hostnames.Storage = []string{host + "-storage"}
+	for _, name := range devices {
+		d := &ConfigFileDevice{}
+		d.Name = name
+		n.Devices = append(n.Devices, d)
+	}
+	return n
+}
+
+func testFileCluster(nodes ...ConfigFileNode) ConfigFileCluster {
+	return ConfigFileCluster{Nodes: nodes}
+}
+
+func TestPlanTopology(t *testing.T) {
+	tagged := testFileNode("host1", 1, "/dev/sdb")
+	tagged.Node.Tags = map[string]string{"arbiter": "required"}
+	offline := testFileNode("host1", 1, "/dev/sdb")
+	offline.State = api.EntryStateOffline
+	noBlock := testFileCluster(tagged)
+	noBlock.Block = new(bool)
+
+	table := []struct {
+		name     string
+		current  []api.Cluster
+		file     []ConfigFileCluster
+		prune    bool
+		steps    []string
+		warnings []string
+	}{
+		{
+			name: "unchanged",
+			current: []api.Cluster{
+				testCluster("c1", testNode("host1", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(testFileNode("host1", 1, "/dev/sdb")),
+			},
+			prune: true,
+		},
+		{
+			name: "add device",
+			current: []api.Cluster{
+				testCluster("c1", testNode("host1", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(testFileNode("host1", 1, "/dev/sdb", "/dev/sdc")),
+			},
+			steps: []string{"+ add device host1:/dev/sdc"},
+		},
+		{
+			name: "add node",
+			current: []api.Cluster{
+				testCluster("c1", testNode("host1", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(
+					testFileNode("host1", 1, "/dev/sdb"),
+					testFileNode("host2", 2, "/dev/sdb")),
+			},
+			steps: []string{
+				"+ add node host2 (zone: 2)",
+				"+ add device host2:/dev/sdb",
+			},
+		},
+		{
+			name: "add cluster",
+			file: []ConfigFileCluster{
+				testFileCluster(testFileNode("host1", 1, "/dev/sdb")),
+			},
+			steps: []string{
+				"+ create cluster (file: true, block: true)",
+				"+ add node host1 (zone: 1)",
+				"+ add device host1:/dev/sdb",
+			},
+		},
+		{
+			name: "change flags and tags",
+			current: []api.Cluster{
+				testCluster("c1", testNode("host1", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{noBlock},
+			steps: []string{
+				"~ set flags of cluster c1 (file: true, block: false)",
+				"~ set tags of node host1: (none) -> arbiter:required",
+			},
+		},
+		{
+			name: "disable node",
+			current: []api.Cluster{
+				testCluster("c1", testNode("host1", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(offline),
+			},
+			steps: []string{"~ disable node host1"},
+		},
+		{
+			name: "changes that can not be applied",
+			current: []api.Cluster{
+				testCluster("c1", testNode("host1", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(testFileNode("host1", 2, "/dev/sdb")),
+			},
+			warnings: []string{
+				"zone of node host1: 1 -> 2: the zone of a node can not be changed",
+			},
+		},
+		{
+			name: "remove without prune",
+			current: []api.Cluster{
+				testCluster("c1",
+					testNode("host1", 1, "/dev/sdb", "/dev/sdc"),
+					testNode("host2", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(testFileNode("host1", 1, "/dev/sdb")),
+			},
+		},
+		{
+			name: "remove device",
+			current: []api.Cluster{
+				testCluster("c1", testNode("host1", 1, "/dev/sdb", "/dev/sdc")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(testFileNode("host1", 1, "/dev/sdb")),
+			},
+			prune: true,
+			steps: []string{"- remove device host1:/dev/sdc (0 bricks)"},
+		},
+		{
+			name: "remove node",
+			current: []api.Cluster{
+				testCluster("c1",
+					testNode("host1", 1, "/dev/sdb"),
+					testNode("host2", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(testFileNode("host1", 1, "/dev/sdb")),
+			},
+			prune: true,
+			steps: []string{"- remove node host2 (1 devices)"},
+		},
+		{
+			name: "remove cluster",
+			current: []api.Cluster{
+				testCluster("c1", testNode("host1", 1, "/dev/sdb")),
+				testCluster("c2", testNode("host2", 1, "/dev/sdb")),
+			},
+			file: []ConfigFileCluster{
+				testFileCluster(testFileNode("host1", 1, "/dev/sdb")),
+			},
+			prune: true,
+			steps: []string{
+				"- remove node host2 (1 devices)",
+				"- delete cluster c2",
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			current := &api.TopologyInfoResponse{ClusterList: test.current}
+			plan := planTopology(&fakeTopologyClient{}, current,
+				&ConfigFile{Clusters: test.file}, test.prune)
+			steps := []string{}
+			for _, s := range plan.steps {
+				steps = append(steps, s.symbol+" "+s.desc)
+			}
+			tests.Assert(t, fmt.Sprint(steps) == fmt.Sprint(test.steps),
+				"expected", test.steps, "got", steps)
+			tests.Assert(t, fmt.Sprint(plan.warnings) == fmt.Sprint(test.warnings),
+				"expected", test.warnings, "got", plan.warnings)
+		})
+	}
+}
+
+func TestApplyTopologyPlan(t *testing.T) {
+	stdout = ioutil.Discard
+	current := &api.TopologyInfoResponse{ClusterList: []api.Cluster{
+		testCluster("c1", testNode("host1", 1, "/dev/sdb")),
+		testCluster("c2", testNode("host2", 1, "/dev/sdb")),
+	}}
+	file := &ConfigFile{Clusters: []ConfigFileCluster{
+		testFileCluster(testFileNode("host1", 1, "/dev/sdb"),
+			testFileNode("host3", 1, "/dev/sdc")),
+	}}
+
+	heketi := &fakeTopologyClient{}
+	err := planTopology(heketi, current, file, true).apply()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	expected := []string{
+		"NodeAdd host3 c1",
+		"DeviceAdd new-node /dev/sdc",
+		"NodeInfo new-node",
+		"NodeState host2-id offline",
+		"NodeState host2-id failed",
+		"DeviceDelete host2/dev/sdb-id",
+		"NodeDelete host2-id",
+		"ClusterDelete c2",
+	}
+	tests.Assert(t, fmt.Sprint(heketi.calls) == fmt.Sprint(expected),
+		"expected", expected, "got", heketi.calls)
+}
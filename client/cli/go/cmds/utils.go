@@ -39,15 +39,9 @@ func setTagsCommand(cmd *cobra.Command,
 
 	id = s[0]
 
-	newTags := map[string]string{}
-	for _, t := range s[1:] {
-		parts := strings.SplitN(t, ":", 2)
-		if len(parts) < 2 {
-			return fmt.Errorf(
-				"expected colon (:) between tag name and value, got: %v",
-				t)
-		}
-		newTags[parts[0]] = parts[1]
+	newTags, err := parseTagValues(s[1:])
+	if err != nil {
+		return err
 	}
 
 	var req *api.TagsChangeRequest
@@ -60,6 +54,21 @@ func setTagsCommand(cmd *cobra.Command,
 	return submitTags(id, req)
 }
 
+// parseTagValues converts a list of tag:value strings into a map.
+func parseTagValues(values []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, t := range values {
+		parts := strings.SplitN(t, ":", 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf(
+				"expected colon (:) between tag name and value, got: %v",
+				t)
+		}
+		tags[parts[0]] = parts[1]
+	}
+	return tags, nil
+}
+
 func rmTagsCommand(cmd *cobra.Command,
 	submitTags func(id string, r *api.TagsChangeRequest) error) error {
 
@@ -109,6 +109,14 @@ func init() {
 	volumeCloneCommand.Flags().StringVar(&volname, "name", "",
 		"\n\tOptional: Name of the newly cloned volume.")
 	volumeCloneCommand.SilenceUsage = true
+
+	volumeCommand.AddCommand(volumeImportCommand)
+	volumeImportCommand.Flags().StringVar(&volname, "name", "",
+		"\n\tName of the existing gluster volume")
+	volumeImportCommand.Flags().StringVar(&clusters, "cluster", "",
+		"\n\tOptional: Id of the cluster hosting the volume."+
+			"\n\tRequired if heketi manages more than one cluster.")
+	volumeImportCommand.SilenceUsage = true
 }
 
 var volumeCommand = &cobra.Command{
@@ -602,3 +610,43 @@ var volumeCloneCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var volumeImportCommand = &cobra.Command{
+	Use:   "import",
+	Short: "Imports an existing GlusterFS volume",
+	Long: "Imports a GlusterFS volume that was not created by Heketi. " +
+		"All bricks of the volume must be on devices managed by Heketi.",
+	Example: `  $ heketi-cli volume import --name=gv0 \
+      --cluster=886a86a868711bef83001`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if volname == "" {
+			return errors.New("Missing volume name")
+		}
+
+		req := &api.VolumeImportRequest{}
+		req.Name = volname
+		req.Cluster = clusters
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		// Import the volume
+		volume, err := heketi.VolumeImport(req)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(volume)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else {
+			printVolumeInfo(volume)
+		}
+		return nil
+	},
+}
@@ -292,6 +292,16 @@ func (s *CmdExecutor) removeBrickFromFstab(
 			paths.BrickIdToName(brick.Name),
 			s.Fstab),
 	}
+	// Bricks that were not created by heketi (e.g. imported volumes)
+	// do not carry the brick name in the fstab entry. Match those on
+	// the mount point instead.
+	if !strings.HasPrefix(brick.Path, paths.BrickMountPointParent(brick.VgId)+"/") {
+		commands = []string{
+			fmt.Sprintf("sed -i.save \"\\#[[:space:]]%v[[:space:]]#d\" %v",
+				brick.Path,
+				s.Fstab),
+		}
+	}
 	err := rex.AnyError(s.RemoteExecutor.ExecCommands(host, commands, 5))
 	if err != nil {
 		logger.Err(err)
@@ -299,6 +309,23 @@ func (s *CmdExecutor) removeBrickFromFstab(
 	return err
 }
 
+// MountBrick mounts the file system of a brick using its entry
+// in fstab.
+func (s *CmdExecutor) MountBrick(host string, mountPoint string) error {
+	godbc.Require(host != "")
+	godbc.Require(mountPoint != "")
+
+	commands := []string{
+		fmt.Sprintf("mount %v", mountPoint),
+	}
+	err := rex.AnyError(s.RemoteExecutor.ExecCommands(host, commands, 5))
+	if err != nil {
+		logger.Err(err)
+		return fmt.Errorf("Unable to mount %v: %v", mountPoint, err)
+	}
+	return nil
+}
+
 func errIsLvNotFound(err error) bool {
 	if err == nil {
 		return false
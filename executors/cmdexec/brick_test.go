@@ -352,6 +352,63 @@ func TestSshExecBrickDestroy(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 }
 
+func TestSshExecRemoveImportedBrickFromFstab(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+	s.portStr = "100"
+
+	b := &executors.BrickRequest{
+		VgId:   "xvgid",
+		Name:   "id",
+		Path:   "/bricks/gv0",
+		TpName: "pool0",
+		LvName: "gv0",
+	}
+
+	calls := 0
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		calls++
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t,
+			commands[0] == "sed -i.save "+
+				"\"\\#[[:space:]]/bricks/gv0[[:space:]]#d\" /my/fstab",
+			commands[0])
+		return fakeResults(""), nil
+	}
+
+	err = s.removeBrickFromFstab("myhost", b)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, calls == 1, calls)
+}
+
+func TestSshExecMountBrick(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+	s.portStr = "100"
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "mount /bricks/gv0", commands[0])
+		return fakeResults(""), nil
+	}
+
+	err = s.MountBrick("myhost", "/bricks/gv0")
+	tests.Assert(t, err == nil, err)
+}
+
 func fakeResults(f ...string) rex.Results {
 	results := make(rex.Results, len(f))
 	for i, s := range f {
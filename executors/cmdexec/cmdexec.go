@@ -17,6 +17,7 @@ import (
 	"sync"
 
 	"github.com/heketi/heketi/pkg/logging"
+	"github.com/heketi/heketi/pkg/metrics"
 	rex "github.com/heketi/heketi/pkg/remoteexec"
 )
 
@@ -111,6 +112,24 @@ func (s *CmdExecutor) FreeConnection(host string) {
 	<-c
 }
 
+// ObserveResults records the latency of the commands run on the host
+// and their failures in the metrics. A connection level error is
+// counted as a failure of the first command that did not complete.
+func ObserveResults(host string,
+	commands []string, results rex.Results, err error) {
+
+	for i, command := range commands {
+		if i >= len(results) || !results[i].Completed {
+			if err != nil {
+				metrics.ObserveCommand(command, host, 0, true)
+			}
+			return
+		}
+		metrics.ObserveCommand(command, host,
+			results[i].Duration, !results[i].Ok())
+	}
+}
+
 func (s *CmdExecutor) SetLogLevel(level string) {
 	switch level {
 	case "none":
@@ -13,6 +13,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -20,6 +21,7 @@ import (
 	conv "github.com/heketi/heketi/pkg/conversions"
 	"github.com/heketi/heketi/pkg/paths"
 	rex "github.com/heketi/heketi/pkg/remoteexec"
+	"github.com/lpabon/godbc"
 )
 
 const (
@@ -132,6 +134,18 @@ func (s *CmdExecutor) LVS(host string) (d *executors.LVSCommandOutput, e error)
 	return &lvsCommandOutput, nil
 }
 
+// LVRemove removes the logical volume given as "vg/lv".
+func (s *CmdExecutor) LVRemove(host string, lv string) error {
+	godbc.Require(host != "")
+	godbc.Require(strings.Contains(lv, "/"))
+
+	if err := s.deleteBrickLV(host, lv); err != nil {
+		logger.Err(err)
+		return fmt.Errorf("Unable to remove logical volume %v: %v", lv, err)
+	}
+	return nil
+}
+
 func (s *CmdExecutor) GetDeviceInfo(host, device, vgid string) (d *executors.DeviceInfo, e error) {
 	// Vg info
 	d = &executors.DeviceInfo{}
@@ -139,6 +153,13 @@ func (s *CmdExecutor) GetDeviceInfo(host, device, vgid string) (d *executors.Dev
 	if err != nil {
 		return nil, err
 	}
+	// The identity is informational, failing to read it must not
+	// fail the device operation
+	err = s.getPvIdentityFromNode(d, host, vgid)
+	if err != nil {
+		logger.Warning("Unable to determine identity of device %v on host %v: %v",
+			device, host, err)
+	}
 	return d, nil
 }
 
@@ -251,3 +272,65 @@ func (s *CmdExecutor) getVgSizeFromNode(
 	logger.Debug("%v in %v has TotalSize:%v, FreeSize:%v, UsedSize:%v", device, host, d.TotalSize, d.FreeSize, d.UsedSize)
 	return nil
 }
+
+// getPvIdentityFromNode fills in the persistent identifiers of the
+// physical volume backing the device's volume group. The volume group
+// is named after the device id so it can be found even if the kernel
+// has assigned the disk a different name.
+func (s *CmdExecutor) getPvIdentityFromNode(
+	d *executors.DeviceInfo,
+	host, vgid string) error {
+
+	commands := []string{
+		fmt.Sprintf("vgs --noheadings --separator : -o pv_name,pv_uuid %v",
+			paths.VgIdToName(vgid)),
+	}
+	results, err := s.RemoteExecutor.ExecCommands(host, commands, 5)
+	if err := rex.AnyError(results, err); err != nil {
+		return err
+	}
+
+	// Example:
+	//   /dev/sdb:rJ0bIG-3XNc-NoS0-fkKm-batK-dFyX-xbxHym
+	lines := strings.Split(strings.TrimSpace(results[0].Output), "\n")
+	if len(lines) != 1 {
+		return fmt.Errorf("expected one physical volume, got: %v",
+			results[0].Output)
+	}
+	pvinfo := strings.Split(strings.TrimSpace(lines[0]), ":")
+	if len(pvinfo) != 2 {
+		return fmt.Errorf("vgs returned an invalid string: %v", lines[0])
+	}
+	d.PvName = pvinfo[0]
+	d.PvUUID = pvinfo[1]
+
+	// These may not be available for all kinds of disks
+	commands = []string{
+		fmt.Sprintf("lsblk --nodeps --noheadings --output WWN %v", d.PvName),
+		fmt.Sprintf("udevadm info --query=symlink --name=%v", d.PvName),
+	}
+	results, err = s.RemoteExecutor.ExecCommands(host, commands, 5)
+	if err != nil {
+		return err
+	}
+	if len(results) > 0 && results[0].Ok() {
+		d.Wwn = strings.TrimSpace(results[0].Output)
+	}
+	if len(results) > 1 && results[1].Ok() {
+		d.IdPaths = parseUdevIdLinks(results[1].Output)
+	}
+	return nil
+}
+
+// parseUdevIdLinks returns the by-id paths found in the list of
+// symlinks reported by udevadm.
+func parseUdevIdLinks(output string) []string {
+	links := []string{}
+	for _, l := range strings.Fields(output) {
+		if strings.HasPrefix(l, "disk/by-id/") {
+			links = append(links, "/dev/"+l)
+		}
+	}
+	sort.Strings(links)
+	return links
+}
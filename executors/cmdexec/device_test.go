@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+	"github.com/heketi/tests"
+)
+
+const testVgdisplayOutput = "vg_abc:r/w:772:-1:0:0:0:-1:0:1:1:" +
+	"524275712:4096:127997:2560:125437:rJ0bIG-3XNc-NoS0-fkKm-batK-dFyX-xbxHym"
+
+func TestSshExecGetDeviceInfo(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		switch {
+		case strings.HasPrefix(commands[0], "vgdisplay"):
+			tests.Assert(t, commands[0] == "vgdisplay -c vg_abc", commands)
+			return rex.Results{
+				{Completed: true, Output: testVgdisplayOutput},
+			}, nil
+		case strings.HasPrefix(commands[0], "vgs"):
+			tests.Assert(t, strings.HasSuffix(commands[0], " vg_abc"), commands)
+			return rex.Results{
+				{Completed: true,
+					Output: "  /dev/sdc:ZyXw12-3XNc-NoS0-fkKm-batK-dFyX-xbxHym\n"},
+			}, nil
+		case strings.HasPrefix(commands[0], "lsblk"):
+			tests.Assert(t, len(commands) == 2, commands)
+			tests.Assert(t, strings.HasSuffix(commands[0], " /dev/sdc"), commands)
+			tests.Assert(t, strings.HasSuffix(commands[1], "=/dev/sdc"), commands)
+			return rex.Results{
+				{Completed: true, Output: "0x5000c500deadbeef\n"},
+				{Completed: true, Output: "disk/by-path/pci-0000:00:1f.2-ata-3 " +
+					"disk/by-id/wwn-0x5000c500deadbeef disk/by-id/ata-FAST_SSD_1234\n"},
+			}, nil
+		}
+		t.Fatalf("unexpected commands: %v", commands)
+		return nil, nil
+	}
+
+	d, err := s.GetDeviceInfo("myhost", "/dev/sdb", "abc")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.ExtentSize == 4096, d.ExtentSize)
+	tests.Assert(t, d.TotalSize == 127997*4096, d.TotalSize)
+	tests.Assert(t, d.PvName == "/dev/sdc", d.PvName)
+	tests.Assert(t, d.PvUUID == "ZyXw12-3XNc-NoS0-fkKm-batK-dFyX-xbxHym", d.PvUUID)
+	tests.Assert(t, d.Wwn == "0x5000c500deadbeef", d.Wwn)
+	tests.Assert(t, len(d.IdPaths) == 2, d.IdPaths)
+	tests.Assert(t, d.IdPaths[0] == "/dev/disk/by-id/ata-FAST_SSD_1234", d.IdPaths)
+	tests.Assert(t, d.IdPaths[1] == "/dev/disk/by-id/wwn-0x5000c500deadbeef", d.IdPaths)
+}
+
+func TestSshExecGetDeviceInfoNoIdentity(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		if strings.HasPrefix(commands[0], "vgdisplay") {
+			return rex.Results{
+				{Completed: true, Output: testVgdisplayOutput},
+			}, nil
+		}
+		return rex.Results{
+			{
+				Completed:  true,
+				ErrOutput:  "Unknown field pv_uuid",
+				Err:        fmt.Errorf("exit 5"),
+				ExitStatus: 5,
+			},
+		}, nil
+	}
+
+	// the sizes must still be reported
+	d, err := s.GetDeviceInfo("myhost", "/dev/sdb", "abc")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.ExtentSize == 4096, d.ExtentSize)
+	tests.Assert(t, d.PvName == "", d.PvName)
+	tests.Assert(t, d.PvUUID == "", d.PvUUID)
+}
+
+func TestSshExecLVRemove(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "lvremove --autobackup=n -f vg_abc/brick_123",
+			commands[0])
+		return rex.Results{{Completed: true}}, nil
+	}
+
+	err = s.LVRemove("myhost", "vg_abc/brick_123")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
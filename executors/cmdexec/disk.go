@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/executors"
+)
+
+const (
+	lsblkCommand = "lsblk --bytes --paths --pairs" +
+		" --output NAME,TYPE,SIZE,ROTA,WWN,FSTYPE,PTTYPE,MOUNTPOINT,PKNAME"
+	// the by-id directory may not exist on hosts without persistent
+	// device names so this command is allowed to fail
+	diskByIdCommand = `find /dev/disk/by-id -type l -printf "%p %l\n"`
+)
+
+var lsblkPairRe = regexp.MustCompile(`([A-Z:-]+)="([^"]*)"`)
+
+// ListDisks returns the block devices of type disk that exist on
+// the given host along with the metadata needed to decide if the
+// disk is a candidate for use by heketi.
+func (s *CmdExecutor) ListDisks(host string) (*executors.DisksInfo, error) {
+	godbc.Require(host != "")
+
+	commands := []string{
+		lsblkCommand,
+		diskByIdCommand,
+	}
+
+	results, err := s.RemoteExecutor.ExecCommands(host, commands, 5)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) < 1 || !results[0].Ok() {
+		return nil, fmt.Errorf("Unable to list disks on host %v: %v",
+			host, results.FirstError())
+	}
+	byId := map[string][]string{}
+	if len(results) > 1 && results[1].Ok() {
+		byId = parseDiskIdLinks(results[1].Output)
+	} else {
+		logger.Warning("Unable to read persistent disk names on host %v", host)
+	}
+	return parseLsblkDisks(results[0].Output, byId)
+}
+
+type lsblkEntry struct {
+	name       string
+	devType    string
+	size       uint64
+	rotational bool
+	wwn        string
+	fsType     string
+	ptType     string
+	mountPoint string
+	parent     string
+}
+
+func parseLsblkLine(line string) (*lsblkEntry, error) {
+	e := &lsblkEntry{}
+	for _, m := range lsblkPairRe.FindAllStringSubmatch(line, -1) {
+		switch m[1] {
+		case "NAME":
+			e.name = m[2]
+		case "TYPE":
+			e.devType = m[2]
+		case "SIZE":
+			if m[2] == "" {
+				continue
+			}
+			v, err := strconv.ParseUint(m[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size for %v: %v", line, err)
+			}
+			e.size = v
+		case "ROTA":
+			e.rotational = (m[2] == "1")
+		case "WWN":
+			e.wwn = m[2]
+		case "FSTYPE":
+			e.fsType = m[2]
+		case "PTTYPE":
+			e.ptType = m[2]
+		case "MOUNTPOINT":
+			e.mountPoint = m[2]
+		case "PKNAME":
+			e.parent = m[2]
+		}
+	}
+	if e.name == "" {
+		return nil, fmt.Errorf("missing device name in lsblk output: %v", line)
+	}
+	return e, nil
+}
+
+// parseDiskIdLinks converts the output of the by-id find command
+// into a map of device paths to the persistent links pointing at them.
+func parseDiskIdLinks(output string) map[string][]string {
+	byId := map[string][]string{}
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		link, target := parts[0], parts[1]
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(link), target)
+		}
+		byId[target] = append(byId[target], link)
+	}
+	for _, links := range byId {
+		sort.Strings(links)
+	}
+	return byId
+}
+
+func parseLsblkDisks(
+	output string, byId map[string][]string) (*executors.DisksInfo, error) {
+
+	entries := map[string]*lsblkEntry{}
+	order := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		e, err := parseLsblkLine(line)
+		if err != nil {
+			return nil, err
+		}
+		// a device can be listed more than once when it is
+		// shared by multiple holders (e.g. multipath)
+		if _, found := entries[e.name]; !found {
+			order = append(order, e.name)
+		}
+		entries[e.name] = e
+	}
+
+	// root finds the disk an entry ultimately lives on
+	root := func(e *lsblkEntry) *lsblkEntry {
+		seen := map[string]bool{}
+		for e.parent != "" && !seen[e.name] {
+			seen[e.name] = true
+			p, ok := entries[e.parent]
+			if !ok {
+				break
+			}
+			e = p
+		}
+		return e
+	}
+
+	disks := map[string]*executors.DiskInfo{}
+	for _, name := range order {
+		e := entries[name]
+		if e.devType != "disk" {
+			continue
+		}
+		disks[name] = &executors.DiskInfo{
+			Name:       e.name,
+			Size:       e.size / 1024,
+			Rotational: e.rotational,
+			Wwn:        e.wwn,
+			IdPaths:    byId[e.name],
+		}
+	}
+
+	for _, name := range order {
+		e := entries[name]
+		d, ok := disks[root(e).name]
+		if !ok {
+			continue
+		}
+		if e.fsType != "" {
+			d.Signatures = append(d.Signatures, e.fsType)
+		}
+		if e.ptType != "" && e.name == d.Name {
+			d.Signatures = append(d.Signatures, e.ptType)
+		}
+		if e.name != d.Name && e.devType == "part" && e.fsType == "" {
+			// an empty partition still means the disk is in use
+			d.Signatures = append(d.Signatures, "partition")
+		}
+		if e.mountPoint != "" {
+			d.Mounted = true
+		}
+	}
+
+	info := &executors.DisksInfo{}
+	for _, name := range order {
+		if d, ok := disks[name]; ok {
+			info.Disks = append(info.Disks, *d)
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"testing"
+
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+	"github.com/heketi/tests"
+)
+
+const testLsblkOutput = `NAME="/dev/sda" TYPE="disk" SIZE="107374182400" ROTA="1" WWN="0x5000c500a1b2c3d4" FSTYPE="" PTTYPE="gpt" MOUNTPOINT="" PKNAME=""
+NAME="/dev/sda1" TYPE="part" SIZE="1073741824" ROTA="1" WWN="0x5000c500a1b2c3d4" FSTYPE="xfs" PTTYPE="gpt" MOUNTPOINT="/boot" PKNAME="/dev/sda"
+NAME="/dev/sdb" TYPE="disk" SIZE="536870912000" ROTA="0" WWN="0x5000c500deadbeef" FSTYPE="" PTTYPE="" MOUNTPOINT="" PKNAME=""
+NAME="/dev/sdc" TYPE="disk" SIZE="536870912000" ROTA="1" WWN="" FSTYPE="LVM2_member" PTTYPE="" MOUNTPOINT="" PKNAME=""
+NAME="/dev/mapper/vg-lv" TYPE="lvm" SIZE="1073741824" ROTA="1" WWN="" FSTYPE="xfs" PTTYPE="" MOUNTPOINT="/mnt" PKNAME="/dev/sdc"
+NAME="/dev/sr0" TYPE="rom" SIZE="1073741312" ROTA="1" WWN="" FSTYPE="" PTTYPE="" MOUNTPOINT="" PKNAME=""
+`
+
+const testByIdOutput = `/dev/disk/by-id/wwn-0x5000c500deadbeef ../../sdb
+/dev/disk/by-id/ata-FAST_SSD_1234 ../../sdb
+/dev/disk/by-id/wwn-0x5000c500a1b2c3d4-part1 ../../sda1
+`
+
+func TestSshExecListDisks(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		tests.Assert(t, host == "myhost:22", host)
+		tests.Assert(t, len(commands) == 2)
+		tests.Assert(t, commands[0] == lsblkCommand, commands)
+		tests.Assert(t, commands[1] == diskByIdCommand, commands)
+
+		return rex.Results{
+			{Completed: true, Output: testLsblkOutput},
+			{Completed: true, Output: testByIdOutput},
+		}, nil
+	}
+
+	info, err := s.ListDisks("myhost")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.Disks) == 3,
+		"expected len(info.Disks) == 3, got:", len(info.Disks))
+
+	sda := info.Disks[0]
+	tests.Assert(t, sda.Name == "/dev/sda", sda.Name)
+	tests.Assert(t, sda.Size == 104857600, sda.Size)
+	tests.Assert(t, sda.Rotational)
+	tests.Assert(t, sda.Mounted)
+	tests.Assert(t, len(sda.Signatures) == 2, sda.Signatures)
+	tests.Assert(t, len(sda.IdPaths) == 0, sda.IdPaths)
+
+	sdb := info.Disks[1]
+	tests.Assert(t, sdb.Name == "/dev/sdb", sdb.Name)
+	tests.Assert(t, !sdb.Rotational)
+	tests.Assert(t, !sdb.Mounted)
+	tests.Assert(t, sdb.Wwn == "0x5000c500deadbeef", sdb.Wwn)
+	tests.Assert(t, len(sdb.Signatures) == 0, sdb.Signatures)
+	tests.Assert(t, len(sdb.IdPaths) == 2, sdb.IdPaths)
+	tests.Assert(t, sdb.IdPaths[0] == "/dev/disk/by-id/ata-FAST_SSD_1234",
+		sdb.IdPaths)
+
+	sdc := info.Disks[2]
+	tests.Assert(t, sdc.Name == "/dev/sdc", sdc.Name)
+	tests.Assert(t, sdc.Mounted)
+	tests.Assert(t, len(sdc.Signatures) == 2, sdc.Signatures)
+	tests.Assert(t, sdc.Signatures[0] == "LVM2_member", sdc.Signatures)
+}
+
+func TestSshExecListDisksNoById(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		return rex.Results{
+			{Completed: true, Output: testLsblkOutput},
+			{
+				Completed:  true,
+				ErrOutput:  "find: '/dev/disk/by-id': No such file or directory",
+				Err:        fmt.Errorf("exit 1"),
+				ExitStatus: 1,
+			},
+		}, nil
+	}
+
+	info, err := s.ListDisks("myhost")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.Disks) == 3,
+		"expected len(info.Disks) == 3, got:", len(info.Disks))
+	tests.Assert(t, len(info.Disks[1].IdPaths) == 0, info.Disks[1].IdPaths)
+}
+
+func TestSshExecListDisksFails(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		return rex.Results{
+			{
+				Completed:  true,
+				ErrOutput:  "lsblk: command not found",
+				Err:        fmt.Errorf("exit 127"),
+				ExitStatus: 127,
+			},
+			{},
+		}, nil
+	}
+
+	_, err = s.ListDisks("myhost")
+	tests.Assert(t, err != nil, "expected err != nil")
+}
@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/logging"
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+)
+
+// LoggingTransport wraps a command transport and logs the commands it
+// runs with the given logger, so the lines carry the fields of the
+// logger, such as the id of the operation running the commands.
+type LoggingTransport struct {
+	RemoteCommandTransport
+	Logger *logging.Logger
+}
+
+func (t *LoggingTransport) ExecCommands(
+	host string, commands []string, timeoutMinutes int) (rex.Results, error) {
+
+	results, err := t.RemoteCommandTransport.ExecCommands(
+		host, commands, timeoutMinutes)
+	for i, command := range commands {
+		if i >= len(results) || !results[i].Completed {
+			if err != nil {
+				t.Logger.Warning("Command [%v] on %v failed: %v",
+					command, host, err)
+			}
+			break
+		}
+		if !results[i].Ok() {
+			t.Logger.Warning("Command [%v] on %v failed: %v",
+				command, host, results[i])
+			break
+		}
+		t.Logger.Debug("Ran command [%v] on %v in %v",
+			command, host, results[i].Duration)
+	}
+	return results, err
+}
+
+// Logged returns an executor that logs the commands of c with the
+// given logger through a LoggingTransport.
+func (c *CmdExecutor) Logged(l *logging.Logger) executors.Executor {
+	return c.withTransport(&LoggingTransport{
+		RemoteCommandTransport: c.RemoteExecutor,
+		Logger:                 l,
+	})
+}
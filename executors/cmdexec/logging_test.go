@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/heketi/heketi/pkg/logging"
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+	"github.com/heketi/tests"
+)
+
+func TestLoggedExecutor(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	calls := 0
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		calls++
+		if calls > 1 {
+			return nil, errors.New("connection refused")
+		}
+		return rex.Results{
+			{Completed: true, Output: "ok"},
+			{Completed: true, ExitStatus: 1, ErrOutput: "failed"},
+		}, nil
+	}
+
+	l := logging.NewLogger("[testing]", logging.LEVEL_CRITICAL).
+		WithFields(logging.Fields{logging.OperationIdKey: "op1"})
+	lt := &LoggingTransport{RemoteCommandTransport: s, Logger: l}
+	results, err := lt.ExecCommands("host", []string{"a", "b"}, 1)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(results) == 2, results)
+	tests.Assert(t, results[1].ExitStatus == 1, results[1])
+
+	_, err = lt.ExecCommands("host", []string{"a"}, 1)
+	tests.Assert(t, err != nil && err.Error() == "connection refused", err)
+
+	// the executor is unchanged
+	s.Logged(l)
+	_, ok := s.RemoteExecutor.(*LoggingTransport)
+	tests.Assert(t, !ok)
+}
@@ -10,10 +10,12 @@
 package cmdexec
 
 import (
+	"encoding/xml"
 	"fmt"
 
 	"github.com/lpabon/godbc"
 
+	"github.com/heketi/heketi/executors"
 	rex "github.com/heketi/heketi/pkg/remoteexec"
 )
 
@@ -84,3 +86,30 @@ func (s *CmdExecutor) GlusterdCheck(host string) error {
 
 	return nil
 }
+
+func (s *CmdExecutor) PeerStatus(host string) (*executors.PeerStatus, error) {
+	godbc.Require(host != "")
+
+	type CliOutput struct {
+		OpRet      int                  `xml:"opRet"`
+		OpErrno    int                  `xml:"opErrno"`
+		OpErrStr   string               `xml:"opErrstr"`
+		PeerStatus executors.PeerStatus `xml:"peerStatus"`
+	}
+
+	command := []string{
+		fmt.Sprintf("%v peer status --xml", s.glusterCommand()),
+	}
+
+	results, err := s.RemoteExecutor.ExecCommands(host, command,
+		s.GlusterCliExecTimeout())
+	if err := rex.AnyError(results, err); err != nil {
+		return nil, fmt.Errorf("Unable to get peer status of %v: %v", host, err)
+	}
+	var peerStatus CliOutput
+	err = xml.Unmarshal([]byte(results[0].Output), &peerStatus)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine peer status of %v", host)
+	}
+	return &peerStatus.PeerStatus, nil
+}
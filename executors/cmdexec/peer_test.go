@@ -101,3 +101,60 @@ func TestSshExecGlusterdCheck(t *testing.T) {
 	err = s.GlusterdCheck("newhost")
 	tests.Assert(t, err == nil, err)
 }
+
+func TestSshExecPeerStatus(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script --timeout=42 peer status --xml", commands)
+
+		return rex.Results{{Completed: true, Output: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <peerStatus>
+    <peer>
+      <uuid>3c3f6c2c-0f5b-4b1a-9d7e-4a1e0c6d3b11</uuid>
+      <hostname>10.0.0.2</hostname>
+      <hostnames>
+        <hostname>10.0.0.2</hostname>
+        <hostname>node2</hostname>
+      </hostnames>
+      <connected>1</connected>
+      <state>3</state>
+      <stateStr>Peer in Cluster</stateStr>
+    </peer>
+    <peer>
+      <uuid>8a1d2f0e-5c7b-4e3a-b6f1-2d9c8e7a6b54</uuid>
+      <hostname>10.0.0.3</hostname>
+      <hostnames>
+        <hostname>10.0.0.3</hostname>
+      </hostnames>
+      <connected>0</connected>
+      <state>3</state>
+      <stateStr>Peer in Cluster</stateStr>
+    </peer>
+  </peerStatus>
+</cliOutput>
+`}}, nil
+	}
+
+	ps, err := s.PeerStatus("host")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(ps.Peers) == 2, ps.Peers)
+	tests.Assert(t, ps.Peers[0].Hostname == "10.0.0.2", ps.Peers[0])
+	tests.Assert(t, len(ps.Peers[0].Hostnames) == 2, ps.Peers[0])
+	tests.Assert(t, ps.Peers[0].Hostnames[1] == "node2", ps.Peers[0])
+	tests.Assert(t, ps.Peers[0].Connected == 1, ps.Peers[0])
+	tests.Assert(t, ps.Peers[1].Connected == 0, ps.Peers[1])
+}
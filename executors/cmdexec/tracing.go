@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"github.com/heketi/heketi/executors"
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+	"github.com/heketi/heketi/pkg/tracing"
+)
+
+// TracingTransport wraps a command transport and records a span for
+// every call of ExecCommands, tagged with the host and the commands.
+type TracingTransport struct {
+	RemoteCommandTransport
+	Parent tracing.SpanContext
+}
+
+func (t *TracingTransport) ExecCommands(
+	host string, commands []string, timeoutMinutes int) (rex.Results, error) {
+
+	span := tracing.StartSpan("ExecCommands", tracing.SpanKindClient, t.Parent)
+	span.SetAttribute("host", host)
+	span.SetAttribute("commands", commands)
+	defer span.End()
+
+	results, err := t.RemoteCommandTransport.ExecCommands(
+		host, commands, timeoutMinutes)
+	if err != nil {
+		span.SetError(err)
+		return results, err
+	}
+	for i, r := range results {
+		if r.Completed && !r.Ok() {
+			span.SetAttribute("failed_command", commands[i])
+			span.SetError(r)
+			break
+		}
+	}
+	return results, err
+}
+
+// Traced returns an executor that runs the commands of c through a
+// TracingTransport, recording them as children of the parent span.
+// Connections are still throttled by the transport of c.
+func (c *CmdExecutor) Traced(parent tracing.SpanContext) executors.Executor {
+	return c.withTransport(&TracingTransport{
+		RemoteCommandTransport: c.RemoteExecutor,
+		Parent:                 parent,
+	})
+}
+
+// withTransport returns a copy of c running its commands through t.
+func (c *CmdExecutor) withTransport(t RemoteCommandTransport) *CmdExecutor {
+	return &CmdExecutor{
+		config:         c.config,
+		RemoteExecutor: t,
+		Fstab:          c.Fstab,
+		BackupLVM:      c.BackupLVM,
+	}
+}
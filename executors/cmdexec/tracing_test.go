@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+	"github.com/heketi/heketi/pkg/tracing"
+	"github.com/heketi/tests"
+)
+
+func TestTracedExecutor(t *testing.T) {
+	var buf bytes.Buffer
+	tracing.SetExporter(tracing.NewJSONExporter(&buf, "test"))
+	defer tracing.SetExporter(nil)
+
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		return rex.Results{
+			{Completed: true, ExitStatus: 1, ErrOutput: "peer detach failed"},
+		}, nil
+	}
+
+	parent := tracing.StartSpan("exec", tracing.SpanKindInternal, tracing.SpanContext{})
+	// detach failures are only logged
+	err = s.Traced(parent.Context()).PeerDetach("host", "oldnode")
+	tests.Assert(t, err == nil, err)
+	parent.End()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	tests.Assert(t, len(lines) == 2, lines)
+	span := lines[0]
+	tests.Assert(t, strings.Contains(span, `"name":"ExecCommands"`), span)
+	tests.Assert(t, strings.Contains(span,
+		`"traceId":"`+parent.Context().TraceID.String()+`"`), span)
+	tests.Assert(t, strings.Contains(span,
+		`"parentSpanId":"`+parent.Context().SpanID.String()+`"`), span)
+	tests.Assert(t, strings.Contains(span,
+		`{"key":"host","value":{"stringValue":"host"}}`), span)
+	tests.Assert(t, strings.Contains(span,
+		"gluster --mode=script --timeout=42 peer detach oldnode"), span)
+	tests.Assert(t, strings.Contains(span,
+		`"status":{"code":2,"message":"peer detach failed"}`), span)
+
+	// the executor is unchanged
+	_, ok := s.RemoteExecutor.(*TracingTransport)
+	tests.Assert(t, !ok)
+}
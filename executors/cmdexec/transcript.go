@@ -0,0 +1,62 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"time"
+
+	"github.com/heketi/heketi/executors"
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+)
+
+// CommandRecorder receives the commands run through a
+// TranscriptTransport with their results.
+type CommandRecorder interface {
+	RecordCommand(host, command string, started time.Time, result rex.Result)
+}
+
+// TranscriptTransport wraps a command transport and passes every
+// command it runs to a CommandRecorder. As for the metrics, a
+// connection level error is recorded as the result of the first
+// command that did not complete.
+type TranscriptTransport struct {
+	RemoteCommandTransport
+	Recorder CommandRecorder
+}
+
+func (t *TranscriptTransport) ExecCommands(
+	host string, commands []string, timeoutMinutes int) (rex.Results, error) {
+
+	started := time.Now()
+	results, err := t.RemoteCommandTransport.ExecCommands(
+		host, commands, timeoutMinutes)
+	for i, command := range commands {
+		if i >= len(results) || !results[i].Completed {
+			if err != nil {
+				t.Recorder.RecordCommand(host, command, started,
+					rex.Result{Err: err, Duration: time.Since(started)})
+			}
+			break
+		}
+		// the commands run one after the other
+		t.Recorder.RecordCommand(host, command, started, results[i])
+		started = started.Add(results[i].Duration)
+	}
+	return results, err
+}
+
+// Transcribed returns an executor that passes the commands of c to
+// the recorder through a TranscriptTransport.
+func (c *CmdExecutor) Transcribed(r CommandRecorder) executors.Executor {
+	return c.withTransport(&TranscriptTransport{
+		RemoteCommandTransport: c.RemoteExecutor,
+		Recorder:               r,
+	})
+}
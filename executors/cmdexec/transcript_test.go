@@ -0,0 +1,89 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+	"github.com/heketi/tests"
+)
+
+type testRecord struct {
+	host    string
+	command string
+	started time.Time
+	result  rex.Result
+}
+
+type testRecorder []testRecord
+
+func (r *testRecorder) RecordCommand(host, command string,
+	started time.Time, result rex.Result) {
+
+	*r = append(*r, testRecord{host, command, started, result})
+}
+
+func TestTranscribedExecutor(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		return rex.Results{
+			{Completed: true, Output: "ok", Duration: time.Second},
+			{Completed: true, ExitStatus: 5, ErrOutput: "failed"},
+			{},
+		}, nil
+	}
+
+	var rec testRecorder
+	tt := &TranscriptTransport{RemoteCommandTransport: s, Recorder: &rec}
+	_, err = tt.ExecCommands("host", []string{"a", "b", "c"}, 1)
+	tests.Assert(t, err == nil, err)
+
+	// commands that did not run are not recorded
+	tests.Assert(t, len(rec) == 2, rec)
+	tests.Assert(t, rec[0].host == "host", rec[0].host)
+	tests.Assert(t, rec[0].command == "a", rec[0].command)
+	tests.Assert(t, rec[0].result.Output == "ok", rec[0].result)
+	tests.Assert(t, rec[1].command == "b", rec[1].command)
+	tests.Assert(t, rec[1].result.ExitStatus == 5, rec[1].result)
+	tests.Assert(t, rec[1].started.Sub(rec[0].started) == time.Second,
+		rec[0].started, rec[1].started)
+
+	// connection errors are recorded for the first command
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		return nil, errors.New("connection refused")
+	}
+	rec = nil
+	// detach failures are only logged
+	err = s.Transcribed(&rec).PeerDetach("host", "oldnode")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(rec) == 1, rec)
+	tests.Assert(t, rec[0].command ==
+		"gluster --mode=script --timeout=42 peer detach oldnode", rec[0].command)
+	tests.Assert(t, !rec[0].result.Completed)
+	tests.Assert(t, rec[0].result.Err.Error() == "connection refused", rec[0].result)
+
+	// the executor is unchanged
+	_, ok := s.RemoteExecutor.(*TranscriptTransport)
+	tests.Assert(t, !ok)
+}
@@ -171,6 +171,25 @@ func (s *CmdExecutor) VolumeDestroyCheck(host, volume string) error {
 	return s.checkForSnapshots(host, volume)
 }
 
+// VolumeStartForce starts the processes of the volume that are not
+// running, such as the brick processes that exited when their brick
+// was not mounted.
+func (s *CmdExecutor) VolumeStartForce(host string, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	commands := []string{
+		fmt.Sprintf("%v volume start %v force", s.glusterCommand(), volume),
+	}
+
+	err := rex.AnyError(s.RemoteExecutor.ExecCommands(host, commands,
+		s.GlusterCliExecTimeout()))
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to start volume %v: %v", volume, err))
+	}
+	return nil
+}
+
 func (s *CmdExecutor) createVolumeOptionsCommand(volume *executors.VolumeRequest) []string {
 	commands := []string{}
 	var cmd string
@@ -317,6 +336,34 @@ func (s *CmdExecutor) VolumesInfo(host string) (*executors.VolInfo, error) {
 	return &volumeInfo.VolInfo, nil
 }
 
+func (s *CmdExecutor) VolumesStatus(host string) (*executors.VolStatus, error) {
+
+	godbc.Require(host != "")
+
+	type CliOutput struct {
+		OpRet     int                 `xml:"opRet"`
+		OpErrno   int                 `xml:"opErrno"`
+		OpErrStr  string              `xml:"opErrstr"`
+		VolStatus executors.VolStatus `xml:"volStatus"`
+	}
+
+	command := []string{
+		fmt.Sprintf("%v volume status all --xml", s.glusterCommand()),
+	}
+
+	results, err := s.RemoteExecutor.ExecCommands(host, command,
+		s.GlusterCliExecTimeout())
+	if err := rex.AnyError(results, err); err != nil {
+		return nil, fmt.Errorf("Unable to get volume status")
+	}
+	var volumeStatus CliOutput
+	err = xml.Unmarshal([]byte(results[0].Output), &volumeStatus)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal volume status")
+	}
+	return &volumeStatus.VolStatus, nil
+}
+
 func (s *CmdExecutor) VolumeReplaceBrick(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
 	godbc.Require(volume != "")
 	godbc.Require(host != "")
@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"testing"
+
+	rex "github.com/heketi/heketi/pkg/remoteexec"
+	"github.com/heketi/tests"
+)
+
+const testVolumeStatusOutput = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volStatus>
+    <volumes>
+      <volume>
+        <volName>vol_1</volName>
+        <nodeCount>3</nodeCount>
+        <node>
+          <hostname>10.0.0.1</hostname>
+          <path>/var/lib/heketi/mounts/vg_1/brick_1/brick</path>
+          <peerid>0d4a7e4e-5a8f-4f53-8f2b-6b1e3c9a2d01</peerid>
+          <status>1</status>
+          <port>49152</port>
+          <pid>1234</pid>
+        </node>
+        <node>
+          <hostname>10.0.0.2</hostname>
+          <path>/var/lib/heketi/mounts/vg_2/brick_2/brick</path>
+          <peerid>3c3f6c2c-0f5b-4b1a-9d7e-4a1e0c6d3b11</peerid>
+          <status>0</status>
+          <port>N/A</port>
+          <pid>-1</pid>
+        </node>
+        <node>
+          <hostname>Self-heal Daemon</hostname>
+          <path>10.0.0.1</path>
+          <peerid>0d4a7e4e-5a8f-4f53-8f2b-6b1e3c9a2d01</peerid>
+          <status>1</status>
+          <port>N/A</port>
+          <pid>2345</pid>
+        </node>
+      </volume>
+    </volumes>
+  </volStatus>
+</cliOutput>
+`
+
+func TestSshExecVolumesStatus(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script --timeout=42 volume status all --xml", commands)
+
+		return rex.Results{{Completed: true, Output: testVolumeStatusOutput}}, nil
+	}
+
+	vs, err := s.VolumesStatus("host")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vs.Volumes) == 1, vs.Volumes)
+	v := vs.Volumes[0]
+	tests.Assert(t, v.VolumeName == "vol_1", v)
+	tests.Assert(t, len(v.Nodes) == 3, v.Nodes)
+	tests.Assert(t, v.Nodes[0].Hostname == "10.0.0.1", v.Nodes[0])
+	tests.Assert(t, v.Nodes[0].Status == 1 && v.Nodes[0].Pid == 1234, v.Nodes[0])
+	tests.Assert(t, v.Nodes[1].Status == 0 && v.Nodes[1].Pid == -1, v.Nodes[1])
+	tests.Assert(t, v.Nodes[2].Path == "10.0.0.1", v.Nodes[2])
+}
+
+func TestSshExecVolumeStartForce(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) (rex.Results, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script --timeout=42 volume start vol_1 force", commands)
+
+		return rex.Results{{Completed: true}}, nil
+	}
+
+	err = s.VolumeStartForce("host", "vol_1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -15,6 +15,7 @@ type Executor interface {
 	GlusterdCheck(host string) error
 	PeerProbe(exec_host, newnode string) error
 	PeerDetach(exec_host, detachnode string) error
+	PeerStatus(host string) (*PeerStatus, error)
 	DeviceSetup(host, device, vgid string, destroy bool) (*DeviceInfo, error)
 	GetDeviceInfo(host, device, vgid string) (*DeviceInfo, error)
 	DeviceTeardown(host, device, vgid string) error
@@ -24,10 +25,12 @@ type Executor interface {
 	VolumeCreate(host string, volume *VolumeRequest) (*Volume, error)
 	VolumeDestroy(host string, volume string) error
 	VolumeDestroyCheck(host, volume string) error
+	VolumeStartForce(host string, volume string) error
 	VolumeExpand(host string, volume *VolumeRequest) (*Volume, error)
 	VolumeReplaceBrick(host string, volume string, oldBrick *BrickInfo, newBrick *BrickInfo) error
 	VolumeInfo(host string, volume string) (*Volume, error)
 	VolumesInfo(host string) (*VolInfo, error)
+	VolumesStatus(host string) (*VolStatus, error)
 	VolumeClone(host string, vsr *VolumeCloneRequest) (*Volume, error)
 	VolumeSnapshot(host string, vsr *VolumeSnapshotRequest) (*Snapshot, error)
 	SnapshotCloneVolume(host string, scr *SnapshotCloneRequest) (*Volume, error)
@@ -42,6 +45,9 @@ type Executor interface {
 	LVS(host string) (*LVSCommandOutput, error)
 	GetBrickMountStatus(host string) (*BricksMountStatus, error)
 	ListBlockVolumes(host string, blockhostingvolume string) ([]string, error)
+	ListDisks(host string) (*DisksInfo, error)
+	MountBrick(host string, mountPoint string) error
+	LVRemove(host string, lv string) error
 }
 
 // Enumerate durability types
@@ -109,6 +115,29 @@ type BricksMountStatus struct {
 	Statuses []BrickMountStatus
 }
 
+// DiskInfo describes a raw block device found on a host.
+type DiskInfo struct {
+	// Name is the kernel path of the device, for example /dev/sdb
+	Name string
+	// Size in KB
+	Size       uint64
+	Rotational bool
+	Wwn        string
+	// IdPaths contains the persistent /dev/disk/by-id links
+	// that resolve to this device
+	IdPaths []string
+	// Signatures lists the filesystem, LVM or partition table
+	// signatures present on the device or its partitions
+	Signatures []string
+	// Mounted is true if the device or any of its partitions
+	// are mounted
+	Mounted bool
+}
+
+type DisksInfo struct {
+	Disks []DiskInfo
+}
+
 // Returns the size of the device
 type DeviceInfo struct {
 	// Size in KB
@@ -116,6 +145,13 @@ type DeviceInfo struct {
 	FreeSize   uint64
 	UsedSize   uint64
 	ExtentSize uint64
+
+	// Identity of the physical volume backing the device.
+	// Empty if the executor was unable to determine it.
+	PvName  string
+	PvUUID  string
+	Wwn     string
+	IdPaths []string
 }
 
 type BrickFormatType int
@@ -283,6 +319,41 @@ type VolInfo struct {
 	Volumes Volumes  `xml:"volumes"`
 }
 
+// PeerStatus lists the peers of a node, the node itself not included.
+type PeerStatus struct {
+	XMLName xml.Name `xml:"peerStatus"`
+	Peers   []Peer   `xml:"peer"`
+}
+
+type Peer struct {
+	UUID      string   `xml:"uuid"`
+	Hostname  string   `xml:"hostname"`
+	Hostnames []string `xml:"hostnames>hostname"`
+	Connected int      `xml:"connected"`
+	StateStr  string   `xml:"stateStr"`
+}
+
+// VolStatus is the status of the processes of the started volumes.
+type VolStatus struct {
+	XMLName xml.Name       `xml:"volStatus"`
+	Volumes []VolumeStatus `xml:"volumes>volume"`
+}
+
+type VolumeStatus struct {
+	VolumeName string `xml:"volName"`
+	// Nodes are the bricks and the daemons of the volume. The path of
+	// the daemons is not absolute.
+	Nodes []BrickStatus `xml:"node"`
+}
+
+type BrickStatus struct {
+	Hostname string `xml:"hostname"`
+	Path     string `xml:"path"`
+	PeerId   string `xml:"peerid"`
+	Status   int    `xml:"status"`
+	Pid      int    `xml:"pid"`
+}
+
 type HealInfoBricks struct {
 	BrickList []BrickHealStatus `xml:"brick"`
 }
@@ -32,6 +32,9 @@ func newMockBase() *mockexec.MockExecutor {
 	m.MockPeerDetach = func(exec_host, newnode string) error {
 		return NotSupportedError
 	}
+	m.MockPeerStatus = func(host string) (*executors.PeerStatus, error) {
+		return nil, NotSupportedError
+	}
 	m.MockDeviceSetup = func(host, device, vgid string, destroy bool) (*executors.DeviceInfo, error) {
 		return nil, NotSupportedError
 	}
@@ -56,6 +59,9 @@ func newMockBase() *mockexec.MockExecutor {
 	m.MockVolumeDestroyCheck = func(host, volume string) error {
 		return NotSupportedError
 	}
+	m.MockVolumeStartForce = func(host string, volume string) error {
+		return NotSupportedError
+	}
 	m.MockVolumeReplaceBrick = func(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
 		return NotSupportedError
 	}
@@ -65,6 +71,9 @@ func newMockBase() *mockexec.MockExecutor {
 	m.MockVolumesInfo = func(host string) (*executors.VolInfo, error) {
 		return nil, NotSupportedError
 	}
+	m.MockVolumesStatus = func(host string) (*executors.VolStatus, error) {
+		return nil, NotSupportedError
+	}
 	m.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
 		return nil, NotSupportedError
 	}
@@ -104,5 +113,14 @@ func newMockBase() *mockexec.MockExecutor {
 	m.MockListBlockVolumes = func(host string, blockhostingvolume string) ([]string, error) {
 		return nil, NotSupportedError
 	}
+	m.MockListDisks = func(host string) (*executors.DisksInfo, error) {
+		return nil, NotSupportedError
+	}
+	m.MockMountBrick = func(host string, mountPoint string) error {
+		return NotSupportedError
+	}
+	m.MockLVRemove = func(host string, lv string) error {
+		return NotSupportedError
+	}
 	return m
 }
@@ -166,7 +166,9 @@ func (k *KubeExecutor) ExecCommands(
 		return nil, err
 	}
 
-	return kube.ExecCommands(k.kconn, tc, commands, timeoutMinutes)
+	results, err := kube.ExecCommands(k.kconn, tc, commands, timeoutMinutes)
+	cmdexec.ObserveResults(host, commands, results, err)
+	return results, err
 }
 
 func (k *KubeExecutor) RebalanceOnExpansion() bool {
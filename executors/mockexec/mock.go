@@ -18,6 +18,7 @@ type MockExecutor struct {
 	MockGlusterdCheck            func(host string) error
 	MockPeerProbe                func(exec_host, newnode string) error
 	MockPeerDetach               func(exec_host, newnode string) error
+	MockPeerStatus               func(host string) (*executors.PeerStatus, error)
 	MockDeviceSetup              func(host, device, vgid string, destroy bool) (*executors.DeviceInfo, error)
 	MockDeviceTeardown           func(host, device, vgid string) error
 	MockGetDeviceInfo            func(host, device, vgid string) (*executors.DeviceInfo, error)
@@ -27,9 +28,11 @@ type MockExecutor struct {
 	MockVolumeExpand             func(host string, volume *executors.VolumeRequest) (*executors.Volume, error)
 	MockVolumeDestroy            func(host string, volume string) error
 	MockVolumeDestroyCheck       func(host, volume string) error
+	MockVolumeStartForce         func(host string, volume string) error
 	MockVolumeReplaceBrick       func(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error
 	MockVolumeInfo               func(host string, volume string) (*executors.Volume, error)
 	MockVolumesInfo              func(host string) (*executors.VolInfo, error)
+	MockVolumesStatus            func(host string) (*executors.VolStatus, error)
 	MockVolumeClone              func(host string, volume *executors.VolumeCloneRequest) (*executors.Volume, error)
 	MockVolumeSnapshot           func(host string, volume *executors.VolumeSnapshotRequest) (*executors.Snapshot, error)
 	MockSnapshotCloneVolume      func(host string, volume *executors.SnapshotCloneRequest) (*executors.Volume, error)
@@ -43,6 +46,9 @@ type MockExecutor struct {
 	MockLVS                      func(host string) (*executors.LVSCommandOutput, error)
 	MockGetBrickMountStatus      func(host string) (*executors.BricksMountStatus, error)
 	MockListBlockVolumes         func(host string, blockhostingvolume string) ([]string, error)
+	MockListDisks                func(host string) (*executors.DisksInfo, error)
+	MockMountBrick               func(host string, mountPoint string) error
+	MockLVRemove                 func(host string, lv string) error
 }
 
 func NewMockExecutor() (*MockExecutor, error) {
@@ -60,6 +66,10 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
+	m.MockPeerStatus = func(host string) (*executors.PeerStatus, error) {
+		return &executors.PeerStatus{}, nil
+	}
+
 	m.MockDeviceSetup = func(host, device, vgid string, destroy bool) (*executors.DeviceInfo, error) {
 		d := &executors.DeviceInfo{}
 		d.TotalSize = 500 * 1024 * 1024 // Size in KB
@@ -110,6 +120,10 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
+	m.MockVolumeStartForce = func(host string, volume string) error {
+		return nil
+	}
+
 	m.MockVolumeReplaceBrick = func(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
 		return nil
 	}
@@ -159,6 +173,10 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return volinfo, nil
 	}
 
+	m.MockVolumesStatus = func(host string) (*executors.VolStatus, error) {
+		return &executors.VolStatus{}, nil
+	}
+
 	m.MockVolumeSnapshot = func(host string, vsr *executors.VolumeSnapshotRequest) (*executors.Snapshot, error) {
 		snapshot := &executors.Snapshot{
 			Name: vsr.Snapshot,
@@ -244,6 +262,18 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return []string{}, nil
 	}
 
+	m.MockListDisks = func(host string) (*executors.DisksInfo, error) {
+		return &executors.DisksInfo{}, nil
+	}
+
+	m.MockMountBrick = func(host string, mountPoint string) error {
+		return nil
+	}
+
+	m.MockLVRemove = func(host string, lv string) error {
+		return nil
+	}
+
 	return m, nil
 }
 
@@ -263,6 +293,10 @@ func (m *MockExecutor) PeerDetach(exec_host, newnode string) error {
 	return m.MockPeerDetach(exec_host, newnode)
 }
 
+func (m *MockExecutor) PeerStatus(host string) (*executors.PeerStatus, error) {
+	return m.MockPeerStatus(host)
+}
+
 func (m *MockExecutor) DeviceSetup(host, device, vgid string, destroy bool) (*executors.DeviceInfo, error) {
 	return m.MockDeviceSetup(host, device, vgid, destroy)
 }
@@ -303,6 +337,10 @@ func (m *MockExecutor) VolumeDestroyCheck(host string, volume string) error {
 	return m.MockVolumeDestroyCheck(host, volume)
 }
 
+func (m *MockExecutor) VolumeStartForce(host string, volume string) error {
+	return m.MockVolumeStartForce(host, volume)
+}
+
 func (m *MockExecutor) VolumeReplaceBrick(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
 	return m.MockVolumeReplaceBrick(host, volume, oldBrick, newBrick)
 }
@@ -315,6 +353,10 @@ func (m *MockExecutor) VolumesInfo(host string) (*executors.VolInfo, error) {
 	return m.MockVolumesInfo(host)
 }
 
+func (m *MockExecutor) VolumesStatus(host string) (*executors.VolStatus, error) {
+	return m.MockVolumesStatus(host)
+}
+
 func (m *MockExecutor) VolumeClone(host string, vcr *executors.VolumeCloneRequest) (*executors.Volume, error) {
 	return m.MockVolumeClone(host, vcr)
 }
@@ -366,3 +408,15 @@ func (m *MockExecutor) GetBrickMountStatus(host string) (*executors.BricksMountS
 func (m *MockExecutor) ListBlockVolumes(host string, blockhostingvolume string) ([]string, error) {
 	return m.MockListBlockVolumes(host, blockhostingvolume)
 }
+
+func (m *MockExecutor) ListDisks(host string) (*executors.DisksInfo, error) {
+	return m.MockListDisks(host)
+}
+
+func (m *MockExecutor) MountBrick(host string, mountPoint string) error {
+	return m.MockMountBrick(host, mountPoint)
+}
+
+func (m *MockExecutor) LVRemove(host string, lv string) error {
+	return m.MockLVRemove(host, lv)
+}
@@ -145,7 +145,10 @@ func (s *SshExecutor) ExecCommands(
 	defer s.FreeConnection(host)
 
 	// Execute
-	return s.exec.ExecCommands(host+":"+s.port, commands, timeoutMinutes, s.config.Sudo)
+	results, err := s.exec.ExecCommands(
+		host+":"+s.port, commands, timeoutMinutes, s.config.Sudo)
+	cmdexec.ObserveResults(host, commands, results, err)
+	return results, err
 }
 
 func (s *SshExecutor) RebalanceOnExpansion() bool {
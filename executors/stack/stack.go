@@ -66,6 +66,16 @@ func (es *ExecutorStack) PeerDetach(exec_host, detachnode string) error {
 	return NotSupportedError
 }
 
+func (es *ExecutorStack) PeerStatus(host string) (*executors.PeerStatus, error) {
+	for _, e := range es.executors {
+		ps, err := e.PeerStatus(host)
+		if err != NotSupportedError {
+			return ps, err
+		}
+	}
+	return nil, NotSupportedError
+}
+
 func (es *ExecutorStack) DeviceSetup(host, device, vgid string, destroy bool) (*executors.DeviceInfo, error) {
 	for _, e := range es.executors {
 		di, err := e.DeviceSetup(host, device, vgid, destroy)
@@ -156,6 +166,16 @@ func (es *ExecutorStack) VolumeDestroyCheck(host, volume string) error {
 	return NotSupportedError
 }
 
+func (es *ExecutorStack) VolumeStartForce(host string, volume string) error {
+	for _, e := range es.executors {
+		err := e.VolumeStartForce(host, volume)
+		if err != NotSupportedError {
+			return err
+		}
+	}
+	return NotSupportedError
+}
+
 func (es *ExecutorStack) VolumeExpand(host string, volume *executors.VolumeRequest) (*executors.Volume, error) {
 	for _, e := range es.executors {
 		v, err := e.VolumeExpand(host, volume)
@@ -196,6 +216,16 @@ func (es *ExecutorStack) VolumesInfo(host string) (*executors.VolInfo, error) {
 	return nil, NotSupportedError
 }
 
+func (es *ExecutorStack) VolumesStatus(host string) (*executors.VolStatus, error) {
+	for _, e := range es.executors {
+		v, err := e.VolumesStatus(host)
+		if err != NotSupportedError {
+			return v, err
+		}
+	}
+	return nil, NotSupportedError
+}
+
 func (es *ExecutorStack) HealInfo(host string, volume string) (*executors.HealInfo, error) {
 	for _, e := range es.executors {
 		hi, err := e.HealInfo(host, volume)
@@ -341,3 +371,33 @@ func (es *ExecutorStack) ListBlockVolumes(host string, blockhostingvolume string
 	}
 	return nil, NotSupportedError
 }
+
+func (es *ExecutorStack) ListDisks(host string) (*executors.DisksInfo, error) {
+	for _, e := range es.executors {
+		v, err := e.ListDisks(host)
+		if err != NotSupportedError {
+			return v, err
+		}
+	}
+	return nil, NotSupportedError
+}
+
+func (es *ExecutorStack) MountBrick(host string, mountPoint string) error {
+	for _, e := range es.executors {
+		err := e.MountBrick(host, mountPoint)
+		if err != NotSupportedError {
+			return err
+		}
+	}
+	return NotSupportedError
+}
+
+func (es *ExecutorStack) LVRemove(host string, lv string) error {
+	for _, e := range es.executors {
+		err := e.LVRemove(host, lv)
+		if err != NotSupportedError {
+			return err
+		}
+	}
+	return NotSupportedError
+}
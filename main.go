@@ -43,6 +43,10 @@ var (
 	debugOutput                  bool
 	deleteAllBricksWithEmptyPath bool
 	dryRun                       bool
+	fixDb                        bool
+	migrateStatus                bool
+	migrateTo                    int
+	backupName                   string
 	force                        bool
 )
 
@@ -137,15 +141,27 @@ var checkdbCmd = &cobra.Command{
 	Use:     "consistency-check",
 	Short:   "checks the db for inconsistencies",
 	Long:    "checks the db for inconsistencies",
-	Example: "heketi db consistency-check --dbfile=/db/file/path/",
+	Example: "heketi db consistency-check --dbfile=/db/file/path/ [--fix [--dry-run]]",
 	Run: func(cmd *cobra.Command, args []string) {
 		if dbFile == "" {
 			fmt.Fprintln(os.Stderr, "Please provide path for db file")
 			os.Exit(1)
 		}
+		if dryRun && !fixDb {
+			fmt.Fprintln(os.Stderr, "--dry-run requires --fix")
+			os.Exit(1)
+		}
 		if debugOutput {
 			glusterfs.SetLogLevel("debug")
 		}
+		if fixDb {
+			err := glusterfs.DbCheckFix(dbFile, dryRun)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to fix db: %v\n", err.Error())
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
 		err := glusterfs.DbCheck(dbFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to check db: %v\n", err.Error())
@@ -155,6 +171,97 @@ var checkdbCmd = &cobra.Command{
 	},
 }
 
+var migratedbCmd = &cobra.Command{
+	Use:     "migrate",
+	Short:   "migrates the db to a given version",
+	Long:    "migrates the db to the latest or a given version after taking a backup of the db file",
+	Example: "heketi db migrate --dbfile=/db/file/path/ [--status | --to=version]",
+	Run: func(cmd *cobra.Command, args []string) {
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		if debugOutput {
+			glusterfs.SetLogLevel("debug")
+		}
+		if migrateStatus {
+			err := glusterfs.DbMigrateStatus(dbFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to get migration status: %v\n", err.Error())
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+		to := -1
+		if cmd.Flags().Changed("to") {
+			to = migrateTo
+		}
+		err := glusterfs.DbMigrate(dbFile, to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate db: %v\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "DB migrated")
+		os.Exit(0)
+	},
+}
+
+var backupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "manage the db backups taken by the server",
+	Long:  "manage the db backups stored in the backup target of the configuration file",
+}
+
+var listBackupsCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "lists the db backups",
+	Long:    "lists the db backups stored in the configured backup target, oldest first",
+	Example: "heketi db backups list --config=heketi.json",
+	Run: func(cmd *cobra.Command, args []string) {
+		if configfile == "" {
+			fmt.Fprintf(os.Stderr, "Configuration file is required\n")
+			os.Exit(1)
+		}
+		c, err := config.ReadConfig(configfile)
+		if err != nil {
+			os.Exit(1)
+		}
+		err = glusterfs.DbBackupsList(c.GlusterFS)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list backups: %v\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+}
+
+var restoreBackupCmd = &cobra.Command{
+	Use:     "restore",
+	Short:   "replaces the db file with a db backup",
+	Long:    "replaces the db file with the most recent or the named db backup, the server must not be running",
+	Example: "heketi db backups restore --config=heketi.json [--name=backup] [--dbfile=/db/file/path/]",
+	Run: func(cmd *cobra.Command, args []string) {
+		if configfile == "" {
+			fmt.Fprintf(os.Stderr, "Configuration file is required\n")
+			os.Exit(1)
+		}
+		c, err := config.ReadConfig(configfile)
+		if err != nil {
+			os.Exit(1)
+		}
+		if debugOutput {
+			glusterfs.SetLogLevel("debug")
+		}
+		name, err := glusterfs.DbBackupsRestore(c.GlusterFS, backupName, dbFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to restore backup: %v\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "DB restored from backup", name)
+		os.Exit(0)
+	},
+}
+
 var deleteBricksWithEmptyPath = &cobra.Command{
 	Use:     "delete-bricks-with-empty-path",
 	Short:   "removes brick entries from db that have empty path",
@@ -325,8 +432,29 @@ func init() {
 	dbCmd.AddCommand(checkdbCmd)
 	checkdbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be exported")
 	checkdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	checkdbCmd.Flags().BoolVar(&fixDb, "fix", false, "Repair the inconsistencies that are safe to fix")
+	checkdbCmd.Flags().BoolVar(&dryRun, "dry-run", false, "With --fix, only list the changes without saving them")
 	checkdbCmd.SilenceUsage = true
 
+	dbCmd.AddCommand(migratedbCmd)
+	migratedbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be migrated")
+	migratedbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	migratedbCmd.Flags().BoolVar(&migrateStatus, "status", false, "Show the migrations applied to the db")
+	migratedbCmd.Flags().IntVar(&migrateTo, "to", 0, "Version to migrate the db to (default latest)")
+	migratedbCmd.SilenceUsage = true
+
+	dbCmd.AddCommand(backupsCmd)
+	backupsCmd.SilenceUsage = true
+	backupsCmd.AddCommand(listBackupsCmd)
+	listBackupsCmd.Flags().StringVar(&configfile, "config", "", "Configuration file")
+	listBackupsCmd.SilenceUsage = true
+	backupsCmd.AddCommand(restoreBackupCmd)
+	restoreBackupCmd.Flags().StringVar(&configfile, "config", "", "Configuration file")
+	restoreBackupCmd.Flags().StringVar(&backupName, "name", "", "Name of the backup to restore (default most recent)")
+	restoreBackupCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be replaced (default from configuration)")
+	restoreBackupCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	restoreBackupCmd.SilenceUsage = true
+
 	dbCmd.AddCommand(deleteBricksWithEmptyPath)
 	deleteBricksWithEmptyPath.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to operate on")
 	deleteBricksWithEmptyPath.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
@@ -407,6 +535,15 @@ func setupApp(config *config.Config) (a *glusterfs.App) {
 	glusterfs.EnableBackgroundCleaner = enableBackgroundTask(
 		config.GlusterFS.DisableBackgroundCleaner,
 		"HEKETI_DISABLE_BACKGROUND_CLEANER")
+	// If one really needs to disable the state checker for
+	// the server binary.
+	glusterfs.EnableStateChecker = enableBackgroundTask(
+		config.GlusterFS.DisableStateChecker,
+		"HEKETI_DISABLE_STATE_CHECKER")
+	// The brick remounter changes the nodes on its own, so unlike
+	// the other background tasks it has to be enabled.
+	glusterfs.EnableBrickRemount = config.GlusterFS.EnableBrickRemount ||
+		os.Getenv("HEKETI_ENABLE_BRICK_REMOUNT") == "true"
 
 	a = glusterfs.NewApp(config.GlusterFS)
 	if a != nil {
@@ -483,7 +620,13 @@ func main() {
 			fmt.Fprint(w, "Hello from Heketi")
 		})
 
-	router.Methods("GET").Path("/metrics").Name("Metrics").HandlerFunc(metrics.NewMetricsHandler(app))
+	// Add the liveness and readiness probes
+	router.Methods("GET").Path("/healthz").Name("Healthz").HandlerFunc(app.Liveness)
+	router.Methods("GET").Path("/readyz").Name("Readyz").HandlerFunc(
+		app.Readiness)
+
+	router.Methods("GET").Path("/metrics").Name("Metrics").HandlerFunc(
+		app.DbGatedOrUnavailable(metrics.NewMetricsHandler(app)))
 
 	// Enable profiling on "/debug/pprof"
 	if options.Profiling {
@@ -519,6 +662,11 @@ func main() {
 	adminss := admin.New()
 	n.Use(adminss)
 	adminss.SetRoutes(heketiRouter)
+	app.SetAdminState(adminss)
+
+	if options.EnableTls {
+		app.SetTLSCertificate(options.CertFile)
+	}
 
 	if options.BackupDbToKubeSecret {
 		// Check if running in a Kubernetes environment
@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package backup
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LocalTarget stores backups as files in a directory.
+type LocalTarget struct {
+	dir string
+}
+
+func NewLocalTarget(dir string) *LocalTarget {
+	return &LocalTarget{dir: dir}
+}
+
+func (l *LocalTarget) String() string {
+	return fmt.Sprintf("directory %v", l.dir)
+}
+
+func (l *LocalTarget) path(name string) (string, error) {
+	if _, err := ParseName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, name), nil
+}
+
+// Put writes the backup to a temporary file first so that a partial
+// backup is never listed.
+func (l *LocalTarget) Put(name string, r io.Reader, size int64) error {
+	path, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return err
+	}
+	fp, err := ioutil.TempFile(l.dir, ".tmp-"+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fp.Name())
+
+	n, err := io.Copy(fp, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("wrote %v bytes of %v", n, size)
+	}
+	if err == nil {
+		err = fp.Sync()
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(fp.Name(), path)
+}
+
+func (l *LocalTarget) Get(name string, w io.Writer) error {
+	path, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	_, err = io.Copy(w, fp)
+	return err
+}
+
+func (l *LocalTarget) Delete(name string) error {
+	path, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (l *LocalTarget) List() ([]Backup, error) {
+	backups := []Backup{}
+	files, err := ioutil.ReadDir(l.dir)
+	if os.IsNotExist(err) {
+		return backups, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		t, err := ParseName(f.Name())
+		if err != nil || !f.Mode().IsRegular() {
+			continue
+		}
+		backups = append(backups, Backup{
+			Name: f.Name(),
+			Size: f.Size(),
+			Time: t,
+		})
+	}
+	sortBackups(backups)
+	return backups, nil
+}
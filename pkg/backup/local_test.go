@@ -0,0 +1,151 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package backup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+)
+
+func putBackups(t *testing.T, target Target, count int) []string {
+	names := []string{}
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < count; i++ {
+		name := NewName(start.Add(time.Duration(i) * time.Hour))
+		data := "backup " + name
+		err := target.Put(name, strings.NewReader(data), int64(len(data)))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		names = append(names, name)
+	}
+	return names
+}
+
+func testTarget(t *testing.T, target Target) {
+	backups, err := target.List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 0, backups)
+
+	names := putBackups(t, target, 4)
+
+	backups, err = target.List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 4, backups)
+	for i, b := range backups {
+		tests.Assert(t, b.Name == names[i], b.Name, names[i])
+		tests.Assert(t, b.Size == int64(len("backup "+b.Name)), b.Size)
+	}
+	tests.Assert(t, backups[1].Time.Sub(backups[0].Time) == time.Hour)
+
+	var buf bytes.Buffer
+	err = target.Get(names[2], &buf)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, buf.String() == "backup "+names[2], buf.String())
+
+	latest, err := Latest(target)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, latest.Name == names[3], latest.Name)
+
+	deleted, err := Prune(target, 2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(deleted) == 2, deleted)
+	tests.Assert(t, deleted[0] == names[0] && deleted[1] == names[1], deleted)
+
+	backups, err = target.List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 2, backups)
+	tests.Assert(t, backups[0].Name == names[2], backups)
+
+	err = target.Get(names[0], &buf)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = target.Put("../heketi.db", strings.NewReader("x"), 1)
+	tests.Assert(t, err == ErrInvalidName, "expected ErrInvalidName, got:", err)
+}
+
+func TestLocalTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-backup-")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	// the directory is created by the first backup
+	target := NewLocalTarget(filepath.Join(dir, "backups"))
+	testTarget(t, target)
+
+	// other files in the directory are not backups
+	err = ioutil.WriteFile(filepath.Join(dir, "backups", "notes.txt"), []byte("x"), 0600)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	backups, err := target.List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 2, backups)
+}
+
+func TestLocalTargetShortPut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-backup-")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	target := NewLocalTarget(dir)
+	name := NewName(time.Now())
+	err = target.Put(name, strings.NewReader("abc"), 10)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// nothing is left behind
+	files, err := ioutil.ReadDir(dir)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(files) == 0, files)
+}
+
+func TestNames(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 30, 15, 123000000, time.UTC)
+	name := NewName(now)
+	tests.Assert(t, name == "heketi-db-20180601T123015.123Z.db", name)
+
+	parsed, err := ParseName(name)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, parsed.Equal(now), parsed)
+
+	for _, bad := range []string{"heketi.db", "heketi-db-yesterday.db", "../" + name} {
+		_, err := ParseName(bad)
+		tests.Assert(t, err == ErrInvalidName, bad, err)
+	}
+}
+
+func TestNewTarget(t *testing.T) {
+	_, err := NewTarget(Config{})
+	tests.Assert(t, err == ErrNotConfigured, "expected ErrNotConfigured, got:", err)
+
+	_, err = NewTarget(Config{
+		Directory: "/tmp",
+		S3:        S3Config{Endpoint: "http://localhost:9000", Bucket: "b"},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	target, err := NewTarget(Config{Directory: "/tmp"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, ok := target.(*LocalTarget)
+	tests.Assert(t, ok, target)
+
+	target, err = NewTarget(Config{
+		S3: S3Config{Endpoint: "http://localhost:9000", Bucket: "b"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, ok = target.(*S3Target)
+	tests.Assert(t, ok, target)
+
+	_, err = NewTarget(Config{S3: S3Config{Endpoint: "http://localhost:9000"}})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
@@ -0,0 +1,304 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	// seconds a request to the storage may take, including the
+	// upload of the backup
+	defaultS3Timeout = 300
+	// hash of the empty payload of GET and DELETE requests
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Config describes a bucket of an S3 compatible object storage, such
+// as AWS S3 or MinIO. Objects are addressed in path style.
+type S3Config struct {
+	// Endpoint is the URL of the storage, e.g. https://s3.amazonaws.com
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	// Timeout of the requests in seconds
+	Timeout int `json:"timeout"`
+}
+
+// S3Target stores backups as objects in a bucket.
+type S3Target struct {
+	conf     S3Config
+	endpoint *url.URL
+	client   *http.Client
+	// for tests
+	now func() time.Time
+}
+
+func NewS3Target(c S3Config) (*S3Target, error) {
+	if c.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", c.Endpoint)
+	}
+	if c.Region == "" {
+		c.Region = defaultS3Region
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultS3Timeout
+	}
+	return &S3Target{
+		conf:     c,
+		endpoint: endpoint,
+		client: &http.Client{
+			Timeout: time.Duration(c.Timeout) * time.Second,
+		},
+		now: time.Now,
+	}, nil
+}
+
+func (s *S3Target) String() string {
+	return fmt.Sprintf("s3 bucket %v at %v", s.conf.Bucket, s.conf.Endpoint)
+}
+
+func (s *S3Target) objectURL(name string) *url.URL {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") +
+		"/" + s.conf.Bucket + "/" + s.conf.Prefix + name
+	return &u
+}
+
+func (s *S3Target) Put(name string, r io.Reader, size int64) error {
+	if _, err := ParseName(name); err != nil {
+		return err
+	}
+	// the payload is signed so it has to be read up front
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("read %v bytes of %v", len(data), size)
+	}
+	hash := sha256.Sum256(data)
+	resp, err := s.do("PUT", s.objectURL(name), bytes.NewReader(data),
+		hex.EncodeToString(hash[:]))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Target) Get(name string, w io.Writer) error {
+	if _, err := ParseName(name); err != nil {
+		return err
+	}
+	resp, err := s.do("GET", s.objectURL(name), nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (s *S3Target) Delete(name string) error {
+	if _, err := ParseName(name); err != nil {
+		return err
+	}
+	resp, err := s.do("DELETE", s.objectURL(name), nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key  string
+		Size int64
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3Target) List() ([]Backup, error) {
+	backups := []Backup{}
+	token := ""
+	for {
+		u := s.objectURL("")
+		u.Path = strings.TrimSuffix(u.Path, "/"+s.conf.Prefix)
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", s.conf.Prefix+namePrefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		resp, err := s.do("GET", u, nil, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse s3 object list: %v", err)
+		}
+
+		for _, o := range result.Contents {
+			name := strings.TrimPrefix(o.Key, s.conf.Prefix)
+			t, err := ParseName(name)
+			if err != nil {
+				continue
+			}
+			backups = append(backups, Backup{Name: name, Size: o.Size, Time: t})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sortBackups(backups)
+	return backups, nil
+}
+
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do sends a signed request and returns the response if it succeeded.
+func (s *S3Target) do(method string, u *url.URL, body io.Reader,
+	payloadHash string) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, payloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var e s3Error
+	if err := xml.NewDecoder(resp.Body).Decode(&e); err != nil || e.Code == "" {
+		return nil, fmt.Errorf("s3 %v %v failed: %v", method, u.Path, resp.Status)
+	}
+	return nil, fmt.Errorf("s3 %v %v failed: %v: %v", method, u.Path, e.Code, e.Message)
+}
+
+// sign adds an AWS signature version 4 to the request. All headers of
+// the request are signed.
+func (s *S3Target) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.conf.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.conf.SecretKey), date)
+	key = hmacSHA256(key, s.conf.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		s.conf.AccessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		values := q[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
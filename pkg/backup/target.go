@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package backup stores copies of the heketi db in a local directory
+// or in S3 compatible object storage.
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	namePrefix = "heketi-db-"
+	nameSuffix = ".db"
+	timeFormat = "20060102T150405.000Z"
+
+	DefaultRetention = 7
+)
+
+var (
+	ErrNotConfigured = errors.New("no backup target configured")
+	ErrInvalidName   = errors.New("invalid backup name")
+)
+
+// Backup describes a stored copy of the db.
+type Backup struct {
+	Name string    `json:"name"`
+	Size int64     `json:"size"`
+	Time time.Time `json:"time"`
+}
+
+// Target is a place db backups are stored in.
+type Target interface {
+	// Put stores a backup read from r of the given size.
+	Put(name string, r io.Reader, size int64) error
+	// Get writes the content of a backup to w.
+	Get(name string, w io.Writer) error
+	// Delete removes a backup.
+	Delete(name string) error
+	// List returns the stored backups, oldest first.
+	List() ([]Backup, error)
+	// String describes the target for log messages.
+	String() string
+}
+
+// Config selects the target and the schedule of the db backups.
+type Config struct {
+	// Interval between backups in seconds. Backups are disabled if zero.
+	Interval uint32 `json:"interval"`
+	// StartTime is the delay in seconds before the first backup.
+	StartTime uint32 `json:"start_time"`
+	// Retention is the number of backups kept.
+	Retention int `json:"retention"`
+	// Directory is the local directory backups are stored in.
+	Directory string `json:"directory"`
+	// S3 is the object storage backups are stored in.
+	S3 S3Config `json:"s3"`
+}
+
+// NewTarget returns the target selected by the configuration. It returns
+// ErrNotConfigured if no target is set.
+func NewTarget(c Config) (Target, error) {
+	switch {
+	case c.Directory != "" && c.S3.Endpoint != "":
+		return nil, fmt.Errorf("only one of directory and s3 may be set")
+	case c.Directory != "":
+		return NewLocalTarget(c.Directory), nil
+	case c.S3.Endpoint != "":
+		return NewS3Target(c.S3)
+	}
+	return nil, ErrNotConfigured
+}
+
+// NewName returns the name of a backup taken at the given time. Names
+// sort in the order the backups were taken.
+func NewName(t time.Time) string {
+	return namePrefix + t.UTC().Format(timeFormat) + nameSuffix
+}
+
+// ParseName returns the time encoded in the name of a backup.
+func ParseName(name string) (time.Time, error) {
+	if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, nameSuffix) {
+		return time.Time{}, ErrInvalidName
+	}
+	t, err := time.Parse(timeFormat,
+		strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), nameSuffix))
+	if err != nil {
+		return time.Time{}, ErrInvalidName
+	}
+	return t, nil
+}
+
+// Prune deletes the oldest backups so that at most keep are left.
+// It returns the names of the deleted backups.
+func Prune(t Target, keep int) ([]string, error) {
+	backups, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+	deleted := []string{}
+	for i := 0; i < len(backups)-keep; i++ {
+		if err := t.Delete(backups[i].Name); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, backups[i].Name)
+	}
+	return deleted, nil
+}
+
+// Latest returns the most recent backup of the target.
+func Latest(t Target) (*Backup, error) {
+	backups, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("no backups found in %v", t)
+	}
+	return &backups[len(backups)-1], nil
+}
+
+// sortBackups orders backups by name, which is the order they were taken.
+func sortBackups(backups []Backup) {
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name < backups[j].Name
+	})
+}
@@ -18,8 +18,13 @@ package api
 
 import (
 	"fmt"
+	"net/url"
+	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
@@ -177,10 +182,22 @@ func (devAddReq DeviceAddRequest) Validate() error {
 	)
 }
 
+// DeviceIdentity holds the persistent identifiers of the disk backing
+// a device. Unlike the device name these do not change when the kernel
+// enumerates the disks in a different order.
+type DeviceIdentity struct {
+	Wwn     string   `json:"wwn,omitempty"`
+	IdPaths []string `json:"id_paths,omitempty"`
+	PvUUID  string   `json:"pv_uuid,omitempty"`
+	// kernel path of the disk when the identity was last recorded
+	PvName string `json:"pv_name,omitempty"`
+}
+
 type DeviceInfo struct {
 	Device
-	Storage StorageSize `json:"storage"`
-	Id      string      `json:"id"`
+	Storage  StorageSize    `json:"storage"`
+	Id       string         `json:"id"`
+	Identity DeviceIdentity `json:"identity"`
 }
 
 type DeviceInfoResponse struct {
@@ -217,6 +234,166 @@ type NodeInfoResponse struct {
 	DevicesInfo []DeviceInfoResponse `json:"devices"`
 }
 
+// DiskMedia indicates the kind of storage media a disk uses.
+type DiskMedia string
+
+const (
+	DiskMediaAny DiskMedia = ""
+	DiskMediaHDD DiskMedia = "hdd"
+	DiskMediaSSD DiskMedia = "ssd"
+)
+
+// NodeDisk describes a raw block device found on a node.
+type NodeDisk struct {
+	Name string `json:"name"`
+	// Size in KB
+	Size       uint64   `json:"size"`
+	Rotational bool     `json:"rotational"`
+	Wwn        string   `json:"wwn,omitempty"`
+	IdPaths    []string `json:"id_paths,omitempty"`
+	Signatures []string `json:"signatures,omitempty"`
+	Mounted    bool     `json:"mounted"`
+	// DeviceId is set if the disk is already managed by heketi
+	DeviceId string `json:"device,omitempty"`
+}
+
+// Candidate returns true if the disk can be added to heketi
+// without destroying existing data.
+func (nd NodeDisk) Candidate() bool {
+	return nd.DeviceId == "" && !nd.Mounted && len(nd.Signatures) == 0
+}
+
+type NodeDisksResponse struct {
+	NodeId string     `json:"node"`
+	Disks  []NodeDisk `json:"disks"`
+}
+
+// NodeHealthState is the overall health of a node. A degraded node
+// runs glusterd but fails one of the other checks.
+type NodeHealthState string
+
+const (
+	NodeHealthUnknown  NodeHealthState = "unknown"
+	NodeHealthUp       NodeHealthState = "up"
+	NodeHealthDegraded NodeHealthState = "degraded"
+	NodeHealthDown     NodeHealthState = "down"
+)
+
+// HealthCheckStatus is the result of a node health check. The status
+// is unknown when the check could not be run.
+type HealthCheckStatus string
+
+const (
+	HealthCheckUnknown HealthCheckStatus = "unknown"
+	HealthCheckOk      HealthCheckStatus = "ok"
+	HealthCheckFailed  HealthCheckStatus = "failed"
+)
+
+// Names of the node health checks
+const (
+	HealthCheckGlusterd       = "glusterd"
+	HealthCheckPeers          = "peers"
+	HealthCheckBrickProcesses = "brick_processes"
+	HealthCheckBrickMounts    = "brick_mounts"
+)
+
+// NodeHealthCheck is the result of the latest run of a check. Since
+// is the time the check got its current status.
+type NodeHealthCheck struct {
+	Name    string            `json:"name"`
+	Status  HealthCheckStatus `json:"status"`
+	Message string            `json:"message,omitempty"`
+	Since   time.Time         `json:"since"`
+}
+
+// NodeHealthTransition records a change of the health of a node.
+type NodeHealthTransition struct {
+	Time   time.Time       `json:"time"`
+	State  NodeHealthState `json:"state"`
+	Reason string          `json:"reason,omitempty"`
+}
+
+// NodeHealthResponse is the health of a node as seen by the latest
+// health check, with the latest changes of its health, oldest first.
+type NodeHealthResponse struct {
+	NodeId     string                 `json:"node"`
+	Host       string                 `json:"host"`
+	State      NodeHealthState        `json:"state"`
+	Since      time.Time              `json:"since"`
+	LastUpdate time.Time              `json:"last_update"`
+	Checks     []NodeHealthCheck      `json:"checks"`
+	History    []NodeHealthTransition `json:"history"`
+}
+
+// Names of the readiness checks of the server
+const (
+	ReadinessCheckDb             = "db"
+	ReadinessCheckAdminState     = "admin_state"
+	ReadinessCheckNodeHealth     = "node_health"
+	ReadinessCheckOperations     = "operations"
+	ReadinessCheckTLSCertificate = "tls_certificate"
+)
+
+// ReadinessCheck is the result of a readiness check.
+type ReadinessCheck struct {
+	Name    string            `json:"name"`
+	Status  HealthCheckStatus `json:"status"`
+	Message string            `json:"message,omitempty"`
+}
+
+// ReadinessResponse is the readiness of the server. The status is ok
+// if none of the checks that were run failed.
+type ReadinessResponse struct {
+	Status HealthCheckStatus `json:"status"`
+	Checks []ReadinessCheck  `json:"checks"`
+}
+
+// DiskTagRule sets tags on disks added by the auto-add policy.
+// A rule applies to a disk when the disk matches both the path
+// glob (if set) and the media type (if set).
+type DiskTagRule struct {
+	Match string            `json:"match,omitempty"`
+	Media DiskMedia         `json:"media,omitempty"`
+	Tags  map[string]string `json:"tags"`
+}
+
+func (dtr DiskTagRule) Validate() error {
+	return validation.ValidateStruct(&dtr,
+		validation.Field(&dtr.Match, validation.By(ValidateGlob)),
+		validation.Field(&dtr.Media,
+			validation.In(DiskMediaAny, DiskMediaHDD, DiskMediaSSD)),
+		validation.Field(&dtr.Tags, validation.Required, validation.By(ValidateTags)),
+	)
+}
+
+// NodeDisksAddRequest requests that all candidate disks on a node
+// matching the path glob be added to heketi as devices.
+type NodeDisksAddRequest struct {
+	PathGlob string        `json:"path_glob"`
+	TagRules []DiskTagRule `json:"tag_rules,omitempty"`
+}
+
+func (req NodeDisksAddRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.PathGlob, validation.Required, validation.By(ValidateGlob)),
+		validation.Field(&req.TagRules),
+	)
+}
+
+func ValidateGlob(v interface{}) error {
+	s, _ := v.(string)
+	if s == "" {
+		return nil
+	}
+	if _, err := filepath.Match(s, "/dev"); err != nil {
+		return fmt.Errorf("%v is not a valid path glob", s)
+	}
+	if !strings.HasPrefix(s, "/dev/") {
+		return fmt.Errorf("%v must be an absolute path under /dev", s)
+	}
+	return nil
+}
+
 // Cluster
 
 type ClusterFlags struct {
@@ -343,6 +520,9 @@ type VolumeInfo struct {
 		BlockVolumes sort.StringSlice `json:"blockvolume,omitempty"`
 		Restriction  BlockRestriction `json:"restriction,omitempty"`
 	} `json:"blockinfo,omitempty"`
+	// Discrepancy is set by a state repair when the volume does
+	// not match its state in gluster
+	Discrepancy string `json:"discrepancy,omitempty"`
 }
 
 type VolumeInfoResponse struct {
@@ -374,6 +554,24 @@ func (vcr VolumeCloneRequest) Validate() error {
 	)
 }
 
+// VolumeImportRequest asks heketi to take over management of a
+// gluster volume that was created outside of heketi.
+type VolumeImportRequest struct {
+	// Name of the existing gluster volume
+	Name string `json:"name"`
+	// Cluster the volume belongs to. May be omitted if heketi
+	// manages a single cluster.
+	Cluster string `json:"cluster,omitempty"`
+}
+
+func (vir VolumeImportRequest) Validate() error {
+	return validation.ValidateStruct(&vir,
+		validation.Field(&vir.Name, validation.Required,
+			validation.Match(volumeNameRe)),
+		validation.Field(&vir.Cluster, validation.By(ValidateUUID)),
+	)
+}
+
 type VolumeBlockRestrictionRequest struct {
 	Restriction BlockRestriction `json:"restriction"`
 }
@@ -537,6 +735,9 @@ func (v *VolumeInfoResponse) String() string {
 		s += fmt.Sprintf("Snapshot Factor: %.2f\n",
 			v.Snapshot.Factor)
 	}
+	if v.Discrepancy != "" {
+		s += fmt.Sprintf("Discrepancy: %v\n", v.Discrepancy)
+	}
 	return s
 }
 
@@ -595,10 +796,25 @@ func (v *BlockVolumeInfoResponse) String() string {
 type OperationsInfo struct {
 	Total    uint64 `json:"total"`
 	InFlight uint64 `json:"in_flight"`
+	Queued   uint64 `json:"queued"`
 	// state based counts:
 	Stale  uint64 `json:"stale"`
 	Failed uint64 `json:"failed"`
 	New    uint64 `json:"new"`
+	// limits on in-flight operations
+	Limits OperationLimits `json:"limits"`
+}
+
+// OperationLimits reports the limits on the number of in-flight
+// operations, in total and touching a single cluster or node, and the
+// number of operations in-flight on each cluster and node.
+// A zero per cluster or per node limit means no limit.
+type OperationLimits struct {
+	Max             uint64            `json:"max"`
+	MaxPerCluster   uint64            `json:"max_per_cluster"`
+	MaxPerNode      uint64            `json:"max_per_node"`
+	ClusterInFlight map[string]uint64 `json:"cluster_in_flight"`
+	NodeInFlight    map[string]uint64 `json:"node_in_flight"`
 }
 
 type AdminState string
@@ -678,3 +894,297 @@ func ValidateIds(v interface{}) error {
 	}
 	return nil
 }
+
+// DiscrepancyType identifies a kind of difference found between the
+// state of heketi and the state of gluster.
+type DiscrepancyType string
+
+const (
+	DiscrepancyVolumeMissing     DiscrepancyType = "volume-missing"
+	DiscrepancyVolumeExtra       DiscrepancyType = "volume-extra"
+	DiscrepancyBrickPathMismatch DiscrepancyType = "brick-path-mismatch"
+	DiscrepancyBrickUnmounted    DiscrepancyType = "brick-unmounted"
+	DiscrepancyOrphanedLv        DiscrepancyType = "orphaned-lv"
+)
+
+// DiscrepancyTypes lists all known discrepancy types.
+var DiscrepancyTypes = []DiscrepancyType{
+	DiscrepancyVolumeMissing,
+	DiscrepancyVolumeExtra,
+	DiscrepancyBrickPathMismatch,
+	DiscrepancyBrickUnmounted,
+	DiscrepancyOrphanedLv,
+}
+
+// Discrepancy describes a single difference between the heketi db
+// and gluster. Only the fields relevant to the type are set.
+type Discrepancy struct {
+	Type        DiscrepancyType `json:"type"`
+	Cluster     string          `json:"cluster"`
+	Node        string          `json:"node,omitempty"`
+	Volume      string          `json:"volume,omitempty"`
+	VolumeName  string          `json:"volume_name,omitempty"`
+	Brick       string          `json:"brick,omitempty"`
+	Path        string          `json:"path,omitempty"`
+	Description string          `json:"description"`
+}
+
+// RepairAction identifies the fix applied for a discrepancy.
+type RepairAction string
+
+const (
+	// RepairNone is used when heketi can not fix the discrepancy
+	RepairNone RepairAction = "none"
+	// RepairRemount mounts a brick using its fstab entry
+	RepairRemount RepairAction = "remount"
+	// RepairRemoveLv deletes a logical volume not used by heketi
+	RepairRemoveLv RepairAction = "remove-lv"
+	// RepairMark records the discrepancy on the volume entry
+	RepairMark RepairAction = "mark"
+	// RepairUnmark clears a discrepancy that no longer exists
+	RepairUnmark RepairAction = "unmark"
+)
+
+type StateRepairRequest struct {
+	// DryRun only lists the fixes without applying them
+	DryRun bool `json:"dry_run,omitempty"`
+	// Types limits the repair to the given discrepancy types
+	Types []DiscrepancyType `json:"types,omitempty"`
+}
+
+func (srr StateRepairRequest) Validate() error {
+	return validation.ValidateStruct(&srr,
+		validation.Field(&srr.Types, validation.By(ValidateDiscrepancyTypes)),
+	)
+}
+
+func ValidateDiscrepancyTypes(v interface{}) error {
+	types, ok := v.([]DiscrepancyType)
+	if !ok {
+		return fmt.Errorf("must be a list of discrepancy types")
+	}
+	for _, t := range types {
+		known := false
+		for _, k := range DiscrepancyTypes {
+			known = known || t == k
+		}
+		if !known {
+			return fmt.Errorf("unknown discrepancy type %v", t)
+		}
+	}
+	return nil
+}
+
+// StateRepairFix describes a fix proposed or applied for a
+// discrepancy. Operation is the id of the operation that applied it.
+type StateRepairFix struct {
+	Discrepancy Discrepancy  `json:"discrepancy"`
+	Action      RepairAction `json:"action"`
+	Reason      string       `json:"reason,omitempty"`
+	Applied     bool         `json:"applied"`
+	Operation   string       `json:"operation,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+type StateRepairResponse struct {
+	DryRun bool             `json:"dry_run"`
+	Fixes  []StateRepairFix `json:"fixes"`
+	Report []string         `json:"report"`
+}
+
+// StateCheckSummary counts the problems found by the most recent run
+// of the background state checker.
+type StateCheckSummary struct {
+	Timestamp         int64
+	DbInconsistencies int
+	// Discrepancies maps cluster ids to counts per discrepancy type
+	Discrepancies map[string]map[DiscrepancyType]int
+}
+
+// DbFixRequest asks the server to repair inconsistencies found by
+// the db check.
+type DbFixRequest struct {
+	// DryRun only lists the changes without saving them
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+type OperationHistoryStatus string
+
+const (
+	OperationSucceeded OperationHistoryStatus = "succeeded"
+	OperationFailed    OperationHistoryStatus = "failed"
+)
+
+// OperationPhase records when a phase of an operation ran. Phases
+// that were run more than once, when an operation is retried, are
+// listed once per run.
+type OperationPhase struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error,omitempty"`
+}
+
+// OperationResource is an item of the db changed by an operation.
+type OperationResource struct {
+	Id          string `json:"id"`
+	Description string `json:"description"`
+}
+
+// OperationHistoryInfo describes a completed or failed operation.
+type OperationHistoryInfo struct {
+	Id        string                 `json:"id"`
+	Label     string                 `json:"label"`
+	TypeName  string                 `json:"type_name"`
+	Status    OperationHistoryStatus `json:"status"`
+	Caller    string                 `json:"caller"`
+	Started   time.Time              `json:"started"`
+	Finished  time.Time              `json:"finished"`
+	Phases    []OperationPhase       `json:"phases"`
+	Resources []OperationResource    `json:"resources"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+type OperationHistoryResponse struct {
+	Operations []OperationHistoryInfo `json:"operations"`
+}
+
+// OperationHistoryFilter selects the operations returned from the
+// operation history. Empty fields match all operations.
+type OperationHistoryFilter struct {
+	TypeName string
+	Status   OperationHistoryStatus
+	Caller   string
+	// Resource matches operations that changed the item with this id
+	Resource string
+	// Since and Until are unix timestamps the operation finished in between
+	Since int64
+	Until int64
+	// Limit is the maximum number of the most recent matches returned
+	Limit int
+}
+
+func (f OperationHistoryFilter) Validate() error {
+	return validation.ValidateStruct(&f,
+		validation.Field(&f.Status,
+			validation.In(OperationSucceeded, OperationFailed)),
+		validation.Field(&f.Since, validation.Min(0)),
+		validation.Field(&f.Until, validation.Min(0)),
+		validation.Field(&f.Limit, validation.Min(0)),
+	)
+}
+
+// Query returns the filter as the query parameters of a history request.
+func (f OperationHistoryFilter) Query() url.Values {
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	set("type", f.TypeName)
+	set("status", string(f.Status))
+	set("caller", f.Caller)
+	set("resource", f.Resource)
+	if f.Since != 0 {
+		q.Set("since", strconv.FormatInt(f.Since, 10))
+	}
+	if f.Until != 0 {
+		q.Set("until", strconv.FormatInt(f.Until, 10))
+	}
+	if f.Limit != 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+	return q
+}
+
+// NewOperationHistoryFilter parses the query parameters of a history
+// request.
+func NewOperationHistoryFilter(q url.Values) (OperationHistoryFilter, error) {
+	f := OperationHistoryFilter{
+		TypeName: q.Get("type"),
+		Status:   OperationHistoryStatus(q.Get("status")),
+		Caller:   q.Get("caller"),
+		Resource: q.Get("resource"),
+	}
+	var err error
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, fmt.Errorf("invalid since: %v", v)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, fmt.Errorf("invalid until: %v", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return f, fmt.Errorf("invalid limit: %v", v)
+		}
+	}
+	return f, nil
+}
+
+// CommandTranscript records a command an operation ran on a node.
+// Output and ErrOutput are cut to a bounded size, in which case
+// Truncated is set.
+type CommandTranscript struct {
+	Host       string    `json:"host"`
+	Command    string    `json:"command"`
+	Completed  bool      `json:"completed"`
+	ExitStatus int       `json:"exit_status"`
+	Output     string    `json:"output"`
+	ErrOutput  string    `json:"err_output"`
+	Error      string    `json:"error,omitempty"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Truncated  bool      `json:"truncated,omitempty"`
+}
+
+// OperationTranscript lists the commands run by an operation, in the
+// order they completed. Commands dropped to bound the size of the
+// transcript are counted in Dropped.
+type OperationTranscript struct {
+	Id       string              `json:"id"`
+	Commands []CommandTranscript `json:"commands"`
+	Dropped  int                 `json:"dropped,omitempty"`
+}
+
+type EventType string
+
+const (
+	EventVolumeCreated      EventType = "volume_created"
+	EventVolumeDeleted      EventType = "volume_deleted"
+	EventVolumeExpanded     EventType = "volume_expanded"
+	EventDeviceStateChanged EventType = "device_state_changed"
+	EventNodeHealthChanged  EventType = "node_health_changed"
+	EventBrickUnmounted     EventType = "brick_unmounted"
+	EventBrickRemounted     EventType = "brick_remounted"
+	EventOperationStarted   EventType = "operation_started"
+	EventOperationFinished  EventType = "operation_finished"
+	EventOperationFailed    EventType = "operation_failed"
+	// sent on event streams when events after the resume token
+	// are no longer kept by the server
+	EventsLost EventType = "events_lost"
+)
+
+// Event is a change of the state of the server. The id of an event is
+// the token to resume reading the events after it.
+type Event struct {
+	Id          string            `json:"id"`
+	Type        EventType         `json:"type"`
+	Time        time.Time         `json:"time"`
+	ResourceId  string            `json:"resource_id,omitempty"`
+	OperationId string            `json:"operation_id,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// EventsResponse lists the events after the requested token. Next is
+// the token of the following request. Lost is set if some events after
+// the requested token are no longer kept by the server.
+type EventsResponse struct {
+	Events []Event `json:"events"`
+	Next   string  `json:"next"`
+	Lost   bool    `json:"lost,omitempty"`
+}
@@ -0,0 +1,60 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package logging
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/heketi/heketi/pkg/idgen"
+)
+
+const (
+	RequestIdHeader = "X-Request-Id"
+
+	// keys of the context fields
+	RequestIdKey   = "request_id"
+	OperationIdKey = "operation_id"
+	ResourceIdKey  = "resource_id"
+)
+
+var (
+	validRequestId = regexp.MustCompile("^[a-zA-Z0-9._-]{1,64}$")
+)
+
+// RequestHandler returns a handler that gives the requests served by h
+// a request id. The id is taken from the X-Request-Id header of the
+// request, or generated if missing, and returned in the X-Request-Id
+// header of the response. The handlers get the fields to log the id
+// with from RequestFields.
+func RequestHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIdHeader)
+		if !validRequestId.MatchString(id) {
+			id = idgen.GenUUID()
+		}
+		// the request is updated in place, rather than replaced by a
+		// copy with a new context, so the values other middleware
+		// stored against it are kept
+		r.Header.Set(RequestIdHeader, id)
+		w.Header().Set(RequestIdHeader, id)
+		h(w, r)
+	}
+}
+
+// RequestFields returns the fields identifying the request in log
+// lines, empty if the request has no valid request id.
+func RequestFields(r *http.Request) Fields {
+	id := r.Header.Get(RequestIdHeader)
+	if !validRequestId.MatchString(id) {
+		return Fields{}
+	}
+	return Fields{RequestIdKey: id}
+}
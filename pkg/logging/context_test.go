@@ -0,0 +1,62 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestRequestHandler(t *testing.T) {
+	var requestFields Fields
+	ts := httptest.NewServer(RequestHandler(
+		func(w http.ResponseWriter, r *http.Request) {
+			requestFields = RequestFields(r)
+		}))
+	defer ts.Close()
+
+	// the id of the caller is kept
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Header.Set(RequestIdHeader, "abc-123")
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	tests.Assert(t, r.Header.Get(RequestIdHeader) == "abc-123", r.Header)
+	tests.Assert(t, requestFields[RequestIdKey] == "abc-123", requestFields)
+
+	// invalid or missing ids are replaced
+	req.Header.Set(RequestIdHeader, "not a valid id")
+	r, err = http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+	id := r.Header.Get(RequestIdHeader)
+	tests.Assert(t, id != "" && id != "not a valid id", id)
+	tests.Assert(t, requestFields[RequestIdKey] == id, requestFields)
+}
+
+func TestRequestFields(t *testing.T) {
+	r, err := http.NewRequest("GET", "/volumes", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(RequestFields(r)) == 0, RequestFields(r))
+	r.Header.Set(RequestIdHeader, "not a valid id")
+	tests.Assert(t, len(RequestFields(r)) == 0, RequestFields(r))
+	r.Header.Set(RequestIdHeader, "abc-123")
+	tests.Assert(t, RequestFields(r)[RequestIdKey] == "abc-123", RequestFields(r))
+
+	l := NewLogger("[testing]", LEVEL_INFO).WithFields(RequestFields(r))
+	tests.Assert(t, l.Fields()[RequestIdKey] == "abc-123", l.Fields())
+	// the fields of the logger are not changed through the copy
+	l.Fields()[RequestIdKey] = "other"
+	tests.Assert(t, l.Fields()[RequestIdKey] == "abc-123", l.Fields())
+}
@@ -0,0 +1,162 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Format int32
+
+// Output formats
+const (
+	// FormatText writes lines of the form
+	// "[prefix] LEVEL date time message key=value ..."
+	FormatText Format = iota
+	// FormatJSON writes a JSON object per line
+	FormatJSON
+)
+
+var format int32 = int32(FormatText)
+
+// SetFormat sets the output format of all the loggers.
+func SetFormat(f Format) {
+	atomic.StoreInt32(&format, int32(f))
+}
+
+// CurrentFormat returns the output format of the loggers.
+func CurrentFormat() Format {
+	return Format(atomic.LoadInt32(&format))
+}
+
+// ParseFormat returns the format with the given name, "text" or "json".
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "text", "":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return FormatText, fmt.Errorf("invalid log format: %s", name)
+	}
+}
+
+// Fields are key/value pairs added to log lines.
+type Fields map[string]interface{}
+
+// merge returns a copy of f with the fields of o added.
+func (f Fields) merge(o Fields) Fields {
+	if len(o) == 0 {
+		return f
+	}
+	m := make(Fields, len(f)+len(o))
+	for k, v := range f {
+		m[k] = v
+	}
+	for k, v := range o {
+		m[k] = v
+	}
+	return m
+}
+
+func (f Fields) keys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatFields returns the fields as " key=value" pairs sorted by key.
+func formatFields(f Fields) string {
+	if len(f) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, k := range f.keys() {
+		v := fmt.Sprintf("%v", f[k])
+		if strings.ContainsAny(v, " \"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&b, " %v=%v", k, v)
+	}
+	return b.String()
+}
+
+var levelNames = map[LogLevel]string{
+	LEVEL_CRITICAL: "critical",
+	LEVEL_ERROR:    "error",
+	LEVEL_WARNING:  "warning",
+	LEVEL_INFO:     "info",
+	LEVEL_DEBUG:    "debug",
+}
+
+// reserved keys of the JSON lines, fields with these keys are
+// prefixed with "field."
+var reservedKeys = map[string]bool{
+	"time":   true,
+	"level":  true,
+	"logger": true,
+	"source": true,
+	"msg":    true,
+}
+
+// serializes the JSON lines of all loggers, so that lines written at the
+// same time do not interleave
+var jsonLock sync.Mutex
+
+func (l *Logger) writeJSON(level LogLevel,
+	src, msg string, fields Fields) {
+
+	line := make(map[string]interface{}, len(fields)+5)
+	for k, v := range fields {
+		if reservedKeys[k] {
+			k = "field." + k
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		line[k] = v
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line["level"] = levelNames[level]
+	line["logger"] = l.name
+	line["msg"] = msg
+	if src != "" {
+		line["source"] = src
+	}
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"time":   line["time"],
+			"level":  line["level"],
+			"logger": l.name,
+			"msg":    msg,
+			"error":  "unable to encode fields: " + err.Error(),
+		})
+	}
+	b = append(b, '\n')
+
+	w := l.stdout
+	if level <= LEVEL_ERROR {
+		w = l.stderr
+	}
+	jsonLock.Lock()
+	defer jsonLock.Unlock()
+	w.Write(b)
+}
@@ -42,10 +42,20 @@ type Logger struct {
 	debuglog, warninglog       *log.Logger
 
 	level LogLevel
+
+	// name of the logger and writers of the JSON format
+	name           string
+	stdout, stderr io.Writer
+	// fields added to every line and the logger the level is
+	// shared with, for loggers created by WithFields
+	fields Fields
+	base   *Logger
 }
 
-func logWithLongFile(l *log.Logger, format string, v ...interface{}) {
-	fun, file, line := TraceSkip(2)
+// source returns the file, line and function of the caller skip
+// frames above the caller of source.
+func source(skip int) string {
+	fun, file, line := TraceSkip(skip + 1)
 
 	// Shorten the path.
 	// From
@@ -60,8 +70,45 @@ func logWithLongFile(l *log.Logger, format string, v ...interface{}) {
 		i += len(basePath)
 	}
 
-	l.Print(fmt.Sprintf("%v:%v:%v: ", file[i:], line, filepath.Base(fun)) +
-		fmt.Sprintf(format, v...))
+	return fmt.Sprintf("%v:%v:%v", file[i:], line, filepath.Base(fun))
+}
+
+// output writes a line at the given level. The source of the line is
+// included if longFile is set.
+func (l *Logger) output(level LogLevel, longFile bool,
+	format string, v ...interface{}) {
+
+	var src string
+	if longFile {
+		// skip output and the exported method that called it
+		src = source(2)
+	}
+	msg := fmt.Sprintf(format, v...)
+	fields := l.fields
+
+	if CurrentFormat() == FormatJSON {
+		l.writeJSON(level, src, msg, fields)
+		return
+	}
+	if src != "" {
+		msg = src + ": " + msg
+	}
+	l.levelLogger(level).Print(msg + formatFields(fields))
+}
+
+func (l *Logger) levelLogger(level LogLevel) *log.Logger {
+	switch level {
+	case LEVEL_CRITICAL:
+		return l.critlog
+	case LEVEL_ERROR:
+		return l.errorlog
+	case LEVEL_WARNING:
+		return l.warninglog
+	case LEVEL_INFO:
+		return l.infolog
+	default:
+		return l.debuglog
+	}
 }
 
 // Create a new logger
@@ -82,6 +129,9 @@ func NewLogger(prefix string, level LogLevel) *Logger {
 	l.warninglog = log.New(stdout, prefix+" WARNING ", log.LstdFlags)
 	l.infolog = log.New(stdout, prefix+" INFO ", log.LstdFlags)
 	l.debuglog = log.New(stdout, prefix+" DEBUG ", log.LstdFlags)
+	l.name = strings.Trim(prefix, "[]")
+	l.stdout = stdout
+	l.stderr = stderr
 
 	godbc.Ensure(l.critlog != nil)
 	godbc.Ensure(l.errorlog != nil)
@@ -92,27 +142,48 @@ func NewLogger(prefix string, level LogLevel) *Logger {
 	return l
 }
 
+// WithFields returns a logger that adds the fields to every line it
+// writes. The returned logger shares the level of l.
+func (l *Logger) WithFields(f Fields) *Logger {
+	nl := *l
+	nl.base = l.root()
+	nl.fields = l.fields.merge(f)
+	return &nl
+}
+
+// Fields returns the fields added to every line written by l.
+func (l *Logger) Fields() Fields {
+	return Fields{}.merge(l.fields)
+}
+
+func (l *Logger) root() *Logger {
+	if l.base != nil {
+		return l.base
+	}
+	return l
+}
+
 // Return current level
 func (l *Logger) Level() LogLevel {
-	return l.level
+	return l.root().level
 }
 
 // Set level
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	l.root().level = level
 }
 
 // Log critical information
 func (l *Logger) Critical(format string, v ...interface{}) {
-	if l.level >= LEVEL_CRITICAL {
-		logWithLongFile(l.critlog, format, v...)
+	if l.Level() >= LEVEL_CRITICAL {
+		l.output(LEVEL_CRITICAL, true, format, v...)
 	}
 }
 
 // Log error string
 func (l *Logger) LogError(format string, v ...interface{}) error {
-	if l.level >= LEVEL_ERROR {
-		logWithLongFile(l.errorlog, format, v...)
+	if l.Level() >= LEVEL_ERROR {
+		l.output(LEVEL_ERROR, true, format, v...)
 	}
 
 	return fmt.Errorf(format, v...)
@@ -120,8 +191,8 @@ func (l *Logger) LogError(format string, v ...interface{}) error {
 
 // Log error variable
 func (l *Logger) Err(err error) error {
-	if l.level >= LEVEL_ERROR {
-		logWithLongFile(l.errorlog, "%v", err)
+	if l.Level() >= LEVEL_ERROR {
+		l.output(LEVEL_ERROR, true, "%v", err)
 	}
 
 	return err
@@ -129,15 +200,15 @@ func (l *Logger) Err(err error) error {
 
 // Log warning information
 func (l *Logger) Warning(format string, v ...interface{}) {
-	if l.level >= LEVEL_WARNING {
-		l.warninglog.Printf(format, v...)
+	if l.Level() >= LEVEL_WARNING {
+		l.output(LEVEL_WARNING, false, format, v...)
 	}
 }
 
 // Log error variable as a warning
 func (l *Logger) WarnErr(err error) error {
-	if l.level >= LEVEL_WARNING {
-		logWithLongFile(l.warninglog, "%v", err)
+	if l.Level() >= LEVEL_WARNING {
+		l.output(LEVEL_WARNING, true, "%v", err)
 	}
 
 	return err
@@ -145,14 +216,14 @@ func (l *Logger) WarnErr(err error) error {
 
 // Log string
 func (l *Logger) Info(format string, v ...interface{}) {
-	if l.level >= LEVEL_INFO {
-		l.infolog.Printf(format, v...)
+	if l.Level() >= LEVEL_INFO {
+		l.output(LEVEL_INFO, false, format, v...)
 	}
 }
 
 // Log string as debug
 func (l *Logger) Debug(format string, v ...interface{}) {
-	if l.level >= LEVEL_DEBUG {
-		logWithLongFile(l.debuglog, format, v...)
+	if l.Level() >= LEVEL_DEBUG {
+		l.output(LEVEL_DEBUG, true, format, v...)
 	}
 }
@@ -11,10 +11,13 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/heketi/tests"
 )
@@ -201,3 +204,98 @@ func TestLogErr(t *testing.T) {
 	l.Err(ErrSample)
 	tests.Assert(t, testbuffer.Len() == 0)
 }
+
+func TestLogWithFields(t *testing.T) {
+	var testbuffer bytes.Buffer
+
+	defer tests.Patch(&stdout, &testbuffer).Restore()
+
+	l := NewLogger("[testing]", LEVEL_INFO)
+	fl := l.WithFields(Fields{"volume": "vol1", "reason": "no space"})
+
+	fl.Info("Hello %v", "World")
+	tests.Assert(t, strings.Contains(testbuffer.String(),
+		`Hello World reason="no space" volume=vol1`), testbuffer.String())
+	testbuffer.Reset()
+
+	// the level is shared
+	l.SetLevel(LEVEL_WARNING)
+	tests.Assert(t, fl.Level() == LEVEL_WARNING)
+	fl.Info("TEXT")
+	tests.Assert(t, testbuffer.Len() == 0)
+
+	// the original logger has no fields
+	l.Warning("TEXT")
+	tests.Assert(t, strings.HasSuffix(testbuffer.String(), " TEXT\n"), testbuffer.String())
+}
+
+func TestLogJSON(t *testing.T) {
+	var testbuffer bytes.Buffer
+
+	defer tests.Patch(&stdout, &testbuffer).Restore()
+	defer SetFormat(FormatText)
+
+	f, err := ParseFormat("json")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	SetFormat(f)
+
+	l := NewLogger("[testing]", LEVEL_DEBUG)
+	l.WithFields(Fields{OperationIdKey: "op1"}).
+		WithFields(Fields{"volume": "vol1", "msg": "shadowed"}).
+		Info("Hello %v", "World")
+
+	var line map[string]interface{}
+	err = json.Unmarshal(testbuffer.Bytes(), &line)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err, testbuffer.String())
+	tests.Assert(t, line["level"] == "info", line)
+	tests.Assert(t, line["logger"] == "testing", line)
+	tests.Assert(t, line["msg"] == "Hello World", line)
+	tests.Assert(t, line["volume"] == "vol1", line)
+	tests.Assert(t, line["field.msg"] == "shadowed", line)
+	tests.Assert(t, line[OperationIdKey] == "op1", line)
+	tests.Assert(t, line["source"] == nil, line)
+	_, err = time.Parse(time.RFC3339Nano, line["time"].(string))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	testbuffer.Reset()
+
+	l.Debug("TEXT")
+	line = map[string]interface{}{}
+	err = json.Unmarshal(testbuffer.Bytes(), &line)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err, testbuffer.String())
+	tests.Assert(t, line["level"] == "debug", line)
+	tests.Assert(t, strings.HasPrefix(line["source"].(string), "heketi/pkg/logging/log_test.go:"), line)
+
+	_, err = ParseFormat("xml")
+	tests.Assert(t, err != nil)
+}
+
+func TestLogJSONConcurrent(t *testing.T) {
+	var testbuffer bytes.Buffer
+
+	defer tests.Patch(&stdout, &testbuffer).Restore()
+	defer tests.Patch(&stderr, &testbuffer).Restore()
+	defer SetFormat(FormatText)
+	SetFormat(FormatJSON)
+
+	l := NewLogger("[testing]", LEVEL_DEBUG)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Info("info %v %v", i, j)
+				l.LogError("error %v %v", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(testbuffer.String(), "\n"), "\n")
+	tests.Assert(t, len(lines) == 2000, len(lines))
+	for _, s := range lines {
+		var line map[string]interface{}
+		err := json.Unmarshal([]byte(s), &line)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err, s)
+	}
+}
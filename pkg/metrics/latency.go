@@ -0,0 +1,164 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// Latency metrics are observed as requests, operations and commands
+// run, unlike the inventory metrics that are collected from the
+// application on every scrape. They are exported once the metrics
+// handler is created.
+var (
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the API requests per route",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"route"},
+	)
+
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of API requests per route and status code",
+		},
+		[]string{"route", "code"},
+	)
+
+	operationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the operations per type and status",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+		},
+		[]string{"type", "status"},
+	)
+
+	operationPhaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_phase_duration_seconds",
+			Help:      "Duration of the build, exec, rollback and finalize phases of the operations per type",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 18),
+		},
+		[]string{"type", "phase"},
+	)
+
+	commandDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "executor_command_duration_seconds",
+			Help:      "Latency of the commands run on the storage nodes per command and host",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+		},
+		[]string{"command", "host"},
+	)
+
+	commandFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "executor_command_failures_total",
+			Help:      "Number of commands run on the storage nodes that failed per command and host",
+		},
+		[]string{"command", "host"},
+	)
+)
+
+func latencyCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		requestDuration,
+		requestsTotal,
+		operationDuration,
+		operationPhaseDuration,
+		commandDuration,
+		commandFailures,
+	}
+}
+
+// InstrumentHandler returns a handler that records the latency and
+// the status code of the requests served by h under the route name.
+func InstrumentHandler(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := utils.NewStatusRecorder(w)
+		h(sr, r)
+		requestDuration.WithLabelValues(route).Observe(
+			time.Since(start).Seconds())
+		requestsTotal.WithLabelValues(route, strconv.Itoa(sr.Status)).Inc()
+	}
+}
+
+// ObserveOperation records the duration of a completed or failed
+// operation.
+func ObserveOperation(opType, status string, d time.Duration) {
+	operationDuration.WithLabelValues(opType, status).Observe(d.Seconds())
+}
+
+// ObserveOperationPhase records the duration of a phase of an
+// operation.
+func ObserveOperationPhase(opType, phase string, d time.Duration) {
+	operationPhaseDuration.WithLabelValues(opType, phase).Observe(d.Seconds())
+}
+
+// ObserveCommand records the latency of a command run on a storage
+// node and, if it failed, counts the failure.
+func ObserveCommand(command, host string, d time.Duration, failed bool) {
+	verb := CommandVerb(command)
+	commandDuration.WithLabelValues(verb, host).Observe(d.Seconds())
+	if failed {
+		commandFailures.WithLabelValues(verb, host).Inc()
+	}
+}
+
+// CommandVerb returns the verb of a command line without the
+// arguments, which would make the number of label values unbounded:
+// the program and, for the gluster and gluster-block cli, the
+// sub-commands.
+func CommandVerb(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) > 0 && fields[0] == "sudo" {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	subs := 0
+	switch fields[0] {
+	case "gluster":
+		// e.g. gluster volume create
+		subs = 2
+	case "gluster-block":
+		// e.g. gluster-block create
+		subs = 1
+	}
+	verb := []string{fields[0]}
+	for _, f := range fields[1:] {
+		if len(verb) > subs {
+			break
+		}
+		if !strings.HasPrefix(f, "-") {
+			verb = append(verb, f)
+		}
+	}
+	return strings.Join(verb, " ")
+}
@@ -0,0 +1,32 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestCommandVerb(t *testing.T) {
+	for command, verb := range map[string]string{
+		"gluster --mode=script --timeout=600 volume create vol_1 replica 3": "gluster volume create",
+		"gluster --mode=script --timeout=600 --xml snapshot list vol_1":     "gluster snapshot list",
+		"gluster --mode=script peer probe 192.0.2.1":                        "gluster peer probe",
+		"gluster-block create vol_1/blk_1 ha 3":                             "gluster-block create",
+		"lvcreate -qq --autobackup=n --poolmetadatasize 8192K":              "lvcreate",
+		"sudo mkfs.xfs -i size=512 /dev/mapper/vg_1-brick_1":                "mkfs.xfs",
+		"  umount /var/lib/heketi/mounts/vg_1/brick_1 ":                     "umount",
+		"": "",
+	} {
+		tests.Assert(t, CommandVerb(command) == verb,
+			"expected", verb, "for", command, "got:", CommandVerb(command))
+	}
+}
@@ -12,8 +12,10 @@ package metrics
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/heketi/heketi/apps"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -22,12 +24,49 @@ type Metrics struct {
 	app apps.Application
 }
 
+// StateChecker is implemented by applications that periodically check
+// their state. The summary is nil if no check has been run yet.
+type StateChecker interface {
+	StateCheckSummary() (*api.StateCheckSummary, error)
+}
+
+// DbBackupRecorder is implemented by applications that take backups of
+// their db. The time is zero if no backup has been taken yet.
+type DbBackupRecorder interface {
+	LastDbBackup() time.Time
+}
+
+// OperationLimiter is implemented by applications that limit the
+// number of operations in-flight.
+type OperationLimiter interface {
+	OperationLimits() api.OperationLimits
+}
+
+// OperationCounter is implemented by applications that track their
+// operations. Throttled operations are those rejected because too
+// many operations were in-flight.
+type OperationCounter interface {
+	OperationCounts() (inFlight, queued, throttled uint64)
+}
+
+// VolumeMetricsLimiter is implemented by applications that limit the
+// number of volumes and block volumes exported with a series of their
+// own. A negative limit disables the per-volume series.
+type VolumeMetricsLimiter interface {
+	VolumeMetricsLimit() int
+}
+
 const (
 	namespace = "heketi"
 )
 
 const (
 	KB uint64 = 1024
+	GB uint64 = KB * KB * KB
+
+	// number of volumes and block volumes exported with a series of
+	// their own if the application does not set a limit
+	defaultVolumeMetricsLimit = 1000
 )
 
 var (
@@ -108,6 +147,120 @@ var (
 		"Number of bricks on device",
 		[]string{"cluster", "hostname", "device"},
 	)
+
+	clusterVolumeCount = promDesc(
+		"cluster_volume_count",
+		"Number of volumes on cluster per durability type",
+		[]string{"cluster", "durability"},
+	)
+
+	clusterVolumeSize = promDesc(
+		"cluster_volume_size_bytes",
+		"Total size of the volumes on cluster per durability type in bytes",
+		[]string{"cluster", "durability"},
+	)
+
+	volumeSize = promDesc(
+		"volume_size_bytes",
+		"Size of the volume in bytes",
+		[]string{"cluster", "volume", "name", "durability"},
+	)
+
+	volumeBrickCount = promDesc(
+		"volume_brick_count",
+		"Number of bricks of the volume",
+		[]string{"cluster", "volume"},
+	)
+
+	blockHostingFree = promDesc(
+		"block_hosting_volume_free_bytes",
+		"Space available for block volumes on the block hosting volume in bytes",
+		[]string{"cluster", "volume"},
+	)
+
+	blockHostingReserved = promDesc(
+		"block_hosting_volume_reserved_bytes",
+		"Space reserved on the block hosting volume in bytes",
+		[]string{"cluster", "volume"},
+	)
+
+	blockHostingRestricted = promDesc(
+		"block_hosting_volume_restricted",
+		"Is no block volume allowed on the block hosting volume? The restriction label is the reason",
+		[]string{"cluster", "volume", "restriction"},
+	)
+
+	blockVolumeSize = promDesc(
+		"block_volume_size_bytes",
+		"Size of the block volume in bytes",
+		[]string{"cluster", "volume", "name", "block_hosting_volume"},
+	)
+
+	blockVolumeHacount = promDesc(
+		"block_volume_hacount",
+		"Number of paths to the block volume",
+		[]string{"cluster", "volume"},
+	)
+
+	stateCheckTimestamp = promDesc(
+		"state_check_timestamp_seconds",
+		"Time of the most recent state check",
+		nil,
+	)
+
+	stateDbInconsistencies = promDesc(
+		"state_db_inconsistencies",
+		"Number of db inconsistencies found by the most recent state check",
+		nil,
+	)
+
+	stateDiscrepancies = promDesc(
+		"state_discrepancies",
+		"Number of differences with gluster found by the most recent state check",
+		[]string{"cluster", "type"},
+	)
+
+	dbBackupTimestamp = promDesc(
+		"db_backup_last_success_timestamp_seconds",
+		"Time of the most recent successful db backup",
+		nil,
+	)
+
+	operationsLimit = promDesc(
+		"operations_in_flight_limit",
+		"Maximum number of in-flight operations in total, per cluster or per node (0 is unlimited)",
+		[]string{"scope"},
+	)
+
+	clusterOperations = promDesc(
+		"cluster_operations_in_flight",
+		"Number of in-flight operations on the cluster",
+		[]string{"cluster"},
+	)
+
+	nodeOperations = promDesc(
+		"node_operations_in_flight",
+		"Number of in-flight operations on the node",
+		[]string{"node"},
+	)
+
+	operationsInFlight = promDesc(
+		"operations_in_flight",
+		"Number of in-flight operations",
+		nil,
+	)
+
+	operationsQueued = promDesc(
+		"operations_queued",
+		"Number of operations waiting for an in-flight operation to complete",
+		nil,
+	)
+
+	operationsThrottled = promDesc(
+		"operations_throttled_total",
+		"Number of operations rejected because too many operations were in-flight",
+		nil,
+	)
 )
 
 func promDesc(name, help string, variableLabels []string) *prometheus.Desc {
@@ -133,7 +286,25 @@ func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
 	ch <- deviceFreeInBytes
 	ch <- deviceUsedInBytes
 	ch <- brickCount
-
+	ch <- clusterVolumeCount
+	ch <- clusterVolumeSize
+	ch <- volumeSize
+	ch <- volumeBrickCount
+	ch <- blockHostingFree
+	ch <- blockHostingReserved
+	ch <- blockHostingRestricted
+	ch <- blockVolumeSize
+	ch <- blockVolumeHacount
+	ch <- stateCheckTimestamp
+	ch <- stateDbInconsistencies
+	ch <- stateDiscrepancies
+	ch <- dbBackupTimestamp
+	ch <- operationsLimit
+	ch <- clusterOperations
+	ch <- nodeOperations
+	ch <- operationsInFlight
+	ch <- operationsQueued
+	ch <- operationsThrottled
 }
 
 // Collect metrics from heketi app
@@ -246,6 +417,247 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 			}
 		}
 	}
+
+	m.collectVolumes(ch, topinfo)
+	m.collectStateCheck(ch)
+	m.collectDbBackup(ch)
+	m.collectOperationLimits(ch)
+	m.collectOperationCounts(ch)
+}
+
+// volumeMetricsLimit returns the number of volumes and block volumes
+// exported with a series of their own.
+func (m *Metrics) volumeMetricsLimit() int {
+	limiter, ok := m.app.(VolumeMetricsLimiter)
+	if !ok || limiter.VolumeMetricsLimit() == 0 {
+		return defaultVolumeMetricsLimit
+	}
+	return limiter.VolumeMetricsLimit()
+}
+
+func (m *Metrics) collectVolumes(ch chan<- prometheus.Metric,
+	topinfo *api.TopologyInfoResponse) {
+
+	total := 0
+	for _, cluster := range topinfo.ClusterList {
+		total += len(cluster.Volumes) + len(cluster.BlockVolumes)
+	}
+	// the series of every volume and block volume are only exported
+	// while there are few enough of them, the per cluster totals and
+	// the block hosting volumes are always exported
+	perVolume := total <= m.volumeMetricsLimit()
+
+	for _, cluster := range topinfo.ClusterList {
+		counts := map[string]int{}
+		sizes := map[string]uint64{}
+		for _, volume := range cluster.Volumes {
+			durability := string(volume.Durability.Type)
+			counts[durability]++
+			sizes[durability] += uint64(volume.Size) * GB
+
+			if volume.Block {
+				restricted := 0.0
+				if volume.BlockInfo.Restriction != api.Unrestricted {
+					restricted = 1.0
+				}
+				ch <- prometheus.MustNewConstMetric(
+					blockHostingFree,
+					prometheus.GaugeValue,
+					float64(uint64(volume.BlockInfo.FreeSize)*GB),
+					cluster.Id,
+					volume.Id,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					blockHostingReserved,
+					prometheus.GaugeValue,
+					float64(uint64(volume.BlockInfo.ReservedSize)*GB),
+					cluster.Id,
+					volume.Id,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					blockHostingRestricted,
+					prometheus.GaugeValue,
+					restricted,
+					cluster.Id,
+					volume.Id,
+					string(volume.BlockInfo.Restriction),
+				)
+			}
+
+			if !perVolume {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				volumeSize,
+				prometheus.GaugeValue,
+				float64(uint64(volume.Size)*GB),
+				cluster.Id,
+				volume.Id,
+				volume.Name,
+				durability,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				volumeBrickCount,
+				prometheus.GaugeValue,
+				float64(len(volume.Bricks)),
+				cluster.Id,
+				volume.Id,
+			)
+		}
+		for durability, count := range counts {
+			ch <- prometheus.MustNewConstMetric(
+				clusterVolumeCount,
+				prometheus.GaugeValue,
+				float64(count),
+				cluster.Id,
+				durability,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				clusterVolumeSize,
+				prometheus.GaugeValue,
+				float64(sizes[durability]),
+				cluster.Id,
+				durability,
+			)
+		}
+
+		if !perVolume {
+			continue
+		}
+		for _, blockVolume := range cluster.BlockVolumes {
+			ch <- prometheus.MustNewConstMetric(
+				blockVolumeSize,
+				prometheus.GaugeValue,
+				float64(uint64(blockVolume.Size)*GB),
+				cluster.Id,
+				blockVolume.Id,
+				blockVolume.Name,
+				blockVolume.BlockHostingVolume,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				blockVolumeHacount,
+				prometheus.GaugeValue,
+				float64(blockVolume.Hacount),
+				cluster.Id,
+				blockVolume.Id,
+			)
+		}
+	}
+}
+
+func (m *Metrics) collectStateCheck(ch chan<- prometheus.Metric) {
+	checker, ok := m.app.(StateChecker)
+	if !ok {
+		return
+	}
+	summary, err := checker.StateCheckSummary()
+	if err != nil {
+		log.Println("Can't collect state check summary for metrics: " + err.Error())
+		return
+	}
+	if summary == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		stateCheckTimestamp,
+		prometheus.GaugeValue,
+		float64(summary.Timestamp),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		stateDbInconsistencies,
+		prometheus.GaugeValue,
+		float64(summary.DbInconsistencies),
+	)
+	for cluster, counts := range summary.Discrepancies {
+		for t, count := range counts {
+			ch <- prometheus.MustNewConstMetric(
+				stateDiscrepancies,
+				prometheus.GaugeValue,
+				float64(count),
+				cluster,
+				string(t),
+			)
+		}
+	}
+}
+
+func (m *Metrics) collectDbBackup(ch chan<- prometheus.Metric) {
+	recorder, ok := m.app.(DbBackupRecorder)
+	if !ok {
+		return
+	}
+	last := recorder.LastDbBackup()
+	if last.IsZero() {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		dbBackupTimestamp,
+		prometheus.GaugeValue,
+		float64(last.Unix()),
+	)
+}
+
+func (m *Metrics) collectOperationLimits(ch chan<- prometheus.Metric) {
+	limiter, ok := m.app.(OperationLimiter)
+	if !ok {
+		return
+	}
+	limits := limiter.OperationLimits()
+
+	for scope, limit := range map[string]uint64{
+		"total":   limits.Max,
+		"cluster": limits.MaxPerCluster,
+		"node":    limits.MaxPerNode,
+	} {
+		ch <- prometheus.MustNewConstMetric(
+			operationsLimit,
+			prometheus.GaugeValue,
+			float64(limit),
+			scope,
+		)
+	}
+	for cluster, count := range limits.ClusterInFlight {
+		ch <- prometheus.MustNewConstMetric(
+			clusterOperations,
+			prometheus.GaugeValue,
+			float64(count),
+			cluster,
+		)
+	}
+	for node, count := range limits.NodeInFlight {
+		ch <- prometheus.MustNewConstMetric(
+			nodeOperations,
+			prometheus.GaugeValue,
+			float64(count),
+			node,
+		)
+	}
+}
+
+func (m *Metrics) collectOperationCounts(ch chan<- prometheus.Metric) {
+	counter, ok := m.app.(OperationCounter)
+	if !ok {
+		return
+	}
+	inFlight, queued, throttled := counter.OperationCounts()
+
+	ch <- prometheus.MustNewConstMetric(
+		operationsInFlight,
+		prometheus.GaugeValue,
+		float64(inFlight),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		operationsQueued,
+		prometheus.GaugeValue,
+		float64(queued),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		operationsThrottled,
+		prometheus.CounterValue,
+		float64(throttled),
+	)
 }
 
 func NewMetricsHandler(app apps.Application) http.HandlerFunc {
@@ -253,6 +665,7 @@ func NewMetricsHandler(app apps.Application) http.HandlerFunc {
 		app: app,
 	}
 	prometheus.MustRegister(m)
+	prometheus.MustRegister(latencyCollectors()...)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		promhttp.Handler().ServeHTTP(w, r)
 	})
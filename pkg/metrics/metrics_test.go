@@ -15,13 +15,20 @@ import (
 	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type testApp struct {
 	topologyInfo *api.TopologyInfoResponse
+	stateSummary *api.StateCheckSummary
+	lastDbBackup time.Time
+	opLimits     api.OperationLimits
+	volumeLimit  int
 }
 
 func (t *testApp) SetRoutes(router *mux.Router) error {
@@ -32,17 +39,69 @@ func (t *testApp) TopologyInfo() (*api.TopologyInfoResponse, error) {
 	return t.topologyInfo, nil
 }
 
+func (t *testApp) StateCheckSummary() (*api.StateCheckSummary, error) {
+	return t.stateSummary, nil
+}
+
+func (t *testApp) LastDbBackup() time.Time {
+	return t.lastDbBackup
+}
+
+func (t *testApp) OperationLimits() api.OperationLimits {
+	return t.opLimits
+}
+
+func (t *testApp) OperationCounts() (uint64, uint64, uint64) {
+	return 5, 2, 7
+}
+
+func (t *testApp) VolumeMetricsLimit() int {
+	return t.volumeLimit
+}
+
 func (t *testApp) Close() {}
 
 func (t *testApp) Auth(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 }
 
+func testVolumes() ([]api.VolumeInfoResponse, []api.BlockVolumeInfoResponse) {
+	v1 := api.VolumeInfoResponse{
+		Bricks: []api.BrickInfo{{Id: "b1"}, {Id: "b2"}, {Id: "b3"}},
+	}
+	v1.Id = "v1"
+	v1.Name = "vol_v1"
+	v1.Size = 10
+	v1.Durability.Type = api.DurabilityReplicate
+	v2 := api.VolumeInfoResponse{
+		Bricks: []api.BrickInfo{{Id: "b4"}, {Id: "b5"}, {Id: "b6"}},
+	}
+	v2.Id = "v2"
+	v2.Name = "vol_v2"
+	v2.Size = 100
+	v2.Durability.Type = api.DurabilityReplicate
+	v2.Block = true
+	v2.BlockInfo.FreeSize = 93
+	v2.BlockInfo.ReservedSize = 2
+	v2.BlockInfo.Restriction = api.Locked
+	bv1 := api.BlockVolumeInfoResponse{}
+	bv1.Id = "bv1"
+	bv1.Name = "blockvol_bv1"
+	bv1.Size = 5
+	bv1.Hacount = 3
+	bv1.BlockHostingVolume = "v2"
+	return []api.VolumeInfoResponse{v1, v2},
+		[]api.BlockVolumeInfoResponse{bv1}
+}
+
 func TestMetricsEndpoint(t *testing.T) {
+	volumes, blockVolumes := testVolumes()
 	ta := &testApp{
 		topologyInfo: &api.TopologyInfoResponse{
 			ClusterList: []api.Cluster{
 				{
-					Id: "c1",
+					Id:           "c1",
+					Volumes:      volumes,
+					BlockVolumes: blockVolumes,
 					Nodes: []api.NodeInfoResponse{
 						{
 							NodeInfo: api.NodeInfo{NodeAddRequest: api.NodeAddRequest{Hostnames: api.HostAddresses{Manage: []string{"n1"}}}},
@@ -69,12 +128,45 @@ func TestMetricsEndpoint(t *testing.T) {
 				},
 			},
 		},
+		stateSummary: &api.StateCheckSummary{
+			Timestamp:         1500000000,
+			DbInconsistencies: 3,
+			Discrepancies: map[string]map[api.DiscrepancyType]int{
+				"c1": {
+					api.DiscrepancyOrphanedLv:     2,
+					api.DiscrepancyBrickUnmounted: 0,
+				},
+			},
+		},
+		lastDbBackup: time.Unix(1500000100, 0),
+		opLimits: api.OperationLimits{
+			Max:             8,
+			MaxPerCluster:   4,
+			ClusterInFlight: map[string]uint64{"c1": 3},
+			NodeInFlight:    map[string]uint64{"n1": 2},
+		},
 	}
 
 	ts := httptest.NewServer(NewMetricsHandler(ta))
 	defer ts.Close()
 
-	res, err := http.Get(ts.URL)
+	// latency metrics
+	rs := httptest.NewServer(InstrumentHandler("VolumeList",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+	res, err := http.Get(rs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	rs.Close()
+	ObserveOperation("create-volume", "succeeded", 3*time.Second)
+	ObserveOperationPhase("create-volume", "exec", 2*time.Second)
+	ObserveCommand("gluster --mode=script volume create vol_1 replica 3", "n1", 250*time.Millisecond, false)
+	ObserveCommand("lvcreate -qq --autobackup=n -L 1G vg_1", "n1", time.Second, true)
+
+	res, err = http.Get(ts.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -93,4 +185,184 @@ func TestMetricsEndpoint(t *testing.T) {
 	if !match || err != nil {
 		t.Fatal("heketi_device_size{cluster=\"c1\",device=\"d1\",hostname=\"n1\"} 2 should be present in the metrics output")
 	}
+
+	match, err = regexp.Match("heketi_state_db_inconsistencies 3", body)
+	if !match || err != nil {
+		t.Fatal("heketi_state_db_inconsistencies 3 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_state_discrepancies{cluster=\"c1\",type=\"orphaned-lv\"} 2", body)
+	if !match || err != nil {
+		t.Fatal("heketi_state_discrepancies{cluster=\"c1\",type=\"orphaned-lv\"} 2 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_state_discrepancies{cluster=\"c1\",type=\"brick-unmounted\"} 0", body)
+	if !match || err != nil {
+		t.Fatal("heketi_state_discrepancies{cluster=\"c1\",type=\"brick-unmounted\"} 0 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_db_backup_last_success_timestamp_seconds 1.5000001e\\+09", body)
+	if !match || err != nil {
+		t.Fatal("heketi_db_backup_last_success_timestamp_seconds 1.5000001e+09 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_operations_in_flight_limit{scope=\"cluster\"} 4", body)
+	if !match || err != nil {
+		t.Fatal("heketi_operations_in_flight_limit{scope=\"cluster\"} 4 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_operations_in_flight_limit{scope=\"node\"} 0", body)
+	if !match || err != nil {
+		t.Fatal("heketi_operations_in_flight_limit{scope=\"node\"} 0 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_cluster_operations_in_flight{cluster=\"c1\"} 3", body)
+	if !match || err != nil {
+		t.Fatal("heketi_cluster_operations_in_flight{cluster=\"c1\"} 3 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_node_operations_in_flight{node=\"n1\"} 2", body)
+	if !match || err != nil {
+		t.Fatal("heketi_node_operations_in_flight{node=\"n1\"} 2 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_operations_in_flight 5", body)
+	if !match || err != nil {
+		t.Fatal("heketi_operations_in_flight 5 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_operations_queued 2", body)
+	if !match || err != nil {
+		t.Fatal("heketi_operations_queued 2 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_operations_throttled_total 7", body)
+	if !match || err != nil {
+		t.Fatal("heketi_operations_throttled_total 7 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_http_request_duration_seconds_count{route=\"VolumeList\"} 1", body)
+	if !match || err != nil {
+		t.Fatal("heketi_http_request_duration_seconds_count{route=\"VolumeList\"} 1 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_http_requests_total{code=\"418\",route=\"VolumeList\"} 1", body)
+	if !match || err != nil {
+		t.Fatal("heketi_http_requests_total{code=\"418\",route=\"VolumeList\"} 1 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_operation_duration_seconds_sum{status=\"succeeded\",type=\"create-volume\"} 3", body)
+	if !match || err != nil {
+		t.Fatal("heketi_operation_duration_seconds_sum{status=\"succeeded\",type=\"create-volume\"} 3 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_operation_phase_duration_seconds_sum{phase=\"exec\",type=\"create-volume\"} 2", body)
+	if !match || err != nil {
+		t.Fatal("heketi_operation_phase_duration_seconds_sum{phase=\"exec\",type=\"create-volume\"} 2 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_executor_command_duration_seconds_count{command=\"gluster volume create\",host=\"n1\"} 1", body)
+	if !match || err != nil {
+		t.Fatal("heketi_executor_command_duration_seconds_count{command=\"gluster volume create\",host=\"n1\"} 1 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_executor_command_failures_total{command=\"lvcreate\",host=\"n1\"} 1", body)
+	if !match || err != nil {
+		t.Fatal("heketi_executor_command_failures_total{command=\"lvcreate\",host=\"n1\"} 1 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_cluster_volume_count{cluster=\"c1\",durability=\"replicate\"} 2", body)
+	if !match || err != nil {
+		t.Fatal("heketi_cluster_volume_count{cluster=\"c1\",durability=\"replicate\"} 2 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_cluster_volume_size_bytes{cluster=\"c1\",durability=\"replicate\"} 1.1811160064e\\+11", body)
+	if !match || err != nil {
+		t.Fatal("heketi_cluster_volume_size_bytes{cluster=\"c1\",durability=\"replicate\"} 1.1811160064e+11 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_volume_size_bytes{cluster=\"c1\",durability=\"replicate\",name=\"vol_v1\",volume=\"v1\"} 1.073741824e\\+10", body)
+	if !match || err != nil {
+		t.Fatal("heketi_volume_size_bytes{cluster=\"c1\",durability=\"replicate\",name=\"vol_v1\",volume=\"v1\"} 1.073741824e+10 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_volume_brick_count{cluster=\"c1\",volume=\"v1\"} 3", body)
+	if !match || err != nil {
+		t.Fatal("heketi_volume_brick_count{cluster=\"c1\",volume=\"v1\"} 3 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_block_hosting_volume_free_bytes{cluster=\"c1\",volume=\"v2\"} 9.9857989632e\\+10", body)
+	if !match || err != nil {
+		t.Fatal("heketi_block_hosting_volume_free_bytes{cluster=\"c1\",volume=\"v2\"} 9.9857989632e+10 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_block_hosting_volume_reserved_bytes{cluster=\"c1\",volume=\"v2\"} 2.147483648e\\+09", body)
+	if !match || err != nil {
+		t.Fatal("heketi_block_hosting_volume_reserved_bytes{cluster=\"c1\",volume=\"v2\"} 2.147483648e+09 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_block_hosting_volume_restricted{cluster=\"c1\",restriction=\"locked\",volume=\"v2\"} 1", body)
+	if !match || err != nil {
+		t.Fatal("heketi_block_hosting_volume_restricted{cluster=\"c1\",restriction=\"locked\",volume=\"v2\"} 1 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_block_volume_size_bytes{block_hosting_volume=\"v2\",cluster=\"c1\",name=\"blockvol_bv1\",volume=\"bv1\"} 5.36870912e\\+09", body)
+	if !match || err != nil {
+		t.Fatal("heketi_block_volume_size_bytes{block_hosting_volume=\"v2\",cluster=\"c1\",name=\"blockvol_bv1\",volume=\"bv1\"} 5.36870912e+09 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_block_volume_hacount{cluster=\"c1\",volume=\"bv1\"} 3", body)
+	if !match || err != nil {
+		t.Fatal("heketi_block_volume_hacount{cluster=\"c1\",volume=\"bv1\"} 3 should be present in the metrics output")
+	}
+}
+
+func TestVolumeMetricsLimit(t *testing.T) {
+	volumes, blockVolumes := testVolumes()
+	ta := &testApp{
+		topologyInfo: &api.TopologyInfoResponse{
+			ClusterList: []api.Cluster{
+				{
+					Id:           "c1",
+					Volumes:      volumes,
+					BlockVolumes: blockVolumes,
+				},
+			},
+		},
+	}
+
+	gather := func() map[string]int {
+		r := prometheus.NewRegistry()
+		r.MustRegister(&Metrics{app: ta})
+		families, err := r.Gather()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		series := map[string]int{}
+		for _, f := range families {
+			series[f.GetName()] = len(f.GetMetric())
+		}
+		return series
+	}
+
+	// the default limit is well above three volumes
+	series := gather()
+	tests.Assert(t, series["heketi_volume_size_bytes"] == 2, series)
+	tests.Assert(t, series["heketi_block_volume_hacount"] == 1, series)
+
+	ta.volumeLimit = 3
+	series = gather()
+	tests.Assert(t, series["heketi_volume_size_bytes"] == 2, series)
+
+	// over the limit only the totals and block hosting volumes remain
+	ta.volumeLimit = 2
+	series = gather()
+	tests.Assert(t, series["heketi_volume_size_bytes"] == 0, series)
+	tests.Assert(t, series["heketi_volume_brick_count"] == 0, series)
+	tests.Assert(t, series["heketi_block_volume_size_bytes"] == 0, series)
+	tests.Assert(t, series["heketi_cluster_volume_count"] == 1, series)
+	tests.Assert(t, series["heketi_block_hosting_volume_free_bytes"] == 1, series)
+
+	ta.volumeLimit = -1
+	series = gather()
+	tests.Assert(t, series["heketi_volume_size_bytes"] == 0, series)
+	tests.Assert(t, series["heketi_cluster_volume_size_bytes"] == 1, series)
 }
@@ -13,6 +13,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"time"
 
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/client/unversioned/remotecommand"
@@ -66,6 +67,7 @@ func ExecCommands(
 		var berr bytes.Buffer
 
 		// Excute command
+		start := time.Now()
 		err = exec.Stream(remotecommand.StreamOptions{
 			SupportedProtocols: kubeletcmd.SupportedStreamingProtocols,
 			Stdout:             &b,
@@ -76,6 +78,7 @@ func ExecCommands(
 			Output:    b.String(),
 			ErrOutput: berr.String(),
 			Err:       err,
+			Duration:  time.Since(start),
 		}
 		if err == nil {
 			k.logger.Debug(
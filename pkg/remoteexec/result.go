@@ -11,6 +11,7 @@ package remoteexec
 
 import (
 	"errors"
+	"time"
 )
 
 // Result is used to capture the result of running a command
@@ -21,6 +22,8 @@ type Result struct {
 	ErrOutput  string
 	Err        error
 	ExitStatus int
+	// time the command took to run
+	Duration time.Duration
 }
 
 // Ok returns a boolean indicating that the command ran and
@@ -160,6 +160,7 @@ func (s *SshExec) ExecCommands(
 		command = "/bin/bash -c '" + command + "'"
 
 		// Execute command
+		start := time.Now()
 		err = session.Start(command)
 		if err != nil {
 			return nil, err
@@ -182,6 +183,7 @@ func (s *SshExec) ExecCommands(
 				Output:    b.String(),
 				ErrOutput: berr.String(),
 				Err:       err,
+				Duration:  time.Since(start),
 			}
 			if err == nil {
 				s.logger.Debug(
@@ -0,0 +1,241 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	DefaultServiceName = "heketi"
+
+	// OTLP status codes
+	statusUnset = 0
+	statusError = 2
+)
+
+// Exporter sends ended spans to a tracing backend.
+type Exporter interface {
+	Export(s *Span)
+	Close() error
+}
+
+// Config selects the exporter of the spans.
+type Config struct {
+	// Exporter is "stdout" or "file". Tracing is disabled if empty.
+	Exporter string `json:"exporter"`
+	// File is the file spans are appended to by the file exporter.
+	File string `json:"file"`
+	// ServiceName is the service.name resource attribute of the spans.
+	ServiceName string `json:"service_name"`
+}
+
+// NewExporter returns the exporter selected by the configuration, or
+// nil if tracing is disabled.
+func NewExporter(c Config) (Exporter, error) {
+	name := c.ServiceName
+	if name == "" {
+		name = DefaultServiceName
+	}
+	switch c.Exporter {
+	case "":
+		return nil, nil
+	case "stdout":
+		return NewJSONExporter(os.Stdout, name), nil
+	case "file":
+		if c.File == "" {
+			return nil, fmt.Errorf("the file exporter requires a file")
+		}
+		f, err := os.OpenFile(c.File,
+			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		e := NewJSONExporter(f, name)
+		e.closer = f
+		return e, nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %v", c.Exporter)
+	}
+}
+
+// JSONExporter writes every span as a line of JSON in the format of
+// the OTLP file exporter: an OTLP/JSON ExportTraceServiceRequest
+// holding the span. The files can be loaded into a collector with its
+// otlpjsonfile receiver once a backend is reachable.
+type JSONExporter struct {
+	lock        sync.Mutex
+	w           io.Writer
+	closer      io.Closer
+	serviceName string
+}
+
+func NewJSONExporter(w io.Writer, serviceName string) *JSONExporter {
+	return &JSONExporter{
+		w:           w,
+		serviceName: serviceName,
+	}
+}
+
+func (e *JSONExporter) Export(s *Span) {
+	b, err := json.Marshal(e.request(s))
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.w.Write(b)
+}
+
+func (e *JSONExporter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.closer == nil {
+		return nil
+	}
+	err := e.closer.Close()
+	e.closer = nil
+	return err
+}
+
+// The types below follow the JSON mapping of the OTLP trace protobuf
+// messages. Ids are hex encoded and 64 bit integers are strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpValue `json:"values"`
+}
+
+func toValue(v interface{}) otlpValue {
+	switch x := v.(type) {
+	case string:
+		return otlpValue{StringValue: &x}
+	case bool:
+		return otlpValue{BoolValue: &x}
+	case int:
+		s := strconv.FormatInt(int64(x), 10)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		return otlpValue{IntValue: &s}
+	case uint64:
+		s := strconv.FormatUint(x, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &x}
+	case []string:
+		a := &otlpArrayValue{Values: []otlpValue{}}
+		for _, s := range x {
+			a.Values = append(a.Values, toValue(s))
+		}
+		return otlpValue{ArrayValue: a}
+	default:
+		s := fmt.Sprintf("%v", x)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+func (e *JSONExporter) request(s *Span) otlpRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	span := otlpSpan{
+		TraceId:           s.ctx.TraceID.String(),
+		SpanId:            s.ctx.SpanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Status:            otlpStatus{Code: statusUnset},
+	}
+	if s.parent.IsValid() {
+		span.ParentSpanId = s.parent.String()
+	}
+	for _, a := range s.attrs {
+		span.Attributes = append(span.Attributes,
+			otlpKeyValue{Key: a.key, Value: toValue(a.value)})
+	}
+	if s.err != "" {
+		span.Status = otlpStatus{Code: statusError, Message: s.err}
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{{
+					Key:   "service.name",
+					Value: toValue(e.serviceName),
+				}},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/heketi/heketi"},
+				Spans: []otlpSpan{span},
+			}},
+		}},
+	}
+}
@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/context"
+
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+
+	requestSpanKey = "span"
+)
+
+// Handler returns a handler that records a span named after the route
+// for every request served by h. The span is a child of the span in
+// the traceparent header of the request, if any, and can be retrieved
+// by h with RequestSpan.
+func Handler(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() {
+			h(w, r)
+			return
+		}
+		parent, _ := ParseTraceparent(r.Header.Get(TraceparentHeader))
+		span := StartSpan(route, SpanKindServer, parent)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		context.Set(r, requestSpanKey, span)
+		defer context.Delete(r, requestSpanKey)
+
+		sr := utils.NewStatusRecorder(w)
+		h(sr, r)
+		span.SetAttribute("http.status_code", sr.Status)
+		if sr.Status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%v", http.StatusText(sr.Status)))
+		}
+		span.End()
+	}
+}
+
+// RequestSpan returns the span of the request, or nil if the request
+// is not traced.
+func RequestSpan(r *http.Request) *Span {
+	span, _ := context.Get(r, requestSpanKey).(*Span)
+	return span
+}
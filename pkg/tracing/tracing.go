@@ -0,0 +1,232 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package tracing records spans of the API requests, the operations and
+// the commands run on the storage nodes and exports them in the
+// OpenTelemetry protocol (OTLP) JSON encoding. Trace context is
+// propagated from incoming requests with the W3C traceparent header.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext identifies a span within a trace. The zero value is not
+// a valid context, a span started from it is the root of a new trace.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (c SpanContext) IsValid() bool {
+	return c.TraceID.IsValid() && c.SpanID.IsValid()
+}
+
+// Traceparent returns the context as the value of a W3C traceparent
+// header.
+func (c SpanContext) Traceparent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%v-%v-%v", c.TraceID, c.SpanID, flags)
+}
+
+// ParseTraceparent parses the value of a W3C traceparent header.
+func ParseTraceparent(h string) (SpanContext, bool) {
+	var c SpanContext
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return c, false
+	}
+	// version 00 has exactly four fields, later versions may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return c, false
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 {
+		return c, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return c, false
+	}
+	if _, err := hex.Decode(c.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(c.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	c.Sampled = flags[0]&0x01 != 0
+	if !c.IsValid() {
+		return SpanContext{}, false
+	}
+	return c, true
+}
+
+type SpanKind int
+
+// Values of the span kinds of the OTLP protocol.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Span is a timed part of a trace. All the methods of Span can be
+// called on a nil span, which is what StartSpan returns if tracing
+// is not enabled.
+type Span struct {
+	lock   sync.Mutex
+	name   string
+	kind   SpanKind
+	ctx    SpanContext
+	parent SpanID
+	start  time.Time
+	end    time.Time
+	attrs  []attribute
+	err    string
+	ended  bool
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+var (
+	exporterLock sync.RWMutex
+	exporter     Exporter
+)
+
+// SetExporter sets the exporter of the ended spans. Tracing is disabled
+// if the exporter is nil.
+func SetExporter(e Exporter) {
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+	exporter = e
+}
+
+func currentExporter() Exporter {
+	exporterLock.RLock()
+	defer exporterLock.RUnlock()
+	return exporter
+}
+
+// Enabled returns true if spans are exported.
+func Enabled() bool {
+	return currentExporter() != nil
+}
+
+// StartSpan starts a span that is a child of the parent span, or the
+// root of a new trace if the parent is not valid. It returns nil if
+// tracing is not enabled.
+func StartSpan(name string, kind SpanKind, parent SpanContext) *Span {
+	if !Enabled() {
+		return nil
+	}
+	s := &Span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+	}
+	if parent.IsValid() {
+		s.ctx.TraceID = parent.TraceID
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.ctx.TraceID[:])
+	}
+	rand.Read(s.ctx.SpanID[:])
+	s.ctx.Sampled = true
+	return s
+}
+
+// Context returns the context of the span, to start child spans from.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetAttribute sets an attribute of the span. Values are strings,
+// integers, floats, booleans or slices of strings.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := range s.attrs {
+		if s.attrs[i].key == key {
+			s.attrs[i].value = value
+			return
+		}
+	}
+	s.attrs = append(s.attrs, attribute{key: key, value: value})
+}
+
+// SetError marks the span failed with the error, if not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span and exports it. Ending a span more than once has
+// no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.lock.Unlock()
+
+	if e := currentExporter(); e != nil {
+		e.Export(s)
+	}
+}
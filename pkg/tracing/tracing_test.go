@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+const (
+	testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+)
+
+// exported spans decoded from the lines written by a JSONExporter
+func decodeSpans(t *testing.T, b []byte) []otlpSpan {
+	spans := []otlpSpan{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		var req otlpRequest
+		err := json.Unmarshal(s.Bytes(), &req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(req.ResourceSpans) == 1, req)
+		tests.Assert(t, len(req.ResourceSpans[0].ScopeSpans) == 1, req)
+		spans = append(spans, req.ResourceSpans[0].ScopeSpans[0].Spans...)
+	}
+	return spans
+}
+
+func attr(s otlpSpan, key string) *otlpValue {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return &a.Value
+		}
+	}
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	c, ok := ParseTraceparent(testTraceparent)
+	tests.Assert(t, ok)
+	tests.Assert(t, c.TraceID.String() == "4bf92f3577b34da6a3ce929d0e0e4736", c.TraceID)
+	tests.Assert(t, c.SpanID.String() == "00f067aa0ba902b7", c.SpanID)
+	tests.Assert(t, c.Sampled)
+	tests.Assert(t, c.Traceparent() == testTraceparent, c.Traceparent())
+
+	c, ok = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	tests.Assert(t, ok)
+	tests.Assert(t, !c.Sampled)
+
+	// later versions may add fields
+	_, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	tests.Assert(t, ok)
+
+	for _, h := range []string{
+		"",
+		"garbage",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	} {
+		_, ok := ParseTraceparent(h)
+		tests.Assert(t, !ok, "expected", h, "to be rejected")
+	}
+}
+
+func TestSpanDisabled(t *testing.T) {
+	SetExporter(nil)
+	tests.Assert(t, !Enabled())
+
+	s := StartSpan("test", SpanKindInternal, SpanContext{})
+	tests.Assert(t, s == nil)
+	// methods of nil spans have no effect
+	s.SetAttribute("key", "value")
+	s.SetError(errors.New("failed"))
+	s.End()
+	tests.Assert(t, !s.Context().IsValid())
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	SetExporter(NewJSONExporter(&buf, "test-service"))
+	defer SetExporter(nil)
+
+	parent, _ := ParseTraceparent(testTraceparent)
+	s := StartSpan("child", SpanKindClient, parent)
+	s.SetAttribute("host", "node1")
+	s.SetAttribute("commands", []string{"a", "b"})
+	s.SetAttribute("count", 3)
+	s.SetError(errors.New("failed"))
+	s.End()
+	// ending again exports nothing
+	s.End()
+
+	root := StartSpan("root", SpanKindInternal, SpanContext{})
+	root.End()
+	tests.Assert(t, root.Context().TraceID != parent.TraceID)
+
+	var req otlpRequest
+	line, err := bufio.NewReader(bytes.NewReader(buf.Bytes())).ReadBytes('\n')
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = json.Unmarshal(line, &req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	res := req.ResourceSpans[0].Resource.Attributes
+	tests.Assert(t, len(res) == 1 && res[0].Key == "service.name", res)
+	tests.Assert(t, *res[0].Value.StringValue == "test-service", res)
+
+	spans := decodeSpans(t, buf.Bytes())
+	tests.Assert(t, len(spans) == 2, spans)
+	child := spans[0]
+	tests.Assert(t, child.Name == "child", child.Name)
+	tests.Assert(t, child.Kind == SpanKindClient, child.Kind)
+	tests.Assert(t, child.TraceId == parent.TraceID.String(), child.TraceId)
+	tests.Assert(t, child.ParentSpanId == parent.SpanID.String(), child.ParentSpanId)
+	tests.Assert(t, child.SpanId == s.Context().SpanID.String(), child.SpanId)
+	tests.Assert(t, child.Status.Code == statusError, child.Status)
+	tests.Assert(t, child.Status.Message == "failed", child.Status)
+	tests.Assert(t, *attr(child, "host").StringValue == "node1")
+	tests.Assert(t, len(attr(child, "commands").ArrayValue.Values) == 2)
+	tests.Assert(t, *attr(child, "count").IntValue == "3")
+	tests.Assert(t, child.StartTimeUnixNano <= child.EndTimeUnixNano)
+
+	tests.Assert(t, spans[1].Name == "root", spans[1].Name)
+	tests.Assert(t, spans[1].ParentSpanId == "", spans[1].ParentSpanId)
+	tests.Assert(t, spans[1].Status.Code == statusUnset, spans[1].Status)
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	SetExporter(NewJSONExporter(&buf, DefaultServiceName))
+	defer SetExporter(nil)
+
+	var inner SpanContext
+	ts := httptest.NewServer(Handler("VolumeList",
+		func(w http.ResponseWriter, r *http.Request) {
+			inner = RequestSpan(r).Context()
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL+"/volumes", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Header.Set(TraceparentHeader, testTraceparent)
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r.Body.Close()
+
+	parent, _ := ParseTraceparent(testTraceparent)
+	tests.Assert(t, inner.TraceID == parent.TraceID, inner)
+
+	spans := decodeSpans(t, buf.Bytes())
+	tests.Assert(t, len(spans) == 1, spans)
+	tests.Assert(t, spans[0].Name == "VolumeList", spans[0].Name)
+	tests.Assert(t, spans[0].Kind == SpanKindServer, spans[0].Kind)
+	tests.Assert(t, spans[0].SpanId == inner.SpanID.String(), spans[0].SpanId)
+	tests.Assert(t, spans[0].ParentSpanId == parent.SpanID.String())
+	tests.Assert(t, *attr(spans[0], "http.method").StringValue == "GET")
+	tests.Assert(t, *attr(spans[0], "http.target").StringValue == "/volumes")
+	tests.Assert(t, *attr(spans[0], "http.status_code").IntValue == "500")
+	tests.Assert(t, spans[0].Status.Code == statusError, spans[0].Status)
+}
+
+func TestNewExporter(t *testing.T) {
+	e, err := NewExporter(Config{})
+	tests.Assert(t, err == nil && e == nil, err, e)
+
+	_, err = NewExporter(Config{Exporter: "file"})
+	tests.Assert(t, err != nil)
+
+	_, err = NewExporter(Config{Exporter: "jaeger"})
+	tests.Assert(t, err != nil)
+
+	e, err = NewExporter(Config{Exporter: "stdout"})
+	tests.Assert(t, err == nil && e != nil, err, e)
+	tests.Assert(t, e.Close() == nil)
+}
@@ -0,0 +1,36 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), as published by the Free Software Foundation,
+// or under the Apache License, Version 2.0 <LICENSE-APACHE2 or
+// http://www.apache.org/licenses/LICENSE-2.0>.
+//
+// You may not use this file except in compliance with those terms.
+//
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	sr := NewStatusRecorder(w)
+	sr.Write([]byte("ok"))
+	tests.Assert(t, sr.Status == http.StatusOK, sr.Status)
+
+	w = httptest.NewRecorder()
+	sr = NewStatusRecorder(w)
+	sr.WriteHeader(http.StatusNotFound)
+	sr.Flush()
+	tests.Assert(t, sr.Status == http.StatusNotFound, sr.Status)
+	tests.Assert(t, w.Code == http.StatusNotFound, w.Code)
+	tests.Assert(t, w.Flushed)
+}
@@ -0,0 +1,328 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package webhook delivers notifications as signed JSON POST requests
+// to the configured URLs, retrying failed deliveries and recording the
+// notifications that could not be delivered in a dead-letter log.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/heketi/heketi/pkg/logging"
+)
+
+const (
+	TypeHeader      = "X-Heketi-Event"
+	DeliveryHeader  = "X-Heketi-Delivery"
+	SignatureHeader = "X-Heketi-Signature"
+
+	DefaultMaxRetries = 5
+	DefaultRetryDelay = 1
+	DefaultTimeout    = 10
+
+	// notifications waiting to be delivered to a hook
+	queueSize = 1000
+	// longest delay between two attempts
+	maxRetryDelay = 5 * time.Minute
+)
+
+var (
+	logger = logging.NewLogger("[webhook]", logging.LEVEL_INFO)
+
+	// unit of the retry delays, shortened by the tests
+	delayUnit = time.Second
+)
+
+// HookConfig is a URL notifications are sent to.
+type HookConfig struct {
+	// Name of the hook in log messages, the URL if empty.
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Secret is the key of the HMAC-SHA256 signature of the payloads.
+	// Payloads are not signed if empty.
+	Secret string `json:"secret"`
+	// Events are the types of the notifications sent, all if empty.
+	Events []string `json:"events"`
+	// MaxRetries is the number of times a failed delivery is retried.
+	MaxRetries int `json:"max_retries"`
+	// RetryDelay is the delay in seconds before the first retry, doubled
+	// for every following retry.
+	RetryDelay uint32 `json:"retry_delay"`
+	// Timeout of a delivery in seconds.
+	Timeout uint32 `json:"timeout"`
+}
+
+// Config lists the hooks and where the notifications that could not be
+// delivered are recorded.
+type Config struct {
+	Hooks []HookConfig `json:"hooks"`
+	// DeadLetterFile is the file notifications that could not be
+	// delivered are appended to, as JSON lines. They are only logged
+	// if empty.
+	DeadLetterFile string `json:"dead_letter_file"`
+}
+
+// Message is a notification. The payload is sent as JSON.
+type Message struct {
+	Type    string
+	Id      string
+	Payload interface{}
+}
+
+// DeadLetter records a notification that could not be delivered.
+type DeadLetter struct {
+	Time     time.Time       `json:"time"`
+	Hook     string          `json:"hook"`
+	Type     string          `json:"type"`
+	Id       string          `json:"id"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Sign returns the signature of the payload with the given secret, as
+// sent in the X-Heketi-Signature header.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if the signature is the signature of the payload
+// with the given secret.
+func Verify(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
+
+type delivery struct {
+	Message
+	body []byte
+}
+
+type hook struct {
+	HookConfig
+	events map[string]bool
+	client *http.Client
+	queue  chan *delivery
+	d      *Dispatcher
+}
+
+// Dispatcher sends the notifications to the hooks. Every hook has a
+// queue of its own so a hook that is down does not delay the others.
+type Dispatcher struct {
+	hooks      []*hook
+	deadLetter io.Writer
+	lock       sync.Mutex
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewDispatcher checks the configuration and starts the delivery of
+// the notifications to the hooks.
+func NewDispatcher(c Config) (*Dispatcher, error) {
+	d := &Dispatcher{stop: make(chan struct{})}
+	for i, hc := range c.Hooks {
+		u, err := url.Parse(hc.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %v: invalid url: %v", i, hc.URL)
+		}
+		if hc.Name == "" {
+			hc.Name = hc.URL
+		}
+		if hc.MaxRetries == 0 {
+			hc.MaxRetries = DefaultMaxRetries
+		}
+		if hc.RetryDelay == 0 {
+			hc.RetryDelay = DefaultRetryDelay
+		}
+		if hc.Timeout == 0 {
+			hc.Timeout = DefaultTimeout
+		}
+		h := &hook{
+			HookConfig: hc,
+			events:     map[string]bool{},
+			client: &http.Client{
+				Timeout: time.Duration(hc.Timeout) * time.Second,
+			},
+			queue: make(chan *delivery, queueSize),
+			d:     d,
+		}
+		for _, t := range hc.Events {
+			h.events[t] = true
+		}
+		d.hooks = append(d.hooks, h)
+	}
+	if c.DeadLetterFile != "" {
+		f, err := openDeadLetterFile(c.DeadLetterFile)
+		if err != nil {
+			return nil, err
+		}
+		d.deadLetter = f
+	}
+	for _, h := range d.hooks {
+		d.wg.Add(1)
+		go h.run()
+	}
+	return d, nil
+}
+
+// Send queues the message for the hooks accepting its type. It does
+// not wait for the deliveries.
+func (d *Dispatcher) Send(m Message) {
+	body, err := json.Marshal(m.Payload)
+	if err != nil {
+		logger.LogError("Unable to encode notification %v: %v", m.Id, err)
+		return
+	}
+	for _, h := range d.hooks {
+		if len(h.events) > 0 && !h.events[m.Type] {
+			continue
+		}
+		select {
+		case h.queue <- &delivery{Message: m, body: body}:
+		default:
+			d.dead(h, &delivery{Message: m, body: body}, 0,
+				fmt.Errorf("queue full"))
+		}
+	}
+}
+
+// Close stops the deliveries. Notifications not delivered yet are
+// recorded in the dead-letter log.
+func (d *Dispatcher) Close() error {
+	close(d.stop)
+	d.wg.Wait()
+	if c, ok := d.deadLetter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func openDeadLetterFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+}
+
+// dead records a notification that could not be delivered.
+func (d *Dispatcher) dead(h *hook, dl *delivery, attempts int, err error) {
+	logger.LogError("Unable to deliver notification %v (%v) to %v after %v attempts: %v",
+		dl.Id, dl.Type, h.Name, attempts, err)
+	if d.deadLetter == nil {
+		return
+	}
+	line, merr := json.Marshal(DeadLetter{
+		Time:     time.Now(),
+		Hook:     h.Name,
+		Type:     dl.Type,
+		Id:       dl.Id,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Payload:  json.RawMessage(dl.body),
+	})
+	if merr != nil {
+		logger.Err(merr)
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, werr := d.deadLetter.Write(append(line, '\n')); werr != nil {
+		logger.LogError("Unable to write dead-letter log: %v", werr)
+	}
+}
+
+func (h *hook) run() {
+	defer h.d.wg.Done()
+	for {
+		select {
+		case dl := <-h.queue:
+			h.deliver(dl)
+		case <-h.d.stop:
+			for {
+				select {
+				case dl := <-h.queue:
+					h.d.dead(h, dl, 0, fmt.Errorf("server stopped"))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver posts the notification until it is accepted, the retries
+// are exhausted or the dispatcher is closed.
+func (h *hook) deliver(dl *delivery) {
+	delay := time.Duration(h.RetryDelay) * delayUnit
+	for attempt := 1; ; attempt++ {
+		retry, err := h.post(dl)
+		if err == nil {
+			logger.Debug("Delivered notification %v to %v", dl.Id, h.Name)
+			return
+		}
+		if !retry || attempt > h.MaxRetries {
+			h.d.dead(h, dl, attempt, err)
+			return
+		}
+		logger.Warning("Delivery of notification %v to %v failed, retrying in %v: %v",
+			dl.Id, h.Name, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-h.d.stop:
+			h.d.dead(h, dl, attempt, err)
+			return
+		}
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// post sends the notification once. It returns whether a failed
+// delivery is worth retrying: errors of the server and of the
+// connection are, rejections of the notification are not.
+func (h *hook) post(dl *delivery) (bool, error) {
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TypeHeader, dl.Type)
+	req.Header.Set(DeliveryHeader, dl.Id)
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, dl.body))
+	}
+	r, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(r.Body, 64*1024))
+	r.Body.Close()
+	switch {
+	case r.StatusCode >= 200 && r.StatusCode < 300:
+		return false, nil
+	case r.StatusCode == http.StatusTooManyRequests ||
+		r.StatusCode >= http.StatusInternalServerError:
+		return true, fmt.Errorf("%v", r.Status)
+	default:
+		return false, fmt.Errorf("%v", r.Status)
+	}
+}
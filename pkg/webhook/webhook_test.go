@@ -0,0 +1,175 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+)
+
+// standIn is a local HTTP server recording the notifications it gets
+// and answering with the given status codes, then 200.
+type standIn struct {
+	*httptest.Server
+	lock     sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   [][]byte
+	got      chan struct{}
+}
+
+func newStandIn(statuses ...int) *standIn {
+	s := &standIn{statuses: statuses, got: make(chan struct{}, 100)}
+	s.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			s.lock.Lock()
+			s.received = append(s.received, r)
+			s.bodies = append(s.bodies, body)
+			status := http.StatusOK
+			if len(s.statuses) > 0 {
+				status, s.statuses = s.statuses[0], s.statuses[1:]
+			}
+			s.lock.Unlock()
+			w.WriteHeader(status)
+			s.got <- struct{}{}
+		}))
+	return s
+}
+
+func (s *standIn) wait(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.got:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %v requests, got %v", n, i)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"type":"operation_failed"}`)
+	sig := Sign("secret", payload)
+	tests.Assert(t, len(sig) == len("sha256=")+64, sig)
+	tests.Assert(t, Verify("secret", payload, sig))
+	tests.Assert(t, !Verify("other", payload, sig))
+	tests.Assert(t, !Verify("secret", []byte(`{}`), sig))
+}
+
+func TestDispatcherDeliver(t *testing.T) {
+	all := newStandIn()
+	defer all.Close()
+	filtered := newStandIn()
+	defer filtered.Close()
+
+	d, err := NewDispatcher(Config{Hooks: []HookConfig{
+		{URL: all.URL, Secret: "s3cr3t"},
+		{URL: filtered.URL, Events: []string{"node_health_changed"}},
+	}})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer d.Close()
+
+	d.Send(Message{Type: "operation_failed", Id: "e-1",
+		Payload: map[string]string{"text": "failed"}})
+	d.Send(Message{Type: "node_health_changed", Id: "e-2",
+		Payload: map[string]string{"text": "down"}})
+	all.wait(t, 2)
+	filtered.wait(t, 1)
+
+	r := all.received[0]
+	tests.Assert(t, r.Method == "POST", r.Method)
+	tests.Assert(t, r.Header.Get("Content-Type") == "application/json")
+	tests.Assert(t, r.Header.Get(TypeHeader) == "operation_failed")
+	tests.Assert(t, r.Header.Get(DeliveryHeader) == "e-1")
+	tests.Assert(t, Verify("s3cr3t", all.bodies[0], r.Header.Get(SignatureHeader)))
+	tests.Assert(t, string(all.bodies[0]) == `{"text":"failed"}`,
+		string(all.bodies[0]))
+
+	r = filtered.received[0]
+	tests.Assert(t, r.Header.Get(TypeHeader) == "node_health_changed")
+	tests.Assert(t, r.Header.Get(SignatureHeader) == "")
+}
+
+func TestDispatcherRetry(t *testing.T) {
+	delayUnit = time.Millisecond
+	defer func() { delayUnit = time.Second }()
+
+	deadLetters := tests.Tempfile()
+	defer os.Remove(deadLetters)
+
+	flaky := newStandIn(http.StatusServiceUnavailable, http.StatusBadGateway)
+	defer flaky.Close()
+	down := newStandIn(500, 500, 500, 500)
+	defer down.Close()
+	rejecting := newStandIn(http.StatusBadRequest)
+	defer rejecting.Close()
+
+	d, err := NewDispatcher(Config{
+		Hooks: []HookConfig{
+			{URL: flaky.URL},
+			{Name: "down", URL: down.URL, MaxRetries: 3},
+			{Name: "rejecting", URL: rejecting.URL},
+		},
+		DeadLetterFile: deadLetters,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	d.Send(Message{Type: "operation_failed", Id: "e-1",
+		Payload: map[string]string{"text": "failed"}})
+	// retried until accepted
+	flaky.wait(t, 3)
+	// retried until the retries are exhausted
+	down.wait(t, 4)
+	// rejected notifications are not retried
+	rejecting.wait(t, 1)
+	err = d.Close()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	f, err := os.Open(deadLetters)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer f.Close()
+	dead := map[string]DeadLetter{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var dl DeadLetter
+		err := json.Unmarshal(s.Bytes(), &dl)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		dead[dl.Hook] = dl
+	}
+	tests.Assert(t, len(dead) == 2, dead)
+	tests.Assert(t, dead["down"].Attempts == 4, dead["down"])
+	tests.Assert(t, dead["down"].Error == "500 Internal Server Error", dead["down"])
+	tests.Assert(t, dead["down"].Id == "e-1", dead["down"])
+	tests.Assert(t, string(dead["down"].Payload) == `{"text":"failed"}`,
+		string(dead["down"].Payload))
+	tests.Assert(t, dead["rejecting"].Attempts == 1, dead["rejecting"])
+}
+
+func TestDispatcherConfig(t *testing.T) {
+	for _, u := range []string{"", "ftp://host/x", "http://", ":"} {
+		_, err := NewDispatcher(Config{Hooks: []HookConfig{{URL: u}}})
+		tests.Assert(t, err != nil, "expected", u, "to be rejected")
+	}
+
+	d, err := NewDispatcher(Config{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	// nothing to deliver to
+	d.Send(Message{Type: "operation_failed", Id: "e-1"})
+	tests.Assert(t, d.Close() == nil)
+}